@@ -144,20 +144,19 @@ func newSerialNumber() (*big.Int, error) {
 	return serialNumber, nil
 }
 
-func NewAgent() (ca, srv, client *PEMPair, err error) {
-	caSerialNumber, err := newSerialNumber()
+// NewCA creates a self-signed ECDSA P-256 CA certificate of subject, valid until notAfter.
+//
+// If permittedDNSDomains is not empty, the CA can only issue certificates for them and their subdomains.
+func NewCA(subject pkix.Name, notAfter time.Time, permittedDNSDomains ...string) (*PEMPair, error) {
+	serialNumber, err := newSerialNumber()
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
-	// Create the CA's certificate
-	caTemplate := &x509.Certificate{
-		SerialNumber: caSerialNumber,
-		Subject: pkix.Name{
-			Organization: []string{"GoDoxy"},
-			CommonName:   common.CertsDNSName,
-		},
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
 		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(1000, 0, 0), // 1000 years
+		NotAfter:              notAfter,
 		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		BasicConstraintsValid: true,
 		IsCA:                  true,
@@ -165,81 +164,91 @@ func NewAgent() (ca, srv, client *PEMPair, err error) {
 		MaxPathLenZero:        true,
 		SignatureAlgorithm:    x509.ECDSAWithSHA256,
 	}
+	if len(permittedDNSDomains) > 0 {
+		template.PermittedDNSDomainsCritical = true
+		template.PermittedDNSDomains = permittedDNSDomains
+	}
 
-	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 
-	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
+	return toPEMPair(der, key), nil
+}
 
-	ca = toPEMPair(caDER, caKey)
-
-	// Generate a new private key for the server certificate
-	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+// NewCert creates an ECDSA P-256 certificate of template signed by ca,
+// the serial number and signature algorithm of template are generated.
+func NewCert(ca *PEMPair, template *x509.Certificate) (*PEMPair, error) {
+	caCert, err := ca.ToTLSCert()
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 
-	serverSerialNumber, err := newSerialNumber()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		return nil, nil, nil, err
-	}
-	srvTemplate := &x509.Certificate{
-		SerialNumber: serverSerialNumber,
-		Issuer:       caTemplate.Subject,
-		Subject: pkix.Name{
-			Organization:       caTemplate.Subject.Organization,
-			OrganizationalUnit: []string{"Server"},
-			CommonName:         common.CertsDNSName,
-		},
-		DNSNames:           []string{common.CertsDNSName},
-		NotBefore:          time.Now(),
-		NotAfter:           time.Now().AddDate(1000, 0, 0), // Add validity period
-		KeyUsage:           x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		SignatureAlgorithm: x509.ECDSAWithSHA256,
+		return nil, err
 	}
 
-	srvCertDER, err := x509.CreateCertificate(rand.Reader, srvTemplate, caTemplate, &serverKey.PublicKey, caKey)
+	serialNumber, err := newSerialNumber()
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
+	template.SerialNumber = serialNumber
+	template.SignatureAlgorithm = x509.ECDSAWithSHA256
 
-	srv = toPEMPair(srvCertDER, serverKey)
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert.Leaf, &key.PublicKey, caCert.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return toPEMPair(der, key), nil
+}
 
-	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+func NewAgent() (ca, srv, client *PEMPair, err error) {
+	// Create the CA's certificate
+	caSubject := pkix.Name{
+		Organization: []string{"GoDoxy"},
+		CommonName:   common.CertsDNSName,
+	}
+	ca, err = NewCA(caSubject, time.Now().AddDate(1000, 0, 0)) // 1000 years
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	clientSerialNumber, err := newSerialNumber()
+	srv, err = NewCert(ca, &x509.Certificate{
+		Subject: pkix.Name{
+			Organization:       caSubject.Organization,
+			OrganizationalUnit: []string{"Server"},
+			CommonName:         common.CertsDNSName,
+		},
+		DNSNames:    []string{common.CertsDNSName},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().AddDate(1000, 0, 0), // Add validity period
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	clientTemplate := &x509.Certificate{
-		SerialNumber: clientSerialNumber,
-		Issuer:       caTemplate.Subject,
+
+	client, err = NewCert(ca, &x509.Certificate{
 		Subject: pkix.Name{
-			Organization:       caTemplate.Subject.Organization,
+			Organization:       caSubject.Organization,
 			OrganizationalUnit: []string{"Client"},
 			CommonName:         common.CertsDNSName,
 		},
-		DNSNames:           []string{common.CertsDNSName},
-		NotBefore:          time.Now(),
-		NotAfter:           time.Now().AddDate(1000, 0, 0),
-		KeyUsage:           x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-		SignatureAlgorithm: x509.ECDSAWithSHA256,
-	}
-	clientCertDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caTemplate, &clientKey.PublicKey, caKey)
+		DNSNames:    []string{common.CertsDNSName},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().AddDate(1000, 0, 0),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
 	if err != nil {
 		return nil, nil, nil, err
 	}
-
-	client = toPEMPair(clientCertDER, clientKey)
-	return ca, srv, client, err
+	return ca, srv, client, nil
 }
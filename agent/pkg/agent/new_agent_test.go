@@ -4,10 +4,12 @@ import (
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/yusing/godoxy/agent/pkg/agent/common"
@@ -111,3 +113,26 @@ func TestPEMPairEncryptDecrypt(t *testing.T) {
 	require.Equal(t, string(ca.Cert), string(decCA.Cert))
 	require.Equal(t, string(ca.Key), string(decCA.Key))
 }
+
+func TestNewCert(t *testing.T) {
+	ca, err := NewCA(pkix.Name{CommonName: "Test CA"}, time.Now().AddDate(1, 0, 0))
+	require.NoError(t, err)
+
+	leaf, err := NewCert(ca, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "nas.local"},
+		DNSNames:    []string{"nas.local"},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	require.NoError(t, err)
+
+	leafTLS, err := leaf.ToTLSCert()
+	require.NoError(t, err)
+
+	caPool := x509.NewCertPool()
+	require.True(t, caPool.AppendCertsFromPEM(ca.Cert))
+	_, err = leafTLS.Leaf.Verify(x509.VerifyOptions{DNSName: "nas.local", Roots: caPool})
+	require.NoError(t, err)
+}
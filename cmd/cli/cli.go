@@ -20,7 +20,8 @@ import (
 )
 
 type config struct {
-	Addr string
+	Addr  string
+	Token string
 }
 
 type stringSliceFlag struct {
@@ -63,7 +64,7 @@ func run(args []string) error {
 		return unknownCommandError(rest)
 	}
 	cmdArgs := rest[matchedLen:]
-	return executeEndpoint(cfg.Addr, *ep, cmdArgs)
+	return executeEndpoint(cfg, *ep, cmdArgs)
 }
 
 func parseGlobal(args []string) (config, []string, error) {
@@ -71,17 +72,25 @@ func parseGlobal(args []string) (config, []string, error) {
 	fs := flag.NewFlagSet("godoxy", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 	fs.StringVar(&cfg.Addr, "addr", "", "API address, e.g. 127.0.0.1:8888 or http://127.0.0.1:8888")
+	fs.StringVar(&cfg.Token, "token", "", "API token, sent in the Authorization header (env: GODOXY_API_TOKEN)")
 	if err := fs.Parse(args); err != nil {
 		return cfg, nil, err
 	}
+	if cfg.Token == "" {
+		cfg.Token = env.GetEnvString("API_TOKEN", "")
+	}
 	return cfg, fs.Args(), nil
 }
 
-func resolveBaseURL(addrFlag string) (string, error) {
-	if addrFlag != "" {
-		return normalizeURL(addrFlag), nil
+func resolveBaseURL(cfg config) (string, error) {
+	if cfg.Addr != "" {
+		return normalizeURL(cfg.Addr), nil
 	}
 	_, _, _, fullURL := env.GetAddrEnv("LOCAL_API_ADDR", "", "http")
+	if fullURL == "" && cfg.Token != "" {
+		// the local API is unauthenticated, the API requires a token
+		_, _, _, fullURL = env.GetAddrEnv("API_ADDR", "", "http")
+	}
 	if fullURL == "" {
 		return "", errors.New("missing LOCAL_API_ADDR (or GODOXY_LOCAL_API_ADDR). set env var or pass --addr")
 	}
@@ -119,7 +128,7 @@ func findEndpoint(args []string) (*Endpoint, int) {
 	return best, bestLen
 }
 
-func executeEndpoint(addrFlag string, ep Endpoint, args []string) error {
+func executeEndpoint(cfg config, ep Endpoint, args []string) error {
 	fs := flag.NewFlagSet(strings.Join(ep.CommandPath, "-"), flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 	useWS := false
@@ -171,7 +180,7 @@ func executeEndpoint(addrFlag string, ep Endpoint, args []string) error {
 		}
 	}
 
-	baseURL, err := resolveBaseURL(addrFlag)
+	baseURL, err := resolveBaseURL(cfg)
 	if err != nil {
 		return err
 	}
@@ -184,9 +193,9 @@ func executeEndpoint(addrFlag string, ep Endpoint, args []string) error {
 		if !ep.IsWebSocket {
 			return errors.New("--ws is only supported for websocket endpoints")
 		}
-		return execWebsocket(ep, reqURL)
+		return execWebsocket(ep, reqURL, cfg.Token)
 	}
-	return execHTTP(ep, reqURL, body)
+	return execHTTP(ep, reqURL, body, cfg.Token)
 }
 
 func buildRequest(ep Endpoint, baseURL string, typedValues map[string]any, isSet map[string]bool) (string, []byte, error) {
@@ -332,7 +341,7 @@ func paramBodyValue(p Param, raw any) (any, error) {
 	}
 }
 
-func execHTTP(ep Endpoint, reqURL string, body []byte) error {
+func execHTTP(ep Endpoint, reqURL string, body []byte, token string) error {
 	var r io.Reader
 	if body != nil {
 		r = bytes.NewReader(body)
@@ -344,6 +353,7 @@ func execHTTP(ep Endpoint, reqURL string, body []byte) error {
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	setAuthorization(req.Header, token)
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -366,13 +376,15 @@ func execHTTP(ep Endpoint, reqURL string, body []byte) error {
 	return nil
 }
 
-func execWebsocket(ep Endpoint, reqURL string) error {
+func execWebsocket(ep Endpoint, reqURL, token string) error {
 	wsURL := strings.Replace(reqURL, "http://", "ws://", 1)
 	wsURL = strings.Replace(wsURL, "https://", "wss://", 1)
 	if strings.ToUpper(ep.Method) != http.MethodGet {
 		return fmt.Errorf("--ws requires GET endpoint, got %s", ep.Method)
 	}
-	c, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	header := http.Header{}
+	setAuthorization(header, token)
+	c, _, err := websocket.DefaultDialer.Dial(wsURL, header)
 	if err != nil {
 		return err
 	}
@@ -411,6 +423,12 @@ func execWebsocket(ep Endpoint, reqURL string) error {
 	}
 }
 
+func setAuthorization(h http.Header, token string) {
+	if token != "" {
+		h.Set("Authorization", "Bearer "+token)
+	}
+}
+
 func printJSON(payload []byte) {
 	if len(payload) == 0 {
 		fmt.Println("null")
@@ -427,7 +445,7 @@ func printJSON(payload []byte) {
 }
 
 func printHelp() {
-	fmt.Println("godoxy [--addr ADDR] <command>")
+	fmt.Println("godoxy [--addr ADDR] [--token TOKEN] <command>")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  godoxy version")
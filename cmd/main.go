@@ -16,6 +16,7 @@ import (
 	"github.com/yusing/godoxy/internal/logging/memlogger"
 	"github.com/yusing/godoxy/internal/net/gphttp/middleware"
 	"github.com/yusing/godoxy/internal/route/rules"
+	"github.com/yusing/godoxy/internal/tracing"
 	"github.com/yusing/goutils/task"
 	"github.com/yusing/goutils/version"
 )
@@ -59,6 +60,10 @@ func main() {
 		prepareDirectory(dir)
 	}
 
+	if err := tracing.Init(); err != nil {
+		log.Warn().Err(err).Msg("failed to initialize tracing")
+	}
+
 	err := config.Load()
 	if err != nil {
 		if criticalErr, ok := errors.AsType[config.CriticalError](err); ok {
@@ -0,0 +1,298 @@
+package acl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/maxmind"
+	"github.com/yusing/godoxy/internal/notif"
+	strutils "github.com/yusing/goutils/strings"
+	"github.com/yusing/goutils/task"
+)
+
+type (
+	// AutoBanConfig bans client IPs with too many failed requests within a window.
+	AutoBanConfig struct {
+		Window      time.Duration `json:"window,omitempty"`       // default: 1m
+		BanDuration time.Duration `json:"ban_duration,omitempty"` // default: 1h
+		// Events per window to ban an IP, 0 for default, -1 to ignore the event
+		Thresholds struct {
+			Unauthorized int `json:"unauthorized,omitempty" validate:"min=-1"` // 401 responses, default: 20
+			Forbidden    int `json:"forbidden,omitempty" validate:"min=-1"`    // 403 responses, default: 20
+			NotFound     int `json:"not_found,omitempty" validate:"min=-1"`    // 404 responses, default: 50
+			RuleError    int `json:"rule_error,omitempty" validate:"min=-1"`   // `error` rule commands, default: 10
+			Captcha      int `json:"captcha,omitempty" validate:"min=-1"`      // failed captchas, default: 5
+			RateLimit    int `json:"rate_limit,omitempty" validate:"min=-1"`   // rate limited requests, default: 50
+		} `json:"thresholds"`
+		// IPs never banned, in addition to loopback and allow_local IPs
+		Exclude Matchers `json:"exclude,omitempty"`
+	}
+
+	// AutoBanEvent is a failed request counted towards an auto ban.
+	AutoBanEvent uint8
+
+	autoBan struct {
+		acl        *Config
+		thresholds [numAutoBanEvents]int
+		counters   *xsync.Map[string, *autoBanCounter] // ip -> counter
+	}
+
+	autoBanCounter struct {
+		mu          sync.Mutex
+		windowStart time.Time
+		counts      [numAutoBanEvents]int
+	}
+
+	// autoBanReport is the event of a request counted by ReportStatus when the response is written.
+	autoBanReport struct {
+		ip       string // client IP of the connection, checked by the ACL
+		event    AutoBanEvent
+		reported bool
+	}
+
+	autoBanReportKey struct{}
+)
+
+const (
+	AutoBanUnauthorized AutoBanEvent = iota
+	AutoBanForbidden
+	AutoBanNotFound
+	AutoBanRuleError
+	AutoBanCaptcha
+	AutoBanRateLimit
+
+	numAutoBanEvents
+)
+
+const (
+	defaultAutoBanWindow      = time.Minute
+	defaultAutoBanBanDuration = time.Hour
+
+	autoBanCreatedBy = "auto_ban"
+)
+
+var autoBanEventNames = [numAutoBanEvents]string{
+	AutoBanUnauthorized: "unauthorized responses",
+	AutoBanForbidden:    "forbidden responses",
+	AutoBanNotFound:     "not found responses",
+	AutoBanRuleError:    "rule errors",
+	AutoBanCaptcha:      "failed captchas",
+	AutoBanRateLimit:    "rate limited requests",
+}
+
+// activeAutoBan is the auto ban of the running ACL, nil if disabled.
+var activeAutoBan atomic.Pointer[autoBan]
+
+func (e AutoBanEvent) String() string {
+	return autoBanEventNames[e]
+}
+
+func (c *AutoBanConfig) Validate() error {
+	if c.Window <= 0 {
+		c.Window = defaultAutoBanWindow
+	}
+	if c.BanDuration <= 0 {
+		c.BanDuration = defaultAutoBanBanDuration
+	}
+	for _, threshold := range []struct {
+		value *int
+		def   int
+	}{
+		{&c.Thresholds.Unauthorized, 20},
+		{&c.Thresholds.Forbidden, 20},
+		{&c.Thresholds.NotFound, 50},
+		{&c.Thresholds.RuleError, 10},
+		{&c.Thresholds.Captcha, 5},
+		{&c.Thresholds.RateLimit, 50},
+	} {
+		if *threshold.value == 0 {
+			*threshold.value = threshold.def
+		}
+	}
+	return nil
+}
+
+func newAutoBan(acl *Config) *autoBan {
+	t := &acl.AutoBan.Thresholds
+	return &autoBan{
+		acl: acl,
+		thresholds: [numAutoBanEvents]int{
+			AutoBanUnauthorized: t.Unauthorized,
+			AutoBanForbidden:    t.Forbidden,
+			AutoBanNotFound:     t.NotFound,
+			AutoBanRuleError:    t.RuleError,
+			AutoBanCaptcha:      t.Captcha,
+			AutoBanRateLimit:    t.RateLimit,
+		},
+		counters: xsync.NewMap[string, *autoBanCounter](),
+	}
+}
+
+// start activates the auto ban until parent is done, and removes idle counters every window.
+func (ab *autoBan) start(parent task.Parent) {
+	activeAutoBan.Store(ab)
+
+	go func() {
+		ticker := time.NewTicker(ab.acl.AutoBan.Window)
+		defer ticker.Stop()
+		defer activeAutoBan.CompareAndSwap(ab, nil)
+
+		for {
+			select {
+			case <-parent.Context().Done():
+				return
+			case now := <-ticker.C:
+				for ip, counter := range ab.counters.Range {
+					counter.mu.Lock()
+					idle := now.Sub(counter.windowStart) >= ab.acl.AutoBan.Window
+					counter.mu.Unlock()
+					if idle {
+						ab.counters.Delete(ip)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// AutoBanEnabled returns true if the running ACL has auto ban enabled.
+func AutoBanEnabled() bool {
+	return activeAutoBan.Load() != nil
+}
+
+// WithAutoBanReport returns r with the client IP of the connection, which is checked by the ACL,
+// to be counted by ReportStatus once for the response. It must be called before any middleware
+// rewrites the remote address. Events reported with Report for r or derived requests replace the status.
+func WithAutoBanReport(r *http.Request) *http.Request {
+	report := &autoBanReport{ip: remoteHost(r)}
+	return r.WithContext(context.WithValue(r.Context(), autoBanReportKey{}, report))
+}
+
+// ReportStatus counts the response towards an auto ban of the client IP: the event reported with Report
+// for the request if any, otherwise a 401, 403 or 404 status code.
+func ReportStatus(r *http.Request, status int) {
+	ab := activeAutoBan.Load()
+	if ab == nil {
+		return
+	}
+	ip := remoteHost(r)
+	if report, ok := r.Context().Value(autoBanReportKey{}).(*autoBanReport); ok {
+		ip = report.ip
+		if report.reported {
+			ab.report(ip, report.event)
+			return
+		}
+	}
+	switch status {
+	case http.StatusUnauthorized:
+		ab.report(ip, AutoBanUnauthorized)
+	case http.StatusForbidden:
+		ab.report(ip, AutoBanForbidden)
+	case http.StatusNotFound:
+		ab.report(ip, AutoBanNotFound)
+	}
+}
+
+// Report counts event towards an auto ban of the client IP, it does nothing if auto ban is disabled.
+//
+// For requests from WithAutoBanReport, it is counted by ReportStatus instead of the response status,
+// only the first event of a request is counted.
+func Report(r *http.Request, event AutoBanEvent) {
+	if report, ok := r.Context().Value(autoBanReportKey{}).(*autoBanReport); ok {
+		if !report.reported {
+			report.event = event
+			report.reported = true
+		}
+		return
+	}
+	ab := activeAutoBan.Load()
+	if ab == nil {
+		return
+	}
+	ab.report(remoteHost(r), event)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (ab *autoBan) report(host string, event AutoBanEvent) {
+	threshold := ab.thresholds[event]
+	if threshold <= 0 {
+		return
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || (ab.acl.allowLocal && ip.IsPrivate()) {
+		return
+	}
+	ipStr := ip.String()
+	if ab.acl.AutoBan.Exclude.Match(&maxmind.IPInfo{IP: ip, Str: ipStr}) {
+		return
+	}
+	// requests of existing connections are still served after a ban
+	if banOf(ip, ipStr) != nil {
+		return
+	}
+
+	counter, _ := ab.counters.LoadOrCompute(ipStr, func() (*autoBanCounter, bool) {
+		return &autoBanCounter{windowStart: time.Now()}, false
+	})
+
+	counter.mu.Lock()
+	now := time.Now()
+	if now.Sub(counter.windowStart) >= ab.acl.AutoBan.Window {
+		counter.windowStart = now
+		counter.counts = [numAutoBanEvents]int{}
+	}
+	counter.counts[event]++
+	exceeded := counter.counts[event] >= threshold
+	if exceeded {
+		counter.counts = [numAutoBanEvents]int{}
+	}
+	counter.mu.Unlock()
+
+	if exceeded {
+		ab.ban(ipStr, event, threshold)
+	}
+}
+
+func (ab *autoBan) ban(ip string, event AutoBanEvent, count int) {
+	window := strutils.FormatDuration(ab.acl.AutoBan.Window)
+	reason := fmt.Sprintf("%d %s in %s", count, event, window)
+	ban, err := AddBan(ip, ab.acl.AutoBan.BanDuration, reason, autoBanCreatedBy)
+	if err != nil {
+		log.Err(err).Str("ip", ip).Msg("failed to auto ban IP")
+		return
+	}
+
+	log.Warn().
+		Str("ip", ip).
+		Str("reason", reason).
+		Time("expires_at", ban.ExpiresAt).
+		Msg("IP auto banned")
+
+	var fields notif.FieldsBody
+	fields.Add("IP", ip)
+	fields.Add("Reason", reason)
+	fields.Add("Duration", strutils.FormatDuration(ab.acl.AutoBan.BanDuration))
+	notif.Notify(&notif.LogMessage{
+		Level: zerolog.WarnLevel,
+		Title: "IP auto banned",
+		Body:  fields,
+		Color: notif.ColorError,
+		To:    ab.acl.Notify.To,
+	})
+}
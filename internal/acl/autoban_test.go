@@ -0,0 +1,134 @@
+package acl
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newTestAutoBan(t *testing.T, modify func(cfg *AutoBanConfig)) *Config {
+	t.Helper()
+	cfg := newTestConfig(t, ACLAllow, nil, nil)
+	cfg.AutoBan = &AutoBanConfig{}
+	modify(cfg.AutoBan)
+	expect.NoError(t, cfg.AutoBan.Validate())
+
+	activeAutoBan.Store(newAutoBan(cfg))
+	t.Cleanup(func() {
+		activeAutoBan.Store(nil)
+		for _, ban := range Bans() {
+			_ = RemoveBan(ban.IP)
+		}
+	})
+	return cfg
+}
+
+func reportFrom(ip string, status int) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = net.JoinHostPort(ip, "12345")
+	ReportStatus(r, status)
+}
+
+func TestAutoBan(t *testing.T) {
+	cfg := newTestAutoBan(t, func(cfg *AutoBanConfig) {
+		cfg.Thresholds.NotFound = 3
+		cfg.Thresholds.Forbidden = -1
+		cfg.Exclude = Matchers{{}}
+		expect.NoError(t, cfg.Exclude[0].Parse("ip:198.51.100.1"))
+	})
+	expect.Equal(t, cfg.AutoBan.Window, defaultAutoBanWindow)
+	expect.Equal(t, cfg.AutoBan.BanDuration, defaultAutoBanBanDuration)
+	expect.Equal(t, cfg.AutoBan.Thresholds.Unauthorized, 20)
+
+	ip := net.ParseIP("203.0.113.1")
+	for range 2 {
+		reportFrom(ip.String(), http.StatusNotFound)
+		reportFrom(ip.String(), http.StatusOK)
+	}
+	expect.True(t, cfg.IPAllowed(ip))
+
+	reportFrom(ip.String(), http.StatusNotFound)
+	expect.False(t, cfg.IPAllowed(ip))
+
+	bans := Bans()
+	expect.Equal(t, len(bans), 1)
+	expect.Equal(t, bans[0].IP, ip.String())
+	expect.Equal(t, bans[0].CreatedBy, autoBanCreatedBy)
+	expect.True(t, bans[0].ExpiresAt.After(time.Now().Add(defaultAutoBanBanDuration-time.Minute)))
+
+	t.Run("ignored", func(t *testing.T) {
+		for _, ip := range []string{
+			"127.0.0.1",      // loopback
+			"192.168.1.1",    // allow_local
+			"198.51.100.1",   // excluded
+			"not an ip",      // invalid
+			"203.0.113.2:80", // invalid
+		} {
+			for range 5 {
+				reportFrom(ip, http.StatusNotFound)
+			}
+		}
+		// disabled event
+		for range 50 {
+			reportFrom("203.0.113.3", http.StatusForbidden)
+		}
+		expect.Equal(t, len(Bans()), 1)
+	})
+}
+
+func TestAutoBanWindow(t *testing.T) {
+	cfg := newTestAutoBan(t, func(cfg *AutoBanConfig) {
+		cfg.Window = 50 * time.Millisecond
+		cfg.Thresholds.RateLimit = 2
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.1:12345"
+
+	Report(r, AutoBanRateLimit)
+	time.Sleep(100 * time.Millisecond)
+	Report(r, AutoBanRateLimit)
+	expect.True(t, cfg.IPAllowed(net.ParseIP("203.0.113.1")))
+
+	Report(r, AutoBanRateLimit)
+	expect.False(t, cfg.IPAllowed(net.ParseIP("203.0.113.1")))
+}
+
+func TestAutoBanReportOnce(t *testing.T) {
+	cfg := newTestAutoBan(t, func(cfg *AutoBanConfig) {
+		cfg.Thresholds.Captcha = 2
+		cfg.Thresholds.Unauthorized = 2
+	})
+
+	ip := net.ParseIP("203.0.113.1")
+	failCaptcha := func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = net.JoinHostPort(ip.String(), "12345")
+		r = WithAutoBanReport(r)
+
+		// rewritten by real_ip behind a proxy
+		downstream := r.Clone(r.Context())
+		downstream.RemoteAddr = "198.51.100.1:12345"
+		Report(downstream, AutoBanCaptcha)
+		ReportStatus(r, http.StatusUnauthorized)
+	}
+
+	// a failed captcha is not also counted as a 401 response
+	failCaptcha()
+	expect.True(t, cfg.IPAllowed(ip))
+
+	failCaptcha()
+	expect.False(t, cfg.IPAllowed(ip))
+	expect.True(t, cfg.IPAllowed(net.ParseIP("198.51.100.1")))
+}
+
+func TestAutoBanDisabled(t *testing.T) {
+	expect.False(t, AutoBanEnabled())
+
+	reportFrom("203.0.113.1", http.StatusNotFound)
+	expect.Equal(t, len(Bans()), 0)
+}
@@ -0,0 +1,200 @@
+package acl
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/jsonstore"
+)
+
+// Ban is a temporary deny rule added at runtime, it takes precedence over all rules except loopback.
+type Ban struct {
+	// IP address or CIDR
+	IP        string    `json:"ip"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+} // @name ACLBan
+
+// cidrBan is the parsed prefix of a CIDR ban, the ban itself is in bans.
+type cidrBan struct {
+	prefix netip.Prefix
+	key    string
+}
+
+var bans = jsonstore.Store[*Ban](common.NamespaceACLBans)
+
+var (
+	// cidrBans is the prefixes of CIDR bans, rebuilt when a CIDR ban is added or removed,
+	// so connections do not parse them on every check.
+	cidrBans   atomic.Pointer[[]cidrBan]
+	cidrBansMu sync.Mutex
+)
+
+func init() {
+	rebuildCIDRBans()
+}
+
+var (
+	ErrInvalidBanTarget = errors.New("invalid IP or CIDR")
+	ErrInvalidBanTTL    = errors.New("ban TTL must be positive")
+	ErrBanNotFound      = errors.New("ban not found")
+)
+
+// normalizeBanTarget returns the key of a ban target, the address for single IPs, the masked prefix for CIDRs.
+func normalizeBanTarget(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return "", ErrInvalidBanTarget
+		}
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked()
+		if prefix.IsSingleIP() {
+			return prefix.Addr().String(), nil
+		}
+		return prefix.String(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return "", ErrInvalidBanTarget
+	}
+	return addr.Unmap().WithZone("").String(), nil
+}
+
+func (b *Ban) Expired() bool {
+	return !time.Now().Before(b.ExpiresAt)
+}
+
+// AddBan bans an IP or CIDR for ttl, an existing ban of the same target is replaced.
+func AddBan(ipOrCIDR string, ttl time.Duration, reason, createdBy string) (*Ban, error) {
+	key, err := normalizeBanTarget(ipOrCIDR)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return nil, ErrInvalidBanTTL
+	}
+	now := time.Now()
+	ban := &Ban{
+		IP:        key,
+		Reason:    reason,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	bans.Store(key, ban)
+	if isCIDRBan(key) {
+		rebuildCIDRBans()
+	}
+	return ban, nil
+}
+
+// RemoveBan lifts the ban of an IP or CIDR.
+func RemoveBan(ipOrCIDR string) error {
+	key, err := normalizeBanTarget(ipOrCIDR)
+	if err != nil {
+		return err
+	}
+	ban, ok := bans.LoadAndDelete(key)
+	if ok && isCIDRBan(key) {
+		rebuildCIDRBans()
+	}
+	if !ok || ban.Expired() {
+		return ErrBanNotFound
+	}
+	return nil
+}
+
+// Bans returns the active bans sorted by expiry, expired bans are removed.
+func Bans() []Ban {
+	list := make([]Ban, 0, bans.Size())
+	for key, ban := range bans.Range {
+		if ban.Expired() {
+			deleteBan(key)
+			continue
+		}
+		list = append(list, *ban)
+	}
+	slices.SortFunc(list, func(a, b Ban) int {
+		return a.ExpiresAt.Compare(b.ExpiresAt)
+	})
+	return list
+}
+
+// banOf returns the active ban matching ip, nil if none.
+func banOf(ip net.IP, ipStr string) *Ban {
+	if bans.Size() == 0 {
+		return nil
+	}
+	if ban, ok := bans.Load(ipStr); ok {
+		if !ban.Expired() {
+			return ban
+		}
+		deleteBan(ipStr)
+	}
+
+	prefixes := *cidrBans.Load()
+	if len(prefixes) == 0 {
+		return nil
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return nil
+	}
+	addr = addr.Unmap()
+	for _, cidr := range prefixes {
+		if !cidr.prefix.Contains(addr) {
+			continue
+		}
+		ban, ok := bans.Load(cidr.key)
+		if !ok {
+			continue
+		}
+		if ban.Expired() {
+			deleteBan(cidr.key)
+			continue
+		}
+		return ban
+	}
+	return nil
+}
+
+func isCIDRBan(key string) bool {
+	return strings.Contains(key, "/")
+}
+
+// deleteBan deletes the ban of key, e.g. after it expired.
+func deleteBan(key string) {
+	bans.Delete(key)
+	if isCIDRBan(key) {
+		rebuildCIDRBans()
+	}
+}
+
+// rebuildCIDRBans parses the prefixes of CIDR bans in bans.
+func rebuildCIDRBans() {
+	cidrBansMu.Lock()
+	defer cidrBansMu.Unlock()
+
+	var prefixes []cidrBan
+	for key := range bans.Range {
+		if !isCIDRBan(key) {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(key)
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, cidrBan{prefix: prefix, key: key})
+	}
+	cidrBans.Store(&prefixes)
+}
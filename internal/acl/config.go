@@ -32,6 +32,11 @@ type Config struct {
 		IncludeAllowed *bool         `json:"include_allowed,omitzero"` // default: false
 	} `json:"notify"`
 
+	AutoBan *AutoBanConfig `json:"auto_ban,omitempty"`
+
+	// named lists for `list:{name}` matchers
+	Lists map[string]*ListConfig `json:"lists,omitempty"`
+
 	config
 	valErr gperr.Error
 }
@@ -62,12 +67,17 @@ type config struct {
 
 	// will be nil if both Log and Notify.To are empty
 	logNotifyCh chan ipLog
+
+	stats *stats
+
+	lists map[string]*ipList
 }
 
 type checkCache struct {
 	*maxmind.IPInfo
 	allow   bool
 	reason  string
+	rule    ruleRef
 	created time.Time
 }
 
@@ -83,8 +93,6 @@ func (c *checkCache) Expired() bool {
 	return c.created.Add(cacheTTL).Before(time.Now())
 }
 
-// TODO: add stats
-
 const (
 	ACLAllow = "allow"
 	ACLDeny  = "deny"
@@ -120,7 +128,13 @@ func (c *Config) Validate() error {
 		return c.valErr
 	}
 
+	if err := c.resolveLists(); err != nil {
+		c.valErr = err
+		return c.valErr
+	}
+
 	c.ipCache = xsync.NewMap[string, *checkCache]()
+	c.stats = newStats(len(c.Allow), len(c.Deny))
 
 	if c.Notify.IncludeAllowed != nil {
 		c.notifyAllowed = *c.Notify.IncludeAllowed
@@ -162,16 +176,26 @@ func (c *Config) Start(parent task.Parent) error {
 		go c.logNotifyLoop(parent)
 	}
 
+	if len(c.lists) > 0 {
+		c.startLists(parent)
+	}
+
+	if c.AutoBan != nil {
+		newAutoBan(c).start(parent)
+	}
+
 	log.Info().
 		Str("default", c.Default).
 		Bool("allow_local", c.allowLocal).
 		Int("allow_rules", len(c.Allow)).
 		Int("deny_rules", len(c.Deny)).
+		Int("lists", len(c.lists)).
+		Bool("auto_ban", c.AutoBan != nil).
 		Msg("ACL started")
 	return nil
 }
 
-func (c *Config) cacheRecord(info *maxmind.IPInfo, allow bool, reason string) {
+func (c *Config) cacheRecord(info *maxmind.IPInfo, allow bool, reason string, rule ruleRef) {
 	if common.ForceResolveCountry && info.City == nil {
 		maxmind.LookupCity(info)
 	}
@@ -179,6 +203,7 @@ func (c *Config) cacheRecord(info *maxmind.IPInfo, allow bool, reason string) {
 		IPInfo:  info,
 		allow:   allow,
 		reason:  reason,
+		rule:    rule,
 		created: time.Now(),
 	})
 }
@@ -265,8 +290,9 @@ func (c *Config) logNotifyLoop(parent task.Parent) {
 	}
 }
 
-// log and notify if needed
-func (c *Config) logAndNotify(info *maxmind.IPInfo, allowed bool, reason string) {
+// record stats, log and notify if needed
+func (c *Config) logAndNotify(info *maxmind.IPInfo, allowed bool, reason string, rule ruleRef) {
+	c.stats.record(info, allowed, rule)
 	if c.logNotifyCh != nil {
 		c.logNotifyCh <- ipLog{info: info, allowed: allowed, reason: reason}
 	}
@@ -282,29 +308,41 @@ func (c *Config) IPAllowed(ip net.IP) bool {
 		return true
 	}
 
+	// bans are not cached, so they take effect immediately
+	ipStr := ip.String()
+	if ban := banOf(ip, ipStr); ban != nil {
+		reason := "banned until " + ban.ExpiresAt.Format(time.RFC3339)
+		if ban.Reason != "" {
+			reason += ": " + ban.Reason
+		}
+		c.logAndNotify(&maxmind.IPInfo{IP: ip, Str: ipStr}, false, reason, ruleRef{kind: ruleBan})
+		return false
+	}
+
 	if c.allowLocal && ip.IsPrivate() {
-		c.logAndNotify(&maxmind.IPInfo{IP: ip, Str: ip.String()}, true, "allowed by allow_local rule")
+		c.logAndNotify(&maxmind.IPInfo{IP: ip, Str: ipStr}, true, "allowed by allow_local rule", ruleRef{kind: ruleAllowLocal})
 		return true
 	}
 
-	ipStr := ip.String()
 	record, ok := c.ipCache.Load(ipStr)
 	if ok && !record.Expired() {
-		c.logAndNotify(record.IPInfo, record.allow, record.reason)
+		c.logAndNotify(record.IPInfo, record.allow, record.reason, record.rule)
 		return record.allow
 	}
 
 	ipAndStr := &maxmind.IPInfo{IP: ip, Str: ipStr}
 	if index := c.Deny.MatchedIndex(ipAndStr); index != -1 {
 		reason := "blocked by deny rule: " + c.Deny[index].raw
-		c.logAndNotify(ipAndStr, false, reason)
-		c.cacheRecord(ipAndStr, false, reason)
+		rule := ruleRef{kind: ruleDeny, index: index}
+		c.logAndNotify(ipAndStr, false, reason, rule)
+		c.cacheRecord(ipAndStr, false, reason, rule)
 		return false
 	}
 	if index := c.Allow.MatchedIndex(ipAndStr); index != -1 {
 		reason := "allowed by allow rule: " + c.Allow[index].raw
-		c.logAndNotify(ipAndStr, true, reason)
-		c.cacheRecord(ipAndStr, true, reason)
+		rule := ruleRef{kind: ruleAllow, index: index}
+		c.logAndNotify(ipAndStr, true, reason, rule)
+		c.cacheRecord(ipAndStr, true, reason, rule)
 		return true
 	}
 
@@ -312,7 +350,8 @@ func (c *Config) IPAllowed(ip net.IP) bool {
 	if c.defaultAllow {
 		reason = "allowed by default"
 	}
-	c.logAndNotify(ipAndStr, c.defaultAllow, reason)
-	c.cacheRecord(ipAndStr, c.defaultAllow, reason)
+	rule := ruleRef{kind: ruleDefault}
+	c.logAndNotify(ipAndStr, c.defaultAllow, reason, rule)
+	c.cacheRecord(ipAndStr, c.defaultAllow, reason, rule)
 	return c.defaultAllow
 }
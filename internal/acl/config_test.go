@@ -0,0 +1,120 @@
+package acl
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newTestConfig(t *testing.T, defaultAction string, allow, deny []string) *Config {
+	t.Helper()
+	cfg := &Config{Default: defaultAction}
+	for _, s := range allow {
+		var m Matcher
+		expect.NoError(t, m.Parse(s))
+		cfg.Allow = append(cfg.Allow, m)
+	}
+	for _, s := range deny {
+		var m Matcher
+		expect.NoError(t, m.Parse(s))
+		cfg.Deny = append(cfg.Deny, m)
+	}
+	expect.NoError(t, cfg.Validate())
+	return cfg
+}
+
+func TestBans(t *testing.T) {
+	cfg := newTestConfig(t, ACLAllow, nil, nil)
+
+	_, err := AddBan("not an ip", time.Minute, "", "")
+	expect.ErrorIs(t, ErrInvalidBanTarget, err)
+	_, err = AddBan("1.2.3.4", 0, "", "")
+	expect.ErrorIs(t, ErrInvalidBanTTL, err)
+
+	// cached as allowed before the ban
+	expect.True(t, cfg.IPAllowed(net.ParseIP("1.2.3.4")))
+
+	ban, err := AddBan("::ffff:1.2.3.4", time.Hour, "scanner", "admin")
+	expect.NoError(t, err)
+	t.Cleanup(func() { _ = RemoveBan("1.2.3.4") })
+	expect.Equal(t, ban.IP, "1.2.3.4")
+	expect.Equal(t, ban.Reason, "scanner")
+	expect.Equal(t, ban.CreatedBy, "admin")
+	expect.False(t, cfg.IPAllowed(net.ParseIP("1.2.3.4")))
+	expect.True(t, cfg.IPAllowed(net.ParseIP("1.2.3.5")))
+
+	// bans take precedence over allow_local
+	ban, err = AddBan("10.1.2.3/8", time.Minute, "", "")
+	expect.NoError(t, err)
+	t.Cleanup(func() { _ = RemoveBan("10.0.0.0/8") })
+	expect.Equal(t, ban.IP, "10.0.0.0/8")
+	expect.False(t, cfg.IPAllowed(net.ParseIP("10.20.30.40")))
+	expect.True(t, cfg.IPAllowed(net.ParseIP("192.168.0.1")))
+
+	// loopback cannot be banned
+	_, err = AddBan("127.0.0.1", time.Minute, "", "")
+	expect.NoError(t, err)
+	t.Cleanup(func() { _ = RemoveBan("127.0.0.1") })
+	expect.True(t, cfg.IPAllowed(net.ParseIP("127.0.0.1")))
+
+	list := Bans()
+	expect.Equal(t, len(list), 3)
+	expect.Equal(t, list[len(list)-1].IP, "1.2.3.4") // sorted by expiry
+
+	expect.NoError(t, RemoveBan("1.2.3.4"))
+	expect.True(t, cfg.IPAllowed(net.ParseIP("1.2.3.4")))
+	expect.ErrorIs(t, ErrBanNotFound, RemoveBan("1.2.3.4"))
+
+	// expired bans are ignored and removed
+	bans.Store("5.6.7.8", &Ban{IP: "5.6.7.8", ExpiresAt: time.Now().Add(-time.Second)})
+	expect.True(t, cfg.IPAllowed(net.ParseIP("5.6.7.8")))
+	_, ok := bans.Load("5.6.7.8")
+	expect.False(t, ok)
+
+	// CIDR bans are lifted immediately
+	expect.NoError(t, RemoveBan("10.0.0.0/8"))
+	expect.Equal(t, len(*cidrBans.Load()), 0)
+	expect.True(t, cfg.IPAllowed(net.ParseIP("10.20.30.40")))
+}
+
+func TestStats(t *testing.T) {
+	cfg := newTestConfig(t, ACLDeny, []string{"ip:1.1.1.1"}, []string{"cidr:8.8.8.0/24"})
+
+	for _, ip := range []string{
+		"1.1.1.1", "1.1.1.1", // allow rule, then cached
+		"8.8.8.8", "8.8.8.8", "8.8.8.4", // deny rule
+		"9.9.9.9",     // default
+		"192.168.1.1", // allow_local
+		"127.0.0.1",   // not counted
+	} {
+		cfg.IPAllowed(net.ParseIP(ip))
+	}
+
+	stats := cfg.Stats()
+	expect.Equal(t, stats.Allowed, 3)
+	expect.Equal(t, stats.Denied, 4)
+	expect.Equal(t, stats.Rules, []RuleStats{
+		{Action: ACLAllow, Rule: "ip:1.1.1.1", Hits: 2},
+		{Action: ACLDeny, Rule: "cidr:8.8.8.0/24", Hits: 3},
+	})
+	expect.Equal(t, stats.AllowLocalHits, 1)
+	expect.Equal(t, stats.DefaultHits, 1)
+	expect.Equal(t, stats.BanHits, 0)
+	expect.Equal(t, stats.TopBlockedIPs, []BlockedCount{
+		{Key: "8.8.8.8", Count: 2},
+		{Key: "8.8.8.4", Count: 1},
+		{Key: "9.9.9.9", Count: 1},
+	})
+	expect.Equal(t, len(stats.TopBlockedCountries), 0)
+
+	expect.Equal(t, len(stats.TimeSeries), statsDataPoints)
+	var allowed, denied uint64
+	for _, point := range stats.TimeSeries {
+		allowed += point.Allowed
+		denied += point.Denied
+	}
+	expect.Equal(t, allowed, 3)
+	expect.Equal(t, denied, 4)
+}
@@ -0,0 +1,320 @@
+package acl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	gperr "github.com/yusing/goutils/errs"
+	"github.com/yusing/goutils/task"
+)
+
+type (
+	// ListConfig is a list of IPs and CIDRs from a file or URL, refreshed periodically.
+	//
+	// Supported formats are plaintext (FireHOL netsets, Tor exit nodes),
+	// Spamhaus DROP (text or JSON lines) and CSV.
+	ListConfig struct {
+		URL     string        `json:"url,omitempty" validate:"omitempty,url"`
+		Path    string        `json:"path,omitempty"`
+		Refresh time.Duration `json:"refresh,omitempty"` // default: 24h
+		// column of the IP or CIDR for CSV, 1-based, default: 1
+		Column int `json:"column,omitempty" validate:"min=0"`
+	}
+
+	ipList struct {
+		*ListConfig
+		name string
+		trie atomic.Pointer[prefixTrie]
+
+		// for conditional requests of URL lists
+		etag, lastModified string
+	}
+)
+
+const (
+	defaultListRefresh = 24 * time.Hour
+	// listRetryInterval is the interval to retry loading a list after a failure, if shorter than the refresh interval
+	listRetryInterval = 5 * time.Minute
+	listFetchTimeout  = 30 * time.Second
+	listMaxSize       = 64 * 1024 * 1024
+)
+
+var listHTTPClient = &http.Client{Timeout: listFetchTimeout}
+
+var (
+	errListSource  = errors.New("expect exactly one of url and path")
+	errListTooBig  = fmt.Errorf("list exceeds %d MiB", listMaxSize/1024/1024)
+	errUnknownList = errors.New("unknown list")
+	errListEmpty   = errors.New("no valid IP or CIDR in list")
+)
+
+func (l *ListConfig) Validate() error {
+	if (l.URL == "") == (l.Path == "") {
+		return errListSource
+	}
+	if l.Refresh <= 0 {
+		l.Refresh = defaultListRefresh
+	}
+	if l.Column == 0 {
+		l.Column = 1
+	}
+	return nil
+}
+
+func (l *ListConfig) source() string {
+	if l.URL != "" {
+		return l.URL
+	}
+	return l.Path
+}
+
+// Contains returns true if ip is in the list, false if the list is not loaded yet.
+func (l *ipList) Contains(ip net.IP) bool {
+	trie := l.trie.Load()
+	if trie == nil {
+		return false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	return trie.Contains(addr)
+}
+
+func (l *ipList) logger() *zerolog.Logger {
+	logger := log.With().Str("list", l.name).Str("source", l.source()).Logger()
+	return &logger
+}
+
+// load loads the list, it keeps the current list on failure.
+//
+// It returns false if the list is not modified since the last load.
+func (l *ipList) load(ctx context.Context) (bool, error) {
+	var r io.ReadCloser
+	if l.URL != "" {
+		body, err := l.fetch(ctx)
+		if err != nil || body == nil {
+			return false, err
+		}
+		r = body
+	} else {
+		f, err := os.Open(l.Path)
+		if err != nil {
+			return false, err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	trie, skipped, err := parseList(r, l.Column)
+	if err == nil && trie.Len() == 0 && skipped > 0 {
+		// e.g. an error page served with status 200, or the wrong column
+		err = fmt.Errorf("%w, %d lines skipped", errListEmpty, skipped)
+	}
+	if err != nil {
+		// fetch the list again next time instead of getting not modified
+		l.etag, l.lastModified = "", ""
+		return false, err
+	}
+	l.trie.Store(trie)
+	l.logger().Info().
+		Int("entries", trie.Len()).
+		Int("skipped", skipped).
+		Msg("ACL list loaded")
+	return true, nil
+}
+
+// fetch returns the body of the list, or nil if it is not modified.
+func (l *ipList) fetch(ctx context.Context) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if l.trie.Load() != nil {
+		if l.etag != "" {
+			req.Header.Set("If-None-Match", l.etag)
+		}
+		if l.lastModified != "" {
+			req.Header.Set("If-Modified-Since", l.lastModified)
+		}
+	}
+	resp, err := listHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		l.etag = resp.Header.Get("ETag")
+		l.lastModified = resp.Header.Get("Last-Modified")
+		return resp.Body, nil
+	case http.StatusNotModified:
+		resp.Body.Close()
+		return nil, nil
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+// parseList parses a list with an IP or CIDR per line, into a prefix trie.
+//
+// Comments starting with # or ; are ignored, lines without a valid IP or CIDR
+// (e.g. CSV headers) are skipped. For JSON lines, the "cidr" field is used.
+func parseList(r io.Reader, column int) (trie *prefixTrie, skipped int, err error) {
+	trie = new(prefixTrie)
+
+	var size int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		size += len(line) + 1
+		if size > listMaxSize {
+			return nil, 0, errListTooBig
+		}
+
+		var field string
+		if len(line) > 0 && line[0] == '{' {
+			var entry struct {
+				CIDR string `json:"cidr"`
+			}
+			if json.Unmarshal(line, &entry) != nil || entry.CIDR == "" {
+				skipped++
+				continue
+			}
+			field = entry.CIDR
+		} else {
+			s := string(line)
+			if i := strings.IndexAny(s, "#;"); i != -1 {
+				s = s[:i]
+			}
+			fields := strings.FieldsFunc(s, func(r rune) bool {
+				return r == ',' || unicode.IsSpace(r)
+			})
+			if len(fields) == 0 {
+				continue
+			}
+			if column > len(fields) {
+				skipped++
+				continue
+			}
+			field = strings.Trim(fields[column-1], `"'`)
+		}
+
+		prefix, ok := parsePrefix(field)
+		if !ok {
+			skipped++
+			continue
+		}
+		trie.Insert(prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return trie, skipped, nil
+}
+
+func parsePrefix(s string) (netip.Prefix, bool) {
+	if strings.IndexByte(s, '/') != -1 {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix, err == nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), true
+}
+
+// resolveLists resolves the list matchers to the configured lists.
+func (c *Config) resolveLists() error {
+	c.lists = make(map[string]*ipList, len(c.Lists))
+	for name, cfg := range c.Lists {
+		c.lists[name] = &ipList{ListConfig: cfg, name: name}
+	}
+
+	matchers := [][]Matcher{c.Allow, c.Deny}
+	if c.AutoBan != nil {
+		matchers = append(matchers, c.AutoBan.Exclude)
+	}
+	var errs gperr.Builder
+	for _, ms := range matchers {
+		for i := range ms {
+			m := &ms[i]
+			if m.list == "" {
+				continue
+			}
+			list, ok := c.lists[m.list]
+			if !ok {
+				errs.Add(gperr.PrependSubject(errUnknownList, m.list))
+				continue
+			}
+			m.match = matchList(list)
+		}
+	}
+	return errs.Error()
+}
+
+// startLists loads the lists and refreshes them until parent is done.
+//
+// Lists failed to load are logged and retried later, they match nothing until loaded.
+func (c *Config) startLists(parent task.Parent) {
+	var wg sync.WaitGroup
+	for _, list := range c.lists {
+		wg.Go(func() {
+			if _, err := list.load(parent.Context()); err != nil {
+				list.logger().Err(err).Msg("failed to load ACL list")
+			}
+		})
+	}
+	wg.Wait()
+
+	for _, list := range c.lists {
+		go c.refreshList(parent, list)
+	}
+}
+
+func (c *Config) refreshList(parent task.Parent, list *ipList) {
+	retry := min(list.Refresh, listRetryInterval)
+
+	delay := list.Refresh
+	if list.trie.Load() == nil {
+		delay = retry
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-parent.Context().Done():
+			return
+		case <-timer.C:
+			updated, err := list.load(parent.Context())
+			switch {
+			case err != nil:
+				list.logger().Err(err).Msg("failed to refresh ACL list")
+				timer.Reset(retry)
+				continue
+			case updated:
+				// cached results may be outdated
+				c.ipCache.Clear()
+			}
+			timer.Reset(list.Refresh)
+		}
+	}
+}
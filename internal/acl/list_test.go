@@ -0,0 +1,176 @@
+package acl
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     string
+		column   int
+		contains []string
+		skipped  int
+	}{
+		{
+			name: "firehol",
+			list: `#
+# firehol_level1
+#
+1.2.3.0/24
+5.6.7.8
+2001:db8::/32
+`,
+			contains: []string{"1.2.3.4", "5.6.7.8", "2001:db8::1"},
+		},
+		{
+			name: "spamhaus drop",
+			list: `; Spamhaus DROP List
+1.10.16.0/20 ; SBL256894
+1.19.0.0/16 ; SBL434604
+`,
+			contains: []string{"1.10.16.1", "1.19.255.255"},
+		},
+		{
+			name: "spamhaus drop json",
+			list: `{"cidr":"1.10.16.0/20","sblid":"SBL256894","rir":"apnic"}
+{"type":"metadata","timestamp":1700000000,"size":1,"records":1}
+`,
+			contains: []string{"1.10.16.1"},
+			skipped:  1,
+		},
+		{
+			name: "csv",
+			list: `name,network,comment
+"a","10.0.0.0/8","x"
+b,192.0.2.1
+c
+`,
+			column:   2,
+			contains: []string{"10.1.2.3", "192.0.2.1"},
+			skipped:  2, // header and missing column
+		},
+		{
+			name:     "invalid",
+			list:     "not an ip\n1.2.3.4-1.2.3.10\n\n",
+			contains: nil,
+			skipped:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			column := tt.column
+			if column == 0 {
+				column = 1
+			}
+			trie, skipped, err := parseList(strings.NewReader(tt.list), column)
+			expect.NoError(t, err)
+			expect.Equal(t, skipped, tt.skipped)
+			expect.Equal(t, trie.Len(), len(tt.contains))
+			for _, ip := range tt.contains {
+				expect.True(t, trie.Contains(netip.MustParseAddr(ip)))
+			}
+			expect.False(t, trie.Contains(netip.MustParseAddr("203.0.113.1")))
+		})
+	}
+}
+
+func TestListLoadKeepsCurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	expect.NoError(t, os.WriteFile(path, []byte("203.0.113.0/24\n"), 0o644))
+
+	l := &ipList{ListConfig: &ListConfig{Path: path}, name: "test"}
+	expect.NoError(t, l.Validate())
+	updated, err := l.load(t.Context())
+	expect.NoError(t, err)
+	expect.True(t, updated)
+
+	// nothing but skipped lines, e.g. an error page
+	expect.NoError(t, os.WriteFile(path, []byte("<html>\n<body>Service Unavailable</body>\n</html>\n"), 0o644))
+	_, err = l.load(t.Context())
+	expect.ErrorIs(t, errListEmpty, err)
+	expect.True(t, l.Contains(net.ParseIP("203.0.113.1")))
+
+	// an empty list is valid
+	expect.NoError(t, os.WriteFile(path, []byte("# no entries\n"), 0o644))
+	updated, err = l.load(t.Context())
+	expect.NoError(t, err)
+	expect.True(t, updated)
+	expect.False(t, l.Contains(net.ParseIP("203.0.113.1")))
+}
+
+func TestListMatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	expect.NoError(t, os.WriteFile(path, []byte("203.0.113.0/24\n"), 0o644))
+
+	var served int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("198.51.100.1\n"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := &Config{
+		Default: ACLAllow,
+		Lists: map[string]*ListConfig{
+			"file": {Path: path},
+			"url":  {URL: srv.URL},
+		},
+	}
+	for _, list := range cfg.Lists {
+		expect.NoError(t, list.Validate())
+	}
+	for _, s := range []string{"list:file", "list:url"} {
+		var m Matcher
+		expect.NoError(t, m.Parse(s))
+		cfg.Deny = append(cfg.Deny, m)
+	}
+	expect.NoError(t, cfg.Validate())
+
+	// lists match nothing until loaded
+	expect.True(t, cfg.IPAllowed(net.ParseIP("203.0.113.1")))
+	cfg.ipCache.Clear()
+
+	for _, list := range cfg.lists {
+		updated, err := list.load(t.Context())
+		expect.NoError(t, err)
+		expect.True(t, updated)
+	}
+	expect.False(t, cfg.IPAllowed(net.ParseIP("203.0.113.1")))
+	expect.False(t, cfg.IPAllowed(net.ParseIP("198.51.100.1")))
+	expect.True(t, cfg.IPAllowed(net.ParseIP("198.51.100.2")))
+
+	updated, err := cfg.lists["url"].load(t.Context())
+	expect.NoError(t, err)
+	expect.False(t, updated)
+	expect.Equal(t, served, 2)
+	expect.False(t, cfg.IPAllowed(net.ParseIP("198.51.100.1")))
+
+	t.Run("unknown list", func(t *testing.T) {
+		cfg := &Config{}
+		var m Matcher
+		expect.NoError(t, m.Parse("list:unknown"))
+		cfg.Deny = append(cfg.Deny, m)
+		expect.ErrorIs(t, errUnknownList, cfg.Validate())
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		expect.ErrorIs(t, errListSource, (&ListConfig{}).Validate())
+		expect.ErrorIs(t, errListSource, (&ListConfig{URL: srv.URL, Path: path}).Validate())
+	})
+}
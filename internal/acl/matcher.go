@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"net"
+	"strconv"
 	"strings"
 
 	"github.com/yusing/godoxy/internal/maxmind"
@@ -15,6 +16,7 @@ type MatcherFunc func(*maxmind.IPInfo) bool
 type Matcher struct {
 	match MatcherFunc
 	raw   string
+	list  string // name of the list, resolved by Config.Validate
 }
 
 type Matchers []Matcher
@@ -24,6 +26,8 @@ const (
 	MatcherTypeCIDR     = "cidr"
 	MatcherTypeTimeZone = "tz"
 	MatcherTypeCountry  = "country"
+	MatcherTypeASN      = "asn"
+	MatcherTypeList     = "list"
 )
 
 // TODO: use this error in the future
@@ -31,43 +35,55 @@ const (
 //nolint:unused
 var errMatcherFormat = gperr.Multiline().AddLines(
 	"invalid matcher format, expect {type}:{value}",
-	"Available types: ip|cidr|tz|country",
+	"Available types: ip|cidr|tz|country|asn|list",
 	"ip:127.0.0.1",
 	"cidr:127.0.0.0/8",
 	"tz:Asia/Shanghai",
 	"country:GB",
+	"asn:13335",
+	"list:firehol_level1",
 )
 
 var (
 	errSyntax      = errors.New("syntax error")
 	errInvalidIP   = errors.New("invalid IP")
 	errInvalidCIDR = errors.New("invalid CIDR")
+	errInvalidASN  = errors.New("invalid ASN")
 )
 
 func (matcher *Matcher) Parse(s string) error {
-	parts := strings.Split(s, ":")
-	if len(parts) != 2 {
+	typ, value, ok := strings.Cut(s, ":")
+	if !ok || value == "" {
 		return errSyntax
 	}
 	matcher.raw = s
 
-	switch parts[0] {
+	switch typ {
 	case MatcherTypeIP:
-		ip := net.ParseIP(parts[1])
+		ip := net.ParseIP(value)
 		if ip == nil {
 			return errInvalidIP
 		}
 		matcher.match = matchIP(ip)
 	case MatcherTypeCIDR:
-		_, net, err := net.ParseCIDR(parts[1])
+		_, net, err := net.ParseCIDR(value)
 		if err != nil {
 			return errInvalidCIDR
 		}
 		matcher.match = matchCIDR(net)
 	case MatcherTypeTimeZone:
-		matcher.match = matchTimeZone(parts[1])
+		matcher.match = matchTimeZone(value)
 	case MatcherTypeCountry:
-		matcher.match = matchISOCode(parts[1])
+		matcher.match = matchISOCode(value)
+	case MatcherTypeASN:
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(value), "AS"), 10, 32)
+		if err != nil {
+			return errInvalidASN
+		}
+		matcher.match = matchASN(uint(asn))
+	case MatcherTypeList:
+		matcher.list = value
+		matcher.match = matchNone
 	default:
 		return errSyntax
 	}
@@ -135,3 +151,24 @@ func matchISOCode(iso string) MatcherFunc {
 		return city.Country.IsoCode == iso
 	}
 }
+
+func matchASN(asn uint) MatcherFunc {
+	return func(ip *maxmind.IPInfo) bool {
+		info, ok := maxmind.LookupASN(ip)
+		if !ok {
+			return false
+		}
+		return info.Number == asn
+	}
+}
+
+func matchList(list *ipList) MatcherFunc {
+	return func(ip *maxmind.IPInfo) bool {
+		return list.Contains(ip.IP)
+	}
+}
+
+// matchNone matches nothing, for list matchers not resolved by Config.Validate.
+func matchNone(*maxmind.IPInfo) bool {
+	return false
+}
@@ -1,6 +1,7 @@
 package acl
 
 import (
+	"errors"
 	"net"
 	"reflect"
 	"testing"
@@ -13,6 +14,8 @@ func TestMatchers(t *testing.T) {
 	strMatchers := []string{
 		"ip:127.0.0.1",
 		"cidr:10.0.0.0/8",
+		"ip:2001:db8::1",
+		"cidr:2001:db8:1::/48",
 	}
 
 	var mathers Matchers
@@ -30,6 +33,9 @@ func TestMatchers(t *testing.T) {
 		{"127.0.0.2", false},
 		{"192.168.0.1", false},
 		{"11.0.0.1", false},
+		{"2001:db8::1", true},
+		{"2001:db8:1::1", true},
+		{"2001:db8::2", false},
 	}
 
 	for _, test := range tests {
@@ -47,3 +53,29 @@ func TestMatchers(t *testing.T) {
 		}
 	}
 }
+
+func TestMatcherParse(t *testing.T) {
+	tests := []struct {
+		s       string
+		wantErr error
+	}{
+		{"asn:13335", nil},
+		{"asn:AS13335", nil},
+		{"asn:cloudflare", errInvalidASN},
+		{"list:firehol_level1", nil},
+		{"list:", errSyntax},
+		{"ip:::1", nil},
+		{"ip:1.2.3", errInvalidIP},
+		{"cidr:1.2.3.4", errInvalidCIDR},
+		{"unknown:1", errSyntax},
+		{"1.2.3.4", errSyntax},
+	}
+
+	for _, test := range tests {
+		var m Matcher
+		err := m.Parse(test.s)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("Parse(%q) = %v, want %v", test.s, err, test.wantErr)
+		}
+	}
+}
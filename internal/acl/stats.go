@@ -0,0 +1,278 @@
+package acl
+
+import (
+	"cmp"
+	"container/heap"
+	"iter"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/yusing/godoxy/internal/maxmind"
+)
+
+type (
+	// Stats are the statistics of the ACL since it was started.
+	Stats struct {
+		Allowed uint64 `json:"allowed"`
+		Denied  uint64 `json:"denied"`
+		// Hits of the allow and deny rules, in the order of the config
+		Rules []RuleStats `json:"rules"`
+		// Connections allowed by allow_local
+		AllowLocalHits uint64 `json:"allow_local_hits"`
+		// Connections denied by runtime bans
+		BanHits uint64 `json:"ban_hits"`
+		// Connections allowed or denied by default
+		DefaultHits         uint64           `json:"default_hits"`
+		TopBlockedIPs       []BlockedCount   `json:"top_blocked_ips"`
+		TopBlockedCountries []BlockedCount   `json:"top_blocked_countries"`
+		TimeSeries          []StatsDataPoint `json:"time_series"`
+	} // @name ACLStats
+	RuleStats struct {
+		Action string `json:"action"` // allow or deny
+		Rule   string `json:"rule"`
+		Hits   uint64 `json:"hits"`
+	} // @name ACLRuleStats
+	BlockedCount struct {
+		// IP address or country ISO code
+		Key   string `json:"key"`
+		Count uint64 `json:"count"`
+	} // @name ACLBlockedCount
+	StatsDataPoint struct {
+		Timestamp int64  `json:"timestamp"` // start of the interval, unix seconds
+		Allowed   uint64 `json:"allowed"`
+		Denied    uint64 `json:"denied"`
+	} // @name ACLStatsDataPoint
+)
+
+type ruleKind uint8
+
+const (
+	ruleAllowLocal ruleKind = iota
+	ruleBan
+	ruleAllow
+	ruleDeny
+	ruleDefault
+)
+
+// ruleRef is the rule an access decision is made by.
+type ruleRef struct {
+	kind  ruleKind
+	index int // index of the allow or deny rule
+}
+
+const (
+	statsInterval   = time.Minute
+	statsDataPoints = 60
+	statsTopN       = 10
+	// statsMaxBlockedIPs limits the number of blocked IPs tracked,
+	// the least blocked IP is evicted for a new one when exceeded.
+	statsMaxBlockedIPs = 1000
+)
+
+type statsBucket struct {
+	start   int64
+	allowed uint64
+	denied  uint64
+}
+
+type stats struct {
+	mu sync.Mutex
+
+	allowed, denied uint64
+
+	allowHits, denyHits                  []uint64
+	allowLocalHits, banHits, defaultHits uint64
+
+	blockedIPs       *blockedIPs
+	blockedCountries map[string]uint64
+
+	series [statsDataPoints]statsBucket
+}
+
+func newStats(numAllow, numDeny int) *stats {
+	return &stats{
+		allowHits:        make([]uint64, numAllow),
+		denyHits:         make([]uint64, numDeny),
+		blockedIPs:       newBlockedIPs(),
+		blockedCountries: make(map[string]uint64),
+	}
+}
+
+func (s *stats) record(info *maxmind.IPInfo, allowed bool, rule ruleRef) {
+	var country string
+	if !allowed {
+		country = countryOf(info)
+	}
+	now := time.Now().Truncate(statsInterval).Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch rule.kind {
+	case ruleAllowLocal:
+		s.allowLocalHits++
+	case ruleBan:
+		s.banHits++
+	case ruleAllow:
+		s.allowHits[rule.index]++
+	case ruleDeny:
+		s.denyHits[rule.index]++
+	case ruleDefault:
+		s.defaultHits++
+	}
+
+	bucket := &s.series[(now/int64(statsInterval.Seconds()))%statsDataPoints]
+	if bucket.start != now {
+		*bucket = statsBucket{start: now}
+	}
+
+	if allowed {
+		s.allowed++
+		bucket.allowed++
+		return
+	}
+
+	s.denied++
+	bucket.denied++
+	if country != "" {
+		s.blockedCountries[country]++
+	}
+	s.blockedIPs.inc(info.Str)
+}
+
+// blockedIPs counts the blocked IPs in a min-heap by count, so the least blocked IP
+// is evicted for a new one in O(log n) when statsMaxBlockedIPs is reached.
+type blockedIPs struct {
+	entries []BlockedCount
+	index   map[string]int // IP -> index in entries
+}
+
+var _ heap.Interface = (*blockedIPs)(nil)
+
+func newBlockedIPs() *blockedIPs {
+	return &blockedIPs{index: make(map[string]int)}
+}
+
+func (h *blockedIPs) inc(ip string) {
+	if i, ok := h.index[ip]; ok {
+		h.entries[i].Count++
+		heap.Fix(h, i)
+		return
+	}
+	if len(h.entries) >= statsMaxBlockedIPs {
+		heap.Pop(h)
+	}
+	heap.Push(h, BlockedCount{Key: ip, Count: 1})
+}
+
+// All returns the IPs and their counts.
+func (h *blockedIPs) All() iter.Seq2[string, uint64] {
+	return func(yield func(string, uint64) bool) {
+		for _, entry := range h.entries {
+			if !yield(entry.Key, entry.Count) {
+				return
+			}
+		}
+	}
+}
+
+// Len implements heap.Interface.
+func (h *blockedIPs) Len() int { return len(h.entries) }
+
+// Less implements heap.Interface.
+func (h *blockedIPs) Less(i, j int) bool { return h.entries[i].Count < h.entries[j].Count }
+
+// Swap implements heap.Interface.
+func (h *blockedIPs) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.index[h.entries[i].Key] = i
+	h.index[h.entries[j].Key] = j
+}
+
+// Push implements heap.Interface.
+func (h *blockedIPs) Push(x any) {
+	entry := x.(BlockedCount)
+	h.index[entry.Key] = len(h.entries)
+	h.entries = append(h.entries, entry)
+}
+
+// Pop implements heap.Interface.
+func (h *blockedIPs) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	delete(h.index, last.Key)
+	return last
+}
+
+// countryOf returns the country ISO code of info, empty if unknown.
+//
+// It does not look up the city if MaxMind is not configured, to avoid the warning.
+// info is not modified since cached records are shared.
+func countryOf(info *maxmind.IPInfo) string {
+	city := info.City
+	if city == nil && maxmind.HasInstance() {
+		lookup := *info
+		city, _ = maxmind.LookupCity(&lookup)
+	}
+	if city == nil {
+		return ""
+	}
+	return city.Country.IsoCode
+}
+
+func topN(counts iter.Seq2[string, uint64]) []BlockedCount {
+	list := make([]BlockedCount, 0, statsTopN)
+	for key, count := range counts {
+		list = append(list, BlockedCount{Key: key, Count: count})
+	}
+	slices.SortFunc(list, func(a, b BlockedCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	if len(list) > statsTopN {
+		list = list[:statsTopN]
+	}
+	return list
+}
+
+// Stats returns the statistics of the ACL, with a data point per minute of the last hour.
+func (c *Config) Stats() *Stats {
+	s := c.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &Stats{
+		Allowed:             s.allowed,
+		Denied:              s.denied,
+		Rules:               make([]RuleStats, 0, len(c.Allow)+len(c.Deny)),
+		AllowLocalHits:      s.allowLocalHits,
+		BanHits:             s.banHits,
+		DefaultHits:         s.defaultHits,
+		TopBlockedIPs:       topN(s.blockedIPs.All()),
+		TopBlockedCountries: topN(maps.All(s.blockedCountries)),
+		TimeSeries:          make([]StatsDataPoint, statsDataPoints),
+	}
+	for i, m := range c.Allow {
+		result.Rules = append(result.Rules, RuleStats{Action: ACLAllow, Rule: m.raw, Hits: s.allowHits[i]})
+	}
+	for i, m := range c.Deny {
+		result.Rules = append(result.Rules, RuleStats{Action: ACLDeny, Rule: m.raw, Hits: s.denyHits[i]})
+	}
+
+	interval := int64(statsInterval.Seconds())
+	now := time.Now().Truncate(statsInterval).Unix()
+	for i := range statsDataPoints {
+		start := now - int64(statsDataPoints-1-i)*interval
+		point := StatsDataPoint{Timestamp: start}
+		if bucket := s.series[(start/interval)%statsDataPoints]; bucket.start == start {
+			point.Allowed = bucket.allowed
+			point.Denied = bucket.denied
+		}
+		result.TimeSeries[i] = point
+	}
+	return result
+}
@@ -0,0 +1,38 @@
+package acl
+
+import (
+	"fmt"
+	"testing"
+
+	maxmind "github.com/yusing/godoxy/internal/maxmind/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestStatsEvictsLeastBlockedIP(t *testing.T) {
+	s := newStats(0, 0)
+	deny := func(ip string, n int) {
+		for range n {
+			s.record(&maxmind.IPInfo{Str: ip}, false, ruleRef{kind: ruleDefault})
+		}
+	}
+
+	deny("192.0.2.1", 3)
+	deny("192.0.2.2", 2)
+	for i := range statsMaxBlockedIPs - 2 {
+		deny(fmt.Sprintf("10.0.%d.%d", i/256, i%256), 1)
+	}
+	expect.Equal(t, s.blockedIPs.Len(), statsMaxBlockedIPs)
+
+	// a new IP evicts one blocked once, the most blocked IPs are kept
+	deny("198.51.100.1", 1)
+	expect.Equal(t, s.blockedIPs.Len(), statsMaxBlockedIPs)
+	deny("198.51.100.1", 1)
+
+	top := topN(s.blockedIPs.All())
+	expect.Equal(t, top[0], BlockedCount{Key: "192.0.2.1", Count: 3})
+	expect.Equal(t, top[1], BlockedCount{Key: "192.0.2.2", Count: 2})
+	expect.Equal(t, top[2], BlockedCount{Key: "198.51.100.1", Count: 2})
+	for ip, i := range s.blockedIPs.index {
+		expect.Equal(t, s.blockedIPs.entries[i].Key, ip)
+	}
+}
@@ -0,0 +1,114 @@
+package acl
+
+import (
+	"math/bits"
+	"net/netip"
+)
+
+// prefixTrie is a path-compressed binary trie of IP prefixes,
+// answering whether an address is in any of the prefixes.
+//
+// Prefixes covered by another prefix are dropped on insert,
+// so a terminal node never has children.
+type prefixTrie struct {
+	v4, v6 *trieNode
+	size   int // number of prefixes inserted, including covered ones
+}
+
+type trieNode struct {
+	prefix   netip.Prefix
+	terminal bool
+	child    [2]*trieNode
+}
+
+func (t *prefixTrie) Insert(p netip.Prefix) {
+	if addr := p.Addr(); addr.Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(addr.Unmap(), p.Bits()-96)
+	}
+	p = p.Masked()
+	if !p.IsValid() {
+		return
+	}
+	t.size++
+
+	root := &t.v6
+	if p.Addr().Is4() {
+		root = &t.v4
+	}
+	for {
+		n := *root
+		if n == nil {
+			*root = &trieNode{prefix: p, terminal: true}
+			return
+		}
+		common := commonBits(n.prefix, p)
+		switch {
+		case common == n.prefix.Bits(): // n contains p
+			if n.terminal {
+				return
+			}
+			if common == p.Bits() {
+				*n = trieNode{prefix: p, terminal: true}
+				return
+			}
+			root = &n.child[bitAt(p.Addr(), common)]
+		case common == p.Bits(): // p contains n
+			*root = &trieNode{prefix: p, terminal: true}
+			return
+		default:
+			branch := &trieNode{prefix: netip.PrefixFrom(p.Addr(), common).Masked()}
+			branch.child[bitAt(n.prefix.Addr(), common)] = n
+			branch.child[bitAt(p.Addr(), common)] = &trieNode{prefix: p, terminal: true}
+			*root = branch
+			return
+		}
+	}
+}
+
+func (t *prefixTrie) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	n := t.v6
+	if addr.Is4() {
+		n = t.v4
+	}
+	for n != nil && n.prefix.Contains(addr) {
+		if n.terminal {
+			return true
+		}
+		n = n.child[bitAt(addr, n.prefix.Bits())]
+	}
+	return false
+}
+
+// Len returns the number of prefixes inserted.
+func (t *prefixTrie) Len() int {
+	return t.size
+}
+
+// commonBits returns the length of the common prefix of a and b, of the same address family.
+func commonBits(a, b netip.Prefix) int {
+	maxBits := min(a.Bits(), b.Bits())
+	a16, b16 := a.Addr().As16(), b.Addr().As16()
+	offset := 0
+	if a.Addr().Is4() {
+		offset = 12 // IPv4 addresses are the last 4 bytes of As16
+	}
+	n := 0
+	for i := offset; i < 16 && n < maxBits; i++ {
+		if x := a16[i] ^ b16[i]; x != 0 {
+			n += bits.LeadingZeros8(x)
+			break
+		}
+		n += 8
+	}
+	return min(n, maxBits)
+}
+
+// bitAt returns the i-th most significant bit of addr.
+func bitAt(addr netip.Addr, i int) int {
+	a16 := addr.As16()
+	if addr.Is4() {
+		i += 96
+	}
+	return int(a16[i/8]>>(7-i%8)) & 1
+}
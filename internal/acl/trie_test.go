@@ -0,0 +1,101 @@
+package acl
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"testing"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestPrefixTrie(t *testing.T) {
+	var trie prefixTrie
+	for _, s := range []string{
+		"10.1.0.0/16",
+		"10.1.2.0/24", // covered
+		"10.2.3.4/32",
+		"192.168.0.0/24",
+		"192.168.1.0/24",
+		"8.0.0.0/8",
+		"8.8.0.0/16", // covered
+		"172.16.0.0/24",
+		"172.16.0.0/12", // covers the previous one
+		"2001:db8::/32",
+		"::ffff:1.2.3.4/128", // mapped
+	} {
+		trie.Insert(netip.MustParsePrefix(s))
+	}
+	expect.Equal(t, trie.Len(), 11)
+
+	for _, tt := range []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.0.1", true},
+		{"10.1.255.255", true},
+		{"10.2.3.4", true},
+		{"10.2.3.5", false},
+		{"10.0.0.1", false},
+		{"192.168.0.255", true},
+		{"192.168.1.1", true},
+		{"192.168.2.1", false},
+		{"8.8.8.8", true},
+		{"9.0.0.1", false},
+		{"172.31.255.255", true},
+		{"172.32.0.1", false},
+		{"1.2.3.4", true},
+		{"::ffff:1.2.3.4", true},
+		{"1.2.3.5", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"::1", false},
+	} {
+		expect.Equal(t, trie.Contains(netip.MustParseAddr(tt.addr)), tt.want)
+	}
+
+	var empty prefixTrie
+	expect.False(t, empty.Contains(netip.MustParseAddr("1.2.3.4")))
+}
+
+func TestPrefixTrieRandom(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	randAddr := func() netip.Addr {
+		return netip.AddrFrom4([4]byte{byte(rnd.IntN(4)), byte(rnd.IntN(256)), byte(rnd.IntN(256)), byte(rnd.IntN(256))})
+	}
+
+	var trie prefixTrie
+	prefixes := make([]netip.Prefix, 0, 1000)
+	for range cap(prefixes) {
+		p := netip.PrefixFrom(randAddr(), 8+rnd.IntN(25)).Masked()
+		prefixes = append(prefixes, p)
+		trie.Insert(p)
+	}
+
+	for range 10000 {
+		addr := randAddr()
+		want := false
+		for _, p := range prefixes {
+			if p.Contains(addr) {
+				want = true
+				break
+			}
+		}
+		if trie.Contains(addr) != want {
+			t.Fatalf("Contains(%s) = %v, want %v", addr, !want, want)
+		}
+	}
+}
+
+func BenchmarkPrefixTrie(b *testing.B) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	var trie prefixTrie
+	for range 100000 {
+		trie.Insert(netip.PrefixFrom(netip.AddrFrom4([4]byte{byte(rnd.IntN(256)), byte(rnd.IntN(256)), byte(rnd.IntN(256))}), 24))
+	}
+	addr := netip.MustParseAddr("203.0.113.1")
+
+	b.ResetTimer()
+	for b.Loop() {
+		trie.Contains(addr)
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog/log"
 	apiV1 "github.com/yusing/godoxy/internal/api/v1"
+	aclApi "github.com/yusing/godoxy/internal/api/v1/acl"
 	agentApi "github.com/yusing/godoxy/internal/api/v1/agent"
 	authApi "github.com/yusing/godoxy/internal/api/v1/auth"
+	cacheApi "github.com/yusing/godoxy/internal/api/v1/cache"
 	certApi "github.com/yusing/godoxy/internal/api/v1/cert"
 	dockerApi "github.com/yusing/godoxy/internal/api/v1/docker"
 	fileApi "github.com/yusing/godoxy/internal/api/v1/file"
@@ -18,8 +20,11 @@ import (
 	metricsApi "github.com/yusing/godoxy/internal/api/v1/metrics"
 	proxmoxApi "github.com/yusing/godoxy/internal/api/v1/proxmox"
 	routeApi "github.com/yusing/godoxy/internal/api/v1/route"
+	tokenApi "github.com/yusing/godoxy/internal/api/v1/token"
+	userApi "github.com/yusing/godoxy/internal/api/v1/user"
 	"github.com/yusing/godoxy/internal/auth"
 	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/metrics/prometheus"
 	apitypes "github.com/yusing/goutils/apitypes"
 )
 
@@ -51,9 +56,47 @@ func NewHandler(requireAuth bool) *gin.Engine {
 
 	log.Debug().Msg("gin codec json.API: " + reflect.TypeOf(json.API).Name())
 
+	authRequired := auth.IsEnabled() && requireAuth
+	// authorize returns a middleware that rejects users without role, or API tokens without scope.
+	// Every authenticated user has at least the viewer role, and an empty scope denies all API tokens.
+	authorize := func(role auth.Role, scope auth.Scope) gin.HandlerFunc {
+		if !authRequired {
+			return func(c *gin.Context) { c.Next() }
+		}
+		return AuthorizeMiddleware(role, scope)
+	}
+	var (
+		routesRead    = authorize(auth.RoleViewer, auth.ScopeRoutesRead)
+		metricsRead   = authorize(auth.RoleViewer, auth.ScopeMetricsRead)
+		homepageRead  = authorize(auth.RoleViewer, auth.ScopeHomepageRead)
+		homepageWrite = authorize(auth.RoleOperator, auth.ScopeHomepageWrite)
+		dockerRead    = authorize(auth.RoleViewer, auth.ScopeDockerRead)
+		dockerWrite   = authorize(auth.RoleOperator, auth.ScopeDockerWrite)
+		proxmoxRead   = authorize(auth.RoleViewer, auth.ScopeProxmoxRead)
+		proxmoxWrite  = authorize(auth.RoleOperator, auth.ScopeProxmoxWrite)
+		certRead      = authorize(auth.RoleViewer, auth.ScopeCertRead)
+		certRenew     = authorize(auth.RoleOperator, auth.ScopeCertRenew)
+		filesRead     = authorize(auth.RoleAdmin, auth.ScopeFilesRead)
+		filesWrite    = authorize(auth.RoleAdmin, auth.ScopeFilesWrite)
+		agentsRead    = authorize(auth.RoleAdmin, auth.ScopeAgentsRead)
+		agentsWrite   = authorize(auth.RoleAdmin, auth.ScopeAgentsWrite)
+		aclRead       = authorize(auth.RoleViewer, auth.ScopeACLRead)
+		aclWrite      = authorize(auth.RoleAdmin, auth.ScopeACLWrite)
+		adminOnly     = authorize(auth.RoleAdmin, "")  // not accessible with API tokens
+		sessionOnly   = authorize(auth.RoleViewer, "") // any user, not accessible with API tokens
+	)
+
 	r.GET("/api/v1/version", apiV1.Version)
 
-	if auth.IsEnabled() && requireAuth {
+	if prometheus.Enabled() {
+		if authRequired {
+			r.GET("/metrics", AuthMiddleware(), metricsRead, gin.WrapF(prometheus.ServeHTTP))
+		} else {
+			r.GET("/metrics", gin.WrapF(prometheus.ServeHTTP))
+		}
+	}
+
+	if authRequired {
 		v1Auth := r.Group("/api/v1/auth")
 		{
 			v1Auth.HEAD("/check", authApi.Check)
@@ -62,11 +105,14 @@ func NewHandler(requireAuth bool) *gin.Engine {
 			v1Auth.POST("/callback", authApi.Callback)
 			v1Auth.POST("/logout", authApi.Logout)
 			v1Auth.GET("/logout", authApi.Logout)
+			v1Auth.POST("/mfa/totp", authApi.MFATOTP)
+			v1Auth.POST("/mfa/webauthn/begin", authApi.MFAWebAuthnBegin)
+			v1Auth.POST("/mfa/webauthn/finish", authApi.MFAWebAuthnFinish)
 		}
 	}
 
 	v1 := r.Group("/api/v1")
-	if auth.IsEnabled() && requireAuth {
+	if authRequired {
 		v1.Use(AuthMiddleware())
 	}
 	if common.APISkipOriginCheck {
@@ -74,13 +120,13 @@ func NewHandler(requireAuth bool) *gin.Engine {
 	}
 	{
 		// enable cache for favicon
-		v1.GET("/favicon", apiV1.FavIcon)
-		v1.GET("/health", apiV1.Health)
-		v1.GET("/icons", apiV1.Icons)
-		v1.GET("/stats", apiV1.Stats)
-		v1.GET("/events", apiV1.Events)
+		v1.GET("/favicon", routesRead, apiV1.FavIcon)
+		v1.GET("/health", routesRead, apiV1.Health)
+		v1.GET("/icons", routesRead, apiV1.Icons)
+		v1.GET("/stats", metricsRead, apiV1.Stats)
+		v1.GET("/events", metricsRead, apiV1.Events)
 
-		route := v1.Group("/route")
+		route := v1.Group("/route", routesRead)
 		{
 			route.GET("/list", routeApi.Routes)
 			route.GET("/:which", routeApi.Route)
@@ -93,42 +139,57 @@ func NewHandler(requireAuth bool) *gin.Engine {
 
 		file := v1.Group("/file")
 		{
-			file.GET("/list", fileApi.List)
-			file.GET("/content", fileApi.Get)
-			file.PUT("/content", fileApi.Set)
-			file.POST("/content", fileApi.Set)
-			file.POST("/validate", fileApi.Validate)
+			file.GET("/list", filesRead, fileApi.List)
+			file.GET("/content", filesRead, fileApi.Get)
+			file.PUT("/content", filesWrite, fileApi.Set)
+			file.POST("/content", filesWrite, fileApi.Set)
+			file.POST("/validate", filesRead, fileApi.Validate)
 		}
 
 		homepage := v1.Group("/homepage")
 		{
-			homepage.GET("/categories", homepageApi.Categories)
-			homepage.GET("/items", homepageApi.Items)
-			homepage.POST("/set/item", homepageApi.SetItem)
-			homepage.POST("/set/items_batch", homepageApi.SetItemsBatch)
-			homepage.POST("/set/item_visible", homepageApi.SetItemVisible)
-			homepage.POST("/set/item_favorite", homepageApi.SetItemFavorite)
-			homepage.POST("/set/item_sort_order", homepageApi.SetItemSortOrder)
-			homepage.POST("/set/item_all_sort_order", homepageApi.SetItemAllSortOrder)
-			homepage.POST("/set/item_fav_sort_order", homepageApi.SetItemFavSortOrder)
-			homepage.POST("/set/category_order", homepageApi.SetCategoryOrder)
-			homepage.POST("/item_click", homepageApi.ItemClick)
+			homepage.GET("/categories", homepageRead, homepageApi.Categories)
+			homepage.GET("/items", homepageRead, homepageApi.Items)
+			homepage.POST("/set/item", homepageWrite, homepageApi.SetItem)
+			homepage.POST("/set/items_batch", homepageWrite, homepageApi.SetItemsBatch)
+			homepage.POST("/set/item_visible", homepageWrite, homepageApi.SetItemVisible)
+			homepage.POST("/set/item_favorite", homepageWrite, homepageApi.SetItemFavorite)
+			homepage.POST("/set/item_sort_order", homepageWrite, homepageApi.SetItemSortOrder)
+			homepage.POST("/set/item_all_sort_order", homepageWrite, homepageApi.SetItemAllSortOrder)
+			homepage.POST("/set/item_fav_sort_order", homepageWrite, homepageApi.SetItemFavSortOrder)
+			homepage.POST("/set/category_order", homepageWrite, homepageApi.SetCategoryOrder)
+			homepage.POST("/item_click", homepageRead, homepageApi.ItemClick)
 		}
 
 		cert := v1.Group("/cert")
 		{
-			cert.GET("/info", certApi.Info)
-			cert.GET("/renew", certApi.Renew)
+			cert.GET("/info", certRead, certApi.Info)
+			cert.GET("/inventory", certRead, certApi.Inventory)
+			cert.GET("/renew", certRenew, certApi.Renew)
+			cert.GET("/internal_ca", certRead, certApi.InternalCA)
+		}
+
+		cache := v1.Group("/cache", metricsRead)
+		{
+			cache.GET("/stats", cacheApi.Stats)
 		}
 
 		agent := v1.Group("/agent")
 		{
-			agent.GET("/list", agentApi.List)
-			agent.POST("/create", agentApi.Create)
-			agent.POST("/verify", agentApi.Verify)
+			agent.GET("/list", agentsRead, agentApi.List)
+			agent.POST("/create", agentsWrite, agentApi.Create)
+			agent.POST("/verify", agentsWrite, agentApi.Verify)
+		}
+
+		acl := v1.Group("/acl")
+		{
+			acl.GET("/stats", aclRead, aclApi.Stats)
+			acl.GET("/bans", aclRead, aclApi.Bans)
+			acl.POST("/ban", aclWrite, aclApi.Ban)
+			acl.POST("/unban", aclWrite, aclApi.Unban)
 		}
 
-		metrics := v1.Group("/metrics")
+		metrics := v1.Group("/metrics", metricsRead)
 		{
 			metrics.GET("/system_info", metricsApi.SystemInfo)
 			metrics.GET("/all_system_info", metricsApi.AllSystemInfo)
@@ -137,28 +198,52 @@ func NewHandler(requireAuth bool) *gin.Engine {
 
 		docker := v1.Group("/docker")
 		{
-			docker.GET("/container/:id", dockerApi.GetContainer)
-			docker.GET("/containers", dockerApi.Containers)
-			docker.GET("/info", dockerApi.Info)
-			docker.GET("/logs/:id", dockerApi.Logs)
-			docker.POST("/start", dockerApi.Start)
-			docker.POST("/stop", dockerApi.Stop)
-			docker.POST("/restart", dockerApi.Restart)
-			docker.GET("/stats/:id", dockerApi.Stats)
+			docker.GET("/container/:id", dockerRead, dockerApi.GetContainer)
+			docker.GET("/containers", dockerRead, dockerApi.Containers)
+			docker.GET("/info", dockerRead, dockerApi.Info)
+			docker.GET("/logs/:id", dockerRead, dockerApi.Logs)
+			docker.POST("/start", dockerWrite, dockerApi.Start)
+			docker.POST("/stop", dockerWrite, dockerApi.Stop)
+			docker.POST("/restart", dockerWrite, dockerApi.Restart)
+			docker.GET("/stats/:id", dockerRead, dockerApi.Stats)
 		}
 
 		proxmox := v1.Group("/proxmox")
 		{
-			proxmox.GET("/tail", proxmoxApi.Tail)
-			proxmox.GET("/journalctl", proxmoxApi.Journalctl)
-			proxmox.GET("/journalctl/:node", proxmoxApi.Journalctl)
-			proxmox.GET("/journalctl/:node/:vmid", proxmoxApi.Journalctl)
-			proxmox.GET("/journalctl/:node/:vmid/:service", proxmoxApi.Journalctl)
-			proxmox.GET("/stats/:node", proxmoxApi.NodeStats)
-			proxmox.GET("/stats/:node/:vmid", proxmoxApi.VMStats)
-			proxmox.POST("/lxc/:node/:vmid/start", proxmoxApi.Start)
-			proxmox.POST("/lxc/:node/:vmid/stop", proxmoxApi.Stop)
-			proxmox.POST("/lxc/:node/:vmid/restart", proxmoxApi.Restart)
+			proxmox.GET("/tail", proxmoxRead, proxmoxApi.Tail)
+			proxmox.GET("/journalctl", proxmoxRead, proxmoxApi.Journalctl)
+			proxmox.GET("/journalctl/:node", proxmoxRead, proxmoxApi.Journalctl)
+			proxmox.GET("/journalctl/:node/:vmid", proxmoxRead, proxmoxApi.Journalctl)
+			proxmox.GET("/journalctl/:node/:vmid/:service", proxmoxRead, proxmoxApi.Journalctl)
+			proxmox.GET("/stats/:node", proxmoxRead, proxmoxApi.NodeStats)
+			proxmox.GET("/stats/:node/:vmid", proxmoxRead, proxmoxApi.VMStats)
+			proxmox.POST("/lxc/:node/:vmid/start", proxmoxWrite, proxmoxApi.Start)
+			proxmox.POST("/lxc/:node/:vmid/stop", proxmoxWrite, proxmoxApi.Stop)
+			proxmox.POST("/lxc/:node/:vmid/restart", proxmoxWrite, proxmoxApi.Restart)
+		}
+
+		user := v1.Group("/user")
+		{
+			user.GET("/me", userApi.Me)
+			user.GET("/list", adminOnly, userApi.List)
+			user.POST("/set", adminOnly, userApi.Set)
+			user.POST("/delete", adminOnly, userApi.Delete)
+			user.GET("/mfa", sessionOnly, userApi.MFA)
+			user.POST("/mfa/totp/enroll", sessionOnly, userApi.EnrollTOTP)
+			user.POST("/mfa/totp/confirm", sessionOnly, userApi.ConfirmTOTP)
+			user.POST("/mfa/totp/disable", sessionOnly, userApi.DisableTOTP)
+			user.POST("/mfa/recovery_codes", sessionOnly, userApi.RegenerateRecoveryCodes)
+			user.POST("/mfa/webauthn/begin", sessionOnly, userApi.BeginWebAuthn)
+			user.POST("/mfa/webauthn/finish", sessionOnly, userApi.FinishWebAuthn)
+			user.POST("/mfa/webauthn/delete", sessionOnly, userApi.DeleteWebAuthn)
+			user.POST("/mfa/reset", adminOnly, userApi.ResetMFA)
+		}
+
+		token := v1.Group("/token", adminOnly)
+		{
+			token.GET("/list", tokenApi.List)
+			token.POST("/create", tokenApi.Create)
+			token.POST("/revoke", tokenApi.Revoke)
 		}
 	}
 
@@ -179,16 +264,47 @@ func NoCache() gin.HandlerFunc {
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		err := auth.GetDefaultAuth().CheckToken(c.Request)
+		var user *auth.User
+		var err error
+		if token, ok := auth.BearerToken(c.Request); ok {
+			user, err = auth.CheckAPIToken(token)
+		} else {
+			user, err = auth.GetDefaultAuth().CheckUser(c.Request)
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, apitypes.Error("Unauthorized", err))
 			c.Abort()
 			return
 		}
+		c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), user))
 		c.Next()
 	}
 }
 
+// AuthorizeMiddleware rejects requests of users without role, or API tokens without scope,
+// it must be used after AuthMiddleware.
+func AuthorizeMiddleware(role auth.Role, scope auth.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := auth.UserFromCtx(c.Request.Context())
+		switch {
+		case user == nil:
+			c.JSON(http.StatusForbidden, apitypes.Error("Forbidden"))
+		case user.TokenID != "" && !user.Allows(role, scope):
+			if scope == "" {
+				c.JSON(http.StatusForbidden, apitypes.Error("Forbidden: not accessible with api tokens"))
+			} else {
+				c.JSON(http.StatusForbidden, apitypes.Error("Forbidden: "+string(scope)+" scope is required"))
+			}
+		case !user.Allows(role, scope):
+			c.JSON(http.StatusForbidden, apitypes.Error("Forbidden: "+string(role)+" role is required"))
+		default:
+			c.Next()
+			return
+		}
+		c.Abort()
+	}
+}
+
 func SkipOriginCheckMiddleware() gin.HandlerFunc {
 	upgrader := &websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
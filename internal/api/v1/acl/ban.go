@@ -0,0 +1,58 @@
+package aclapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/acl"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type BanRequest struct {
+	// IP address or CIDR
+	IP string `json:"ip" binding:"required"`
+	// Seconds until the ban expires
+	TTL    int    `json:"ttl" binding:"required,min=1"`
+	Reason string `json:"reason"`
+} // @name ACLBanRequest
+
+// @x-id				"ban"
+// @BasePath		/api/v1
+// @Summary		Ban an IP or CIDR
+// @Description	Deny connections from an IP or CIDR until the ban expires, without reloading the config. An existing ban of the same IP or CIDR is replaced.
+// @Tags			acl
+// @Accept			json
+// @Produce		json
+// @Param			request	body		BanRequest	true	"Request"
+// @Success		200		{object}	acl.Ban
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Failure		404		{object}	apitypes.ErrorResponse "ACL is not enabled"
+// @Router			/acl/ban [post]
+func Ban(c *gin.Context) {
+	var req BanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	// bans are enforced by the ACL, they would have no effect without it
+	if aclFromCtx(c) == nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("acl is not enabled"))
+		return
+	}
+
+	var createdBy string
+	if user := auth.UserFromCtx(c.Request.Context()); user != nil {
+		createdBy = user.Username
+	}
+
+	ban, err := acl.AddBan(req.IP, time.Duration(req.TTL)*time.Second, req.Reason, createdBy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	c.JSON(http.StatusOK, ban)
+}
@@ -0,0 +1,23 @@
+package aclapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/acl"
+
+	_ "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"bans"
+// @BasePath		/api/v1
+// @Summary		List bans
+// @Description	List active runtime bans, sorted by expiry
+// @Tags			acl
+// @Produce		json
+// @Success		200	{array}		acl.Ban
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/acl/bans [get]
+func Bans(c *gin.Context) {
+	c.JSON(http.StatusOK, acl.Bans())
+}
@@ -0,0 +1,44 @@
+package aclapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/acl"
+	acltypes "github.com/yusing/godoxy/internal/acl/types"
+	apitypes "github.com/yusing/goutils/apitypes"
+	"github.com/yusing/goutils/http/httpheaders"
+	"github.com/yusing/goutils/http/websocket"
+)
+
+// @x-id				"stats"
+// @BasePath		/api/v1
+// @Summary		Get ACL stats
+// @Description	Get rule hits, top blocked IPs and countries, and allowed and denied connections per minute of the last hour
+// @Tags			acl,websocket
+// @Produce		json
+// @Success		200	{object}	acl.Stats
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse "ACL is not enabled"
+// @Router			/acl/stats [get]
+func Stats(c *gin.Context) {
+	cfg := aclFromCtx(c)
+	if cfg == nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("acl is not enabled"))
+		return
+	}
+
+	if httpheaders.IsWebsocket(c.Request.Header) {
+		websocket.PeriodicWrite(c, time.Second, func() (any, error) {
+			return cfg.Stats(), nil
+		})
+	} else {
+		c.JSON(http.StatusOK, cfg.Stats())
+	}
+}
+
+func aclFromCtx(c *gin.Context) *acl.Config {
+	cfg, _ := acltypes.FromCtx(c.Request.Context()).(*acl.Config)
+	return cfg
+}
@@ -0,0 +1,46 @@
+package aclapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/acl"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type UnbanRequest struct {
+	// IP address or CIDR of the ban
+	IP string `json:"ip" binding:"required"`
+} // @name ACLUnbanRequest
+
+// @x-id				"unban"
+// @BasePath		/api/v1
+// @Summary		Lift a ban
+// @Description	Lift the ban of an IP or CIDR, it takes effect immediately
+// @Tags			acl
+// @Accept			json
+// @Produce		json
+// @Param			request	body		UnbanRequest	true	"Request"
+// @Success		200		{object}	apitypes.SuccessResponse
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Failure		404		{object}	apitypes.ErrorResponse
+// @Router			/acl/unban [post]
+func Unban(c *gin.Context) {
+	var req UnbanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	err := acl.RemoveBan(req.IP)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, apitypes.Success("ban lifted"))
+	case errors.Is(err, acl.ErrBanNotFound):
+		c.JSON(http.StatusNotFound, apitypes.Error("ban not found", err))
+	default:
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+	}
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+)
+
+// userPassAuth returns the username/password provider, or responds 400 if second factors are not supported.
+func userPassAuth(c *gin.Context) (*auth.UserPassAuth, bool) {
+	userpass, ok := auth.GetDefaultAuth().(*auth.UserPassAuth)
+	if !ok {
+		c.String(http.StatusBadRequest, "second factors are only supported for username/password authentication")
+		return nil, false
+	}
+	return userpass, true
+}
+
+// @x-id				"mfaTOTP"
+// @Base			/api/v1
+// @Summary		Verify TOTP code
+// @Description	Completes a login pending a second factor with a TOTP code or a recovery code
+// @Tags			auth
+// @Accept			json
+// @Produce		plain
+// @Param			body	body		auth.MFAVerifyRequest	true	"TOTP code or recovery code"
+// @Success		200		{string}	string	"OK"
+// @Failure		400		{string}	string	"invalid request / code"
+// @Failure		401		{string}	string	"login required"
+// @Failure		429		{string}	string	"too many failed attempts"
+// @Router			/auth/mfa/totp [post]
+func MFATOTP(c *gin.Context) {
+	if userpass, ok := userPassAuth(c); ok {
+		userpass.VerifyTOTPHandler(c.Writer, c.Request)
+	}
+}
+
+// @x-id				"mfaWebAuthnBegin"
+// @Base			/api/v1
+// @Summary		Begin WebAuthn login
+// @Description	Returns the options of navigator.credentials.get for a login pending a second factor
+// @Tags			auth
+// @Produce		json
+// @Success		200	{object}	auth.WebAuthnRequestOptions
+// @Failure		400	{string}	string	"no webauthn credential registered"
+// @Failure		401	{string}	string	"login required"
+// @Failure		429	{string}	string	"too many failed attempts"
+// @Router			/auth/mfa/webauthn/begin [post]
+func MFAWebAuthnBegin(c *gin.Context) {
+	if userpass, ok := userPassAuth(c); ok {
+		userpass.WebAuthnLoginBeginHandler(c.Writer, c.Request)
+	}
+}
+
+// @x-id				"mfaWebAuthnFinish"
+// @Base			/api/v1
+// @Summary		Finish WebAuthn login
+// @Description	Completes a login pending a second factor with the credential returned by navigator.credentials.get
+// @Tags			auth
+// @Accept			json
+// @Produce		plain
+// @Param			body	body		auth.WebAuthnAssertion	true	"PublicKeyCredential.toJSON()"
+// @Success		200		{string}	string	"OK"
+// @Failure		400		{string}	string	"invalid request / webauthn response"
+// @Failure		401		{string}	string	"login required"
+// @Failure		429		{string}	string	"too many failed attempts"
+// @Router			/auth/mfa/webauthn/finish [post]
+func MFAWebAuthnFinish(c *gin.Context) {
+	if userpass, ok := userPassAuth(c); ok {
+		userpass.WebAuthnLoginFinishHandler(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,32 @@
+package cacheapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/net/gphttp/httpcache"
+	"github.com/yusing/goutils/http/httpheaders"
+	"github.com/yusing/goutils/http/websocket"
+
+	_ "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"stats"
+// @BasePath		/api/v1
+// @Summary		Get HTTP cache stats
+// @Description	Get hit ratios and stored responses of routes using the cache middleware
+// @Tags			cache,websocket
+// @Produce		json
+// @Success		200	{array}		httpcache.Stats
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/cache/stats [get]
+func Stats(c *gin.Context) {
+	if httpheaders.IsWebsocket(c.Request.Header) {
+		websocket.PeriodicWrite(c, time.Second, func() (any, error) {
+			return httpcache.AllStats(), nil
+		})
+	} else {
+		c.JSON(http.StatusOK, httpcache.AllStats())
+	}
+}
@@ -0,0 +1,43 @@
+package certapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/autocert"
+	autocertctx "github.com/yusing/godoxy/internal/autocert/types"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"internalCA"
+// @BasePath		/api/v1
+// @Summary		Download internal CA certificate
+// @Description	Download the root certificate of the internal CA, for clients to trust certificates issued by it
+// @Tags			cert
+// @Produce		application/x-pem-file
+// @Success		200	{string}	application/x-pem-file	"PEM encoded root certificate"
+// @Failure		403	{object}	apitypes.ErrorResponse "Unauthorized"
+// @Failure		404	{object}	apitypes.ErrorResponse "Internal CA or autocert is not enabled"
+// @Failure		500	{object}	apitypes.ErrorResponse "Internal server error"
+// @Router		/cert/internal_ca [get]
+func InternalCA(c *gin.Context) {
+	provider := autocertctx.FromCtx(c.Request.Context())
+	if provider == nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("autocert is not enabled"))
+		return
+	}
+
+	cert, err := provider.GetInternalCACert()
+	if err != nil {
+		if errors.Is(err, autocert.ErrNoInternalCA) {
+			c.JSON(http.StatusNotFound, apitypes.Error("internal CA is not enabled"))
+			return
+		}
+		c.Error(apitypes.InternalServerError(err, "failed to get internal CA certificate"))
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="godoxy-internal-ca.crt"`)
+	c.Data(http.StatusOK, "application/x-pem-file", cert)
+}
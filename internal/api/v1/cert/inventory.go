@@ -0,0 +1,33 @@
+package certapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	autocertctx "github.com/yusing/godoxy/internal/autocert/types"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"inventory"
+// @BasePath		/api/v1
+// @Summary		Get cert inventory
+// @Description	List certificates of all providers and on demand certificates, with expiry and renewal status
+// @Tags			cert
+// @Produce		json
+// @Success		200	{array}	  autocert.CertInventoryItem
+// @Failure		403	{object}	apitypes.ErrorResponse "Unauthorized"
+// @Failure		404	{object}	apitypes.ErrorResponse "Autocert is not enabled"
+// @Router		/cert/inventory [get]
+func Inventory(c *gin.Context) {
+	provider := autocertctx.FromCtx(c.Request.Context())
+	if provider == nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("autocert is not enabled"))
+		return
+	}
+
+	items := provider.GetCertInventory()
+	if items == nil {
+		items = []autocertctx.CertInventoryItem{}
+	}
+	c.JSON(http.StatusOK, items)
+}
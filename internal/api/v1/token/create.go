@@ -0,0 +1,65 @@
+package tokenapi
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type CreateAPITokenRequest struct {
+	Name   string       `json:"name" binding:"required"`
+	Scopes []auth.Scope `json:"scopes" binding:"required"`
+	// Days until the token expires, 0 for never
+	ExpiresInDays int `json:"expires_in_days" binding:"gte=0"`
+} // @name CreateAPITokenRequest
+
+type CreateAPITokenResponse struct {
+	// The bearer token, it is only shown once
+	Token    string        `json:"token"`
+	APIToken auth.APIToken `json:"api_token"`
+} // @name CreateAPITokenResponse
+
+// @x-id				"create"
+// @BasePath		/api/v1
+// @Summary		Create an API token
+// @Description	Create a long-lived API token with scopes, used with the `Authorization: Bearer <token>` header, only by admins of username/password authentication
+// @Tags			token
+// @Accept			json
+// @Produce		json
+// @Param			request	body		CreateAPITokenRequest	true	"Request"
+// @Success		200		{object}	CreateAPITokenResponse
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Failure		500		{object}	apitypes.ErrorResponse
+// @Router			/token/create [post]
+func Create(c *gin.Context) {
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	var createdBy string
+	if user := auth.UserFromCtx(c.Request.Context()); user != nil {
+		createdBy = user.Username
+	}
+
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	token, info, err := auth.NewAPIToken(req.Name, req.Scopes, ttl, createdBy)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, CreateAPITokenResponse{Token: token, APIToken: *info})
+	case errors.Is(err, auth.ErrAPITokenCreator):
+		c.JSON(http.StatusForbidden, apitypes.Error("forbidden", err))
+	case errors.Is(err, auth.ErrTokenNameRequired),
+		errors.Is(err, auth.ErrScopesRequired),
+		errors.Is(err, auth.ErrInvalidScope):
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+	default:
+		c.Error(apitypes.InternalServerError(err, "failed to create api token"))
+	}
+}
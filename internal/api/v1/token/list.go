@@ -0,0 +1,23 @@
+package tokenapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+
+	_ "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"list"
+// @BasePath		/api/v1
+// @Summary		List API tokens
+// @Description	List API tokens with their scopes, expiry and last used time, the tokens themselves are not included
+// @Tags			token
+// @Produce		json
+// @Success		200	{array}		auth.APIToken
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/token/list [get]
+func List(c *gin.Context) {
+	c.JSON(http.StatusOK, auth.ListAPITokens())
+}
@@ -0,0 +1,40 @@
+package tokenapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type RevokeAPITokenRequest struct {
+	ID string `json:"id" binding:"required"`
+} // @name RevokeAPITokenRequest
+
+// @x-id				"revoke"
+// @BasePath		/api/v1
+// @Summary		Revoke an API token
+// @Description	Revoke an API token by id, it cannot be used from now on
+// @Tags			token
+// @Accept			json
+// @Produce		json
+// @Param			request	body		RevokeAPITokenRequest	true	"Request"
+// @Success		200		{object}	apitypes.SuccessResponse
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Failure		404		{object}	apitypes.ErrorResponse
+// @Router			/token/revoke [post]
+func Revoke(c *gin.Context) {
+	var req RevokeAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	if err := auth.RevokeAPIToken(req.ID); err != nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("api token not found", err))
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("api token revoked"))
+}
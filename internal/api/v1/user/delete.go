@@ -0,0 +1,40 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type DeleteUserRequest struct {
+	Username string `json:"username" binding:"required"`
+} // @name DeleteUserRequest
+
+// @x-id				"delete"
+// @BasePath		/api/v1
+// @Summary		Delete a user
+// @Description	Delete a user of username/password authentication, the user is logged out immediately
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body		DeleteUserRequest	true	"Request"
+// @Success		200		{object}	apitypes.SuccessResponse
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Failure		404		{object}	apitypes.ErrorResponse
+// @Router			/user/delete [post]
+func Delete(c *gin.Context) {
+	var req DeleteUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	if err := auth.DeleteUser(req.Username); err != nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("user not found", err))
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("user deleted"))
+}
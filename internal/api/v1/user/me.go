@@ -0,0 +1,27 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+
+	_ "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"me"
+// @BasePath		/api/v1
+// @Summary		Get current user
+// @Description	Get the username and role of the current user, the role is admin if authentication is disabled
+// @Tags			user
+// @Produce		json
+// @Success		200	{object}	auth.User
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/user/me [get]
+func Me(c *gin.Context) {
+	user := auth.UserFromCtx(c.Request.Context())
+	if user == nil {
+		user = &auth.User{Role: auth.RoleAdmin}
+	}
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,63 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type ResetMFARequest struct {
+	Username string `json:"username" binding:"required"`
+} // @name ResetMFARequest
+
+// mfaUsername returns the username of the current user, or responds 400 if second factors are not supported.
+func mfaUsername(c *gin.Context) (string, bool) {
+	user := auth.UserFromCtx(c.Request.Context())
+	if _, ok := auth.GetDefaultAuth().(*auth.UserPassAuth); !ok || user == nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("second factors are only supported for username/password authentication"))
+		return "", false
+	}
+	return user.Username, true
+}
+
+// @x-id				"mfa"
+// @BasePath		/api/v1
+// @Summary		Get second factors
+// @Description	Get the second factors enabled for the current user
+// @Tags			user
+// @Produce		json
+// @Success		200	{object}	auth.MFAStatus
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/user/mfa [get]
+func MFA(c *gin.Context) {
+	username, ok := mfaUsername(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, auth.GetMFAStatus(username))
+}
+
+// @x-id				"mfaReset"
+// @BasePath		/api/v1
+// @Summary		Reset second factors of a user
+// @Description	Disable all second factors of a user who lost their authenticators and recovery codes
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body		ResetMFARequest	true	"Request"
+// @Success		200		{object}	apitypes.SuccessResponse
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Router			/user/mfa/reset [post]
+func ResetMFA(c *gin.Context) {
+	var req ResetMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	auth.ResetMFA(req.Username)
+	c.JSON(http.StatusOK, apitypes.Success("second factors reset"))
+}
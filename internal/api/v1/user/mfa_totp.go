@@ -0,0 +1,113 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type ConfirmTOTPRequest struct {
+	// Code generated from the secret of the pending enrollment
+	Code string `json:"code" binding:"required"`
+} // @name ConfirmTOTPRequest
+
+type RecoveryCodesResponse struct {
+	// Single-use codes to log in without the authenticator, they are only shown once
+	RecoveryCodes []string `json:"recovery_codes"`
+} // @name RecoveryCodesResponse
+
+// @x-id				"mfaTOTPEnroll"
+// @BasePath		/api/v1
+// @Summary		Begin TOTP enrollment
+// @Description	Generate a TOTP secret for the current user, it is enabled after confirmed with a code
+// @Tags			user
+// @Produce		json
+// @Success		200	{object}	auth.TOTPEnrollment
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/user/mfa/totp/enroll [post]
+func EnrollTOTP(c *gin.Context) {
+	username, ok := mfaUsername(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, auth.BeginTOTPEnrollment(username))
+}
+
+// @x-id				"mfaTOTPConfirm"
+// @BasePath		/api/v1
+// @Summary		Confirm TOTP enrollment
+// @Description	Enable the pending TOTP secret of the current user, and return new recovery codes
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body		ConfirmTOTPRequest	true	"Request"
+// @Success		200		{object}	RecoveryCodesResponse
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Router			/user/mfa/totp/confirm [post]
+func ConfirmTOTP(c *gin.Context) {
+	username, ok := mfaUsername(c)
+	if !ok {
+		return
+	}
+	var req ConfirmTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	codes, err := auth.ConfirmTOTPEnrollment(username, req.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("failed to enable totp", err))
+		return
+	}
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @x-id				"mfaTOTPDisable"
+// @BasePath		/api/v1
+// @Summary		Disable TOTP
+// @Description	Disable TOTP of the current user, and delete its recovery codes
+// @Tags			user
+// @Produce		json
+// @Success		200	{object}	apitypes.SuccessResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/user/mfa/totp/disable [post]
+func DisableTOTP(c *gin.Context) {
+	username, ok := mfaUsername(c)
+	if !ok {
+		return
+	}
+	if err := auth.DisableTOTP(username); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("failed to disable totp", err))
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("totp disabled"))
+}
+
+// @x-id				"mfaRecoveryCodes"
+// @BasePath		/api/v1
+// @Summary		Regenerate recovery codes
+// @Description	Replace the recovery codes of the current user, the old codes cannot be used from now on
+// @Tags			user
+// @Produce		json
+// @Success		200	{object}	RecoveryCodesResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/user/mfa/recovery_codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	username, ok := mfaUsername(c)
+	if !ok {
+		return
+	}
+	codes, err := auth.RegenerateRecoveryCodes(username)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("failed to regenerate recovery codes", err))
+		return
+	}
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
@@ -0,0 +1,100 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type RegisterWebAuthnRequest struct {
+	// Name of the credential, e.g. the device name
+	Name string `json:"name" binding:"required"`
+	// PublicKeyCredential.toJSON() of the credential returned by navigator.credentials.create
+	Credential auth.WebAuthnRegistration `json:"credential" binding:"required"`
+} // @name RegisterWebAuthnRequest
+
+type DeleteWebAuthnRequest struct {
+	ID string `json:"id" binding:"required"`
+} // @name DeleteWebAuthnRequest
+
+// @x-id				"mfaWebAuthnBegin"
+// @BasePath		/api/v1
+// @Summary		Begin WebAuthn registration
+// @Description	Returns the options of navigator.credentials.create to register a passkey or security key for the current user
+// @Tags			user
+// @Produce		json
+// @Success		200	{object}	auth.WebAuthnCreationOptions
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/user/mfa/webauthn/begin [post]
+func BeginWebAuthn(c *gin.Context) {
+	username, ok := mfaUsername(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, auth.BeginWebAuthnRegistration(c.Request, username))
+}
+
+// @x-id				"mfaWebAuthnFinish"
+// @BasePath		/api/v1
+// @Summary		Finish WebAuthn registration
+// @Description	Verify and register the credential created with the options of /user/mfa/webauthn/begin
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body		RegisterWebAuthnRequest	true	"Request"
+// @Success		200		{object}	auth.WebAuthnCredential
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Router			/user/mfa/webauthn/finish [post]
+func FinishWebAuthn(c *gin.Context) {
+	username, ok := mfaUsername(c)
+	if !ok {
+		return
+	}
+	var req RegisterWebAuthnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	cred, err := auth.FinishWebAuthnRegistration(c.Request, username, req.Name, &req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("failed to register webauthn credential", err))
+		return
+	}
+	c.JSON(http.StatusOK, cred)
+}
+
+// @x-id				"mfaWebAuthnDelete"
+// @BasePath		/api/v1
+// @Summary		Delete a WebAuthn credential
+// @Description	Delete a passkey or security key of the current user
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body		DeleteWebAuthnRequest	true	"Request"
+// @Success		200		{object}	apitypes.SuccessResponse
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Failure		404		{object}	apitypes.ErrorResponse
+// @Router			/user/mfa/webauthn/delete [post]
+func DeleteWebAuthn(c *gin.Context) {
+	username, ok := mfaUsername(c)
+	if !ok {
+		return
+	}
+	var req DeleteWebAuthnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	if err := auth.DeleteWebAuthnCredential(username, req.ID); err != nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("webauthn credential not found", err))
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("webauthn credential deleted"))
+}
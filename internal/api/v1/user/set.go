@@ -0,0 +1,52 @@
+package userapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type SetUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	// Password of the user, leave empty to keep the password of an existing user
+	Password string    `json:"password"`
+	Role     auth.Role `json:"role" binding:"required"`
+} // @name SetUserRequest
+
+// @x-id				"set"
+// @BasePath		/api/v1
+// @Summary		Create or update a user
+// @Description	Create or update a user of username/password authentication
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body		SetUserRequest	true	"Request"
+// @Success		200		{object}	apitypes.SuccessResponse
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Failure		500		{object}	apitypes.ErrorResponse
+// @Router			/user/set [post]
+func Set(c *gin.Context) {
+	var req SetUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	err := auth.SetUser(req.Username, req.Password, req.Role)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, apitypes.Success("user updated"))
+	case errors.Is(err, auth.ErrUsernameRequired),
+		errors.Is(err, auth.ErrUsernameMalformed),
+		errors.Is(err, auth.ErrReservedUsername),
+		errors.Is(err, auth.ErrPasswordRequired),
+		errors.Is(err, auth.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+	default:
+		c.Error(apitypes.InternalServerError(err, "failed to update user"))
+	}
+}
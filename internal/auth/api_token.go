@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/jsonstore"
+)
+
+type (
+	// Scope is a permission of an API token, in the form of `<resource>:<action>`.
+	Scope string // @name APITokenScope
+
+	// APIToken is a long-lived bearer token for automation and the CLI.
+	APIToken struct {
+		ID         string    `json:"id"`
+		Name       string    `json:"name"`
+		Scopes     []Scope   `json:"scopes"`
+		CreatedBy  string    `json:"created_by"`
+		CreatedAt  time.Time `json:"created_at"`
+		ExpiresAt  time.Time `json:"expires_at,omitzero"`
+		LastUsedAt time.Time `json:"last_used_at,omitzero"`
+	} // @name APIToken
+
+	// storedAPIToken is an API token with the SHA-256 hash of its secret, the secret itself is never stored.
+	storedAPIToken struct {
+		APIToken
+		SecretHash string `json:"secret_hash"`
+	}
+)
+
+const (
+	// ScopeAll grants all scopes.
+	ScopeAll           Scope = "*"
+	ScopeRoutesRead    Scope = "routes:read"
+	ScopeMetricsRead   Scope = "metrics:read"
+	ScopeHomepageRead  Scope = "homepage:read"
+	ScopeHomepageWrite Scope = "homepage:write"
+	ScopeDockerRead    Scope = "docker:read"
+	ScopeDockerWrite   Scope = "docker:write"
+	ScopeProxmoxRead   Scope = "proxmox:read"
+	ScopeProxmoxWrite  Scope = "proxmox:write"
+	ScopeCertRead      Scope = "cert:read"
+	ScopeCertRenew     Scope = "cert:renew"
+	ScopeFilesRead     Scope = "files:read"
+	ScopeFilesWrite    Scope = "files:write"
+	ScopeAgentsRead    Scope = "agents:read"
+	ScopeAgentsWrite   Scope = "agents:write"
+	ScopeACLRead       Scope = "acl:read"
+	ScopeACLWrite      Scope = "acl:write"
+)
+
+var AllScopes = []Scope{
+	ScopeAll,
+	ScopeRoutesRead,
+	ScopeMetricsRead,
+	ScopeHomepageRead,
+	ScopeHomepageWrite,
+	ScopeDockerRead,
+	ScopeDockerWrite,
+	ScopeProxmoxRead,
+	ScopeProxmoxWrite,
+	ScopeCertRead,
+	ScopeCertRenew,
+	ScopeFilesRead,
+	ScopeFilesWrite,
+	ScopeAgentsRead,
+	ScopeAgentsWrite,
+	ScopeACLRead,
+	ScopeACLWrite,
+}
+
+const (
+	apiTokenPrefix = "gdx_"
+	// last used time is updated at most once per interval to avoid a store update on every request
+	apiTokenLastUsedInterval = time.Minute
+)
+
+var apiTokens = jsonstore.Store[*storedAPIToken](common.NamespaceAPITokens)
+
+var (
+	ErrInvalidScope      = errors.New("invalid scope")
+	ErrScopesRequired    = errors.New("at least one scope is required")
+	ErrTokenNameRequired = errors.New("token name is required")
+	ErrAPITokenNotFound  = errors.New("api token not found")
+	ErrInvalidAPIToken   = errors.New("invalid api token")
+	ErrAPITokenExpired   = errors.New("api token expired")
+	// ErrAPITokenCreator is returned when the creator is not an admin of username/password authentication,
+	// the role of OIDC and LDAP users cannot be checked when their tokens are used.
+	ErrAPITokenCreator = errors.New("api tokens can only be created by local admins")
+)
+
+func (s Scope) IsValid() bool {
+	return slices.Contains(AllScopes, s)
+}
+
+// BearerToken returns the token of the `Authorization: Bearer` header.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// NewAPIToken creates an API token and returns the token, which is only available here.
+//
+// A zero ttl creates a token that never expires. createdBy must be a local admin, see isLocalAdmin.
+func NewAPIToken(name string, scopes []Scope, ttl time.Duration, createdBy string) (string, *APIToken, error) {
+	if !isLocalAdmin(createdBy) {
+		return "", nil, fmt.Errorf("%w: %q", ErrAPITokenCreator, createdBy)
+	}
+	if name == "" {
+		return "", nil, ErrTokenNameRequired
+	}
+	if len(scopes) == 0 {
+		return "", nil, ErrScopesRequired
+	}
+	for _, scope := range scopes {
+		if !scope.IsValid() {
+			return "", nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	_, _ = rand.Read(id)
+	_, _ = rand.Read(secret)
+
+	now := time.Now()
+	stored := &storedAPIToken{
+		APIToken: APIToken{
+			ID:        hex.EncodeToString(id),
+			Name:      name,
+			Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+			CreatedBy: createdBy,
+			CreatedAt: now,
+		},
+		SecretHash: hashAPITokenSecret(secret),
+	}
+	if ttl > 0 {
+		stored.ExpiresAt = now.Add(ttl)
+	}
+	apiTokens.Store(stored.ID, stored)
+
+	log.Info().Str("id", stored.ID).Str("name", name).Str("created_by", createdBy).Msg("api token created")
+	token := apiTokenPrefix + stored.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	info := stored.APIToken
+	return token, &info, nil
+}
+
+// ListAPITokens returns the API tokens sorted by creation time.
+func ListAPITokens() []APIToken {
+	list := make([]APIToken, 0, apiTokens.Size())
+	for _, token := range apiTokens.Range {
+		list = append(list, token.APIToken)
+	}
+	slices.SortFunc(list, func(a, b APIToken) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return list
+}
+
+// RevokeAPIToken deletes the API token with id, it cannot be used from now on.
+func RevokeAPIToken(id string) error {
+	if _, ok := apiTokens.LoadAndDelete(id); !ok {
+		return fmt.Errorf("%w: %s", ErrAPITokenNotFound, id)
+	}
+	log.Info().Str("id", id).Msg("api token revoked")
+	return nil
+}
+
+// revokeAPITokensOf deletes the API tokens created by username,
+// when the user is deleted or is no longer an admin.
+func revokeAPITokensOf(username string) {
+	for id, token := range apiTokens.Range {
+		if token.CreatedBy == username {
+			apiTokens.Delete(id)
+			log.Info().Str("id", id).Str("created_by", username).Msg("api token revoked")
+		}
+	}
+}
+
+// isLocalAdmin reports whether username is an admin of username/password authentication: the user
+// from environment variables or a stored admin. Users of OIDC and LDAP are not, since they can be
+// demoted or removed by the identity provider without GoDoxy knowing.
+func isLocalAdmin(username string) bool {
+	if IsOIDCEnabled() || IsLDAPEnabled() {
+		return false
+	}
+	if username == common.APIUser {
+		return true
+	}
+	user, ok := users.Load(username)
+	return ok && user.Role == RoleAdmin
+}
+
+// CheckAPIToken validates token and returns the API token user with the scopes of the token.
+//
+// The token is invalid if its creator is no longer a local admin.
+func CheckAPIToken(token string) (*User, error) {
+	rest, ok := strings.CutPrefix(token, apiTokenPrefix)
+	if !ok {
+		return nil, ErrInvalidAPIToken
+	}
+	id, encodedSecret, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, ErrInvalidAPIToken
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(encodedSecret)
+	if err != nil {
+		return nil, ErrInvalidAPIToken
+	}
+	stored, ok := apiTokens.Load(id)
+	if !ok || subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(secret)), []byte(stored.SecretHash)) != 1 {
+		return nil, ErrInvalidAPIToken
+	}
+	if !isLocalAdmin(stored.CreatedBy) {
+		return nil, fmt.Errorf("%w: %s: creator %q is not a local admin", ErrInvalidAPIToken, stored.Name, stored.CreatedBy)
+	}
+
+	now := time.Now()
+	if !stored.ExpiresAt.IsZero() && now.After(stored.ExpiresAt) {
+		return nil, fmt.Errorf("%w: %s", ErrAPITokenExpired, stored.Name)
+	}
+	if now.Sub(stored.LastUsedAt) >= apiTokenLastUsedInterval {
+		touchAPIToken(id, now)
+	}
+	return &User{Username: stored.CreatedBy, TokenID: stored.ID, Scopes: stored.Scopes}, nil
+}
+
+// touchAPIToken updates the last used time of the API token, stored tokens are immutable
+// so the store can be saved concurrently.
+func touchAPIToken(id string, now time.Time) {
+	apiTokens.Compute(id, func(old *storedAPIToken, loaded bool) (*storedAPIToken, xsync.ComputeOp) {
+		if !loaded {
+			return old, xsync.CancelOp
+		}
+		updated := *old
+		updated.LastUsedAt = now
+		return &updated, xsync.UpdateOp
+	})
+}
+
+// hashAPITokenSecret returns the hex encoded SHA-256 hash of secret, tokens are random
+// and long enough that a slow password hash is not needed.
+func hashAPITokenSecret(secret []byte) string {
+	hash := sha256.Sum256(secret)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yusing/godoxy/internal/common"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestAPIToken(t *testing.T) {
+	token, info, err := NewAPIToken("ci", []Scope{ScopeDockerWrite, ScopeRoutesRead, ScopeDockerWrite}, 0, "admin")
+	expect.NoError(t, err)
+	t.Cleanup(func() { _ = RevokeAPIToken(info.ID) })
+
+	expect.True(t, strings.HasPrefix(token, apiTokenPrefix+info.ID+"_"))
+	expect.Equal(t, info.Scopes, []Scope{ScopeDockerWrite, ScopeRoutesRead})
+	expect.True(t, info.ExpiresAt.IsZero())
+
+	// only the hash of the secret is stored
+	stored, ok := apiTokens.Load(info.ID)
+	expect.True(t, ok)
+	expect.False(t, strings.Contains(token, stored.SecretHash))
+
+	user, err := CheckAPIToken(token)
+	expect.NoError(t, err)
+	expect.Equal(t, user.Username, "admin")
+	expect.Equal(t, user.TokenID, info.ID)
+	expect.True(t, user.Allows(RoleAdmin, ScopeDockerWrite))
+	expect.False(t, user.Allows(RoleViewer, ScopeDockerRead))
+	expect.False(t, user.Allows(RoleViewer, ""))
+
+	// last used time is tracked
+	list := ListAPITokens()
+	expect.Equal(t, len(list), 1)
+	expect.False(t, list[0].LastUsedAt.IsZero())
+
+	_, err = CheckAPIToken(token + "x")
+	expect.ErrorIs(t, ErrInvalidAPIToken, err)
+	_, err = CheckAPIToken(apiTokenPrefix + info.ID)
+	expect.ErrorIs(t, ErrInvalidAPIToken, err)
+	_, err = CheckAPIToken("not-a-token")
+	expect.ErrorIs(t, ErrInvalidAPIToken, err)
+
+	expect.NoError(t, RevokeAPIToken(info.ID))
+	expect.ErrorIs(t, ErrAPITokenNotFound, RevokeAPIToken(info.ID))
+	_, err = CheckAPIToken(token)
+	expect.ErrorIs(t, ErrInvalidAPIToken, err)
+}
+
+func TestAPITokenExpired(t *testing.T) {
+	token, info, err := NewAPIToken("expired", []Scope{ScopeAll}, time.Nanosecond, "admin")
+	expect.NoError(t, err)
+	t.Cleanup(func() { _ = RevokeAPIToken(info.ID) })
+
+	time.Sleep(time.Millisecond)
+	_, err = CheckAPIToken(token)
+	expect.ErrorIs(t, ErrAPITokenExpired, err)
+}
+
+func TestAPITokenCreatorRevoked(t *testing.T) {
+	expect.NoError(t, SetUser("token-admin", "password", RoleAdmin))
+	t.Cleanup(func() { _ = DeleteUser("token-admin") })
+
+	newToken := func() string {
+		token, info, err := NewAPIToken("ci", []Scope{ScopeAll}, 0, "token-admin")
+		expect.NoError(t, err)
+		t.Cleanup(func() { _ = RevokeAPIToken(info.ID) })
+		return token
+	}
+
+	t.Run("role downgraded", func(t *testing.T) {
+		token := newToken()
+		expect.NoError(t, SetUser("token-admin", "", RoleAdmin))
+		_, err := CheckAPIToken(token)
+		expect.NoError(t, err)
+
+		expect.NoError(t, SetUser("token-admin", "", RoleOperator))
+		_, err = CheckAPIToken(token)
+		expect.ErrorIs(t, ErrInvalidAPIToken, err)
+	})
+
+	t.Run("user deleted", func(t *testing.T) {
+		expect.NoError(t, SetUser("token-admin", "", RoleAdmin))
+		token := newToken()
+		expect.NoError(t, DeleteUser("token-admin"))
+		_, err := CheckAPIToken(token)
+		expect.ErrorIs(t, ErrInvalidAPIToken, err)
+	})
+}
+
+func TestAPITokenNonLocalCreator(t *testing.T) {
+	t.Run("not a local admin", func(t *testing.T) {
+		_, _, err := NewAPIToken("ci", []Scope{ScopeAll}, 0, "idp-user")
+		expect.ErrorIs(t, ErrAPITokenCreator, err)
+	})
+
+	t.Run("identity provider enabled", func(t *testing.T) {
+		token, info, err := NewAPIToken("ci", []Scope{ScopeAll}, 0, "admin")
+		expect.NoError(t, err)
+		t.Cleanup(func() { _ = RevokeAPIToken(info.ID) })
+
+		ldapURL := common.LDAPURL
+		common.LDAPURL = "ldap://ldap.example.com"
+		t.Cleanup(func() { common.LDAPURL = ldapURL })
+
+		// the admin may be a user of the directory, demoted or removed there
+		_, _, err = NewAPIToken("ci", []Scope{ScopeAll}, 0, "admin")
+		expect.ErrorIs(t, ErrAPITokenCreator, err)
+		_, err = CheckAPIToken(token)
+		expect.ErrorIs(t, ErrInvalidAPIToken, err)
+	})
+}
+
+func TestAPITokenInvalid(t *testing.T) {
+	_, _, err := NewAPIToken("", []Scope{ScopeAll}, 0, "admin")
+	expect.ErrorIs(t, ErrTokenNameRequired, err)
+	_, _, err = NewAPIToken("ci", nil, 0, "admin")
+	expect.ErrorIs(t, ErrScopesRequired, err)
+	_, _, err = NewAPIToken("ci", []Scope{"docker:delete"}, 0, "admin")
+	expect.ErrorIs(t, ErrInvalidScope, err)
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{"", "", false},
+		{"Bearer gdx_abc", "gdx_abc", true},
+		{"bearer gdx_abc", "gdx_abc", true},
+		{"Basic dXNlcjpwYXNz", "", false},
+		{"Bearer ", "", false},
+	}
+	for _, tt := range tests {
+		req := &http.Request{Header: http.Header{}}
+		req.Header.Set("Authorization", tt.header)
+		token, ok := BearerToken(req)
+		expect.Equal(t, token, tt.want)
+		expect.Equal(t, ok, tt.ok)
+	}
+}
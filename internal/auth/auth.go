@@ -18,6 +18,8 @@ func Initialize() error {
 	// Initialize OIDC if configured.
 	if common.OIDCIssuerURL != "" {
 		defaultAuth, err = NewOIDCProviderFromEnv()
+	} else if IsLDAPEnabled() {
+		defaultAuth, err = NewLDAPProviderFromEnv()
 	} else {
 		defaultAuth, err = NewUserPassAuthFromEnv()
 	}
@@ -30,13 +32,17 @@ func GetDefaultAuth() Provider {
 }
 
 func IsEnabled() bool {
-	return !common.DebugDisableAuth && (common.APIJWTSecret != nil || IsOIDCEnabled())
+	return !common.DebugDisableAuth && (common.APIJWTSecret != nil || IsOIDCEnabled() || IsLDAPEnabled())
 }
 
 func IsOIDCEnabled() bool {
 	return common.OIDCIssuerURL != ""
 }
 
+func IsLDAPEnabled() bool {
+	return common.LDAPURL != ""
+}
+
 type nextHandler struct{}
 
 var nextHandlerContextKey = nextHandler{}
@@ -21,3 +21,20 @@ func WriteBlockPage(w http.ResponseWriter, status int, errorMessage, actionText,
 		"ActionText": actionText,
 	})
 }
+
+//go:embed ldap_login.html
+var ldapLoginPageHTML string
+
+var ldapLoginPageTemplate = template.Must(template.New("ldap_login").Parse(ldapLoginPageHTML))
+
+// WriteLDAPLoginPage writes the login form of the ldap middleware, which redirects to redirect after login.
+func WriteLDAPLoginPage(w http.ResponseWriter, status int, errorMessage, redirect string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	ldapLoginPageTemplate.Execute(w, map[string]string{
+		"Action":   LDAPLoginPath,
+		"Error":    errorMessage,
+		"Redirect": redirect,
+	})
+}
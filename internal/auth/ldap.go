@@ -0,0 +1,509 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/common"
+	httputils "github.com/yusing/goutils/http"
+)
+
+type (
+	// LDAPConfig is the directory to authenticate users against.
+	LDAPConfig struct {
+		// ldap:// or ldaps:// URL of the server
+		URL string
+		// upgrade ldap:// connections with StartTLS
+		StartTLS  bool
+		TLSConfig *tls.Config
+		// DN and password of the service account to search users with, anonymous if empty
+		BindDN       string
+		BindPassword string
+		BaseDN       string
+		// filter to find a user, `{username}` is replaced with the escaped login name
+		UserFilter string
+		// user attribute listing the groups of the user, e.g. memberOf
+		GroupAttribute string
+		// filter to find the groups of a user, `{dn}` and `{username}` are replaced
+		// with the escaped user DN and login name, disabled if empty
+		GroupFilter string
+		// base DN of GroupFilter, BaseDN if empty
+		GroupBaseDN string
+	}
+
+	// LDAPProvider authenticates users with a bind against an LDAP directory,
+	// e.g. OpenLDAP or Active Directory.
+	LDAPProvider struct {
+		config   LDAPConfig
+		secret   []byte
+		tokenTTL time.Duration
+
+		allowedUsers  []string
+		allowedGroups []string
+
+		// roleGroups maps lowercased groups to roles, the highest role of the user's groups applies.
+		roleGroups map[string]Role
+		// defaultRole is the role of allowed users not in any of roleGroups, admin if empty.
+		defaultRole Role
+	}
+
+	// LDAPClaims is the session token of a user authenticated with LDAP,
+	// groups are looked up on login and kept until the token expires.
+	LDAPClaims struct {
+		jwt.RegisteredClaims
+
+		Username string   `json:"username"`
+		Groups   []string `json:"groups"`
+	}
+)
+
+var _ Provider = (*LDAPProvider)(nil)
+
+const (
+	LDAPTokenCookieName = "godoxy_ldap_token"
+
+	// paths handled by the ldap route middleware
+	LDAPAuthBasePath = "/auth/ldap/"
+	LDAPLoginPath    = LDAPAuthBasePath + "login"
+	LDAPLogoutPath   = LDAPAuthBasePath + "logout"
+
+	ldapTimeout = 10 * time.Second
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrLDAPUnavailable    = errors.New("ldap server unavailable")
+)
+
+func NewLDAPProvider(config LDAPConfig, secret []byte, tokenTTL time.Duration, allowedUsers, allowedGroups []string) (*LDAPProvider, error) {
+	if len(allowedUsers)+len(allowedGroups) == 0 {
+		return nil, errors.New("ldap.allowed_users or ldap.allowed_groups are both empty")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("API_JWT_SECRET is required for ldap sessions")
+	}
+	if config.BaseDN == "" {
+		return nil, errors.New("ldap.base_dn is required")
+	}
+	if !strings.Contains(config.UserFilter, "{username}") {
+		return nil, fmt.Errorf("ldap.user_filter %q must contain {username}", config.UserFilter)
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap.url: %w", err)
+	}
+	switch {
+	case u.Scheme != "ldap" && u.Scheme != "ldaps":
+		return nil, fmt.Errorf("ldap.url: unsupported scheme %q, expect ldap or ldaps", u.Scheme)
+	case u.Scheme == "ldaps" && config.StartTLS:
+		return nil, errors.New("ldap.start_tls cannot be used with ldaps")
+	}
+
+	if config.TLSConfig == nil {
+		config.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	} else {
+		config.TLSConfig = config.TLSConfig.Clone()
+	}
+	// StartTLS does not infer the server name from the URL
+	if config.TLSConfig.ServerName == "" {
+		config.TLSConfig.ServerName = u.Hostname()
+	}
+
+	return &LDAPProvider{
+		config:        config,
+		secret:        secret,
+		tokenTTL:      tokenTTL,
+		allowedUsers:  allowedUsers,
+		allowedGroups: allowedGroups,
+	}, nil
+}
+
+// NewLDAPProviderFromEnv creates a new LDAPProvider from environment variables.
+func NewLDAPProviderFromEnv() (*LDAPProvider, error) {
+	defaultRole, err := ParseRole(common.LDAPDefaultRole)
+	if err != nil {
+		return nil, fmt.Errorf("ldap.default_role: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: common.LDAPInsecureSkipVerify, //nolint:gosec
+	}
+	if common.LDAPCAFile != "" {
+		pem, err := os.ReadFile(common.LDAPCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ldap.ca_file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ldap.ca_file: no certificate found in %s", common.LDAPCAFile)
+		}
+	}
+
+	provider, err := NewLDAPProvider(
+		LDAPConfig{
+			URL:            common.LDAPURL,
+			StartTLS:       common.LDAPStartTLS,
+			TLSConfig:      tlsConfig,
+			BindDN:         common.LDAPBindDN,
+			BindPassword:   common.LDAPBindPassword,
+			BaseDN:         common.LDAPBaseDN,
+			UserFilter:     common.LDAPUserFilter,
+			GroupAttribute: common.LDAPGroupAttribute,
+			GroupFilter:    common.LDAPGroupFilter,
+			GroupBaseDN:    common.LDAPGroupBaseDN,
+		},
+		common.APIJWTSecret,
+		common.APIJWTTokenTTL,
+		common.LDAPAllowedUsers,
+		// users in role groups are allowed as well
+		slices.Concat(common.LDAPAllowedGroups, common.LDAPAdminGroups, common.LDAPOperatorGroups, common.LDAPViewerGroups),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider.SetRoleGroups(newRoleGroups(common.LDAPAdminGroups, common.LDAPOperatorGroups, common.LDAPViewerGroups))
+	provider.SetDefaultRole(defaultRole)
+	return provider, nil
+}
+
+func (auth *LDAPProvider) SetAllowedUsers(users []string) {
+	auth.allowedUsers = users
+}
+
+func (auth *LDAPProvider) SetAllowedGroups(groups []string) {
+	auth.allowedGroups = groups
+}
+
+// SetRoleGroups sets the roles of groups, group names are case-insensitive.
+func (auth *LDAPProvider) SetRoleGroups(roleGroups map[string]Role) {
+	auth.roleGroups = make(map[string]Role, len(roleGroups))
+	for group, role := range roleGroups {
+		group = strings.ToLower(group)
+		if roleLevels[role] > roleLevels[auth.roleGroups[group]] {
+			auth.roleGroups[group] = role
+		}
+	}
+}
+
+func (auth *LDAPProvider) SetDefaultRole(role Role) {
+	auth.defaultRole = role
+}
+
+func (auth *LDAPProvider) TokenCookieName() string {
+	return LDAPTokenCookieName
+}
+
+func (auth *LDAPProvider) NewToken(username string, groups []string) (token string, err error) {
+	claims := &LDAPClaims{
+		Username: username,
+		Groups:   groups,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(auth.tokenTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(auth.tokenSecret())
+}
+
+// tokenSecret returns the signing key of session tokens, derived from API_JWT_SECRET,
+// so tokens of other providers are never accepted.
+func (auth *LDAPProvider) tokenSecret() []byte {
+	secret := sha256.Sum256(append([]byte("godoxy-ldap:"), auth.secret...))
+	return secret[:]
+}
+
+func (auth *LDAPProvider) CheckToken(r *http.Request) error {
+	_, err := auth.CheckUser(r)
+	return err
+}
+
+func (auth *LDAPProvider) CheckUser(r *http.Request) (*User, error) {
+	tokenCookie, err := r.Cookie(auth.TokenCookieName())
+	if err != nil {
+		return nil, ErrMissingSessionToken
+	}
+	var claims LDAPClaims
+	_, err = jwt.ParseWithClaims(tokenCookie.Value, &claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return auth.tokenSecret(), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSessionToken, err)
+	}
+	if !auth.checkAllowed(claims.Username, claims.Groups) {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotAllowed, claims.Username)
+	}
+	return &User{Username: claims.Username, Role: auth.roleOf(claims.Groups)}, nil
+}
+
+// checkAllowed reports whether user or one of groups is allowed, names are case-insensitive in LDAP.
+func (auth *LDAPProvider) checkAllowed(user string, groups []string) bool {
+	if slices.ContainsFunc(auth.allowedUsers, func(allowed string) bool {
+		return strings.EqualFold(allowed, user)
+	}) {
+		return true
+	}
+	return slices.ContainsFunc(groups, func(group string) bool {
+		return slices.ContainsFunc(auth.allowedGroups, func(allowed string) bool {
+			return strings.EqualFold(allowed, group)
+		})
+	})
+}
+
+// roleOf returns the highest role of groups, or the default role if none of groups has a role.
+func (auth *LDAPProvider) roleOf(groups []string) Role {
+	var role Role
+	for _, group := range groups {
+		if groupRole, ok := auth.roleGroups[strings.ToLower(group)]; ok && roleLevels[groupRole] > roleLevels[role] {
+			role = groupRole
+		}
+	}
+	if role != "" {
+		return role
+	}
+	if auth.defaultRole != "" {
+		return auth.defaultRole
+	}
+	return RoleAdmin
+}
+
+// HandleAuth serves the login form of routes with the ldap middleware.
+func (auth *LDAPProvider) HandleAuth(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == LDAPLoginPath && r.Method == http.MethodPost:
+		auth.PostAuthCallbackHandler(w, r)
+	case r.URL.Path == LDAPLogoutPath:
+		auth.LogoutHandler(w, r)
+	case r.URL.Path == LDAPLoginPath:
+		WriteLDAPLoginPage(w, http.StatusUnauthorized, "", "/")
+	default:
+		WriteLDAPLoginPage(w, http.StatusUnauthorized, "", r.URL.RequestURI())
+	}
+}
+
+// LoginHandler redirects to the login page of the WebUI, which posts the credentials to the callback.
+func (auth *LDAPProvider) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+// PostAuthCallbackHandler logs in with a JSON encoded UserPassAuthCallbackRequest from the WebUI,
+// or a form submitted from the login page of the ldap middleware.
+func (auth *LDAPProvider) PostAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isForm := mediaType == "application/x-www-form-urlencoded"
+
+	var creds UserPassAuthCallbackRequest
+	var redirect string
+	if isForm {
+		creds.User = r.PostFormValue("username")
+		creds.Pass = r.PostFormValue("password")
+		redirect = safeRedirectPath(r.PostFormValue("redirect"))
+	} else if err := sonic.ConfigDefault.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	writeError := func(status int, err error) {
+		if isForm {
+			WriteLDAPLoginPage(w, status, err.Error(), redirect)
+		} else {
+			http.Error(w, err.Error(), status)
+		}
+	}
+
+	// directory names are case-insensitive
+	username := strings.ToLower(strings.TrimSpace(creds.User))
+	if retryAfter, locked := lockedOut(r, username); locked {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second).Seconds())))
+		writeError(http.StatusTooManyRequests, ErrTooManyAttempts)
+		return
+	}
+
+	groups, err := auth.authenticate(username, creds.Pass)
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		recordLoginFailure(r, username)
+		writeError(http.StatusBadRequest, ErrInvalidCredentials)
+		return
+	case err != nil:
+		writeError(http.StatusServiceUnavailable, ErrLDAPUnavailable)
+		httputils.LogError(r).Msg(fmt.Sprintf("ldap authentication failed: %v", err))
+		return
+	}
+	resetLoginFailures(r, username)
+
+	if !auth.checkAllowed(username, groups) {
+		writeError(http.StatusForbidden, ErrUserNotAllowed)
+		return
+	}
+
+	token, err := auth.NewToken(username, groups)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		httputils.LogError(r).Msg(fmt.Sprintf("failed to generate token: %v", err))
+		return
+	}
+	SetTokenCookie(w, r, auth.TokenCookieName(), token, auth.tokenTTL)
+	if isForm {
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (auth *LDAPProvider) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	ClearTokenCookie(w, r, auth.TokenCookieName())
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// authenticate binds as username with password, and returns the groups of the user.
+//
+// An error other than ErrInvalidCredentials means the directory cannot be used.
+func (auth *LDAPProvider) authenticate(username, password string) ([]string, error) {
+	// a bind with an empty password is an unauthenticated bind, which succeeds on most servers
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := auth.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := auth.serviceBind(conn); err != nil {
+		return nil, err
+	}
+
+	var attributes []string
+	if auth.config.GroupAttribute != "" {
+		attributes = []string{auth.config.GroupAttribute}
+	}
+	filter := strings.ReplaceAll(auth.config.UserFilter, "{username}", ldap.EscapeFilter(username))
+	// a size limit of 2 is enough to tell if the filter matches more than one user
+	result, err := conn.Search(ldap.NewSearchRequest(
+		auth.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(ldapTimeout.Seconds()), false, filter, attributes, nil,
+	))
+	switch {
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded):
+		log.Warn().Str("username", username).Str("filter", filter).Msg("ldap user filter matches multiple entries")
+		return nil, ErrInvalidCredentials
+	case err != nil:
+		return nil, fmt.Errorf("search user: %w", err)
+	case len(result.Entries) != 1:
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("bind user: %w", err)
+	}
+
+	var groups []string
+	if auth.config.GroupAttribute != "" {
+		for _, value := range entry.GetEqualFoldAttributeValues(auth.config.GroupAttribute) {
+			groups = append(groups, ldapGroupName(value))
+		}
+	}
+	if auth.config.GroupFilter != "" {
+		// the user may not be allowed to read groups
+		if err := auth.serviceBind(conn); err != nil {
+			return nil, err
+		}
+		groupFilter := strings.NewReplacer(
+			"{dn}", ldap.EscapeFilter(entry.DN),
+			"{username}", ldap.EscapeFilter(username),
+		).Replace(auth.config.GroupFilter)
+		baseDN := auth.config.GroupBaseDN
+		if baseDN == "" {
+			baseDN = auth.config.BaseDN
+		}
+		result, err := conn.Search(ldap.NewSearchRequest(
+			baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, int(ldapTimeout.Seconds()), false, groupFilter,
+			[]string{"1.1"}, // DNs only
+			nil,
+		))
+		if err != nil {
+			return nil, fmt.Errorf("search groups: %w", err)
+		}
+		for _, group := range result.Entries {
+			groups = append(groups, ldapGroupName(group.DN))
+		}
+	}
+	slices.Sort(groups)
+	return slices.Compact(groups), nil
+}
+
+func (auth *LDAPProvider) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(auth.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(auth.config.TLSConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+	if auth.config.StartTLS {
+		if err := conn.StartTLS(auth.config.TLSConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start tls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// serviceBind binds as the service account, or anonymously if no service account is configured.
+func (auth *LDAPProvider) serviceBind(conn *ldap.Conn) error {
+	var err error
+	if auth.config.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(auth.config.BindDN, auth.config.BindPassword)
+	}
+	if err != nil {
+		return fmt.Errorf("service bind: %w", err)
+	}
+	return nil
+}
+
+// ldapGroupName returns the common name of a group DN, e.g. "admins" of "cn=admins,ou=groups,dc=example,dc=com",
+// or value as is if it is not a DN.
+func ldapGroupName(value string) string {
+	dn, err := ldap.ParseDN(value)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return value
+	}
+	return dn.RDNs[0].Attributes[0].Value
+}
+
+// safeRedirectPath returns path if it is a local path, or "/" otherwise, so the login form cannot redirect to other sites.
+func safeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return path
+}
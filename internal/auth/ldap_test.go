@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	expect "github.com/yusing/goutils/testing"
+)
+
+const (
+	testLDAPBaseDN    = "dc=example,dc=com"
+	testLDAPServiceDN = "cn=godoxy,ou=services,dc=example,dc=com"
+)
+
+// fakeLDAPServer is an in-process LDAP server supporting simple binds and searches,
+// entries are looked up by the exact search filter.
+type fakeLDAPServer struct {
+	listener  net.Listener
+	passwords map[string]string        // DN -> password
+	entries   map[string][]*ldap.Entry // filter -> entries
+}
+
+func newFakeLDAPServer(t *testing.T) *fakeLDAPServer {
+	t.Helper()
+	srv := &fakeLDAPServer{
+		listener: expect.Must(net.Listen("tcp", "127.0.0.1:0")),
+		passwords: map[string]string{
+			testLDAPServiceDN:                       "service-password",
+			"uid=alice,ou=people,dc=example,dc=com": "alice-password",
+			"uid=bob,ou=people,dc=example,dc=com":   "bob-password",
+			"uid=carol,ou=people,dc=example,dc=com": "carol-password",
+		},
+		entries: map[string][]*ldap.Entry{
+			"(uid=alice)": {ldap.NewEntry("uid=alice,ou=people,dc=example,dc=com", map[string][]string{
+				"memberOf": {"cn=Admins,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+			})},
+			"(uid=bob)": {ldap.NewEntry("uid=bob,ou=people,dc=example,dc=com", map[string][]string{
+				"memberOf": {"cn=staff,ou=groups,dc=example,dc=com"},
+			})},
+			"(uid=carol)": {ldap.NewEntry("uid=carol,ou=people,dc=example,dc=com", nil)},
+			// matches bob if the login name is not escaped
+			"(uid=*)": {ldap.NewEntry("uid=bob,ou=people,dc=example,dc=com", nil)},
+			// group filter of bob
+			"(member=uid=bob,ou=people,dc=example,dc=com)": {
+				ldap.NewEntry("cn=operators,ou=groups,dc=example,dc=com", nil),
+			},
+		},
+	}
+	t.Cleanup(func() { srv.listener.Close() })
+	go srv.serve()
+	return srv
+}
+
+func (srv *fakeLDAPServer) URL() string {
+	return "ldap://" + srv.listener.Addr().String()
+}
+
+func (srv *fakeLDAPServer) serve() {
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			return
+		}
+		go srv.handle(conn)
+	}
+}
+
+func (srv *fakeLDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			resultCode := ldap.LDAPResultInvalidCredentials
+			if dn == "" && password == "" {
+				resultCode = ldap.LDAPResultSuccess // anonymous
+			} else if expected, ok := srv.passwords[dn]; ok && password != "" && password == expected {
+				resultCode = ldap.LDAPResultSuccess
+			}
+			conn.Write(ldapResult(messageID, ldap.ApplicationBindResponse, resultCode).Bytes())
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				return
+			}
+			for _, entry := range srv.entries[filter] {
+				conn.Write(ldapSearchEntry(messageID, entry).Bytes())
+			}
+			conn.Write(ldapResult(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		default: // unbind
+			return
+		}
+	}
+}
+
+func ldapMessage(messageID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func ldapResult(messageID int64, tag ber.Tag, resultCode int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(resultCode), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return ldapMessage(messageID, op)
+}
+
+func ldapSearchEntry(messageID int64, entry *ldap.Entry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "DN"))
+	attributes := ber.NewSequence("Attributes")
+	for _, attr := range entry.Attributes {
+		attribute := ber.NewSequence("Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attr.Name, "Type"))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range attr.Values {
+			values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(values)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	return ldapMessage(messageID, op)
+}
+
+func newTestLDAPProvider(t *testing.T, srv *fakeLDAPServer, config LDAPConfig) *LDAPProvider {
+	t.Helper()
+	config.URL = srv.URL()
+	config.BindDN = testLDAPServiceDN
+	config.BindPassword = "service-password"
+	config.BaseDN = testLDAPBaseDN
+	config.UserFilter = "(uid={username})"
+	if config.GroupAttribute == "" && config.GroupFilter == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	provider := expect.Must(NewLDAPProvider(config, []byte("secret"), time.Hour, []string{"carol"}, []string{"staff"}))
+	provider.SetRoleGroups(newRoleGroups([]string{"admins"}, []string{"operators"}, []string{"staff"}))
+	provider.SetDefaultRole(RoleOperator)
+	return provider
+}
+
+func ldapLogin(provider *LDAPProvider, username, password string) *httptest.ResponseRecorder {
+	body := expect.Must(json.Marshal(UserPassAuthCallbackRequest{User: username, Pass: password}))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/callback", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	provider.PostAuthCallbackHandler(w, req)
+	return w
+}
+
+func ldapSessionUser(provider *LDAPProvider, w *httptest.ResponseRecorder) (*User, error) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return provider.CheckUser(req)
+}
+
+func TestLDAPLogin(t *testing.T) {
+	srv := newFakeLDAPServer(t)
+	provider := newTestLDAPProvider(t, srv, LDAPConfig{})
+	t.Cleanup(loginAttempts.Clear)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		status   int
+		role     Role
+	}{
+		{"group_role", "alice", "alice-password", http.StatusOK, RoleAdmin},
+		{"case_insensitive", "Bob", "bob-password", http.StatusOK, RoleViewer},
+		{"allowed_user_default_role", "carol", "carol-password", http.StatusOK, RoleOperator},
+		{"wrong_password", "bob", "alice-password", http.StatusBadRequest, ""},
+		{"empty_password", "bob", "", http.StatusBadRequest, ""},
+		{"unknown_user", "mallory", "bob-password", http.StatusBadRequest, ""},
+		{"filter_injection", "*", "bob-password", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ldapLogin(provider, tt.username, tt.password)
+			expect.Equal(t, w.Code, tt.status)
+			user, err := ldapSessionUser(provider, w)
+			if tt.status != http.StatusOK {
+				expect.ErrorIs(t, ErrMissingSessionToken, err)
+				return
+			}
+			expect.NoError(t, err)
+			expect.Equal(t, user.Username, strings.ToLower(tt.username))
+			expect.Equal(t, user.Role, tt.role)
+		})
+	}
+}
+
+func TestLDAPGroupFilter(t *testing.T) {
+	srv := newFakeLDAPServer(t)
+	provider := newTestLDAPProvider(t, srv, LDAPConfig{GroupFilter: "(member={dn})"})
+
+	w := ldapLogin(provider, "bob", "bob-password")
+	expect.Equal(t, w.Code, http.StatusForbidden) // not in staff without memberOf
+
+	provider.SetAllowedGroups([]string{"Operators"})
+	w = ldapLogin(provider, "bob", "bob-password")
+	expect.Equal(t, w.Code, http.StatusOK)
+	user, err := ldapSessionUser(provider, w)
+	expect.NoError(t, err)
+	expect.Equal(t, user.Role, RoleOperator)
+
+	// the session is rejected by routes not allowing the user
+	provider.SetAllowedGroups([]string{"admins"})
+	_, err = ldapSessionUser(provider, w)
+	expect.ErrorIs(t, ErrUserNotAllowed, err)
+}
+
+func TestLDAPLoginForm(t *testing.T) {
+	srv := newFakeLDAPServer(t)
+	provider := newTestLDAPProvider(t, srv, LDAPConfig{})
+	t.Cleanup(loginAttempts.Clear)
+
+	submit := func(password, redirect string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {"alice"}, "password": {password}, "redirect": {redirect}}
+		req := httptest.NewRequest(http.MethodPost, LDAPLoginPath, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		provider.HandleAuth(w, req)
+		return w
+	}
+
+	w := submit("wrong-password", "/app")
+	expect.Equal(t, w.Code, http.StatusBadRequest)
+	expect.True(t, strings.Contains(w.Body.String(), ErrInvalidCredentials.Error()))
+
+	w = submit("alice-password", "/app?page=1")
+	expect.Equal(t, w.Code, http.StatusSeeOther)
+	expect.Equal(t, w.Header().Get("Location"), "/app?page=1")
+	_, err := ldapSessionUser(provider, w)
+	expect.NoError(t, err)
+
+	// redirects to other sites are not allowed
+	for _, redirect := range []string{"https://evil.example.com", "//evil.example.com", "/\\evil.example.com"} {
+		w = submit("alice-password", redirect)
+		expect.Equal(t, w.Header().Get("Location"), "/")
+	}
+}
+
+func TestLDAPLoginLockout(t *testing.T) {
+	srv := newFakeLDAPServer(t)
+	provider := newTestLDAPProvider(t, srv, LDAPConfig{})
+	t.Cleanup(loginAttempts.Clear)
+
+	for range maxLoginFailures {
+		expect.Equal(t, ldapLogin(provider, "bob", "wrong-password").Code, http.StatusBadRequest)
+	}
+	w := ldapLogin(provider, "BOB", "bob-password")
+	expect.Equal(t, w.Code, http.StatusTooManyRequests)
+	expect.True(t, w.Header().Get("Retry-After") != "")
+}
+
+func TestLDAPUnavailable(t *testing.T) {
+	srv := newFakeLDAPServer(t)
+	provider := newTestLDAPProvider(t, srv, LDAPConfig{})
+	provider.config.BindPassword = "wrong-password"
+
+	_, err := provider.authenticate("alice", "alice-password")
+	expect.True(t, err != nil && !errors.Is(err, ErrInvalidCredentials))
+	// failures of the directory are not counted as failed logins
+	expect.Equal(t, ldapLogin(provider, "alice", "alice-password").Code, http.StatusServiceUnavailable)
+	_, locked := lockedOut(httptest.NewRequest(http.MethodPost, "/api/v1/auth/callback", nil), "alice")
+	expect.False(t, locked)
+}
+
+func TestLDAPGroupName(t *testing.T) {
+	expect.Equal(t, ldapGroupName("cn=Admins,ou=groups,dc=example,dc=com"), "Admins")
+	expect.Equal(t, ldapGroupName("admins"), "admins")
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog/log"
+)
+
+type (
+	// loginFailures is the failed login attempts of a username, counted for both the password and the second factor.
+	loginFailures struct {
+		count       int
+		lastFailure time.Time
+		lockedUntil time.Time
+	}
+	// loginKey is a username logging in from a client IP, failures from other clients
+	// do not lock out the user, so a third party cannot lock out a legitimate user.
+	// The failures of a username from all clients are counted with an empty ip.
+	loginKey struct {
+		username string
+		ip       string
+	}
+)
+
+const (
+	maxLoginFailures = 5
+	// maxUserLoginFailures locks out a username from all clients, so guesses from many IPs are limited too
+	maxUserLoginFailures = 20
+	loginLockoutDuration = 15 * time.Minute
+	// stale entries are pruned when the number of tracked usernames and clients exceeds this
+	maxTrackedLogins = 10000
+)
+
+var loginAttempts = xsync.NewMap[loginKey, loginFailures]()
+
+var ErrTooManyAttempts = errors.New("too many failed attempts")
+
+func newLoginKey(r *http.Request, username string) loginKey {
+	return loginKey{username: username, ip: requestClientIP(r)}
+}
+
+// lockedOut returns the remaining lockout duration of username for the client of r, or false if it is not locked.
+func lockedOut(r *http.Request, username string) (time.Duration, bool) {
+	now := time.Now()
+	var remaining time.Duration
+	for _, key := range []loginKey{newLoginKey(r, username), {username: username}} {
+		if failures, ok := loginAttempts.Load(key); ok {
+			remaining = max(remaining, failures.lockedUntil.Sub(now))
+		}
+	}
+	return remaining, remaining > 0
+}
+
+// recordLoginFailure counts a failed attempt of username from the client of r, and locks it
+// for loginLockoutDuration after maxLoginFailures failures within the duration. The username is
+// locked for all clients after maxUserLoginFailures failures from any clients.
+//
+// Unknown usernames are counted as well, so lockouts do not reveal whether a user exists.
+func recordLoginFailure(r *http.Request, username string) {
+	now := time.Now()
+	key := newLoginKey(r, username)
+	if countLoginFailure(key, maxLoginFailures, now) {
+		log.Warn().Str("username", username).Str("ip", key.ip).Dur("duration", loginLockoutDuration).Msg("too many failed login attempts, user locked out")
+	}
+	if countLoginFailure(loginKey{username: username}, maxUserLoginFailures, now) {
+		log.Warn().Str("username", username).Dur("duration", loginLockoutDuration).Msg("too many failed login attempts, user locked out for all clients")
+	}
+	if loginAttempts.Size() > maxTrackedLogins {
+		pruneLoginAttempts(now)
+	}
+}
+
+// countLoginFailure counts a failure of key, and reports whether it is locked out after maxFailures failures.
+func countLoginFailure(key loginKey, maxFailures int, now time.Time) (locked bool) {
+	loginAttempts.Compute(key, func(failures loginFailures, loaded bool) (loginFailures, xsync.ComputeOp) {
+		if now.Sub(failures.lastFailure) > loginLockoutDuration {
+			failures.count = 0
+		}
+		failures.count++
+		failures.lastFailure = now
+		if failures.count >= maxFailures {
+			failures.count = 0
+			failures.lockedUntil = now.Add(loginLockoutDuration)
+			locked = true
+		}
+		return failures, xsync.UpdateOp
+	})
+	return locked
+}
+
+// resetLoginFailures clears the failed attempts of username from the client of r after a successful login.
+//
+// The failures from all clients are kept, so a login of the user does not allow more guesses from others.
+func resetLoginFailures(r *http.Request, username string) {
+	loginAttempts.Delete(newLoginKey(r, username))
+}
+
+func pruneLoginAttempts(now time.Time) {
+	for key, failures := range loginAttempts.Range {
+		if now.Sub(failures.lastFailure) > loginLockoutDuration && now.After(failures.lockedUntil) {
+			loginAttempts.Delete(key)
+		}
+	}
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second).Seconds())))
+	http.Error(w, ErrTooManyAttempts.Error(), http.StatusTooManyRequests)
+}
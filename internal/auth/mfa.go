@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/jsonstore"
+	httputils "github.com/yusing/goutils/http"
+)
+
+type (
+	// MFAMethod is a second factor of username/password authentication.
+	MFAMethod string // @name MFAMethod
+
+	// MFAStatus is the second factors enabled for a user.
+	MFAStatus struct {
+		TOTP              bool                 `json:"totp"`
+		RecoveryCodesLeft int                  `json:"recovery_codes_left"`
+		WebAuthn          []WebAuthnCredential `json:"webauthn"`
+	} // @name MFAStatus
+
+	// MFARequiredResponse is the response of a login with a valid password, if the user has a second factor.
+	MFARequiredResponse struct {
+		Methods []MFAMethod `json:"methods"`
+	} // @name MFARequiredResponse
+
+	MFAVerifyRequest struct {
+		// TOTP code or recovery code
+		Code string `json:"code" binding:"required"`
+	} // @name MFAVerifyRequest
+
+	// mfaSettings is the second factors of a user, stored values are immutable and replaced on update.
+	mfaSettings struct {
+		// base32 encoded TOTP secret
+		TOTPSecret string `json:"totp_secret,omitempty"`
+		// time step counter of the last used TOTP code
+		TOTPLastCounter uint64 `json:"totp_last_counter,omitempty"`
+		// SHA-256 hashes of unused recovery codes
+		RecoveryCodes []string                   `json:"recovery_codes,omitempty"`
+		WebAuthn      []storedWebAuthnCredential `json:"webauthn,omitempty"`
+	}
+
+	mfaClaims struct {
+		jwt.RegisteredClaims
+
+		Username string `json:"username"`
+	}
+
+	challenge struct {
+		value     []byte
+		expiresAt time.Time
+	}
+)
+
+const (
+	MFAMethodTOTP     MFAMethod = "totp"
+	MFAMethodWebAuthn MFAMethod = "webauthn"
+)
+
+const (
+	mfaTokenCookieName = "godoxy_mfa_token"
+	// time to complete the second step of a login
+	mfaTokenTTL = 5 * time.Minute
+
+	challengeTOTPEnroll       = "totp_enroll"
+	challengeWebAuthnRegister = "webauthn_register"
+	challengeWebAuthnLogin    = "webauthn_login"
+)
+
+var (
+	mfaStore = jsonstore.Store[*mfaSettings](common.NamespaceMFA)
+	// pending enrollments and WebAuthn challenges, keyed by kind and username
+	challenges = xsync.NewMap[string, challenge]()
+)
+
+// GetMFAStatus returns the second factors enabled for username.
+func GetMFAStatus(username string) MFAStatus {
+	status := MFAStatus{WebAuthn: []WebAuthnCredential{}}
+	settings, ok := mfaStore.Load(username)
+	if !ok {
+		return status
+	}
+	status.TOTP = settings.TOTPSecret != ""
+	status.RecoveryCodesLeft = len(settings.RecoveryCodes)
+	for _, cred := range settings.WebAuthn {
+		status.WebAuthn = append(status.WebAuthn, cred.WebAuthnCredential)
+	}
+	return status
+}
+
+// ResetMFA disables all second factors of username, for users who lost their authenticators and recovery codes.
+func ResetMFA(username string) {
+	if _, ok := mfaStore.LoadAndDelete(username); ok {
+		log.Info().Str("username", username).Msg("second factors reset")
+	}
+}
+
+// mfaMethods returns the second factors enabled for username, a login needs one of them after the password.
+func mfaMethods(username string) []MFAMethod {
+	settings, ok := mfaStore.Load(username)
+	if !ok {
+		return nil
+	}
+	var methods []MFAMethod
+	if settings.TOTPSecret != "" {
+		methods = append(methods, MFAMethodTOTP)
+	}
+	if len(settings.WebAuthn) > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	return methods
+}
+
+// updateMFASettings updates a copy of the settings of username with update, which returns false to discard the changes.
+//
+// Slices of the settings must be replaced instead of modified in place.
+func updateMFASettings(username string, update func(settings *mfaSettings) bool) {
+	mfaStore.Compute(username, func(old *mfaSettings, loaded bool) (*mfaSettings, xsync.ComputeOp) {
+		var settings mfaSettings
+		if loaded {
+			settings = *old
+		}
+		if !update(&settings) {
+			return old, xsync.CancelOp
+		}
+		if settings.TOTPSecret == "" && len(settings.WebAuthn) == 0 {
+			if !loaded {
+				return old, xsync.CancelOp
+			}
+			return nil, xsync.DeleteOp
+		}
+		return &settings, xsync.UpdateOp
+	})
+}
+
+// storeChallenge stores a single-use value of kind for username, and returns its expiry time.
+func storeChallenge(kind, username string, value []byte, ttl time.Duration) time.Time {
+	expiresAt := time.Now().Add(ttl)
+	challenges.Store(kind+":"+username, challenge{value: value, expiresAt: expiresAt})
+	return expiresAt
+}
+
+// peekChallenge returns the unexpired value of kind for username without consuming it.
+func peekChallenge(kind, username string) ([]byte, bool) {
+	c, ok := challenges.Load(kind + ":" + username)
+	if !ok || time.Now().After(c.expiresAt) {
+		return nil, false
+	}
+	return c.value, true
+}
+
+// takeChallenge consumes and returns the unexpired value of kind for username.
+func takeChallenge(kind, username string) ([]byte, bool) {
+	c, ok := challenges.LoadAndDelete(kind + ":" + username)
+	if !ok || time.Now().After(c.expiresAt) {
+		return nil, false
+	}
+	return c.value, true
+}
+
+// mfaSecret returns the signing key of pending second factor tokens, derived from the session token secret,
+// so a pending token is never accepted as a session token.
+func (auth *UserPassAuth) mfaSecret() []byte {
+	secret := sha256.Sum256(append([]byte("godoxy-mfa:"), auth.secret...))
+	return secret[:]
+}
+
+func (auth *UserPassAuth) newMFAToken(username string) (string, error) {
+	claims := &mfaClaims{
+		Username: username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaTokenTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(auth.mfaSecret())
+}
+
+// pendingMFAUser returns the user of a login pending a second factor, or writes an error response.
+func (auth *UserPassAuth) pendingMFAUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(mfaTokenCookieName)
+	if err != nil {
+		http.Error(w, "login required", http.StatusUnauthorized)
+		return "", false
+	}
+	var claims mfaClaims
+	_, err = jwt.ParseWithClaims(cookie.Value, &claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return auth.mfaSecret(), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		http.Error(w, "login required", http.StatusUnauthorized)
+		return "", false
+	}
+	if retryAfter, locked := lockedOut(r, claims.Username); locked {
+		writeTooManyAttempts(w, retryAfter)
+		return "", false
+	}
+	return claims.Username, true
+}
+
+// requireMFA starts the second step of a login if username has a second factor, and reports whether it is started.
+func (auth *UserPassAuth) requireMFA(w http.ResponseWriter, r *http.Request, username string) bool {
+	methods := mfaMethods(username)
+	if len(methods) == 0 {
+		return false
+	}
+	token, err := auth.newMFAToken(username)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		httputils.LogError(r).Msg(fmt.Sprintf("failed to generate token: %v", err))
+		return true
+	}
+	SetTokenCookie(w, r, mfaTokenCookieName, token, mfaTokenTTL)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = sonic.ConfigDefault.NewEncoder(w).Encode(MFARequiredResponse{Methods: methods})
+	return true
+}
+
+// VerifyTOTPHandler completes a login pending a second factor with a TOTP code or a recovery code.
+func (auth *UserPassAuth) VerifyTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := auth.pendingMFAUser(w, r)
+	if !ok {
+		return
+	}
+	var req MFAVerifyRequest
+	if err := sonic.ConfigDefault.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := verifyTOTPOrRecoveryCode(username, req.Code); err != nil {
+		recordLoginFailure(r, username)
+		http.Error(w, ErrInvalidMFACode.Error(), http.StatusBadRequest)
+		return
+	}
+	auth.completeMFA(w, r, username)
+}
+
+// completeMFA replaces the pending second factor token with a session token.
+func (auth *UserPassAuth) completeMFA(w http.ResponseWriter, r *http.Request, username string) {
+	// the user may have been deleted during the second step
+	if _, ok := auth.roleOf(username); !ok {
+		http.Error(w, "login required", http.StatusUnauthorized)
+		return
+	}
+	ClearTokenCookie(w, r, mfaTokenCookieName)
+	auth.login(w, r, username)
+}
@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+const mfaTestHost = "godoxy.example.com"
+
+// doMFARequest calls handler with body and the cookies of the previous response, and returns the response.
+func doMFARequest(handler http.HandlerFunc, prev *httptest.ResponseRecorder, body any) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "https://"+mfaTestHost+"/", bytes.NewReader(expect.Must(json.Marshal(body))))
+	req.RemoteAddr = "203.0.113.1:12345"
+	if prev != nil {
+		for _, cookie := range prev.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func sessionCookie(auth *UserPassAuth, w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == auth.TokenCookieName() && cookie.Value != "" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+	expect.Equal(t, totpCode(secret, 59/totpPeriod), "287082")
+	expect.Equal(t, totpCode(secret, 1111111109/totpPeriod), "081804")
+	expect.Equal(t, totpCode(secret, 2000000000/totpPeriod), "279037")
+
+	now := time.Unix(1111111109, 0)
+	counter, ok := validateTOTP(secret, "081804", now, 0)
+	expect.True(t, ok)
+	_, ok = validateTOTP(secret, "081804", now, counter)
+	expect.False(t, ok)
+	_, ok = validateTOTP(secret, "081804", now.Add(time.Hour), 0)
+	expect.False(t, ok)
+}
+
+func TestTOTPLogin(t *testing.T) {
+	auth := newMockUserPassAuth()
+	t.Cleanup(func() {
+		ResetMFA("username")
+		loginAttempts.Clear()
+	})
+
+	enrollment := BeginTOTPEnrollment("username")
+	secret := expect.Must(totpEncoding.DecodeString(enrollment.Secret))
+	code := totpCode(secret, uint64(time.Now().Unix())/totpPeriod)
+
+	_, err := ConfirmTOTPEnrollment("username", "000000")
+	if code != "000000" {
+		expect.ErrorIs(t, ErrInvalidMFACode, err)
+	}
+	recoveryCodes, err := ConfirmTOTPEnrollment("username", code)
+	expect.NoError(t, err)
+	expect.Equal(t, len(recoveryCodes), numRecoveryCodes)
+	_, err = ConfirmTOTPEnrollment("username", code)
+	expect.ErrorIs(t, ErrNoPendingEnrollment, err)
+
+	// the password alone does not log in
+	w := doMFARequest(auth.PostAuthCallbackHandler, nil, UserPassAuthCallbackRequest{User: "username", Pass: "password"})
+	expect.Equal(t, w.Code, http.StatusAccepted)
+	expect.True(t, sessionCookie(auth, w) == nil)
+	var resp MFARequiredResponse
+	expect.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	expect.Equal(t, resp.Methods, []MFAMethod{MFAMethodTOTP})
+
+	// the second step needs the pending token
+	expect.Equal(t, doMFARequest(auth.VerifyTOTPHandler, nil, MFAVerifyRequest{Code: code}).Code, http.StatusUnauthorized)
+	// the code used for enrollment cannot be replayed
+	expect.Equal(t, doMFARequest(auth.VerifyTOTPHandler, w, MFAVerifyRequest{Code: code}).Code, http.StatusBadRequest)
+
+	verified := doMFARequest(auth.VerifyTOTPHandler, w, MFAVerifyRequest{Code: recoveryCodes[0]})
+	expect.Equal(t, verified.Code, http.StatusOK)
+	expect.True(t, sessionCookie(auth, verified) != nil)
+
+	// recovery codes are single-use
+	expect.Equal(t, doMFARequest(auth.VerifyTOTPHandler, w, MFAVerifyRequest{Code: recoveryCodes[0]}).Code, http.StatusBadRequest)
+	expect.Equal(t, GetMFAStatus("username").RecoveryCodesLeft, numRecoveryCodes-1)
+
+	expect.NoError(t, DisableTOTP("username"))
+	expect.ErrorIs(t, ErrTOTPNotEnabled, DisableTOTP("username"))
+	w = doMFARequest(auth.PostAuthCallbackHandler, nil, UserPassAuthCallbackRequest{User: "username", Pass: "password"})
+	expect.Equal(t, w.Code, http.StatusOK)
+}
+
+func TestLoginLockout(t *testing.T) {
+	auth := newMockUserPassAuth()
+	t.Cleanup(loginAttempts.Clear)
+
+	for range maxLoginFailures {
+		w := doMFARequest(auth.PostAuthCallbackHandler, nil, UserPassAuthCallbackRequest{User: "username", Pass: "wrong-password"})
+		expect.Equal(t, w.Code, http.StatusBadRequest)
+	}
+	// the correct password is rejected while locked out
+	w := doMFARequest(auth.PostAuthCallbackHandler, nil, UserPassAuthCallbackRequest{User: "username", Pass: "password"})
+	expect.Equal(t, w.Code, http.StatusTooManyRequests)
+	expect.True(t, w.Header().Get("Retry-After") != "")
+
+	// other clients are not locked out
+	req := httptest.NewRequest(http.MethodPost, "https://"+mfaTestHost+"/", bytes.NewReader(expect.Must(json.Marshal(UserPassAuthCallbackRequest{User: "username", Pass: "password"}))))
+	req.RemoteAddr = "198.51.100.1:12345"
+	w = httptest.NewRecorder()
+	auth.PostAuthCallbackHandler(w, req)
+	expect.Equal(t, w.Code, http.StatusOK)
+
+	loginAttempts.Clear()
+	w = doMFARequest(auth.PostAuthCallbackHandler, nil, UserPassAuthCallbackRequest{User: "username", Pass: "password"})
+	expect.Equal(t, w.Code, http.StatusOK)
+}
+
+func TestLoginLockoutSpoofedForwardedFor(t *testing.T) {
+	auth := newMockUserPassAuth()
+	t.Cleanup(loginAttempts.Clear)
+
+	login := func(i int, pass string) int {
+		req := httptest.NewRequest(http.MethodPost, "https://"+mfaTestHost+"/", bytes.NewReader(expect.Must(json.Marshal(UserPassAuthCallbackRequest{User: "username", Pass: pass}))))
+		// from the frontend, with a client supplied entry rotated on every attempt
+		req.RemoteAddr = "127.0.0.1:12345"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("10.0.0.%d, 203.0.113.1", i))
+		w := httptest.NewRecorder()
+		auth.PostAuthCallbackHandler(w, req)
+		return w.Code
+	}
+
+	for i := range maxLoginFailures {
+		expect.Equal(t, login(i, "wrong-password"), http.StatusBadRequest)
+	}
+	expect.Equal(t, login(maxLoginFailures, "password"), http.StatusTooManyRequests)
+}
+
+func TestLoginLockoutManyClients(t *testing.T) {
+	auth := newMockUserPassAuth()
+	t.Cleanup(loginAttempts.Clear)
+
+	login := func(i int, pass string) int {
+		req := httptest.NewRequest(http.MethodPost, "https://"+mfaTestHost+"/", bytes.NewReader(expect.Must(json.Marshal(UserPassAuthCallbackRequest{User: "username", Pass: pass}))))
+		req.RemoteAddr = fmt.Sprintf("198.51.100.%d:12345", i)
+		w := httptest.NewRecorder()
+		auth.PostAuthCallbackHandler(w, req)
+		return w.Code
+	}
+
+	// fewer failures than maxLoginFailures from each client
+	for i := range maxUserLoginFailures {
+		expect.Equal(t, login(i, "wrong-password"), http.StatusBadRequest)
+	}
+	expect.Equal(t, login(maxUserLoginFailures, "password"), http.StatusTooManyRequests)
+}
+
+// mockAuthenticator is a WebAuthn authenticator with an ES256 key.
+type mockAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+func (a *mockAuthenticator) authData(flags byte, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(mfaTestHost))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // aaguid
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+	}
+	return data
+}
+
+func clientDataJSON(ceremony, challenge string) []byte {
+	return expect.Must(json.Marshal(webAuthnClientData{Type: ceremony, Challenge: challenge, Origin: "https://" + mfaTestHost}))
+}
+
+func (a *mockAuthenticator) register(challenge string) *WebAuthnRegistration {
+	return &WebAuthnRegistration{
+		ID:   webAuthnEncoding.EncodeToString(a.id),
+		Type: webAuthnCredType,
+		Response: WebAuthnAttestationResponse{
+			ClientDataJSON:     webAuthnEncoding.EncodeToString(clientDataJSON("webauthn.create", challenge)),
+			AuthenticatorData:  webAuthnEncoding.EncodeToString(a.authData(authDataFlagUserPresent|authDataFlagAttestedData, true)),
+			PublicKey:          webAuthnEncoding.EncodeToString(expect.Must(x509.MarshalPKIXPublicKey(&a.key.PublicKey))),
+			PublicKeyAlgorithm: coseAlgES256,
+		},
+	}
+}
+
+func (a *mockAuthenticator) assert(challenge string) *WebAuthnAssertion {
+	a.signCount++
+	authData := a.authData(authDataFlagUserPresent, false)
+	clientData := clientDataJSON("webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	hash := sha256.Sum256(append(bytes.Clone(authData), clientDataHash[:]...))
+	return &WebAuthnAssertion{
+		ID:   webAuthnEncoding.EncodeToString(a.id),
+		Type: webAuthnCredType,
+		Response: WebAuthnAssertionResponse{
+			ClientDataJSON:    webAuthnEncoding.EncodeToString(clientData),
+			AuthenticatorData: webAuthnEncoding.EncodeToString(authData),
+			Signature:         webAuthnEncoding.EncodeToString(expect.Must(ecdsa.SignASN1(rand.Reader, a.key, hash[:]))),
+		},
+	}
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	auth := newMockUserPassAuth()
+	t.Cleanup(func() {
+		ResetMFA("username")
+		loginAttempts.Clear()
+	})
+
+	authenticator := &mockAuthenticator{
+		key: expect.Must(ecdsa.GenerateKey(elliptic.P256(), rand.Reader)),
+		id:  []byte("credential-id"),
+	}
+	req := httptest.NewRequest(http.MethodPost, "https://"+mfaTestHost+"/", nil)
+	req.RemoteAddr = "203.0.113.1:12345"
+
+	options := BeginWebAuthnRegistration(req, "username")
+	expect.Equal(t, options.RP.ID, mfaTestHost)
+
+	// the challenge must match
+	_, err := FinishWebAuthnRegistration(req, "username", "key", authenticator.register("wrong-challenge"))
+	expect.ErrorIs(t, ErrWebAuthnInvalidResponse, err)
+	// the challenge is single-use
+	_, err = FinishWebAuthnRegistration(req, "username", "key", authenticator.register(options.Challenge))
+	expect.ErrorIs(t, ErrNoPendingEnrollment, err)
+
+	options = BeginWebAuthnRegistration(req, "username")
+	cred, err := FinishWebAuthnRegistration(req, "username", "key", authenticator.register(options.Challenge))
+	expect.NoError(t, err)
+	expect.Equal(t, GetMFAStatus("username").WebAuthn, []WebAuthnCredential{*cred})
+
+	options = BeginWebAuthnRegistration(req, "username")
+	expect.Equal(t, options.ExcludeCredentials, []WebAuthnCredentialDescriptor{{Type: webAuthnCredType, ID: cred.ID}})
+	_, err = FinishWebAuthnRegistration(req, "username", "key", authenticator.register(options.Challenge))
+	expect.ErrorIs(t, ErrWebAuthnCredentialExists, err)
+
+	w := doMFARequest(auth.PostAuthCallbackHandler, nil, UserPassAuthCallbackRequest{User: "username", Pass: "password"})
+	expect.Equal(t, w.Code, http.StatusAccepted)
+
+	begin := doMFARequest(auth.WebAuthnLoginBeginHandler, w, nil)
+	expect.Equal(t, begin.Code, http.StatusOK)
+	var requestOptions WebAuthnRequestOptions
+	expect.NoError(t, json.Unmarshal(begin.Body.Bytes(), &requestOptions))
+	expect.Equal(t, requestOptions.RPID, mfaTestHost)
+
+	assertion := authenticator.assert(requestOptions.Challenge)
+	verified := doMFARequest(auth.WebAuthnLoginFinishHandler, w, assertion)
+	expect.Equal(t, verified.Code, http.StatusOK)
+	expect.True(t, sessionCookie(auth, verified) != nil)
+
+	// assertions cannot be replayed
+	expect.Equal(t, doMFARequest(auth.WebAuthnLoginFinishHandler, w, assertion).Code, http.StatusBadRequest)
+
+	// signature counters must increase
+	begin = doMFARequest(auth.WebAuthnLoginBeginHandler, w, nil)
+	expect.NoError(t, json.Unmarshal(begin.Body.Bytes(), &requestOptions))
+	authenticator.signCount = 0
+	expect.Equal(t, doMFARequest(auth.WebAuthnLoginFinishHandler, w, authenticator.assert(requestOptions.Challenge)).Code, http.StatusBadRequest)
+
+	expect.NoError(t, DeleteWebAuthnCredential("username", cred.ID))
+	expect.ErrorIs(t, ErrWebAuthnCredentialUnknown, DeleteWebAuthnCredential("username", cred.ID))
+	expect.Equal(t, GetMFAStatus("username").WebAuthn, []WebAuthnCredential{})
+}
@@ -31,6 +31,11 @@ type (
 		allowedUsers  []string
 		allowedGroups []string
 
+		// roleGroups maps groups to roles, the highest role of the user's groups applies.
+		roleGroups map[string]Role
+		// defaultRole is the role of allowed users not in any of roleGroups, admin if empty.
+		defaultRole Role
+
 		rateLimit *rate.Limiter
 
 		onUnknownPathHandler http.HandlerFunc
@@ -130,13 +135,25 @@ func NewOIDCProvider(issuerURL, clientID, clientSecret string, allowedUsers, all
 
 // NewOIDCProviderFromEnv creates a new OIDCProvider from environment variables.
 func NewOIDCProviderFromEnv() (*OIDCProvider, error) {
-	return NewOIDCProvider(
+	defaultRole, err := ParseRole(common.OIDCDefaultRole)
+	if err != nil {
+		return nil, fmt.Errorf("oidc.default_role: %w", err)
+	}
+
+	provider, err := NewOIDCProvider(
 		common.OIDCIssuerURL,
 		common.OIDCClientID,
 		common.OIDCClientSecret,
 		common.OIDCAllowedUsers,
-		common.OIDCAllowedGroups,
+		// users in role groups are allowed as well
+		slices.Concat(common.OIDCAllowedGroups, common.OIDCAdminGroups, common.OIDCOperatorGroups, common.OIDCViewerGroups),
 	)
+	if err != nil {
+		return nil, err
+	}
+	provider.SetRoleGroups(newRoleGroups(common.OIDCAdminGroups, common.OIDCOperatorGroups, common.OIDCViewerGroups))
+	provider.SetDefaultRole(defaultRole)
+	return provider, nil
 }
 
 // NewOIDCProviderWithCustomClient creates a new OIDCProvider with custom client credentials
@@ -167,6 +184,8 @@ func NewOIDCProviderWithCustomClient(baseProvider *OIDCProvider, clientID, clien
 		endSessionURL: baseProvider.endSessionURL,
 		allowedUsers:  baseProvider.allowedUsers,
 		allowedGroups: baseProvider.allowedGroups,
+		roleGroups:    baseProvider.roleGroups,
+		defaultRole:   baseProvider.defaultRole,
 		rateLimit:     baseProvider.rateLimit,
 	}, nil
 }
@@ -179,6 +198,14 @@ func (auth *OIDCProvider) SetAllowedGroups(groups []string) {
 	auth.allowedGroups = groups
 }
 
+func (auth *OIDCProvider) SetRoleGroups(roleGroups map[string]Role) {
+	auth.roleGroups = roleGroups
+}
+
+func (auth *OIDCProvider) SetDefaultRole(role Role) {
+	auth.defaultRole = role
+}
+
 func (auth *OIDCProvider) SetScopes(scopes []string) {
 	auth.oauthConfig.Scopes = scopes
 }
@@ -292,26 +319,48 @@ func (auth *OIDCProvider) checkAllowed(user string, groups []string) bool {
 	return len(utils.Intersect(groups, auth.allowedGroups)) > 0
 }
 
+// roleOf returns the highest role of groups, or the default role if none of groups has a role.
+func (auth *OIDCProvider) roleOf(groups []string) Role {
+	var role Role
+	for _, group := range groups {
+		if groupRole, ok := auth.roleGroups[group]; ok && roleLevels[groupRole] > roleLevels[role] {
+			role = groupRole
+		}
+	}
+	if role != "" {
+		return role
+	}
+	if auth.defaultRole != "" {
+		return auth.defaultRole
+	}
+	return RoleAdmin
+}
+
 func (auth *OIDCProvider) CheckToken(r *http.Request) error {
+	_, err := auth.CheckUser(r)
+	return err
+}
+
+func (auth *OIDCProvider) CheckUser(r *http.Request) (*User, error) {
 	tokenCookie, err := r.Cookie(auth.getAppScopedCookieName(CookieOauthToken))
 	if err != nil {
-		return ErrMissingOAuthToken
+		return nil, ErrMissingOAuthToken
 	}
 
 	idToken, err := auth.oidcVerifier.Verify(r.Context(), tokenCookie.Value)
 	if err != nil {
-		return fmt.Errorf("%w: %w", ErrInvalidOAuthToken, err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOAuthToken, err)
 	}
 
 	claims, err := parseClaims(idToken)
 	if err != nil {
-		return fmt.Errorf("%w: %w", ErrInvalidOAuthToken, err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOAuthToken, err)
 	}
 
 	if !auth.checkAllowed(claims.Username, claims.Groups) {
-		return ErrUserNotAllowed
+		return nil, ErrUserNotAllowed
 	}
-	return nil
+	return &User{Username: claims.Username, Role: auth.roleOf(claims.Groups)}, nil
 }
 
 func (auth *OIDCProvider) PostAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
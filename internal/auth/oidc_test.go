@@ -455,6 +455,26 @@ func TestCheckToken(t *testing.T) {
 	}
 }
 
+func TestOIDCRoleOf(t *testing.T) {
+	auth := &OIDCProvider{
+		roleGroups: map[string]Role{
+			"admins":    RoleAdmin,
+			"operators": RoleOperator,
+			"viewers":   RoleViewer,
+		},
+		defaultRole: RoleViewer,
+	}
+	expect.Equal(t, auth.roleOf([]string{"viewers"}), RoleViewer)
+	expect.Equal(t, auth.roleOf([]string{"viewers", "operators"}), RoleOperator)
+	expect.Equal(t, auth.roleOf([]string{"other", "admins", "viewers"}), RoleAdmin)
+	expect.Equal(t, auth.roleOf([]string{"other"}), RoleViewer)
+	expect.Equal(t, auth.roleOf(nil), RoleViewer)
+
+	// everyone allowed is an admin without role mapping
+	auth = &OIDCProvider{}
+	expect.Equal(t, auth.roleOf([]string{"other"}), RoleAdmin)
+}
+
 func TestLogoutHandler(t *testing.T) {
 	t.Helper()
 
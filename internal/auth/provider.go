@@ -4,6 +4,8 @@ import "net/http"
 
 type Provider interface {
 	CheckToken(r *http.Request) error
+	// CheckUser is like CheckToken, but returns the authenticated user with its role.
+	CheckUser(r *http.Request) (*User, error)
 	LoginHandler(w http.ResponseWriter, r *http.Request)
 	PostAuthCallbackHandler(w http.ResponseWriter, r *http.Request)
 	LogoutHandler(w http.ResponseWriter, r *http.Request)
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+type (
+	// Role is the role of a user, which decides the API endpoints the user can access.
+	Role string // @name Role
+
+	User struct {
+		Username string `json:"username"`
+		Role     Role   `json:"role,omitempty"`
+		// TokenID is the ID of the API token if the user is authenticated with an API token,
+		// the username is the creator of the token.
+		TokenID string  `json:"token_id,omitempty"`
+		Scopes  []Scope `json:"scopes,omitempty"`
+	} // @name User
+)
+
+const (
+	// RoleViewer has read-only access.
+	RoleViewer Role = "viewer"
+	// RoleOperator has read-only access, and can start/stop/restart containers and renew certificates.
+	RoleOperator Role = "operator"
+	// RoleAdmin has full access.
+	RoleAdmin Role = "admin"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+var roleLevels = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if !role.IsValid() {
+		return "", fmt.Errorf("%w: %q, expect one of admin, operator, viewer", ErrInvalidRole, s)
+	}
+	return role, nil
+}
+
+// newRoleGroups maps groups to roles, a group mapped to multiple roles gets the highest.
+func newRoleGroups(adminGroups, operatorGroups, viewerGroups []string) map[string]Role {
+	roleGroups := make(map[string]Role)
+	for role, groups := range map[Role][]string{
+		RoleViewer:   viewerGroups,
+		RoleOperator: operatorGroups,
+		RoleAdmin:    adminGroups,
+	} {
+		for _, group := range groups {
+			if roleLevels[role] > roleLevels[roleGroups[group]] {
+				roleGroups[group] = role
+			}
+		}
+	}
+	return roleGroups
+}
+
+func (r Role) IsValid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// Includes reports whether r has all permissions of required.
+func (r Role) Includes(required Role) bool {
+	level, ok := roleLevels[required]
+	return ok && roleLevels[r] >= level
+}
+
+// Allows reports whether the user can access an endpoint requiring role, or scope for API token users.
+//
+// API token users cannot access endpoints without a scope.
+func (u *User) Allows(role Role, scope Scope) bool {
+	if u.TokenID != "" {
+		return scope != "" && (slices.Contains(u.Scopes, scope) || slices.Contains(u.Scopes, ScopeAll))
+	}
+	return u.Role.Includes(role)
+}
+
+type userContextKey struct{}
+
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// UserFromCtx returns the authenticated user of the request context, or nil if authentication is not required.
+func UserFromCtx(ctx context.Context) *User {
+	if user, ok := ctx.Value(userContextKey{}).(*User); ok {
+		return user
+	}
+	return nil
+}
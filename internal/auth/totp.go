@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type (
+	// TOTPEnrollment is a pending TOTP enrollment, confirmed with a code generated from the secret.
+	TOTPEnrollment struct {
+		// base32 encoded secret, for manual entry
+		Secret string `json:"secret"`
+		// otpauth:// URL, for QR codes
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	} // @name TOTPEnrollment
+)
+
+// RFC 6238 parameters supported by all authenticator apps.
+const (
+	totpPeriod = 30 // seconds
+	totpDigits = 6
+	totpModulo = 1_000_000 // 10^totpDigits
+	// accepted time steps before and after the current one, to tolerate clock drift
+	totpSkew = 1
+
+	totpIssuer            = "GoDoxy"
+	totpEnrollmentTTL     = 10 * time.Minute
+	numRecoveryCodes      = 10
+	recoveryCodeByteCount = 5 // 8 base32 characters
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var (
+	ErrInvalidMFACode      = errors.New("invalid code")
+	ErrNoPendingEnrollment = errors.New("no pending enrollment, or enrollment expired")
+	ErrTOTPNotEnabled      = errors.New("totp is not enabled")
+)
+
+// BeginTOTPEnrollment generates a TOTP secret for username, which is enabled after confirmed
+// with ConfirmTOTPEnrollment. An enabled TOTP secret is kept until then.
+func BeginTOTPEnrollment(username string) *TOTPEnrollment {
+	secret := make([]byte, 20)
+	_, _ = rand.Read(secret)
+	expiresAt := storeChallenge(challengeTOTPEnroll, username, secret, totpEnrollmentTTL)
+
+	encoded := totpEncoding.EncodeToString(secret)
+	u := url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/" + totpIssuer + ":" + username,
+		RawQuery: url.Values{
+			"secret":    {encoded},
+			"issuer":    {totpIssuer},
+			"algorithm": {"SHA1"},
+			"digits":    {fmt.Sprint(totpDigits)},
+			"period":    {fmt.Sprint(totpPeriod)},
+		}.Encode(),
+	}
+	return &TOTPEnrollment{Secret: encoded, URL: u.String(), ExpiresAt: expiresAt}
+}
+
+// ConfirmTOTPEnrollment enables the pending TOTP secret of username if code is valid,
+// and returns new recovery codes, which are only available here.
+func ConfirmTOTPEnrollment(username, code string) ([]string, error) {
+	secret, ok := peekChallenge(challengeTOTPEnroll, username)
+	if !ok {
+		return nil, ErrNoPendingEnrollment
+	}
+	counter, ok := validateTOTP(secret, code, time.Now(), 0)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	takeChallenge(challengeTOTPEnroll, username)
+
+	codes, hashes := newRecoveryCodes()
+	updateMFASettings(username, func(settings *mfaSettings) bool {
+		settings.TOTPSecret = totpEncoding.EncodeToString(secret)
+		settings.TOTPLastCounter = counter
+		settings.RecoveryCodes = hashes
+		return true
+	})
+	log.Info().Str("username", username).Msg("totp enabled")
+	return codes, nil
+}
+
+// DisableTOTP disables TOTP of username, and deletes its recovery codes.
+func DisableTOTP(username string) error {
+	if settings, ok := mfaStore.Load(username); !ok || settings.TOTPSecret == "" {
+		return ErrTOTPNotEnabled
+	}
+	updateMFASettings(username, func(settings *mfaSettings) bool {
+		settings.TOTPSecret = ""
+		settings.TOTPLastCounter = 0
+		settings.RecoveryCodes = nil
+		return true
+	})
+	log.Info().Str("username", username).Msg("totp disabled")
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of username, and returns the new codes.
+func RegenerateRecoveryCodes(username string) ([]string, error) {
+	if settings, ok := mfaStore.Load(username); !ok || settings.TOTPSecret == "" {
+		return nil, ErrTOTPNotEnabled
+	}
+	codes, hashes := newRecoveryCodes()
+	updateMFASettings(username, func(settings *mfaSettings) bool {
+		settings.RecoveryCodes = hashes
+		return true
+	})
+	log.Info().Str("username", username).Msg("recovery codes regenerated")
+	return codes, nil
+}
+
+// verifyTOTPOrRecoveryCode verifies code of username, a used TOTP code or recovery code cannot be used again.
+func verifyTOTPOrRecoveryCode(username, code string) error {
+	code = strings.TrimSpace(code)
+	hash := hashRecoveryCode(code)
+	now := time.Now()
+
+	err := ErrTOTPNotEnabled
+	// verify and update in one step, so concurrent logins cannot use the same code
+	updateMFASettings(username, func(settings *mfaSettings) bool {
+		if settings.TOTPSecret == "" {
+			return false
+		}
+		err = ErrInvalidMFACode
+		if secret, decodeErr := totpEncoding.DecodeString(settings.TOTPSecret); decodeErr == nil {
+			if counter, ok := validateTOTP(secret, code, now, settings.TOTPLastCounter); ok {
+				settings.TOTPLastCounter = counter
+				err = nil
+				return true
+			}
+		}
+		n := len(settings.RecoveryCodes)
+		settings.RecoveryCodes = slices.DeleteFunc(slices.Clone(settings.RecoveryCodes), func(stored string) bool {
+			return subtle.ConstantTimeCompare([]byte(hash), []byte(stored)) == 1
+		})
+		if len(settings.RecoveryCodes) == n {
+			return false
+		}
+		err = nil
+		log.Info().Str("username", username).Int("remaining", len(settings.RecoveryCodes)).Msg("recovery code used")
+		return true
+	})
+	return err
+}
+
+// validateTOTP reports whether code is valid for secret at now, and returns its time step counter.
+//
+// Codes of time steps not after lastCounter are rejected, so a code cannot be replayed.
+func validateTOTP(secret []byte, code string, now time.Time, lastCounter uint64) (uint64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := uint64(now.Unix()) / totpPeriod
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode returns the HOTP value (RFC 4226) of secret at counter.
+func totpCode(secret []byte, counter uint64) string {
+	mac := hmac.New(sha1.New, secret)
+	_ = binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo)
+}
+
+// newRecoveryCodes returns recovery codes in the form of `xxxx-xxxx`, and their hashes to be stored.
+func newRecoveryCodes() (codes, hashes []string) {
+	codes = make([]string, numRecoveryCodes)
+	hashes = make([]string, numRecoveryCodes)
+	buf := make([]byte, recoveryCodeByteCount)
+	for i := range codes {
+		_, _ = rand.Read(buf)
+		code := strings.ToLower(totpEncoding.EncodeToString(buf))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes
+}
+
+// hashRecoveryCode returns the hash of a recovery code, ignoring case and dashes.
+//
+// Recovery codes are random and single-use, and are protected by the login lockout,
+// so a slow password hash is not needed.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return hashAPITokenSecret([]byte(code))
+}
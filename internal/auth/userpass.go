@@ -58,9 +58,9 @@ func (auth *UserPassAuth) TokenCookieName() string {
 	return "godoxy_token"
 }
 
-func (auth *UserPassAuth) NewToken() (token string, err error) {
+func (auth *UserPassAuth) NewToken(username string) (token string, err error) {
 	claim := &UserPassClaims{
-		Username: auth.username,
+		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(auth.tokenTTL)),
 		},
@@ -74,9 +74,14 @@ func (auth *UserPassAuth) NewToken() (token string, err error) {
 }
 
 func (auth *UserPassAuth) CheckToken(r *http.Request) error {
+	_, err := auth.CheckUser(r)
+	return err
+}
+
+func (auth *UserPassAuth) CheckUser(r *http.Request) (*User, error) {
 	jwtCookie, err := r.Cookie(auth.TokenCookieName())
 	if err != nil {
-		return ErrMissingSessionToken
+		return nil, ErrMissingSessionToken
 	}
 	var claims UserPassClaims
 	token, err := jwt.ParseWithClaims(jwtCookie.Value, &claims, func(t *jwt.Token) (any, error) {
@@ -86,18 +91,21 @@ func (auth *UserPassAuth) CheckToken(r *http.Request) error {
 		return auth.secret, nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	switch {
 	case !token.Valid:
-		return ErrInvalidSessionToken
-	case claims.Username != auth.username:
-		return fmt.Errorf("%w: %s", ErrUserNotAllowed, claims.Username)
+		return nil, ErrInvalidSessionToken
 	case claims.ExpiresAt.Before(time.Now()):
-		return fmt.Errorf("token expired on %s", strutils.FormatTime(claims.ExpiresAt.Time))
+		return nil, fmt.Errorf("token expired on %s", strutils.FormatTime(claims.ExpiresAt.Time))
 	}
 
-	return nil
+	// look up the role on every request, so role changes and deletions take effect immediately
+	role, ok := auth.roleOf(claims.Username)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotAllowed, claims.Username)
+	}
+	return &User{Username: claims.Username, Role: role}, nil
 }
 
 type UserPassAuthCallbackRequest struct {
@@ -112,17 +120,32 @@ func (auth *UserPassAuth) PostAuthCallbackHandler(w http.ResponseWriter, r *http
 		http.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
+	if retryAfter, locked := lockedOut(r, creds.User); locked {
+		writeTooManyAttempts(w, retryAfter)
+		return
+	}
 	if err := auth.validatePassword(creds.User, creds.Pass); err != nil {
+		recordLoginFailure(r, creds.User)
 		// NOTE: do not include the actual error here
 		http.Error(w, "invalid credentials", http.StatusBadRequest)
 		return
 	}
-	token, err := auth.NewToken()
+	// failures are not reset until the second step is completed, so codes cannot be guessed with a known password
+	if auth.requireMFA(w, r, creds.User) {
+		return
+	}
+	auth.login(w, r, creds.User)
+}
+
+// login sets the session token cookie of username after all factors are verified.
+func (auth *UserPassAuth) login(w http.ResponseWriter, r *http.Request, username string) {
+	token, err := auth.NewToken(username)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		httputils.LogError(r).Msg(fmt.Sprintf("failed to generate token: %v", err))
 		return
 	}
+	resetLoginFailures(r, username)
 	SetTokenCookie(w, r, auth.TokenCookieName(), token, auth.tokenTTL)
 	w.WriteHeader(http.StatusOK)
 }
@@ -133,16 +156,35 @@ func (auth *UserPassAuth) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 func (auth *UserPassAuth) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	ClearTokenCookie(w, r, auth.TokenCookieName())
+	ClearTokenCookie(w, r, mfaTokenCookieName)
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
 func (auth *UserPassAuth) validatePassword(user, pass string) error {
+	pwdHash := auth.pwdHash
+	stored, isStored := users.Load(user)
+	// the user from environment variables takes precedence
+	isStored = isStored && user != auth.username
+	if isStored {
+		pwdHash = []byte(stored.PasswordHash)
+	}
 	// always perform bcrypt comparison to avoid timing attacks
-	if err := bcrypt.CompareHashAndPassword(auth.pwdHash, []byte(pass)); err != nil {
+	if err := bcrypt.CompareHashAndPassword(pwdHash, []byte(pass)); err != nil {
 		return err
 	}
-	if user != auth.username {
+	if user != auth.username && !isStored {
 		return ErrInvalidUsername
 	}
 	return nil
 }
+
+// roleOf returns the role of username, the user from environment variables is always an admin.
+func (auth *UserPassAuth) roleOf(username string) (Role, bool) {
+	if username == auth.username {
+		return RoleAdmin, true
+	}
+	if user, ok := users.Load(username); ok {
+		return user.Role, true
+	}
+	return "", false
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/yusing/godoxy/internal/common"
 	expect "github.com/yusing/goutils/testing"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -34,7 +35,7 @@ func TestUserPassValidateCredentials(t *testing.T) {
 
 func TestUserPassCheckToken(t *testing.T) {
 	auth := newMockUserPassAuth()
-	token, err := auth.NewToken()
+	token, err := auth.NewToken("username")
 	expect.NoError(t, err)
 	tests := []struct {
 		token   string
@@ -73,6 +74,7 @@ func TestUserPassLoginCallbackHandler(t *testing.T) {
 		Pass string `json:"password"`
 	}
 	auth := newMockUserPassAuth()
+	t.Cleanup(loginAttempts.Clear)
 	tests := []struct {
 		creds   cred
 		wantErr bool
@@ -113,3 +115,45 @@ func TestUserPassLoginCallbackHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestUserPassStoredUsers(t *testing.T) {
+	auth := newMockUserPassAuth()
+	expect.NoError(t, SetUser("viewer", "viewer-password", RoleViewer))
+	t.Cleanup(func() { _ = DeleteUser("viewer") })
+
+	expect.ErrorIs(t, ErrReservedUsername, SetUser(common.APIUser, "password", RoleViewer))
+	expect.ErrorIs(t, ErrInvalidRole, SetUser("viewer", "", "superuser"))
+	expect.ErrorIs(t, ErrPasswordRequired, SetUser("new-user", "", RoleViewer))
+
+	expect.NoError(t, auth.validatePassword("viewer", "viewer-password"))
+	expect.ErrorIs(t, bcrypt.ErrMismatchedHashAndPassword, auth.validatePassword("viewer", "password"))
+
+	checkUser := func(username string) (*User, error) {
+		token, err := auth.NewToken(username)
+		expect.NoError(t, err)
+		req := &http.Request{Header: http.Header{}}
+		req.Header.Set("Cookie", auth.TokenCookieName()+"="+token)
+		return auth.CheckUser(req)
+	}
+
+	user, err := checkUser("username")
+	expect.NoError(t, err)
+	expect.Equal(t, *user, User{Username: "username", Role: RoleAdmin})
+
+	user, err = checkUser("viewer")
+	expect.NoError(t, err)
+	expect.Equal(t, *user, User{Username: "viewer", Role: RoleViewer})
+
+	// role changes take effect without a new token, and the password is kept
+	expect.NoError(t, SetUser("viewer", "", RoleOperator))
+	expect.NoError(t, auth.validatePassword("viewer", "viewer-password"))
+	user, err = checkUser("viewer")
+	expect.NoError(t, err)
+	expect.Equal(t, user.Role, RoleOperator)
+	expect.Equal(t, ListUsers(), []User{{Username: "viewer", Role: RoleOperator}})
+
+	expect.NoError(t, DeleteUser("viewer"))
+	expect.ErrorIs(t, ErrUserNotFound, DeleteUser("viewer"))
+	_, err = checkUser("viewer")
+	expect.ErrorIs(t, ErrUserNotAllowed, err)
+}
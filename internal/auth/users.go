@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/jsonstore"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// storedUser is a user of username/password authentication, in addition to the user from environment variables.
+type storedUser struct {
+	PasswordHash string `json:"password_hash"`
+	Role         Role   `json:"role"`
+}
+
+var users = jsonstore.Store[*storedUser](common.NamespaceUsers)
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrReservedUsername  = errors.New("username is reserved for the user from environment variables")
+	ErrPasswordRequired  = errors.New("password is required for a new user")
+	ErrUsernameRequired  = errors.New("username is required")
+	ErrUsernameMalformed = errors.New("username must not contain spaces")
+)
+
+// ListUsers returns the stored users sorted by username.
+//
+// The user from environment variables (API_USER) is not included.
+func ListUsers() []User {
+	list := make([]User, 0, users.Size())
+	for username, user := range users.Range {
+		list = append(list, User{Username: username, Role: user.Role})
+	}
+	slices.SortFunc(list, func(a, b User) int {
+		return strings.Compare(a.Username, b.Username)
+	})
+	return list
+}
+
+// SetUser creates or updates a stored user. An empty password keeps the password of an existing user.
+func SetUser(username, password string, role Role) error {
+	switch {
+	case username == "":
+		return ErrUsernameRequired
+	case strings.ContainsFunc(username, unicode.IsSpace):
+		return ErrUsernameMalformed
+	case username == common.APIUser:
+		return fmt.Errorf("%w: %s", ErrReservedUsername, username)
+	case !role.IsValid():
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	user := &storedUser{Role: role}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		user.PasswordHash = string(hash)
+	} else {
+		existing, ok := users.Load(username)
+		if !ok {
+			return ErrPasswordRequired
+		}
+		user.PasswordHash = existing.PasswordHash
+	}
+	users.Store(username, user)
+	if role != RoleAdmin {
+		revokeAPITokensOf(username)
+	}
+	log.Info().Str("username", username).Str("role", string(role)).Msg("user updated")
+	return nil
+}
+
+// DeleteUser deletes a stored user, its second factors and API tokens, the sessions of the user are invalidated immediately.
+func DeleteUser(username string) error {
+	if _, ok := users.LoadAndDelete(username); !ok {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	ResetMFA(username)
+	revokeAPITokensOf(username)
+	log.Info().Str("username", username).Msg("user deleted")
+	return nil
+}
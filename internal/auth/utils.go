@@ -28,6 +28,24 @@ func requestRemoteIP(r *http.Request) string {
 	return ip
 }
 
+// requestClientIP returns the IP of the client, forwarded by the frontend for its requests.
+//
+// It is the last X-Forwarded-For entry, the one appended by the frontend, the others are set by the client.
+func requestClientIP(r *http.Request) string {
+	if IsFrontend(r) {
+		if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+			last := forwardedFor[len(forwardedFor)-1]
+			if i := strings.LastIndexByte(last, ','); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := strings.TrimSpace(last); ip != "" {
+				return ip
+			}
+		}
+	}
+	return requestRemoteIP(r)
+}
+
 func requestHost(r *http.Request) string {
 	// check if it's from backend
 	if IsFrontend(r) {
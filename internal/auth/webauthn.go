@@ -0,0 +1,509 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/rs/zerolog/log"
+)
+
+// WebAuthn (passkeys) as a second factor, the JSON formats are those of PublicKeyCredential.parseCreationOptionsFromJSON,
+// PublicKeyCredential.parseRequestOptionsFromJSON and PublicKeyCredential.toJSON in the browser, binary values are base64url encoded.
+//
+// Attestation is not requested, the public key of a new credential is taken from AuthenticatorAttestationResponse.getPublicKey,
+// so no CBOR parsing is needed.
+
+type (
+	// WebAuthnCredential is a registered WebAuthn credential (passkey or security key).
+	WebAuthnCredential struct {
+		// base64url encoded credential ID
+		ID         string    `json:"id"`
+		Name       string    `json:"name"`
+		CreatedAt  time.Time `json:"created_at"`
+		LastUsedAt time.Time `json:"last_used_at,omitzero"`
+	} // @name WebAuthnCredential
+
+	storedWebAuthnCredential struct {
+		WebAuthnCredential
+		// DER encoded SubjectPublicKeyInfo
+		PublicKey []byte `json:"public_key"`
+		// COSE algorithm identifier
+		Algorithm int    `json:"algorithm"`
+		SignCount uint32 `json:"sign_count"`
+	}
+
+	WebAuthnRelyingParty struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} // @name WebAuthnRelyingParty
+
+	WebAuthnUserEntity struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} // @name WebAuthnUserEntity
+
+	WebAuthnCredentialParameter struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} // @name WebAuthnCredentialParameter
+
+	WebAuthnCredentialDescriptor struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	} // @name WebAuthnCredentialDescriptor
+
+	WebAuthnAuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} // @name WebAuthnAuthenticatorSelection
+
+	// WebAuthnCreationOptions is the options of navigator.credentials.create.
+	WebAuthnCreationOptions struct {
+		RP                     WebAuthnRelyingParty           `json:"rp"`
+		User                   WebAuthnUserEntity             `json:"user"`
+		Challenge              string                         `json:"challenge"`
+		PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+		Timeout                int64                          `json:"timeout"`
+		ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+		AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+		Attestation            string                         `json:"attestation"`
+	} // @name WebAuthnCreationOptions
+
+	// WebAuthnRequestOptions is the options of navigator.credentials.get.
+	WebAuthnRequestOptions struct {
+		Challenge        string                         `json:"challenge"`
+		RPID             string                         `json:"rpId"`
+		AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+		Timeout          int64                          `json:"timeout"`
+		UserVerification string                         `json:"userVerification"`
+	} // @name WebAuthnRequestOptions
+
+	WebAuthnAttestationResponse struct {
+		ClientDataJSON     string `json:"clientDataJSON"`
+		AuthenticatorData  string `json:"authenticatorData"`
+		PublicKey          string `json:"publicKey"`
+		PublicKeyAlgorithm int    `json:"publicKeyAlgorithm"`
+	} // @name WebAuthnAttestationResponse
+
+	// WebAuthnRegistration is the credential returned by navigator.credentials.create.
+	WebAuthnRegistration struct {
+		ID       string                      `json:"id"`
+		Type     string                      `json:"type"`
+		Response WebAuthnAttestationResponse `json:"response"`
+	} // @name WebAuthnRegistration
+
+	WebAuthnAssertionResponse struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} // @name WebAuthnAssertionResponse
+
+	// WebAuthnAssertion is the credential returned by navigator.credentials.get.
+	WebAuthnAssertion struct {
+		ID       string                    `json:"id"`
+		Type     string                    `json:"type"`
+		Response WebAuthnAssertionResponse `json:"response"`
+	} // @name WebAuthnAssertion
+
+	webAuthnClientData struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+
+	// webAuthnAuthData is the parsed authenticator data.
+	webAuthnAuthData struct {
+		rpIDHash     []byte
+		flags        byte
+		signCount    uint32
+		credentialID []byte // only with attested credential data
+	}
+)
+
+// COSE algorithm identifiers.
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+const (
+	webAuthnTimeout  = 5 * time.Minute
+	webAuthnCredType = "public-key"
+
+	authDataFlagUserPresent  = 0x01
+	authDataFlagAttestedData = 0x40
+	authDataMinLength        = 37 // rpIdHash (32) + flags (1) + signCount (4)
+)
+
+var webAuthnEncoding = base64.RawURLEncoding
+
+var (
+	ErrWebAuthnNotEnabled        = errors.New("no webauthn credential registered")
+	ErrChallengeExpired          = errors.New("no pending challenge, or challenge expired")
+	ErrWebAuthnCredentialExists  = errors.New("webauthn credential already registered")
+	ErrWebAuthnCredentialUnknown = errors.New("webauthn credential not found")
+	ErrWebAuthnNameRequired      = errors.New("credential name is required")
+	ErrWebAuthnInvalidResponse   = errors.New("invalid webauthn response")
+	ErrWebAuthnUnsupportedAlg    = errors.New("unsupported webauthn public key algorithm")
+)
+
+// BeginWebAuthnRegistration returns the options to create a WebAuthn credential for username,
+// for the relying party of the request host.
+func BeginWebAuthnRegistration(r *http.Request, username string) *WebAuthnCreationOptions {
+	challenge := newWebAuthnChallenge(challengeWebAuthnRegister, username)
+	userID := sha256.Sum256([]byte(username))
+
+	exclude := []WebAuthnCredentialDescriptor{}
+	if settings, ok := mfaStore.Load(username); ok {
+		exclude = webAuthnDescriptors(settings.WebAuthn)
+	}
+	return &WebAuthnCreationOptions{
+		RP:        WebAuthnRelyingParty{ID: webAuthnRPID(r), Name: totpIssuer},
+		User:      WebAuthnUserEntity{ID: webAuthnEncoding.EncodeToString(userID[:]), Name: username, DisplayName: username},
+		Challenge: challenge,
+		PubKeyCredParams: []WebAuthnCredentialParameter{
+			{Type: webAuthnCredType, Alg: coseAlgES256},
+			{Type: webAuthnCredType, Alg: coseAlgEdDSA},
+			{Type: webAuthnCredType, Alg: coseAlgRS256},
+		},
+		Timeout:            webAuthnTimeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: WebAuthnAuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+// FinishWebAuthnRegistration verifies the credential created with the options of BeginWebAuthnRegistration,
+// and registers it for username with name.
+func FinishWebAuthnRegistration(r *http.Request, username, name string, reg *WebAuthnRegistration) (*WebAuthnCredential, error) {
+	if name == "" {
+		return nil, ErrWebAuthnNameRequired
+	}
+	challenge, ok := takeChallenge(challengeWebAuthnRegister, username)
+	if !ok {
+		return nil, ErrNoPendingEnrollment
+	}
+	if reg.Type != webAuthnCredType {
+		return nil, fmt.Errorf("%w: unexpected type %q", ErrWebAuthnInvalidResponse, reg.Type)
+	}
+	authData, err := verifyWebAuthnResponse(r, "webauthn.create", challenge, reg.Response.ClientDataJSON, reg.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil || webAuthnEncoding.EncodeToString(authData.credentialID) != reg.ID {
+		return nil, fmt.Errorf("%w: credential id mismatch", ErrWebAuthnInvalidResponse)
+	}
+
+	publicKey, err := webAuthnEncoding.DecodeString(reg.Response.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid public key", ErrWebAuthnInvalidResponse)
+	}
+	if err := checkWebAuthnPublicKey(publicKey, reg.Response.PublicKeyAlgorithm); err != nil {
+		return nil, err
+	}
+
+	cred := storedWebAuthnCredential{
+		WebAuthnCredential: WebAuthnCredential{
+			ID:        reg.ID,
+			Name:      name,
+			CreatedAt: time.Now(),
+		},
+		PublicKey: publicKey,
+		Algorithm: reg.Response.PublicKeyAlgorithm,
+		SignCount: authData.signCount,
+	}
+	err = ErrWebAuthnCredentialExists
+	updateMFASettings(username, func(settings *mfaSettings) bool {
+		if webAuthnCredentialIndex(settings, cred.ID) != -1 {
+			return false
+		}
+		settings.WebAuthn = append(slices.Clone(settings.WebAuthn), cred)
+		err = nil
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("username", username).Str("name", name).Msg("webauthn credential registered")
+	return &cred.WebAuthnCredential, nil
+}
+
+// DeleteWebAuthnCredential deletes the WebAuthn credential of username with id.
+func DeleteWebAuthnCredential(username, id string) error {
+	err := fmt.Errorf("%w: %s", ErrWebAuthnCredentialUnknown, id)
+	updateMFASettings(username, func(settings *mfaSettings) bool {
+		i := webAuthnCredentialIndex(settings, id)
+		if i == -1 {
+			return false
+		}
+		settings.WebAuthn = slices.Delete(slices.Clone(settings.WebAuthn), i, i+1)
+		err = nil
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	log.Info().Str("username", username).Str("id", id).Msg("webauthn credential deleted")
+	return nil
+}
+
+// WebAuthnLoginBeginHandler returns the options to get a WebAuthn assertion for a login pending a second factor.
+func (auth *UserPassAuth) WebAuthnLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := auth.pendingMFAUser(w, r)
+	if !ok {
+		return
+	}
+	settings, ok := mfaStore.Load(username)
+	if !ok || len(settings.WebAuthn) == 0 {
+		http.Error(w, ErrWebAuthnNotEnabled.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = sonic.ConfigDefault.NewEncoder(w).Encode(WebAuthnRequestOptions{
+		Challenge:        newWebAuthnChallenge(challengeWebAuthnLogin, username),
+		RPID:             webAuthnRPID(r),
+		AllowCredentials: webAuthnDescriptors(settings.WebAuthn),
+		Timeout:          webAuthnTimeout.Milliseconds(),
+		UserVerification: "preferred",
+	})
+}
+
+// WebAuthnLoginFinishHandler completes a login pending a second factor with a WebAuthn assertion.
+func (auth *UserPassAuth) WebAuthnLoginFinishHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := auth.pendingMFAUser(w, r)
+	if !ok {
+		return
+	}
+	var assertion WebAuthnAssertion
+	if err := sonic.ConfigDefault.NewDecoder(r.Body).Decode(&assertion); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := verifyWebAuthnAssertion(r, username, &assertion); err != nil {
+		recordLoginFailure(r, username)
+		log.Debug().Err(err).Str("username", username).Msg("webauthn assertion rejected")
+		http.Error(w, ErrWebAuthnInvalidResponse.Error(), http.StatusBadRequest)
+		return
+	}
+	auth.completeMFA(w, r, username)
+}
+
+// verifyWebAuthnAssertion verifies an assertion of username for the challenge of WebAuthnLoginBeginHandler,
+// and updates the signature counter of the credential.
+func verifyWebAuthnAssertion(r *http.Request, username string, assertion *WebAuthnAssertion) error {
+	challenge, ok := takeChallenge(challengeWebAuthnLogin, username)
+	if !ok {
+		return ErrChallengeExpired
+	}
+	if assertion.Type != webAuthnCredType {
+		return fmt.Errorf("%w: unexpected type %q", ErrWebAuthnInvalidResponse, assertion.Type)
+	}
+	if assertion.Response.UserHandle != "" {
+		userID := sha256.Sum256([]byte(username))
+		if assertion.Response.UserHandle != webAuthnEncoding.EncodeToString(userID[:]) {
+			return fmt.Errorf("%w: user handle mismatch", ErrWebAuthnInvalidResponse)
+		}
+	}
+	authData, err := verifyWebAuthnResponse(r, "webauthn.get", challenge, assertion.Response.ClientDataJSON, assertion.Response.AuthenticatorData)
+	if err != nil {
+		return err
+	}
+	rawAuthData, _ := webAuthnEncoding.DecodeString(assertion.Response.AuthenticatorData)
+	rawClientData, _ := webAuthnEncoding.DecodeString(assertion.Response.ClientDataJSON)
+	signature, err := webAuthnEncoding.DecodeString(assertion.Response.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: invalid signature", ErrWebAuthnInvalidResponse)
+	}
+	clientDataHash := sha256.Sum256(rawClientData)
+	signed := append(rawAuthData, clientDataHash[:]...)
+
+	err = ErrWebAuthnCredentialUnknown
+	// verify and update in one step, so concurrent logins cannot reuse the same signature counter
+	updateMFASettings(username, func(settings *mfaSettings) bool {
+		i := webAuthnCredentialIndex(settings, assertion.ID)
+		if i == -1 {
+			return false
+		}
+		cred := settings.WebAuthn[i]
+		if err = verifyWebAuthnSignature(cred.PublicKey, cred.Algorithm, signed, signature); err != nil {
+			return false
+		}
+		// a counter not increasing indicates a cloned authenticator, authenticators without counters always send zero
+		if (authData.signCount != 0 || cred.SignCount != 0) && authData.signCount <= cred.SignCount {
+			err = fmt.Errorf("%w: signature counter did not increase", ErrWebAuthnInvalidResponse)
+			return false
+		}
+		cred.SignCount = authData.signCount
+		cred.LastUsedAt = time.Now()
+		settings.WebAuthn = slices.Clone(settings.WebAuthn)
+		settings.WebAuthn[i] = cred
+		return true
+	})
+	return err
+}
+
+// verifyWebAuthnResponse verifies the client data and authenticator data of a response to challenge,
+// and returns the parsed authenticator data.
+func verifyWebAuthnResponse(r *http.Request, ceremony string, challenge []byte, clientDataJSON, authenticatorData string) (*webAuthnAuthData, error) {
+	rawClientData, err := webAuthnEncoding.DecodeString(clientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid client data", ErrWebAuthnInvalidResponse)
+	}
+	var clientData webAuthnClientData
+	if err := sonic.Unmarshal(rawClientData, &clientData); err != nil {
+		return nil, fmt.Errorf("%w: invalid client data", ErrWebAuthnInvalidResponse)
+	}
+	switch {
+	case clientData.Type != ceremony:
+		return nil, fmt.Errorf("%w: unexpected ceremony %q", ErrWebAuthnInvalidResponse, clientData.Type)
+	case clientData.Challenge != webAuthnEncoding.EncodeToString(challenge):
+		return nil, fmt.Errorf("%w: challenge mismatch", ErrWebAuthnInvalidResponse)
+	case clientData.CrossOrigin:
+		return nil, fmt.Errorf("%w: cross origin request", ErrWebAuthnInvalidResponse)
+	}
+	if origin, err := url.Parse(clientData.Origin); err != nil || origin.Host != requestHost(r) {
+		return nil, fmt.Errorf("%w: origin mismatch: %s", ErrWebAuthnInvalidResponse, clientData.Origin)
+	}
+
+	rawAuthData, err := webAuthnEncoding.DecodeString(authenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid authenticator data", ErrWebAuthnInvalidResponse)
+	}
+	authData, err := parseWebAuthnAuthData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	rpIDHash := sha256.Sum256([]byte(webAuthnRPID(r)))
+	switch {
+	case !bytes.Equal(authData.rpIDHash, rpIDHash[:]):
+		return nil, fmt.Errorf("%w: relying party mismatch", ErrWebAuthnInvalidResponse)
+	case authData.flags&authDataFlagUserPresent == 0:
+		return nil, fmt.Errorf("%w: user not present", ErrWebAuthnInvalidResponse)
+	}
+	return authData, nil
+}
+
+// parseWebAuthnAuthData parses the authenticator data up to the credential ID of the attested credential data.
+func parseWebAuthnAuthData(data []byte) (*webAuthnAuthData, error) {
+	if len(data) < authDataMinLength {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrWebAuthnInvalidResponse)
+	}
+	authData := &webAuthnAuthData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&authDataFlagAttestedData == 0 {
+		return authData, nil
+	}
+	// aaguid (16) + credentialIdLength (2) + credentialId
+	rest := data[authDataMinLength:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrWebAuthnInvalidResponse)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	if len(rest) < 18+idLen {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrWebAuthnInvalidResponse)
+	}
+	authData.credentialID = rest[18 : 18+idLen]
+	return authData, nil
+}
+
+// checkWebAuthnPublicKey checks that publicKey is a supported key of the COSE algorithm alg.
+func checkWebAuthnPublicKey(publicKey []byte, alg int) error {
+	key, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("%w: invalid public key", ErrWebAuthnInvalidResponse)
+	}
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if alg == coseAlgES256 && key.Curve == elliptic.P256() {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if alg == coseAlgEdDSA {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if alg == coseAlgRS256 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrWebAuthnUnsupportedAlg, alg)
+}
+
+func verifyWebAuthnSignature(publicKey []byte, alg int, signed, signature []byte) error {
+	key, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(signed)
+	var ok bool
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		ok = alg == coseAlgES256 && ecdsa.VerifyASN1(key, hash[:], signature)
+	case ed25519.PublicKey:
+		ok = alg == coseAlgEdDSA && ed25519.Verify(key, signed, signature)
+	case *rsa.PublicKey:
+		ok = alg == coseAlgRS256 && rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil
+	}
+	if !ok {
+		return fmt.Errorf("%w: invalid signature", ErrWebAuthnInvalidResponse)
+	}
+	return nil
+}
+
+// newWebAuthnChallenge returns a base64url encoded random challenge of kind for username.
+func newWebAuthnChallenge(kind, username string) string {
+	challenge := make([]byte, 32)
+	_, _ = rand.Read(challenge)
+	storeChallenge(kind, username, challenge, webAuthnTimeout)
+	return webAuthnEncoding.EncodeToString(challenge)
+}
+
+// webAuthnRPID returns the relying party ID of the request, which is the request host without port.
+func webAuthnRPID(r *http.Request) string {
+	host := requestHost(r)
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		return hostname
+	}
+	return host
+}
+
+func webAuthnDescriptors(creds []storedWebAuthnCredential) []WebAuthnCredentialDescriptor {
+	descriptors := make([]WebAuthnCredentialDescriptor, len(creds))
+	for i, cred := range creds {
+		descriptors[i] = WebAuthnCredentialDescriptor{Type: webAuthnCredType, ID: cred.ID}
+	}
+	return descriptors
+}
+
+func webAuthnCredentialIndex(settings *mfaSettings, id string) int {
+	return slices.IndexFunc(settings.WebAuthn, func(cred storedWebAuthnCredential) bool {
+		return cred.ID == id
+	})
+}
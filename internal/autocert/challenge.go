@@ -0,0 +1,108 @@
+package autocert
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-acme/lego/v4/challenge/http01"
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+	"github.com/puzpuzpuz/xsync/v4"
+)
+
+// ACME challenge types.
+const (
+	ChallengeDNS01     = "dns-01"
+	ChallengeHTTP01    = "http-01"
+	ChallengeTLSALPN01 = "tls-alpn-01"
+)
+
+// TLSALPN01Protocol is the ALPN protocol of TLS-ALPN-01 challenge validations.
+const TLSALPN01Protocol = tlsalpn01.ACMETLS1Protocol
+
+type (
+	// http01Provider presents HTTP-01 challenges to be served by the entrypoint's HTTP servers.
+	http01Provider struct{}
+	// tlsALPN01Provider presents TLS-ALPN-01 challenges to be answered by GetCert.
+	tlsALPN01Provider struct{}
+
+	http01Challenge struct {
+		domain  string
+		keyAuth string
+	}
+)
+
+// pending challenges of all providers, shared by the entrypoints of old and new config during reloads.
+var (
+	http01Challenges    = xsync.NewMap[string, http01Challenge]()  // token -> challenge
+	tlsALPN01Challenges = xsync.NewMap[string, *tls.Certificate]() // domain -> challenge cert
+)
+
+var http01PathPrefix = http01.ChallengePath("")
+
+// Present implements challenge.Provider.
+func (http01Provider) Present(domain, token, keyAuth string) error {
+	http01Challenges.Store(token, http01Challenge{domain: domain, keyAuth: keyAuth})
+	return nil
+}
+
+// CleanUp implements challenge.Provider.
+func (http01Provider) CleanUp(domain, token, keyAuth string) error {
+	http01Challenges.Delete(token)
+	return nil
+}
+
+// Present implements challenge.Provider.
+func (tlsALPN01Provider) Present(domain, token, keyAuth string) error {
+	cert, err := tlsalpn01.ChallengeCert(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	tlsALPN01Challenges.Store(strings.ToLower(domain), cert)
+	return nil
+}
+
+// CleanUp implements challenge.Provider.
+func (tlsALPN01Provider) CleanUp(domain, token, keyAuth string) error {
+	tlsALPN01Challenges.Delete(strings.ToLower(domain))
+	return nil
+}
+
+// ServeHTTP01Challenge responds to r with the key authorization if it is a pending HTTP-01 challenge,
+// and reports whether it is.
+func ServeHTTP01Challenge(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.URL.Path, http01PathPrefix)
+	if !ok {
+		return false
+	}
+	chall, ok := http01Challenges.Load(token)
+	if !ok {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if !strings.EqualFold(host, chall.domain) {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(chall.keyAuth))
+	return true
+}
+
+// IsTLSALPN01Hello reports whether hello is of a TLS-ALPN-01 challenge validation,
+// which negotiates the acme-tls/1 protocol only.
+func IsTLSALPN01Hello(hello *tls.ClientHelloInfo) bool {
+	return hello != nil && len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == TLSALPN01Protocol
+}
+
+// tlsALPN01Cert returns the challenge certificate for hello, nil if it is not a pending TLS-ALPN-01 challenge.
+func tlsALPN01Cert(hello *tls.ClientHelloInfo) *tls.Certificate {
+	if !IsTLSALPN01Hello(hello) {
+		return nil
+	}
+	cert, _ := tlsALPN01Challenges.Load(strings.ToLower(hello.ServerName))
+	return cert
+}
@@ -0,0 +1,84 @@
+package autocert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTP01Challenge(t *testing.T) {
+	var p http01Provider
+	require.NoError(t, p.Present("example.com", "token", "key-auth"))
+
+	serve := func(host, path string) (bool, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+		return ServeHTTP01Challenge(w, r), w
+	}
+
+	served, w := serve("example.com", "/.well-known/acme-challenge/token")
+	require.True(t, served)
+	require.Equal(t, "key-auth", w.Body.String())
+
+	served, _ = serve("EXAMPLE.com:80", "/.well-known/acme-challenge/token")
+	require.True(t, served)
+
+	served, _ = serve("other.com", "/.well-known/acme-challenge/token")
+	require.False(t, served, "wrong host")
+	served, _ = serve("example.com", "/.well-known/acme-challenge/other")
+	require.False(t, served, "unknown token")
+	served, _ = serve("example.com", "/token")
+	require.False(t, served, "not a challenge")
+
+	require.NoError(t, p.CleanUp("example.com", "token", "key-auth"))
+	served, _ = serve("example.com", "/.well-known/acme-challenge/token")
+	require.False(t, served, "cleaned up")
+}
+
+func TestTLSALPN01Challenge(t *testing.T) {
+	provider, err := NewProvider(&Config{Provider: ProviderLocal}, nil, nil)
+	require.NoError(t, err)
+
+	hello := &tls.ClientHelloInfo{
+		ServerName:      "Example.com",
+		SupportedProtos: []string{TLSALPN01Protocol},
+	}
+	_, err = provider.GetCert(hello)
+	require.ErrorIs(t, err, ErrNoCertificates, "no pending challenge")
+
+	var p tlsALPN01Provider
+	require.NoError(t, p.Present("example.com", "token", "key-auth"))
+
+	cert, err := provider.GetCert(hello)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, []string{"example.com"}, leaf.DNSNames)
+	// id-pe-acmeIdentifier
+	require.True(t, hasExtension(leaf, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}))
+
+	// not a challenge validation
+	_, err = provider.GetCert(&tls.ClientHelloInfo{
+		ServerName:      "example.com",
+		SupportedProtos: []string{"h2", TLSALPN01Protocol},
+	})
+	require.ErrorIs(t, err, ErrNoCertificates)
+
+	require.NoError(t, p.CleanUp("example.com", "token", "key-auth"))
+	_, err = provider.GetCert(hello)
+	require.ErrorIs(t, err, ErrNoCertificates)
+}
+
+func hasExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/go-acme/lego/v4/challenge"
@@ -34,6 +35,16 @@ type (
 		ACMEKeyPath string                       `json:"acme_key_path,omitempty"` // shared by all extra providers with the same CA directory URL
 		Provider    string                       `json:"provider,omitempty"`
 		Options     map[string]strutils.Redacted `json:"options,omitempty"`
+		// ACME challenge type, http-01 and tls-alpn-01 are answered by the entrypoint on port 80 and 443
+		Challenge string `json:"challenge,omitempty" validate:"omitempty,oneof=dns-01 http-01 tls-alpn-01"` // default: dns-01
+		// Request certificates with the OCSP must-staple extension
+		MustStaple bool `json:"must_staple,omitempty"`
+		// Obtain certificates for hostnames of routes on demand, main provider only
+		OnDemand *OnDemandConfig `json:"on_demand,omitempty"`
+		// Internal CA of provider internal
+		InternalCA *InternalCAConfig `json:"internal_ca,omitempty"`
+		// Alert before certificates of all providers expire, main provider only
+		ExpiryAlerts *ExpiryAlertsConfig `json:"expiry_alerts,omitempty"`
 
 		Resolvers []string `json:"resolvers,omitempty"`
 
@@ -58,12 +69,19 @@ var (
 	ErrDuplicatedPath  = gperr.New("duplicated path")
 	ErrInvalidDomain   = gperr.New("invalid domain")
 	ErrUnknownProvider = gperr.New("unknown provider")
+	ErrChallenge       = gperr.New("challenge not supported by provider")
+	ErrOnDemand        = gperr.New("on demand certificates not supported by provider")
 )
 
 const (
 	ProviderLocal  = "local"
 	ProviderPseudo = "pseudo"
 	ProviderCustom = "custom"
+	// ProviderACME obtains certificates from ca_dir_url or Let's Encrypt
+	// with the http-01 or tls-alpn-01 challenge, without a DNS provider.
+	ProviderACME = "acme"
+	// ProviderInternal issues certificates from GoDoxy's internal CA, without an ACME server.
+	ProviderInternal = "internal"
 )
 
 var domainOrWildcardRE = regexp.MustCompile(`^\*?([^.]+\.)+[^.]+$`)
@@ -83,8 +101,15 @@ func (cfg *ConfigExtra) AsConfig() *Config {
 }
 
 func (cfg *Config) validate(seenPaths map[string]int) error {
+	if cfg.Challenge == "" {
+		cfg.Challenge = ChallengeDNS01
+	}
 	if cfg.Provider == "" {
-		cfg.Provider = ProviderLocal
+		if cfg.Challenge != ChallengeDNS01 {
+			cfg.Provider = ProviderACME
+		} else {
+			cfg.Provider = ProviderLocal
+		}
 	}
 	if cfg.CertPath == "" {
 		cfg.CertPath = CertFileDefault
@@ -116,11 +141,52 @@ func (cfg *Config) validate(seenPaths map[string]int) error {
 		b.Add(ErrMissingField.Subject("ca_dir_url"))
 	}
 
+	// http-01 and tls-alpn-01 are answered by GoDoxy itself, not by a DNS provider
+	switch cfg.Challenge {
+	case ChallengeDNS01:
+		if cfg.Provider == ProviderACME {
+			b.Add(ErrChallenge.Subject(cfg.Challenge).Withf("provider %s requires http-01 or tls-alpn-01", ProviderACME))
+		}
+	default:
+		if cfg.Provider != ProviderACME && cfg.Provider != ProviderCustom {
+			b.Add(ErrChallenge.Subject(cfg.Challenge).Withf("use provider %s or %s instead of %s", ProviderACME, ProviderCustom, cfg.Provider))
+		}
+		for i, d := range cfg.Domains {
+			if strings.HasPrefix(d, "*.") {
+				b.Add(ErrInvalidDomain.Subjectf("domains[%d]", i).Withf("wildcard domains require dns-01"))
+			}
+		}
+	}
+
+	if cfg.OnDemand != nil {
+		if cfg.Provider == ProviderLocal || cfg.Provider == ProviderPseudo || cfg.Provider == ProviderInternal {
+			b.Add(ErrOnDemand.Subject(cfg.Provider))
+		}
+		b.Add(cfg.OnDemand.Validate())
+	}
+
+	if cfg.idx == 0 {
+		if cfg.ExpiryAlerts == nil {
+			cfg.ExpiryAlerts = new(ExpiryAlertsConfig)
+		}
+		b.Add(cfg.ExpiryAlerts.Validate())
+	}
+
+	if cfg.Provider == ProviderInternal {
+		if cfg.InternalCA == nil {
+			cfg.InternalCA = new(InternalCAConfig)
+		}
+		b.Add(cfg.InternalCA.Validate())
+		// the internal CA has no OCSP responder
+		cfg.MustStaple = false
+	}
+
 	if cfg.Provider != ProviderLocal && cfg.Provider != ProviderPseudo {
-		if len(cfg.Domains) == 0 {
+		// certificates of on demand providers may be obtained on demand only
+		if len(cfg.Domains) == 0 && cfg.OnDemand == nil {
 			b.Add(ErrMissingField.Subject("domains"))
 		}
-		if cfg.Email == "" {
+		if cfg.Email == "" && cfg.Provider != ProviderInternal {
 			b.Add(ErrMissingField.Subject("email"))
 		}
 		if cfg.Provider != ProviderCustom {
@@ -135,7 +201,7 @@ func (cfg *Config) validate(seenPaths map[string]int) error {
 	// check if provider is implemented
 	providerConstructor, ok := Providers[cfg.Provider]
 	if !ok {
-		if cfg.Provider != ProviderCustom {
+		if cfg.Provider != ProviderCustom && cfg.Provider != ProviderACME && cfg.Provider != ProviderInternal {
 			b.Add(ErrUnknownProvider.
 				Subject(cfg.Provider).
 				With(gperr.DoYouMeanField(cfg.Provider, Providers)))
@@ -176,7 +242,7 @@ func (cfg *Config) GetLegoConfig() (*User, *lego.Config, error) {
 	var privKey *ecdsa.PrivateKey
 	var err error
 
-	if cfg.Provider != ProviderLocal && cfg.Provider != ProviderPseudo {
+	if cfg.Provider != ProviderLocal && cfg.Provider != ProviderPseudo && cfg.Provider != ProviderInternal {
 		if privKey, err = cfg.LoadACMEKey(); err != nil {
 			log.Info().Err(err).Msg("failed to load ACME private key, generating a now one")
 			privKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
@@ -219,6 +285,8 @@ func (cfg *Config) GetLegoConfig() (*User, *lego.Config, error) {
 func MergeExtraConfig(mainCfg *Config, extraCfg *ConfigExtra) ConfigExtra {
 	merged := ConfigExtra(*mainCfg)
 	merged.Extra = nil
+	merged.OnDemand = nil
+	merged.ExpiryAlerts = nil
 	merged.CertPath = extraCfg.CertPath
 	merged.KeyPath = extraCfg.KeyPath
 	// NOTE: Using same ACME key as main provider
@@ -229,6 +297,15 @@ func MergeExtraConfig(mainCfg *Config, extraCfg *ConfigExtra) ConfigExtra {
 	if extraCfg.Email != "" {
 		merged.Email = extraCfg.Email
 	}
+	if extraCfg.Challenge != "" {
+		merged.Challenge = extraCfg.Challenge
+	}
+	if extraCfg.MustStaple {
+		merged.MustStaple = true
+	}
+	if extraCfg.InternalCA != nil {
+		merged.InternalCA = extraCfg.InternalCA
+	}
 	if len(extraCfg.Domains) > 0 {
 		merged.Domains = extraCfg.Domains
 	}
@@ -3,6 +3,7 @@ package autocert_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/goccy/go-yaml"
 	"github.com/stretchr/testify/require"
@@ -59,3 +60,152 @@ func TestExtraCertKeyPathsUnique(t *testing.T) {
 		require.Error(t, cfg.Validate())
 	})
 }
+
+func TestChallengeConfig(t *testing.T) {
+	dnsproviders.InitProviders()
+
+	tests := []struct {
+		name         string
+		yaml         string
+		wantErr      bool
+		wantProvider string
+	}{
+		{
+			name:         "default dns-01",
+			yaml:         "provider: local",
+			wantProvider: autocert.ProviderLocal,
+		},
+		{
+			name:         "http-01 defaults to acme provider",
+			yaml:         "challenge: http-01\nemail: a@example.com\ndomains: [example.com]",
+			wantProvider: autocert.ProviderACME,
+		},
+		{
+			name:         "tls-alpn-01 with custom CA",
+			yaml:         "challenge: tls-alpn-01\nprovider: custom\nca_dir_url: https://ca.example.com/dir\nemail: a@example.com\ndomains: [example.com]",
+			wantProvider: autocert.ProviderCustom,
+		},
+		{
+			name:    "http-01 with wildcard domain",
+			yaml:    "challenge: http-01\nemail: a@example.com\ndomains: [\"*.example.com\"]",
+			wantErr: true,
+		},
+		{
+			name:    "http-01 with dns provider",
+			yaml:    "challenge: http-01\nprovider: cloudflare\nemail: a@example.com\ndomains: [example.com]\noptions: {auth_token: token}",
+			wantErr: true,
+		},
+		{
+			name:    "acme provider with dns-01",
+			yaml:    "challenge: dns-01\nprovider: acme\nemail: a@example.com\ndomains: [example.com]",
+			wantErr: true,
+		},
+		{
+			name:    "unknown challenge",
+			yaml:    "challenge: dns-02\nprovider: local",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := autocert.Config{}
+			err := serialization.UnmarshalValidate([]byte(test.yaml), &cfg, yaml.Unmarshal)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantProvider, cfg.Provider)
+		})
+	}
+
+	t.Run("extra inherits challenge", func(t *testing.T) {
+		cfg := autocert.Config{}
+		err := serialization.UnmarshalValidate([]byte(`
+challenge: http-01
+email: a@example.com
+domains: [example.com]
+extra:
+  - domains: [b.example.com]
+    cert_path: certs/b.crt
+    key_path: certs/b.key
+  - domains: ["*.example.com"]
+    challenge: dns-01
+    provider: cloudflare
+    options: {auth_token: token}
+    cert_path: certs/c.crt
+    key_path: certs/c.key
+`), &cfg, yaml.Unmarshal)
+		require.NoError(t, err)
+		require.Equal(t, autocert.ChallengeHTTP01, cfg.Extra[0].Challenge)
+		require.Equal(t, autocert.ProviderACME, cfg.Extra[0].Provider)
+		require.Equal(t, autocert.ChallengeDNS01, cfg.Extra[1].Challenge)
+	})
+}
+
+func TestInternalCAConfig(t *testing.T) {
+	dnsproviders.InitProviders()
+
+	cfg := autocert.Config{}
+	err := serialization.UnmarshalValidate([]byte("provider: internal\ndomains: [nas.local, \"*.home.arpa\"]\nmust_staple: true"), &cfg, yaml.Unmarshal)
+	require.NoError(t, err, "email is not required")
+	require.NotNil(t, cfg.InternalCA)
+	require.Equal(t, 7*24*time.Hour, cfg.InternalCA.Lifetime)
+	require.False(t, cfg.MustStaple, "internal CA has no OCSP responder")
+
+	for name, yml := range map[string]string{
+		"domains required":      "provider: internal",
+		"on demand":             "provider: internal\ndomains: [nas.local]\non_demand: {rate_limit: 5}",
+		"lifetime too short":    "provider: internal\ndomains: [nas.local]\ninternal_ca: {lifetime: 1m}",
+		"http-01 not supported": "provider: internal\nchallenge: http-01\ndomains: [nas.local]",
+		"invalid domain":        "provider: internal\ndomains: [\"nas local\"]",
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := autocert.Config{}
+			require.Error(t, serialization.UnmarshalValidate([]byte(yml), &cfg, yaml.Unmarshal))
+		})
+	}
+
+	t.Run("extra internal provider", func(t *testing.T) {
+		cfg := autocert.Config{}
+		err := serialization.UnmarshalValidate([]byte(`
+provider: cloudflare
+email: a@example.com
+domains: [example.com]
+options: {auth_token: token}
+extra:
+  - provider: internal
+    domains: [nas.local]
+    internal_ca: {lifetime: 24h}
+    cert_path: certs/internal.crt
+    key_path: certs/internal.key
+`), &cfg, yaml.Unmarshal)
+		require.NoError(t, err)
+		require.Nil(t, cfg.InternalCA)
+		require.Equal(t, autocert.ProviderInternal, cfg.Extra[0].Provider)
+		require.Equal(t, 24*time.Hour, cfg.Extra[0].InternalCA.Lifetime)
+	})
+}
+
+func TestExpiryAlertsConfig(t *testing.T) {
+	dnsproviders.InitProviders()
+
+	cfg := autocert.Config{}
+	err := serialization.UnmarshalValidate([]byte(`
+provider: local
+extra:
+  - cert_path: certs/extra.crt
+    key_path: certs/extra.key
+`), &cfg, yaml.Unmarshal)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.ExpiryAlerts, "enabled by default")
+	require.Equal(t, []int{1, 7, 14}, cfg.ExpiryAlerts.Days)
+	require.Nil(t, cfg.Extra[0].ExpiryAlerts, "main provider only")
+
+	cfg = autocert.Config{}
+	err = serialization.UnmarshalValidate([]byte("provider: local\nexpiry_alerts: {days: [30, 7, 30], to: [discord]}"), &cfg, yaml.Unmarshal)
+	require.NoError(t, err)
+	require.Equal(t, []int{7, 30}, cfg.ExpiryAlerts.Days)
+	require.Equal(t, []string{"discord"}, cfg.ExpiryAlerts.To)
+}
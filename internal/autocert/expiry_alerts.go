@@ -0,0 +1,153 @@
+package autocert
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	autocert "github.com/yusing/godoxy/internal/autocert/types"
+	"github.com/yusing/godoxy/internal/notif"
+	strutils "github.com/yusing/goutils/strings"
+	"github.com/yusing/goutils/task"
+)
+
+type (
+	// ExpiryAlertsConfig notifies before certificates of all providers expire,
+	// e.g. when renewals keep failing.
+	ExpiryAlertsConfig struct {
+		Days []int    `json:"days,omitempty" validate:"dive,min=1"` // days before expiry to alert at, default: [14, 7, 1]
+		To   []string `json:"to,omitempty"`                         // notification providers, default: all
+	}
+
+	expiryAlerts struct {
+		cfg *ExpiryAlertsConfig
+
+		mu      sync.Mutex
+		alerted map[string]int // cert path and expiry -> days of the last alert, 0 for expired
+	}
+)
+
+var defaultExpiryAlertDays = []int{14, 7, 1}
+
+const expiryAlertCheckInterval = time.Hour
+
+var expiryAlertNotify notif.NotifyFunc = notif.Notify
+
+func (cfg *ExpiryAlertsConfig) Validate() error {
+	if len(cfg.Days) == 0 {
+		cfg.Days = slices.Clone(defaultExpiryAlertDays)
+	}
+	slices.Sort(cfg.Days)
+	cfg.Days = slices.Compact(cfg.Days)
+	return nil
+}
+
+func newExpiryAlerts(cfg *ExpiryAlertsConfig) *expiryAlerts {
+	return &expiryAlerts{cfg: cfg, alerted: make(map[string]int)}
+}
+
+// scheduleExpiryAlerts checks the expiry of certificates now and every hour until parent is done.
+func (p *Provider) scheduleExpiryAlerts(parent task.Parent) {
+	task := parent.Subtask("cert-expiry-alerts", true)
+	go func() {
+		ticker := time.NewTicker(expiryAlertCheckInterval)
+		defer ticker.Stop()
+		defer task.Finish(nil)
+
+		p.checkExpiry(time.Now())
+		for {
+			select {
+			case <-task.Context().Done():
+				return
+			case now := <-ticker.C:
+				p.checkExpiry(now)
+			}
+		}
+	}()
+}
+
+// checkExpiry alerts once per threshold for certificates expiring within the configured days.
+func (p *Provider) checkExpiry(now time.Time) {
+	ea := p.expiryAlerts
+	ea.mu.Lock()
+	defer ea.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	for _, item := range p.GetCertInventory() {
+		if item.NotAfter == 0 {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", item.CertPath, item.NotAfter)
+		seen[key] = struct{}{}
+
+		days, ok := ea.threshold(time.Unix(item.NotAfter, 0).Sub(now))
+		if !ok {
+			continue
+		}
+		if last, alerted := ea.alerted[key]; alerted && last <= days {
+			continue
+		}
+		ea.alerted[key] = days
+		p.alertExpiry(&item, now)
+	}
+
+	// forget renewed and removed certificates
+	for key := range ea.alerted {
+		if _, ok := seen[key]; !ok {
+			delete(ea.alerted, key)
+		}
+	}
+}
+
+// threshold returns the smallest configured days not less than remaining, 0 if expired.
+func (ea *expiryAlerts) threshold(remaining time.Duration) (days int, ok bool) {
+	if remaining <= 0 {
+		return 0, true
+	}
+	for _, days := range ea.cfg.Days {
+		if remaining <= time.Duration(days)*24*time.Hour {
+			return days, true
+		}
+	}
+	return 0, false
+}
+
+func (p *Provider) alertExpiry(item *autocert.CertInventoryItem, now time.Time) {
+	expiry := time.Unix(item.NotAfter, 0)
+
+	var fields notif.FieldsBody
+	fields.Add("Provider", item.Provider)
+	fields.Add("Domains", strings.Join(item.DNSNames, ", "))
+	fields.Add("Expires", strutils.FormatTime(expiry))
+	if item.Error != "" {
+		fields.Add("Last Error", item.Error)
+	}
+
+	level, msg, color := zerolog.WarnLevel, "certificate expiring", notif.ColorWarning
+	// remaining days rounded up, a certificate expiring in 12 hours expires in 1 day
+	days := int((expiry.Sub(now) + 24*time.Hour - 1) / (24 * time.Hour))
+	title := fmt.Sprintf("SSL certificate expires in %d days for %s", days, item.Provider)
+	switch {
+	case days <= 0:
+		level, msg, color = zerolog.ErrorLevel, "certificate expired", notif.ColorError
+		title = "SSL certificate expired for " + item.Provider
+	case days == 1:
+		title = "SSL certificate expires in 1 day for " + item.Provider
+	}
+
+	p.logger.WithLevel(level).
+		Str("cert", item.CertPath).
+		Strs("domains", item.DNSNames).
+		Time("expires_at", expiry).
+		Msg(msg)
+	expiryAlertNotify(&notif.LogMessage{
+		Level: level,
+		Title: title,
+		Body:  fields,
+		Color: color,
+		To:    p.expiryAlerts.cfg.To,
+	})
+}
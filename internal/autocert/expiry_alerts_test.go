@@ -0,0 +1,81 @@
+package autocert
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/notif"
+)
+
+func TestExpiryAlerts(t *testing.T) {
+	var alerts []*notif.LogMessage
+	expiryAlertNotify = func(msg *notif.LogMessage) {
+		alerts = append(alerts, msg)
+	}
+	t.Cleanup(func() {
+		expiryAlertNotify = notif.Notify
+	})
+
+	cfg := &ExpiryAlertsConfig{To: []string{"ops"}}
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, []int{1, 7, 14}, cfg.Days)
+
+	dir := t.TempDir()
+	writeOnDemandCert(t, dir, "example.com")
+	p, err := NewProvider(&Config{
+		Provider:     ProviderLocal,
+		CertPath:     filepath.Join(dir, "example.com.crt"),
+		KeyPath:      filepath.Join(dir, "example.com.key"),
+		ExpiryAlerts: cfg,
+	}, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, p.LoadCertAll())
+	notAfter := p.tlsCert.Leaf.NotAfter
+
+	const day = 24 * time.Hour
+	for _, step := range []struct {
+		remaining time.Duration
+		title     string
+		level     zerolog.Level
+		color     notif.Color
+	}{
+		{30 * day, "", 0, 0},
+		{10 * day, "SSL certificate expires in 10 days for main", zerolog.WarnLevel, notif.ColorWarning},
+		{9 * day, "", 0, 0}, // alerted for the same threshold
+		{6*day + time.Hour, "SSL certificate expires in 7 days for main", zerolog.WarnLevel, notif.ColorWarning},
+		{12 * time.Hour, "SSL certificate expires in 1 day for main", zerolog.WarnLevel, notif.ColorWarning},
+		{-time.Minute, "SSL certificate expired for main", zerolog.ErrorLevel, notif.ColorError},
+		{-time.Hour, "", 0, 0},
+	} {
+		alerts = nil
+		p.checkExpiry(notAfter.Add(-step.remaining))
+		if step.title == "" {
+			require.Empty(t, alerts, step.remaining)
+			continue
+		}
+		require.Len(t, alerts, 1, step.remaining)
+		require.Equal(t, step.title, alerts[0].Title)
+		require.Equal(t, step.level, alerts[0].Level)
+		require.Equal(t, step.color, alerts[0].Color)
+		require.Equal(t, []string{"ops"}, alerts[0].To)
+	}
+
+	t.Run("renewed certificate", func(t *testing.T) {
+		cert, err := createTLSCert([]string{"example.com"})
+		require.NoError(t, err)
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		cert.Leaf.NotAfter = notAfter.Add(day)
+		p.tlsCert = cert
+
+		alerts = nil
+		p.checkExpiry(notAfter)
+		require.Len(t, alerts, 1)
+		require.Equal(t, "SSL certificate expires in 1 day for main", alerts[0].Title)
+		require.Len(t, p.expiryAlerts.alerted, 1, "alerts of the previous certificate are forgotten")
+	})
+}
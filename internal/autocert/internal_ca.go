@@ -0,0 +1,257 @@
+package autocert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/agent/pkg/agent"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// InternalCAConfig issues short-lived certificates from GoDoxy's own CA,
+// for private domains and hostnames public CAs cannot issue for, e.g. `*.home.arpa` and `nas.local`.
+type InternalCAConfig struct {
+	CertPath string        `json:"cert_path,omitempty"` // root certificate, default: certs/internal_ca.crt
+	KeyPath  string        `json:"key_path,omitempty"`  // root private key, default: certs/internal_ca.key
+	Lifetime time.Duration `json:"lifetime,omitempty"`  // lifetime of issued certificates, default: 168h (7 days)
+
+	// permittedDomains are the name constraints of the CA when it is created,
+	// the domains of all providers using it, see setInternalCADomains.
+	permittedDomains []string
+}
+
+const (
+	internalCACertFileDefault = certBasePath + "internal_ca.crt"
+	internalCAKeyFileDefault  = certBasePath + "internal_ca.key"
+	defaultInternalCALifetime = 7 * 24 * time.Hour
+	minInternalCALifetime     = time.Hour
+
+	internalCAName     = "GoDoxy Internal CA"
+	internalCAValidity = 10 // years
+	// tolerate clock skew of clients
+	internalCABackdate = 5 * time.Minute
+)
+
+var (
+	ErrInternalCA   = gperr.New("internal CA error")
+	ErrNoInternalCA = errors.New("no internal CA configured")
+)
+
+// internalCAMu prevents the main and extra providers from creating the same CA concurrently.
+var internalCAMu sync.Mutex
+
+func (cfg *InternalCAConfig) Validate() error {
+	if cfg.CertPath == "" {
+		cfg.CertPath = internalCACertFileDefault
+	}
+	if cfg.KeyPath == "" {
+		cfg.KeyPath = internalCAKeyFileDefault
+	}
+	if cfg.Lifetime == 0 {
+		cfg.Lifetime = defaultInternalCALifetime
+	}
+	if cfg.Lifetime < minInternalCALifetime {
+		return ErrInternalCA.Subject("lifetime").Withf("must be at least %s", minInternalCALifetime)
+	}
+	return nil
+}
+
+// loadInternalCA loads the internal CA, creating it if it does not exist.
+func loadInternalCA(cfg *InternalCAConfig) (*agent.PEMPair, error) {
+	internalCAMu.Lock()
+	defer internalCAMu.Unlock()
+
+	certPEM, err := os.ReadFile(cfg.CertPath)
+	if err == nil {
+		keyPEM, err := os.ReadFile(cfg.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		return &agent.PEMPair{Cert: certPEM, Key: keyPEM}, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// the root is long-lived and trusted by clients, constrain it to the configured domains
+	// so a leaked key cannot be used to impersonate other sites
+	ca, err := agent.NewCA(pkix.Name{
+		Organization: []string{"GoDoxy"},
+		CommonName:   internalCAName,
+	}, time.Now().AddDate(internalCAValidity, 0, 0), cfg.permittedDomains...)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.CertPath), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(cfg.KeyPath, ca.Key, 0o600); err != nil { // -rw-------
+		return nil, err
+	}
+	if err := os.WriteFile(cfg.CertPath, ca.Cert, 0o644); err != nil { // -rw-r--r--
+		return nil, err
+	}
+	log.Info().Str("path", cfg.CertPath).Strs("permitted_domains", cfg.permittedDomains).Msg("internal CA created")
+	return ca, nil
+}
+
+// setInternalCADomains sets the permitted domains of the internal CAs to the domains of all providers
+// using them, so a CA shared by the main and extra providers is valid for all of them.
+func (p *Provider) setInternalCADomains() {
+	domains := make(map[string][]string) // CA cert path -> domains
+	for _, provider := range p.allProviders() {
+		if provider.cfg.Provider == ProviderInternal {
+			domains[provider.cfg.InternalCA.CertPath] = append(domains[provider.cfg.InternalCA.CertPath], provider.cfg.Domains...)
+		}
+	}
+	for _, provider := range p.allProviders() {
+		if provider.cfg.Provider == ProviderInternal {
+			provider.cfg.InternalCA.permittedDomains = permittedDNSDomains(domains[provider.cfg.InternalCA.CertPath])
+		}
+	}
+}
+
+// permittedDNSDomains returns the name constraints covering domains: wildcards are replaced by
+// their parent domain, and subdomains of other domains are dropped.
+func permittedDNSDomains(domains []string) []string {
+	names := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		names = append(names, strings.ToLower(strings.TrimPrefix(domain, "*.")))
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	permitted := make([]string, 0, len(names))
+	for _, name := range names {
+		if !slices.ContainsFunc(names, func(parent string) bool { return isSubdomain(name, parent) }) {
+			permitted = append(permitted, name)
+		}
+	}
+	return permitted
+}
+
+// isSubdomain reports whether name is a subdomain of parent.
+func isSubdomain(name, parent string) bool {
+	return strings.HasSuffix(name, "."+parent)
+}
+
+// internalCAPermits reports whether caCert can issue a certificate for domain,
+// CAs without name constraints permit any domain.
+func internalCAPermits(caCert *x509.Certificate, domain string) bool {
+	if len(caCert.PermittedDNSDomains) == 0 {
+		return true
+	}
+	name := strings.ToLower(strings.TrimPrefix(domain, "*."))
+	return slices.ContainsFunc(caCert.PermittedDNSDomains, func(permitted string) bool {
+		return name == permitted || isSubdomain(name, permitted)
+	})
+}
+
+// parseCACert parses the root certificate of ca.
+func parseCACert(ca *agent.PEMPair) (*x509.Certificate, error) {
+	block, _ := pem.Decode(ca.Cert)
+	if block == nil {
+		return nil, ErrInternalCA.Withf("invalid certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// issueInternalCert issues a certificate for the configured domains from the internal CA,
+// bundled with the root certificate.
+func (p *Provider) issueInternalCert() (*certificate.Resource, error) {
+	ca, err := loadInternalCA(p.cfg.InternalCA)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := parseCACert(ca)
+	if err != nil {
+		return nil, err
+	}
+	for _, domain := range p.cfg.Domains {
+		if !internalCAPermits(caCert, domain) {
+			return nil, ErrInternalCA.Subject(domain).Withf("not permitted by %s, remove it and its key to create a new CA", p.cfg.InternalCA.CertPath)
+		}
+	}
+
+	now := time.Now()
+	leaf, err := agent.NewCert(ca, &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{"GoDoxy"},
+			CommonName:   p.cfg.Domains[0],
+		},
+		DNSNames:    p.cfg.Domains,
+		NotBefore:   now.Add(-internalCABackdate),
+		NotAfter:    now.Add(p.cfg.InternalCA.Lifetime),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Info().Strs("domains", p.cfg.Domains).Msg("certificate issued by internal CA")
+	return &certificate.Resource{
+		Domain:            p.cfg.Domains[0],
+		PrivateKey:        leaf.Key,
+		Certificate:       slices.Concat(leaf.Cert, ca.Cert),
+		IssuerCertificate: ca.Cert,
+	}, nil
+}
+
+// issuedByInternalCA reports whether the current certificate is issued by the current internal CA,
+// which may have been replaced.
+func (p *Provider) issuedByInternalCA() bool {
+	if p.tlsCert == nil || p.tlsCert.Leaf == nil {
+		return false
+	}
+	ca, err := loadInternalCA(p.cfg.InternalCA)
+	if err != nil {
+		return false
+	}
+	caCert, err := parseCACert(ca)
+	if err != nil {
+		return false
+	}
+	return p.tlsCert.Leaf.CheckSignatureFrom(caCert) == nil
+}
+
+// GetInternalCACert returns the PEM encoded root certificates of the internal CAs used by this provider
+// and extra providers, for clients to trust.
+func (p *Provider) GetInternalCACert() ([]byte, error) {
+	var certs []byte
+	seen := make(map[string]struct{})
+	for _, provider := range p.allProviders() {
+		if provider.cfg.Provider != ProviderInternal {
+			continue
+		}
+		if _, ok := seen[provider.cfg.InternalCA.CertPath]; ok {
+			continue
+		}
+		seen[provider.cfg.InternalCA.CertPath] = struct{}{}
+
+		ca, err := loadInternalCA(provider.cfg.InternalCA)
+		if err != nil {
+			return nil, provider.fmtError(err)
+		}
+		if !bytes.HasSuffix(ca.Cert, []byte("\n")) {
+			ca.Cert = append(ca.Cert, '\n')
+		}
+		certs = append(certs, ca.Cert...)
+	}
+	if len(certs) == 0 {
+		return nil, ErrNoInternalCA
+	}
+	return certs, nil
+}
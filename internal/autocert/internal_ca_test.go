@@ -0,0 +1,164 @@
+package autocert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestInternalCAProvider(t *testing.T, caDir string, domains ...string) *Provider {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &Config{
+		Provider: ProviderInternal,
+		Domains:  domains,
+		CertPath: filepath.Join(dir, "cert.crt"),
+		KeyPath:  filepath.Join(dir, "priv.key"),
+		InternalCA: &InternalCAConfig{
+			CertPath: filepath.Join(caDir, "internal_ca.crt"),
+			KeyPath:  filepath.Join(caDir, "internal_ca.key"),
+		},
+	}
+	require.NoError(t, cfg.InternalCA.Validate())
+	p, err := NewProvider(cfg, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, p.ObtainCertIfNotExistsAll())
+	return p
+}
+
+func TestInternalCA(t *testing.T) {
+	caDir := t.TempDir()
+	p := newTestInternalCAProvider(t, caDir, "nas.local", "*.home.arpa")
+
+	caPEM, err := p.GetInternalCACert()
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+
+	cert, err := p.GetCert(&tls.ClientHelloInfo{ServerName: "app.home.arpa"})
+	require.NoError(t, err)
+	require.Len(t, cert.Certificate, 2, "bundled with the root certificate")
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: "app.home.arpa", Roots: roots})
+	require.NoError(t, err)
+	require.Equal(t, "nas.local", cert.Leaf.Subject.CommonName)
+	require.Equal(t, internalCAName, cert.Leaf.Issuer.CommonName)
+	require.WithinDuration(t, time.Now().Add(defaultInternalCALifetime), cert.Leaf.NotAfter, time.Minute)
+
+	caCert, err := x509.ParseCertificate(cert.Certificate[1])
+	require.NoError(t, err)
+	require.True(t, caCert.PermittedDNSDomainsCritical)
+	require.Equal(t, []string{"home.arpa", "nas.local"}, caCert.PermittedDNSDomains)
+	require.WithinDuration(t, cert.Leaf.NotAfter.Add(-defaultInternalCALifetime/3), p.ShouldRenewOn(), time.Second)
+	require.Equal(t, CertStateValid, p.certState())
+
+	infos, err := p.GetCertInfos()
+	require.NoError(t, err)
+	require.Nil(t, infos[0].OCSP)
+
+	t.Run("CA persisted and shared", func(t *testing.T) {
+		p2 := newTestInternalCAProvider(t, caDir, "media.home.arpa")
+		caPEM2, err := p2.GetInternalCACert()
+		require.NoError(t, err)
+		require.Equal(t, caPEM, caPEM2)
+
+		info, err := os.Stat(filepath.Join(caDir, "internal_ca.key"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("domain not permitted", func(t *testing.T) {
+		dir := t.TempDir()
+		ca := *p.cfg.InternalCA
+		cfg := &Config{
+			Provider:   ProviderInternal,
+			Domains:    []string{"printer.local"},
+			CertPath:   filepath.Join(dir, "cert.crt"),
+			KeyPath:    filepath.Join(dir, "priv.key"),
+			InternalCA: &ca,
+		}
+		p3, err := NewProvider(cfg, nil, nil)
+		require.NoError(t, err)
+		require.ErrorContains(t, p3.ObtainCertIfNotExistsAll(), "not permitted")
+	})
+
+	t.Run("reissued after CA replaced", func(t *testing.T) {
+		require.NoError(t, os.Remove(filepath.Join(caDir, "internal_ca.crt")))
+		require.NoError(t, os.Remove(filepath.Join(caDir, "internal_ca.key")))
+		require.Equal(t, CertStateMismatch, p.certState())
+
+		renewed, err := p.renew(renewModeIfNeeded)
+		require.NoError(t, err)
+		require.True(t, renewed)
+		require.Equal(t, CertStateValid, p.certState())
+
+		newCAPEM, err := p.GetInternalCACert()
+		require.NoError(t, err)
+		require.NotEqual(t, caPEM, newCAPEM)
+	})
+}
+
+func TestInternalCASharedByExtraProviders(t *testing.T) {
+	caDir, certDir := t.TempDir(), t.TempDir()
+	ca := &InternalCAConfig{CertPath: filepath.Join(caDir, "ca.crt"), KeyPath: filepath.Join(caDir, "ca.key")}
+	require.NoError(t, ca.Validate())
+	cfg := &Config{
+		Provider:   ProviderInternal,
+		Domains:    []string{"nas.local"},
+		CertPath:   filepath.Join(certDir, "nas.crt"),
+		KeyPath:    filepath.Join(certDir, "nas.key"),
+		InternalCA: ca,
+		Extra: []ConfigExtra{
+			{
+				Provider:   ProviderInternal,
+				Domains:    []string{"*.home.arpa", "printer.home.arpa"},
+				CertPath:   filepath.Join(certDir, "home.crt"),
+				KeyPath:    filepath.Join(certDir, "home.key"),
+				InternalCA: ca,
+				idx:        1,
+			},
+		},
+	}
+
+	p, err := NewProvider(cfg, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"home.arpa", "nas.local"}, ca.permittedDomains)
+	// the extra provider creates the CA
+	for _, provider := range slices.Backward(p.allProviders()) {
+		require.NoError(t, provider.ObtainCert())
+	}
+
+	caPEM, err := p.GetInternalCACert()
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+	for _, host := range []string{"nas.local", "app.home.arpa"} {
+		cert, err := p.GetCert(&tls.ClientHelloInfo{ServerName: host})
+		require.NoError(t, err)
+		_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots})
+		require.NoError(t, err, host)
+	}
+}
+
+func TestInternalCALifetime(t *testing.T) {
+	cfg := &InternalCAConfig{Lifetime: time.Minute}
+	require.Error(t, cfg.Validate())
+
+	p := newTestInternalCAProvider(t, t.TempDir(), "nas.local")
+	p.cfg.InternalCA.Lifetime = 3 * time.Hour
+	require.NoError(t, p.ObtainCert())
+	require.WithinDuration(t, time.Now().Add(3*time.Hour), p.tlsCert.Leaf.NotAfter, time.Minute)
+	require.WithinDuration(t, time.Now().Add(2*time.Hour), p.ShouldRenewOn(), time.Minute)
+}
+
+func TestInternalCANotConfigured(t *testing.T) {
+	p, err := NewProvider(&Config{Provider: ProviderLocal}, nil, nil)
+	require.NoError(t, err)
+	_, err = p.GetInternalCACert()
+	require.ErrorIs(t, err, ErrNoInternalCA)
+}
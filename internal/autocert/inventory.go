@@ -0,0 +1,116 @@
+package autocert
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	autocert "github.com/yusing/godoxy/internal/autocert/types"
+)
+
+// renewalAttempt is the last attempt to obtain or renew the certificate of a provider.
+type renewalAttempt struct {
+	at  time.Time
+	err error
+}
+
+// GetCertInventory returns the certificates of this provider, extra providers and on demand certificates
+// with their renewal status, including providers failing to obtain their first certificate.
+func (p *Provider) GetCertInventory() []autocert.CertInventoryItem {
+	var items []autocert.CertInventoryItem
+	for _, provider := range p.allProviders() {
+		item := autocert.CertInventoryItem{
+			Provider: provider.GetName(),
+			Type:     provider.cfg.Provider,
+			CertPath: provider.cfg.CertPath,
+			DNSNames: provider.cfg.Domains,
+		}
+		if provider.tlsCert != nil && provider.tlsCert.Leaf != nil {
+			setCertInventoryLeaf(&item, provider.tlsCert)
+			if provider.cfg.Provider != ProviderLocal && provider.cfg.Provider != ProviderPseudo {
+				item.RenewAt = provider.ShouldRenewOn().Unix()
+			}
+		} else if provider.cfg.Provider == ProviderLocal || len(provider.cfg.Domains) == 0 {
+			// nothing to obtain
+			continue
+		}
+
+		if attempt := provider.lastAttempt.Load(); attempt != nil {
+			item.LastAttempt = attempt.at.Unix()
+			if attempt.err != nil {
+				item.LastFailure = attempt.at.Unix()
+				item.Error = attempt.err.Error()
+			}
+		} else if lastFailure := provider.persistedLastFailure(); !lastFailure.IsZero() {
+			item.LastFailure = lastFailure.Unix()
+		}
+		items = append(items, item)
+	}
+
+	if p.onDemand != nil {
+		var onDemandItems []autocert.CertInventoryItem
+		for host, cert := range p.onDemand.certs.Range {
+			if cert.Leaf == nil {
+				continue
+			}
+			certPath, _ := p.onDemand.paths(host)
+			item := autocert.CertInventoryItem{
+				Provider: "on_demand",
+				Type:     p.cfg.Provider,
+				CertPath: certPath,
+				RenewAt:  cert.Leaf.NotAfter.AddDate(0, -1, 0).Unix(),
+			}
+			setCertInventoryLeaf(&item, cert)
+			if lastFailure, ok := p.onDemand.failures.Load(host); ok {
+				item.LastFailure = lastFailure.Unix()
+			}
+			onDemandItems = append(onDemandItems, item)
+		}
+		slices.SortFunc(onDemandItems, func(a, b autocert.CertInventoryItem) int {
+			return strings.Compare(a.CertPath, b.CertPath)
+		})
+		items = append(items, onDemandItems...)
+	}
+	return items
+}
+
+func setCertInventoryLeaf(item *autocert.CertInventoryItem, cert *tls.Certificate) {
+	leaf := cert.Leaf
+	item.Subject = leaf.Subject.CommonName
+	item.Issuer = leaf.Issuer.CommonName
+	item.DNSNames = leaf.DNSNames
+	item.KeyType = keyType(leaf)
+	item.NotBefore = leaf.NotBefore.Unix()
+	item.NotAfter = leaf.NotAfter.Unix()
+}
+
+// persistedLastFailure returns the last failure persisted by a previous run, without caching it.
+func (p *Provider) persistedLastFailure() time.Time {
+	data, err := os.ReadFile(p.lastFailureFile)
+	if err != nil {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339, string(data))
+	return t
+}
+
+// keyType returns the public key algorithm and size of cert, e.g. ECDSA P-256 or RSA 2048.
+func keyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return cert.PublicKeyAlgorithm.String()
+	}
+}
@@ -0,0 +1,78 @@
+package autocert
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertInventory(t *testing.T) {
+	caDir, certDir := t.TempDir(), t.TempDir()
+	writeOnDemandCert(t, certDir, "local.example.com")
+	notDir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(notDir, nil, 0o644))
+
+	cfg := &Config{
+		Provider: ProviderLocal,
+		CertPath: filepath.Join(certDir, "local.example.com.crt"),
+		KeyPath:  filepath.Join(certDir, "local.example.com.key"),
+		Extra: []ConfigExtra{
+			{
+				Provider:   ProviderInternal,
+				Domains:    []string{"nas.local"},
+				CertPath:   filepath.Join(certDir, "nas.crt"),
+				KeyPath:    filepath.Join(certDir, "nas.key"),
+				InternalCA: &InternalCAConfig{CertPath: filepath.Join(caDir, "ca.crt"), KeyPath: filepath.Join(caDir, "ca.key")},
+				idx:        1,
+			},
+			{
+				Provider: ProviderInternal,
+				Domains:  []string{"broken.local"},
+				CertPath: filepath.Join(certDir, "broken.crt"),
+				KeyPath:  filepath.Join(certDir, "broken.key"),
+				// CA cannot be created
+				InternalCA: &InternalCAConfig{CertPath: filepath.Join(notDir, "ca.crt"), KeyPath: filepath.Join(notDir, "ca.key")},
+				idx:        2,
+			},
+		},
+	}
+	for i := range cfg.Extra {
+		require.NoError(t, cfg.Extra[i].InternalCA.Validate())
+	}
+
+	p, err := NewProvider(cfg, nil, nil)
+	require.NoError(t, err)
+	require.Error(t, p.ObtainCertIfNotExistsAll())
+
+	items := p.GetCertInventory()
+	require.Len(t, items, 3)
+
+	local := items[0]
+	require.Equal(t, "main", local.Provider)
+	require.Equal(t, ProviderLocal, local.Type)
+	require.Equal(t, "local.example.com", local.Subject)
+	require.Equal(t, "RSA 2048", local.KeyType)
+	require.NotZero(t, local.NotAfter)
+	require.Zero(t, local.RenewAt, "local certificates are not renewed")
+	require.Zero(t, local.LastAttempt)
+
+	internal := items[1]
+	require.Equal(t, "extra[1]", internal.Provider)
+	require.Equal(t, ProviderInternal, internal.Type)
+	require.Equal(t, []string{"nas.local"}, internal.DNSNames)
+	require.Equal(t, internalCAName, internal.Issuer)
+	require.Equal(t, "ECDSA P-256", internal.KeyType)
+	require.Equal(t, p.extraProviders[0].ShouldRenewOn().Unix(), internal.RenewAt)
+	require.NotZero(t, internal.LastAttempt)
+	require.Zero(t, internal.LastFailure)
+	require.Empty(t, internal.Error)
+
+	broken := items[2]
+	require.Equal(t, "extra[2]", broken.Provider)
+	require.Equal(t, []string{"broken.local"}, broken.DNSNames)
+	require.Zero(t, broken.NotAfter)
+	require.NotEmpty(t, broken.Error)
+	require.Equal(t, broken.LastAttempt, broken.LastFailure)
+}
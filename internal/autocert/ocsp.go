@@ -0,0 +1,256 @@
+package autocert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog"
+	autocert "github.com/yusing/godoxy/internal/autocert/types"
+	"github.com/yusing/godoxy/internal/mtls"
+	"github.com/yusing/godoxy/internal/notif"
+	"github.com/yusing/goutils/task"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspStaple is the OCSP response of a served certificate.
+type ocspStaple struct {
+	stapled   *tls.Certificate // copy of the certificate with the response stapled, nil if there is no response
+	resp      *ocsp.Response
+	err       error // error of the last refresh
+	refreshAt time.Time
+}
+
+// ocspStaples are the OCSP responses of served certificates, shared by the main provider and extra providers.
+type ocspStaples = xsync.Map[*tls.Certificate, *ocspStaple]
+
+const (
+	// ocspCheckInterval is how often responses due for refresh are refreshed.
+	ocspCheckInterval = 10 * time.Minute
+	// ocspRetryInterval is the interval to retry a failed refresh, the previous response is stapled until it expires.
+	ocspRetryInterval = 10 * time.Minute
+	// ocspDefaultRefresh is the refresh interval of responses without next update.
+	ocspDefaultRefresh = time.Hour
+)
+
+// oidTLSFeature is the TLS feature extension of must-staple certificates (RFC 7633).
+var oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+var errNoIssuer = errors.New("issuer certificate not found in the certificate bundle")
+
+// stapled returns cert with its OCSP response stapled, or cert itself if there is no valid response.
+func (p *Provider) stapled(cert *tls.Certificate) *tls.Certificate {
+	s, ok := p.ocspStaples.Load(cert)
+	if !ok || s.stapled == nil || !s.valid(time.Now()) {
+		return cert
+	}
+	return s.stapled
+}
+
+// ocspCerts returns the served certificates, including on demand certificates, with their OCSP response paths.
+func (p *Provider) ocspCerts() map[*tls.Certificate]string {
+	certs := make(map[*tls.Certificate]string)
+	for _, provider := range p.allProviders() {
+		if provider.tlsCert != nil {
+			certs[provider.tlsCert] = ocspPath(provider.cfg.CertPath)
+		}
+	}
+	if p.onDemand != nil {
+		for host, cert := range p.onDemand.certs.Range {
+			certPath, _ := p.onDemand.paths(host)
+			certs[cert] = ocspPath(certPath)
+		}
+	}
+	return certs
+}
+
+// ocspPath returns the path of the OCSP response persisted next to the certificate.
+func ocspPath(certPath string) string {
+	return certPath + ".ocsp"
+}
+
+// refreshOCSPAll refreshes the OCSP responses of served certificates due for refresh,
+// and removes the responses of certificates no longer served.
+func (p *Provider) refreshOCSPAll() {
+	certs := p.ocspCerts()
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for cert, path := range certs {
+		if s, ok := p.ocspStaples.Load(cert); ok && now.Before(s.refreshAt) {
+			continue
+		}
+		wg.Go(func() {
+			p.stapleOCSP(cert, path)
+		})
+	}
+	wg.Wait()
+
+	for cert := range p.ocspStaples.Range {
+		if _, ok := certs[cert]; !ok {
+			p.ocspStaples.Delete(cert)
+		}
+	}
+}
+
+// scheduleOCSPRefresh refreshes the OCSP responses of served certificates until parent is done.
+func (p *Provider) scheduleOCSPRefresh(parent task.Parent) {
+	task := parent.Subtask("ocsp-refresh-scheduler", true)
+	go func() {
+		ticker := time.NewTicker(ocspCheckInterval)
+		defer ticker.Stop()
+		defer task.Finish(nil)
+
+		for {
+			select {
+			case <-task.Context().Done():
+				return
+			case <-ticker.C:
+				p.refreshOCSPAll()
+			}
+		}
+	}()
+}
+
+// stapleOCSP staples the OCSP response of cert, loaded from path if still fresh or fetched from its OCSP responder.
+func (p *Provider) stapleOCSP(cert *tls.Certificate, path string) {
+	prev, _ := p.ocspStaples.Load(cert)
+	p.ocspStaples.Store(cert, p.refreshOCSP(cert, path, prev))
+}
+
+func (p *Provider) refreshOCSP(cert *tls.Certificate, path string, prev *ocspStaple) *ocspStaple {
+	leaf, issuer, err := certPair(cert)
+	if leaf != nil && len(leaf.OCSPServer) == 0 {
+		// nothing to staple until the certificate is replaced
+		return &ocspStaple{refreshAt: leaf.NotAfter}
+	}
+	if err != nil {
+		return &ocspStaple{err: err, refreshAt: time.Now().Add(ocspRetryInterval)}
+	}
+
+	logger := p.logger.With().Str("subject", leaf.Subject.CommonName).Logger()
+	now := time.Now()
+
+	// restarts reuse the persisted response
+	if prev == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			resp, err := ocsp.ParseResponseForCert(data, leaf, issuer)
+			if err == nil && now.Before(ocspRefreshAt(resp)) {
+				return newOCSPStaple(cert, resp)
+			}
+		}
+	}
+
+	resp, err := mtls.FetchOCSP(leaf, issuer)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to refresh OCSP response")
+		s := &ocspStaple{err: err, refreshAt: now.Add(ocspRetryInterval)}
+		if prev != nil && prev.resp != nil && prev.valid(now) {
+			s.stapled, s.resp = prev.stapled, prev.resp
+		}
+		return s
+	}
+
+	if err := os.WriteFile(path, resp.Raw, 0o644); err != nil { // -rw-r--r--
+		logger.Warn().Err(err).Str("path", path).Msg("failed to save OCSP response")
+	}
+
+	if resp.Status == ocsp.Revoked && (prev == nil || prev.resp == nil || prev.resp.Status != ocsp.Revoked) {
+		logger.Error().Time("revoked_at", resp.RevokedAt).Msg("certificate revoked")
+		notif.Notify(&notif.LogMessage{
+			Level: zerolog.ErrorLevel,
+			Title: "SSL certificate revoked for " + p.GetName(),
+			Body:  notif.ListBody(leaf.DNSNames),
+		})
+	}
+	return newOCSPStaple(cert, resp)
+}
+
+func newOCSPStaple(cert *tls.Certificate, resp *ocsp.Response) *ocspStaple {
+	s := &ocspStaple{resp: resp, refreshAt: ocspRefreshAt(resp)}
+	// clients are expected to retry later on unknown status, do not staple it
+	if resp.Status != ocsp.Unknown {
+		stapled := *cert
+		stapled.OCSPStaple = resp.Raw
+		s.stapled = &stapled
+	}
+	return s
+}
+
+// ocspRefreshAt returns the time to refresh resp, halfway through its validity period.
+func ocspRefreshAt(resp *ocsp.Response) time.Time {
+	if resp.NextUpdate.IsZero() {
+		return resp.ThisUpdate.Add(ocspDefaultRefresh)
+	}
+	return resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2)
+}
+
+// valid reports whether the stapled response is not expired at now.
+func (s *ocspStaple) valid(now time.Time) bool {
+	return s.resp != nil && (s.resp.NextUpdate.IsZero() || now.Before(s.resp.NextUpdate))
+}
+
+// certPair returns the leaf certificate of cert and its issuer, the leaf is returned with errNoIssuer.
+func certPair(cert *tls.Certificate) (leaf, issuer *x509.Certificate, err error) {
+	leaf = cert.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(cert.Certificate) < 2 {
+		return leaf, nil, errNoIssuer
+	}
+	issuer, err = x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return leaf, issuer, nil
+}
+
+// hasMustStaple reports whether cert has the must-staple TLS feature extension.
+func hasMustStaple(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidTLSFeature) {
+			return true
+		}
+	}
+	return false
+}
+
+// ocspInfo returns the OCSP status of cert, nil if it has no OCSP responder.
+func (p *Provider) ocspInfo(cert *tls.Certificate) *autocert.OCSPInfo {
+	if cert.Leaf == nil || len(cert.Leaf.OCSPServer) == 0 {
+		return nil
+	}
+	info := &autocert.OCSPInfo{Status: autocert.OCSPStatusUnavailable}
+	s, ok := p.ocspStaples.Load(cert)
+	if !ok {
+		return info
+	}
+	if s.err != nil {
+		info.Error = s.err.Error()
+	}
+	if s.resp == nil || !s.valid(time.Now()) {
+		return info
+	}
+	switch s.resp.Status {
+	case ocsp.Good:
+		info.Status = autocert.OCSPStatusGood
+	case ocsp.Revoked:
+		info.Status = autocert.OCSPStatusRevoked
+	default:
+		info.Status = autocert.OCSPStatusUnknown
+	}
+	info.ProducedAt = s.resp.ProducedAt.Unix()
+	info.ThisUpdate = s.resp.ThisUpdate.Unix()
+	if !s.resp.NextUpdate.IsZero() {
+		info.NextUpdate = s.resp.NextUpdate.Unix()
+	}
+	return info
+}
@@ -0,0 +1,228 @@
+package autocert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	autocert "github.com/yusing/godoxy/internal/autocert/types"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testOCSPResponder struct {
+	*httptest.Server
+	ca       *x509.Certificate
+	caKey    crypto.Signer
+	status   atomic.Int32 // ocsp status, -1 for HTTP 500
+	requests atomic.Int32
+}
+
+func newTestOCSPResponder(t *testing.T) *testOCSPResponder {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	r := &testOCSPResponder{ca: ca, caKey: caKey}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.requests.Add(1)
+		status := int(r.status.Load())
+		if status < 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		ocspReq, err := ocsp.ParseRequest(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		now := time.Now().Truncate(time.Minute)
+		template := ocsp.Response{
+			Status:       status,
+			SerialNumber: ocspReq.SerialNumber,
+			ThisUpdate:   now,
+			NextUpdate:   now.Add(time.Hour),
+		}
+		if status == ocsp.Revoked {
+			template.RevokedAt = now
+		}
+		resp, err := ocsp.CreateResponse(ca, ca, template, caKey)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		_, _ = w.Write(resp)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// writeCert writes a certificate bundle issued by the responder's CA to dir and returns the cert and key paths.
+func (r *testOCSPResponder) writeCert(t *testing.T, dir string, mustStaple bool) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		OCSPServer:   []string{r.URL},
+	}
+	if mustStaple {
+		// TLS feature: status_request
+		template.ExtraExtensions = []pkix.Extension{{Id: oidTLSFeature, Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05}}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, r.ca, &key.PublicKey, r.caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certPath, keyPath := filepath.Join(dir, "cert.crt"), filepath.Join(dir, "priv.key")
+	bundle := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: r.ca.Raw})...)
+	require.NoError(t, os.WriteFile(certPath, bundle, 0o644))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certPath, keyPath
+}
+
+func newTestOCSPProvider(t *testing.T, certPath, keyPath string) *Provider {
+	t.Helper()
+	p, err := NewProvider(&Config{Provider: ProviderLocal, CertPath: certPath, KeyPath: keyPath}, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, p.LoadCertAll())
+	return p
+}
+
+func TestOCSPStapling(t *testing.T) {
+	responder := newTestOCSPResponder(t)
+	certPath, keyPath := responder.writeCert(t, t.TempDir(), true)
+
+	p := newTestOCSPProvider(t, certPath, keyPath)
+	require.EqualValues(t, 1, responder.requests.Load())
+
+	cert, err := p.GetCert(&tls.ClientHelloInfo{ServerName: "example.com"})
+	require.NoError(t, err)
+	require.NotEmpty(t, cert.OCSPStaple)
+	resp, err := ocsp.ParseResponse(cert.OCSPStaple, responder.ca)
+	require.NoError(t, err)
+	require.Equal(t, ocsp.Good, resp.Status)
+	require.Empty(t, p.tlsCert.OCSPStaple, "served certificate is not modified")
+
+	persisted, err := os.ReadFile(ocspPath(certPath))
+	require.NoError(t, err)
+	require.Equal(t, cert.OCSPStaple, persisted)
+
+	infos, err := p.GetCertInfos()
+	require.NoError(t, err)
+	require.True(t, infos[0].MustStaple)
+	require.Equal(t, &autocert.OCSPInfo{
+		Status:     autocert.OCSPStatusGood,
+		ProducedAt: resp.ProducedAt.Unix(),
+		ThisUpdate: resp.ThisUpdate.Unix(),
+		NextUpdate: resp.NextUpdate.Unix(),
+	}, infos[0].OCSP)
+
+	t.Run("not refreshed before due", func(t *testing.T) {
+		p.refreshOCSPAll()
+		require.EqualValues(t, 1, responder.requests.Load())
+	})
+
+	t.Run("persisted response reused on restart", func(t *testing.T) {
+		p := newTestOCSPProvider(t, certPath, keyPath)
+		require.EqualValues(t, 1, responder.requests.Load())
+		cert, err := p.GetCert(nil)
+		require.NoError(t, err)
+		require.Equal(t, persisted, cert.OCSPStaple)
+	})
+
+	t.Run("previous response stapled on failure", func(t *testing.T) {
+		responder.status.Store(-1)
+		t.Cleanup(func() { responder.status.Store(ocsp.Good) })
+
+		p.stapleOCSP(p.tlsCert, ocspPath(certPath))
+		cert, err := p.GetCert(nil)
+		require.NoError(t, err)
+		require.Equal(t, persisted, cert.OCSPStaple)
+
+		infos, err := p.GetCertInfos()
+		require.NoError(t, err)
+		require.Equal(t, autocert.OCSPStatusGood, infos[0].OCSP.Status)
+		require.NotEmpty(t, infos[0].OCSP.Error)
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		responder.status.Store(ocsp.Revoked)
+		t.Cleanup(func() { responder.status.Store(ocsp.Good) })
+
+		p.stapleOCSP(p.tlsCert, ocspPath(certPath))
+		infos, err := p.GetCertInfos()
+		require.NoError(t, err)
+		require.Equal(t, autocert.OCSPStatusRevoked, infos[0].OCSP.Status)
+	})
+
+	t.Run("unknown not stapled", func(t *testing.T) {
+		responder.status.Store(ocsp.Unknown)
+		t.Cleanup(func() { responder.status.Store(ocsp.Good) })
+
+		p.stapleOCSP(p.tlsCert, ocspPath(certPath))
+		cert, err := p.GetCert(nil)
+		require.NoError(t, err)
+		require.Empty(t, cert.OCSPStaple)
+	})
+}
+
+func TestOCSPStaplingWithoutResponder(t *testing.T) {
+	dir := t.TempDir()
+	cert, err := createTLSCert([]string{"example.com"})
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	certPath, keyPath := filepath.Join(dir, "cert.crt"), filepath.Join(dir, "priv.key")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o644))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	p := newTestOCSPProvider(t, certPath, keyPath)
+	served, err := p.GetCert(nil)
+	require.NoError(t, err)
+	require.Same(t, p.tlsCert, served)
+
+	infos, err := p.GetCertInfos()
+	require.NoError(t, err)
+	require.False(t, infos[0].MustStaple)
+	require.Nil(t, infos[0].OCSP)
+	require.NoFileExists(t, ocspPath(certPath))
+}
@@ -0,0 +1,359 @@
+package autocert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog/log"
+	autocert "github.com/yusing/godoxy/internal/autocert/types"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/goutils/task"
+	"golang.org/x/time/rate"
+)
+
+type (
+	// OnDemandConfig obtains certificates for hostnames of routes on their first TLS handshake,
+	// for hostnames not covered by the certificates of the main and extra providers.
+	OnDemandConfig struct {
+		Dir       string        `json:"dir,omitempty"`                         // default: certs/on_demand
+		RateLimit int           `json:"rate_limit,omitempty" validate:"min=0"` // certificates obtained per interval, default: 10
+		Interval  time.Duration `json:"interval,omitempty"`                    // default: 1h
+		// URL asked with ?domain=<hostname> before obtaining a certificate, a 2xx response allows it
+		Ask string `json:"ask,omitempty" validate:"omitempty,url"`
+	}
+
+	// OnDemandAllowFunc reports whether a certificate may be obtained on demand for host.
+	OnDemandAllowFunc func(host string) bool
+
+	onDemand struct {
+		cfg     *OnDemandConfig
+		p       *Provider
+		allow   atomic.Pointer[OnDemandAllowFunc]
+		limiter *rate.Limiter
+
+		certs    *xsync.Map[string, *tls.Certificate] // host -> cert
+		pending  *xsync.Map[string, struct{}]         // hosts being obtained
+		failures *xsync.Map[string, time.Time]        // host -> last failure, pruned after the cooldown
+	}
+)
+
+const (
+	defaultOnDemandRateLimit = 10
+	defaultOnDemandInterval  = time.Hour
+	onDemandDirDefault       = certBasePath + "on_demand/"
+
+	// hosts failed to obtain a certificate are not retried until the cooldown ends
+	onDemandFailureCooldown = 10 * time.Minute
+	onDemandRenewInterval   = 12 * time.Hour
+	onDemandAskTimeout      = 10 * time.Second
+)
+
+var onDemandHostRE = regexp.MustCompile(`^([a-z0-9_-]+\.)+[a-z0-9-]+$`)
+
+var onDemandAskClient = &http.Client{Timeout: onDemandAskTimeout}
+
+func (cfg *OnDemandConfig) Validate() error {
+	if cfg.Dir == "" {
+		cfg.Dir = onDemandDirDefault
+	}
+	if cfg.RateLimit == 0 {
+		cfg.RateLimit = defaultOnDemandRateLimit
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultOnDemandInterval
+	}
+	return nil
+}
+
+func newOnDemand(p *Provider) *onDemand {
+	cfg := p.cfg.OnDemand
+	od := &onDemand{
+		cfg:      cfg,
+		p:        p,
+		limiter:  rate.NewLimiter(rate.Every(cfg.Interval/time.Duration(cfg.RateLimit)), cfg.RateLimit),
+		certs:    xsync.NewMap[string, *tls.Certificate](),
+		pending:  xsync.NewMap[string, struct{}](),
+		failures: xsync.NewMap[string, time.Time](),
+	}
+	if err := od.load(); err != nil {
+		p.logger.Err(err).Msg("failed to load on demand certificates")
+	}
+	return od
+}
+
+// SetOnDemandAllow sets the check of hostnames to obtain certificates on demand for,
+// no certificate is obtained on demand until it is set.
+func (p *Provider) SetOnDemandAllow(allow OnDemandAllowFunc) {
+	if p.onDemand != nil {
+		p.onDemand.allow.Store(&allow)
+	}
+}
+
+// load loads the certificates obtained on demand previously.
+func (od *onDemand) load() error {
+	files, err := os.ReadDir(od.cfg.Dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range files {
+		host, ok := strings.CutSuffix(f.Name(), ".crt")
+		if !ok || f.IsDir() {
+			continue
+		}
+		certPath, keyPath := od.paths(host)
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			log.Warn().Err(err).Str("domain", host).Msg("failed to load on demand certificate")
+			continue
+		}
+		od.certs.Store(host, &cert)
+	}
+	return nil
+}
+
+func (od *onDemand) paths(host string) (certPath, keyPath string) {
+	return filepath.Join(od.cfg.Dir, host+".crt"), filepath.Join(od.cfg.Dir, host+".key")
+}
+
+// getCert returns the certificate of serverName obtained on demand.
+//
+// If there is none, it starts obtaining one in the background if allowed and returns nil.
+func (od *onDemand) getCert(serverName string) *tls.Certificate {
+	host := normalizeServerName(serverName)
+	if cert, ok := od.certs.Load(host); ok {
+		return cert
+	}
+	if !od.allowed(host) {
+		return nil
+	}
+	if lastFailure, ok := od.failures.Load(host); ok && time.Since(lastFailure) < onDemandFailureCooldown {
+		return nil
+	}
+	if _, loaded := od.pending.LoadOrStore(host, struct{}{}); !loaded {
+		go func() {
+			defer od.pending.Delete(host)
+			if err := od.obtain(host, true); err != nil {
+				od.failures.Store(host, time.Now())
+				od.p.logger.Warn().Err(err).Str("domain", host).Msg("failed to obtain on demand certificate")
+			}
+		}()
+	}
+	return nil
+}
+
+// allowed reports whether host is a valid hostname allowed by the allow check.
+func (od *onDemand) allowed(host string) bool {
+	if !onDemandHostRE.MatchString(host) || len(host) > 253 || net.ParseIP(host) != nil {
+		return false
+	}
+	allow := od.allow.Load()
+	return allow != nil && (*allow)(host)
+}
+
+// obtain obtains a certificate for host, if allowed by the ask URL and the rate limit.
+func (od *onDemand) obtain(host string, limit bool) error {
+	if err := od.ask(host); err != nil {
+		return err
+	}
+	if limit && !od.limiter.Allow() {
+		return errors.New("rate limited")
+	}
+
+	client, err := od.p.acmeClient()
+	if err != nil {
+		return err
+	}
+
+	od.p.logger.Info().Str("domain", host).Msg("obtaining on demand certificate")
+	res, err := client.Certificate.Obtain(certificate.ObtainRequest{
+		Domains:    []string{host},
+		Bundle:     true,
+		MustStaple: od.p.cfg.MustStaple,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := od.save(host, res); err != nil {
+		return err
+	}
+
+	cert, err := tls.X509KeyPair(res.Certificate, res.PrivateKey)
+	if err != nil {
+		return err
+	}
+	certPath, _ := od.paths(host)
+	od.p.stapleOCSP(&cert, ocspPath(certPath))
+	od.certs.Store(host, &cert)
+	od.failures.Delete(host)
+	od.p.logger.Info().Str("domain", host).Msg("on demand certificate obtained")
+	return nil
+}
+
+// ask asks the ask URL whether host is allowed, if configured.
+func (od *onDemand) ask(host string) error {
+	if od.cfg.Ask == "" {
+		return nil
+	}
+	u, err := url.Parse(od.cfg.Ask)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("domain", host)
+	u.RawQuery = q.Encode()
+
+	resp, err := onDemandAskClient.Get(u.String())
+	if err != nil {
+		return fmt.Errorf("ask: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("ask: not allowed, status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (od *onDemand) save(host string, res *certificate.Resource) error {
+	if common.IsTest {
+		return nil
+	}
+	if err := os.MkdirAll(od.cfg.Dir, 0o755); err != nil {
+		return err
+	}
+	certPath, keyPath := od.paths(host)
+	if err := os.WriteFile(keyPath, res.PrivateKey, 0o600); err != nil { // -rw-------
+		return err
+	}
+	return os.WriteFile(certPath, res.Certificate, 0o644) // -rw-r--r--
+}
+
+func (od *onDemand) remove(host string) {
+	od.certs.Delete(host)
+	if common.IsTest {
+		return
+	}
+	certPath, keyPath := od.paths(host)
+	_ = os.Remove(certPath)
+	_ = os.Remove(keyPath)
+	_ = os.Remove(ocspPath(certPath))
+}
+
+// scheduleRenewal renews certificates of hosts still allowed 1 month before expiry,
+// and removes expired certificates of hosts no longer allowed.
+//
+// Failures of hosts are pruned once their cooldown ends, since any SNI may add one.
+func (od *onDemand) scheduleRenewal(parent task.Parent) {
+	task := parent.Subtask("cert-renew-scheduler:on_demand", true)
+	go func() {
+		ticker := time.NewTicker(onDemandRenewInterval)
+		defer ticker.Stop()
+		pruneTicker := time.NewTicker(onDemandFailureCooldown)
+		defer pruneTicker.Stop()
+		defer task.Finish(nil)
+
+		for {
+			select {
+			case <-task.Context().Done():
+				return
+			case <-ticker.C:
+				od.renew()
+			case now := <-pruneTicker.C:
+				od.pruneFailures(now)
+			}
+		}
+	}()
+}
+
+// pruneFailures removes failures of hosts whose cooldown has ended.
+func (od *onDemand) pruneFailures(now time.Time) {
+	for host, lastFailure := range od.failures.Range {
+		if now.Sub(lastFailure) >= onDemandFailureCooldown {
+			od.failures.Delete(host)
+		}
+	}
+}
+
+func (od *onDemand) renew() {
+	now := time.Now()
+	for host, cert := range od.certs.Range {
+		if cert.Leaf == nil || now.Before(cert.Leaf.NotAfter.AddDate(0, -1, 0)) {
+			continue
+		}
+		if !od.allowed(host) {
+			if now.After(cert.Leaf.NotAfter) {
+				od.p.logger.Info().Str("domain", host).Msg("removing expired on demand certificate")
+				od.remove(host)
+			}
+			continue
+		}
+		if err := od.obtain(host, false); err != nil {
+			od.p.logger.Warn().Err(err).Str("domain", host).Msg("on demand certificate renewal failed")
+		}
+	}
+}
+
+func (od *onDemand) certInfos() []autocert.CertInfo {
+	var infos []autocert.CertInfo
+	for _, cert := range od.certs.Range {
+		if cert.Leaf == nil {
+			continue
+		}
+		infos = append(infos, od.p.certInfo(cert))
+	}
+	return infos
+}
+
+// onDemandFallbackCert returns a self-signed certificate for handshakes while certificates are obtained on demand,
+// when the main provider has no certificate.
+var onDemandFallbackCert = sync.OnceValues(func() (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "GoDoxy on demand certificate pending"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+})
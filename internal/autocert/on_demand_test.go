@@ -0,0 +1,106 @@
+package autocert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOnDemand(t *testing.T, cfg *OnDemandConfig) *Provider {
+	t.Helper()
+	if cfg.Dir == "" {
+		cfg.Dir = t.TempDir()
+	}
+	require.NoError(t, cfg.Validate())
+	p, err := NewProvider(&Config{Provider: ProviderCustom, OnDemand: cfg}, nil, nil)
+	require.NoError(t, err)
+	return p
+}
+
+func writeOnDemandCert(t *testing.T, dir, host string) {
+	t.Helper()
+	cert, err := createTLSCert([]string{host})
+	require.NoError(t, err)
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, host+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, host+".key"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600))
+}
+
+func TestOnDemandLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeOnDemandCert(t, dir, "app.example.com")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.example.com.crt"), []byte("broken"), 0o644))
+
+	p := newTestOnDemand(t, &OnDemandConfig{Dir: dir})
+	require.Equal(t, 1, p.onDemand.certs.Size())
+
+	cert, err := p.GetCert(&tls.ClientHelloInfo{ServerName: "APP.example.com."})
+	require.NoError(t, err)
+	require.Equal(t, []string{"app.example.com"}, cert.Leaf.DNSNames)
+
+	// pending without an allow check
+	cert, err = p.GetCert(&tls.ClientHelloInfo{ServerName: "other.example.com"})
+	require.NoError(t, err)
+	fallback, err := onDemandFallbackCert()
+	require.NoError(t, err)
+	require.Same(t, fallback, cert)
+	require.Equal(t, 0, p.onDemand.pending.Size())
+
+	cert, err = p.GetCert(nil)
+	require.NoError(t, err)
+	require.Same(t, fallback, cert)
+}
+
+func TestOnDemandAllowed(t *testing.T) {
+	p := newTestOnDemand(t, &OnDemandConfig{})
+	require.False(t, p.onDemand.allowed("app.example.com"), "no allow check")
+
+	p.SetOnDemandAllow(func(host string) bool { return true })
+	for host, allowed := range map[string]bool{
+		"app.example.com":        true,
+		"a_b.example.com":        true,
+		"localhost":              false,
+		"127.0.0.1":              false,
+		"*.example.com":          false,
+		"../example.com":         false,
+		"app.example.com/../etc": false,
+		"":                       false,
+	} {
+		require.Equal(t, allowed, p.onDemand.allowed(host), host)
+	}
+}
+
+func TestOnDemandAsk(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("domain") != "app.example.com" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	p := newTestOnDemand(t, &OnDemandConfig{Ask: srv.URL + "/check?token=abc"})
+	require.NoError(t, p.onDemand.ask("app.example.com"))
+	require.Error(t, p.onDemand.ask("other.example.com"))
+}
+
+func TestOnDemandPruneFailures(t *testing.T) {
+	p := newTestOnDemand(t, &OnDemandConfig{})
+	now := time.Now()
+	p.onDemand.failures.Store("old.example.com", now.Add(-onDemandFailureCooldown))
+	p.onDemand.failures.Store("new.example.com", now.Add(-time.Minute))
+
+	p.onDemand.pruneFailures(now)
+	_, ok := p.onDemand.failures.Load("old.example.com")
+	require.False(t, ok)
+	_, ok = p.onDemand.failures.Load("new.example.com")
+	require.True(t, ok, "still in cooldown")
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/go-acme/lego/v4/certificate"
 	"github.com/go-acme/lego/v4/lego"
 	"github.com/go-acme/lego/v4/registration"
+	"github.com/puzpuzpuz/xsync/v4"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	autocert "github.com/yusing/godoxy/internal/autocert/types"
@@ -38,7 +39,9 @@ type (
 		user        *User
 		legoCfg     *lego.Config
 		client      *lego.Client
+		clientMu    sync.Mutex
 		lastFailure time.Time
+		lastAttempt atomic.Pointer[renewalAttempt]
 
 		lastFailureFile string
 
@@ -48,6 +51,9 @@ type (
 
 		extraProviders []*Provider
 		sniMatcher     sniMatcher
+		onDemand       *onDemand     // main provider only
+		expiryAlerts   *expiryAlerts // main provider only
+		ocspStaples    *ocspStaples
 
 		forceRenewalCh     chan struct{}
 		forceRenewalDoneCh atomic.Value // chan struct{}
@@ -81,6 +87,7 @@ func NewProvider(cfg *Config, user *User, legoCfg *lego.Config) (*Provider, erro
 		legoCfg:         legoCfg,
 		lastFailureFile: lastFailureFileFor(cfg.CertPath, cfg.KeyPath),
 		forceRenewalCh:  make(chan struct{}, 1),
+		ocspStaples:     xsync.NewMap[*tls.Certificate, *ocspStaple](),
 	}
 	p.forceRenewalDoneCh.Store(emptyForceRenewalDoneCh)
 
@@ -89,23 +96,43 @@ func NewProvider(cfg *Config, user *User, legoCfg *lego.Config) (*Provider, erro
 	} else {
 		p.logger = log.With().Str("provider", fmt.Sprintf("extra[%d]", cfg.idx)).Logger()
 	}
+	if cfg.OnDemand != nil {
+		p.onDemand = newOnDemand(p)
+	}
+	if cfg.ExpiryAlerts != nil {
+		p.expiryAlerts = newExpiryAlerts(cfg.ExpiryAlerts)
+	}
 	if err := p.setupExtraProviders(); err != nil {
 		return nil, err
 	}
+	if cfg.idx == 0 {
+		p.setInternalCADomains()
+	}
 	return p, nil
 }
 
 func (p *Provider) GetCert(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
-	if p.tlsCert == nil {
+	if cert := tlsALPN01Cert(hello); cert != nil {
+		return cert, nil
+	}
+	if p.tlsCert == nil && p.onDemand == nil {
 		return nil, ErrNoCertificates
 	}
-	if hello == nil || hello.ServerName == "" {
-		return p.tlsCert, nil
+	if hello != nil && hello.ServerName != "" {
+		if prov := p.sniMatcher.match(hello.ServerName); prov != nil && prov.tlsCert != nil {
+			return p.stapled(prov.tlsCert), nil
+		}
+		if p.onDemand != nil {
+			if cert := p.onDemand.getCert(hello.ServerName); cert != nil {
+				return p.stapled(cert), nil
+			}
+		}
 	}
-	if prov := p.sniMatcher.match(hello.ServerName); prov != nil && prov.tlsCert != nil {
-		return prov.tlsCert, nil
+	if p.tlsCert == nil {
+		// on demand certificate pending
+		return onDemandFallbackCert()
 	}
-	return p.tlsCert, nil
+	return p.stapled(p.tlsCert), nil
 }
 
 func (p *Provider) GetCertInfos() ([]autocert.CertInfo, error) {
@@ -115,14 +142,10 @@ func (p *Provider) GetCertInfos() ([]autocert.CertInfo, error) {
 		if provider.tlsCert == nil {
 			continue
 		}
-		certInfos = append(certInfos, autocert.CertInfo{
-			Subject:        provider.tlsCert.Leaf.Subject.CommonName,
-			Issuer:         provider.tlsCert.Leaf.Issuer.CommonName,
-			NotBefore:      provider.tlsCert.Leaf.NotBefore.Unix(),
-			NotAfter:       provider.tlsCert.Leaf.NotAfter.Unix(),
-			DNSNames:       provider.tlsCert.Leaf.DNSNames,
-			EmailAddresses: provider.tlsCert.Leaf.EmailAddresses,
-		})
+		certInfos = append(certInfos, p.certInfo(provider.tlsCert))
+	}
+	if p.onDemand != nil {
+		certInfos = append(certInfos, p.onDemand.certInfos()...)
 	}
 
 	if len(certInfos) == 0 {
@@ -131,6 +154,20 @@ func (p *Provider) GetCertInfos() ([]autocert.CertInfo, error) {
 	return certInfos, nil
 }
 
+func (p *Provider) certInfo(cert *tls.Certificate) autocert.CertInfo {
+	leaf := cert.Leaf
+	return autocert.CertInfo{
+		Subject:        leaf.Subject.CommonName,
+		Issuer:         leaf.Issuer.CommonName,
+		NotBefore:      leaf.NotBefore.Unix(),
+		NotAfter:       leaf.NotAfter.Unix(),
+		DNSNames:       leaf.DNSNames,
+		EmailAddresses: leaf.EmailAddresses,
+		MustStaple:     hasMustStaple(leaf),
+		OCSP:           p.ocspInfo(cert),
+	}
+}
+
 func (p *Provider) GetName() string {
 	if p.cfg.idx == 0 {
 		return "main"
@@ -193,6 +230,20 @@ func (p *Provider) ClearLastFailure() error {
 	return nil
 }
 
+// EntrypointChallenges reports whether this provider or any extra provider uses the http-01
+// or tls-alpn-01 challenge, which are answered by the entrypoint.
+func (p *Provider) EntrypointChallenges() (http01, tlsALPN01 bool) {
+	for _, provider := range p.allProviders() {
+		switch provider.cfg.Challenge {
+		case ChallengeHTTP01:
+			http01 = true
+		case ChallengeTLSALPN01:
+			tlsALPN01 = true
+		}
+	}
+	return http01, tlsALPN01
+}
+
 // allProviders returns all providers including this provider and all extra providers.
 func (p *Provider) allProviders() []*Provider {
 	return append([]*Provider{p}, p.extraProviders...)
@@ -213,6 +264,7 @@ func (p *Provider) ObtainCertIfNotExistsAll() error {
 
 	err := errs.Wait().Error()
 	p.rebuildSNIMatcher()
+	p.refreshOCSPAll()
 	return err
 }
 
@@ -220,6 +272,11 @@ func (p *Provider) ObtainCertIfNotExistsAll() error {
 func (p *Provider) obtainCertIfNotExists() error {
 	err := p.loadCert()
 	if err == nil {
+		// certificates of the internal CA are free to issue, replace them now instead of on renewal
+		if p.cfg.Provider == ProviderInternal && p.certState() != CertStateValid {
+			p.logger.Info().Msg("cert expired or mismatch with the internal CA, issuing new cert")
+			return p.ObtainCert()
+		}
 		return nil
 	}
 
@@ -227,6 +284,10 @@ func (p *Provider) obtainCertIfNotExists() error {
 		return err
 	}
 
+	if len(p.cfg.Domains) == 0 { // on demand certificates only
+		return nil
+	}
+
 	// check last failure
 	lastFailure, err := p.GetLastFailure()
 	if err != nil {
@@ -254,11 +315,12 @@ func (p *Provider) ObtainCertAll() error {
 
 	err := errs.Wait().Error()
 	p.rebuildSNIMatcher()
+	p.refreshOCSPAll()
 	return err
 }
 
 // ObtainCert renews existing certificate or obtains a new certificate for this provider.
-func (p *Provider) ObtainCert() error {
+func (p *Provider) ObtainCert() (err error) {
 	if p.cfg.Provider == ProviderLocal {
 		return nil
 	}
@@ -272,12 +334,16 @@ func (p *Provider) ObtainCert() error {
 		return nil
 	}
 
-	if p.client == nil {
-		if err := p.initClient(); err != nil {
-			return err
-		}
+	if len(p.cfg.Domains) == 0 { // on demand certificates only
+		return nil
 	}
 
+	attempt := &renewalAttempt{at: time.Now()}
+	defer func() {
+		attempt.err = err
+		p.lastAttempt.Store(attempt)
+	}()
+
 	// mark it as failed first, clear it later if successful
 	// in case the process crashed / failed to renew, we put it on a cooldown
 	// this prevents rate limiting by the ACME server
@@ -285,35 +351,14 @@ func (p *Provider) ObtainCert() error {
 		return fmt.Errorf("failed to update last failure: %w", err)
 	}
 
-	if p.user.Registration == nil {
-		if err := p.registerACME(); err != nil {
-			return err
-		}
-	}
-
 	var cert *certificate.Resource
-	var err error
-
-	if p.legoCert != nil {
-		cert, err = p.client.Certificate.RenewWithOptions(*p.legoCert, &certificate.RenewOptions{
-			Bundle: true,
-		})
-		if err != nil {
-			p.legoCert = nil
-			log.Err(err).Msg("cert renew failed, fallback to obtain")
-		} else {
-			p.legoCert = cert
-		}
+	if p.cfg.Provider == ProviderInternal {
+		cert, err = p.issueInternalCert()
+	} else {
+		cert, err = p.obtainACMECert()
 	}
-
-	if cert == nil {
-		cert, err = p.client.Certificate.Obtain(certificate.ObtainRequest{
-			Domains: p.cfg.Domains,
-			Bundle:  true,
-		})
-		if err != nil {
-			return err
-		}
+	if err != nil {
+		return err
 	}
 
 	if err = p.saveCert(cert); err != nil {
@@ -329,6 +374,8 @@ func (p *Provider) ObtainCert() error {
 	if err != nil {
 		return err
 	}
+	// staple before serving it, must-staple certificates are rejected without one
+	p.stapleOCSP(&tlsCert, ocspPath(p.cfg.CertPath))
 	p.tlsCert = &tlsCert
 	p.certExpiries = expiries
 	p.rebuildSNIMatcher()
@@ -339,6 +386,41 @@ func (p *Provider) ObtainCert() error {
 	return nil
 }
 
+// obtainACMECert renews the existing certificate or obtains a new certificate from the ACME server.
+func (p *Provider) obtainACMECert() (*certificate.Resource, error) {
+	client, err := p.acmeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var cert *certificate.Resource
+
+	if p.legoCert != nil {
+		cert, err = client.Certificate.RenewWithOptions(*p.legoCert, &certificate.RenewOptions{
+			Bundle:     true,
+			MustStaple: p.cfg.MustStaple,
+		})
+		if err != nil {
+			p.legoCert = nil
+			log.Err(err).Msg("cert renew failed, fallback to obtain")
+		} else {
+			p.legoCert = cert
+		}
+	}
+
+	if cert == nil {
+		cert, err = client.Certificate.Obtain(certificate.ObtainRequest{
+			Domains:    p.cfg.Domains,
+			Bundle:     true,
+			MustStaple: p.cfg.MustStaple,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cert, nil
+}
+
 func (p *Provider) LoadCertAll() error {
 	var errs gperr.Builder
 	for _, provider := range p.allProviders() {
@@ -347,6 +429,7 @@ func (p *Provider) LoadCertAll() error {
 		}
 	}
 	p.rebuildSNIMatcher()
+	p.refreshOCSPAll()
 	return errs.Error()
 }
 
@@ -379,6 +462,9 @@ func (p *Provider) PrintCertExpiriesAll() {
 // ShouldRenewOn returns the time at which the certificate should be renewed.
 func (p *Provider) ShouldRenewOn() time.Time {
 	for _, expiry := range p.certExpiries {
+		if p.cfg.Provider == ProviderInternal {
+			return expiry.Add(-p.cfg.InternalCA.Lifetime / 3) // after 2/3 of the lifetime
+		}
 		return expiry.AddDate(0, -1, 0) // 1 month before
 	}
 	// this line should never be reached in production, but will be useful for testing
@@ -436,6 +522,13 @@ func (p *Provider) WaitRenewalDone(ctx context.Context) bool {
 func (p *Provider) ScheduleRenewalAll(parent task.Parent) {
 	p.scheduleRenewalOnce.Do(func() {
 		p.scheduleRenewal(parent)
+		p.scheduleOCSPRefresh(parent)
+		if p.onDemand != nil {
+			p.onDemand.scheduleRenewal(parent)
+		}
+		if p.expiryAlerts != nil {
+			p.scheduleExpiryAlerts(parent)
+		}
 	})
 	for _, ep := range p.extraProviders {
 		ep.scheduleRenewalOnce.Do(func() {
@@ -475,11 +568,14 @@ func (p *Provider) scheduleRenewal(parent task.Parent) {
 		if renewed {
 			p.rebuildSNIMatcher()
 
-			notif.Notify(&notif.LogMessage{
-				Level: zerolog.InfoLevel,
-				Title: "SSL certificate renewed for " + p.GetName(),
-				Body:  notif.ListBody(p.cfg.Domains),
-			})
+			// certificates of the internal CA are rotated too often to notify
+			if p.cfg.Provider != ProviderInternal {
+				notif.Notify(&notif.LogMessage{
+					Level: zerolog.InfoLevel,
+					Title: "SSL certificate renewed for " + p.GetName(),
+					Body:  notif.ListBody(p.cfg.Domains),
+				})
+			}
 
 			// Reset on success
 			if err := p.ClearLastFailure(); err != nil {
@@ -506,13 +602,38 @@ func (p *Provider) scheduleRenewal(parent task.Parent) {
 	}()
 }
 
+// acmeClient returns the ACME client, initializing it and registering the ACME account if needed.
+func (p *Provider) acmeClient() (*lego.Client, error) {
+	p.clientMu.Lock()
+	defer p.clientMu.Unlock()
+
+	if p.client == nil {
+		if err := p.initClient(); err != nil {
+			return nil, err
+		}
+	}
+	if p.user.Registration == nil {
+		if err := p.registerACME(); err != nil {
+			return nil, err
+		}
+	}
+	return p.client, nil
+}
+
 func (p *Provider) initClient() error {
 	legoClient, err := lego.NewClient(p.legoCfg)
 	if err != nil {
 		return err
 	}
 
-	err = legoClient.Challenge.SetDNS01Provider(p.cfg.challengeProvider, p.cfg.dns01Options()...)
+	switch p.cfg.Challenge {
+	case ChallengeHTTP01:
+		err = legoClient.Challenge.SetHTTP01Provider(http01Provider{})
+	case ChallengeTLSALPN01:
+		err = legoClient.Challenge.SetTLSALPN01Provider(tlsALPN01Provider{})
+	default:
+		err = legoClient.Challenge.SetDNS01Provider(p.cfg.challengeProvider, p.cfg.dns01Options()...)
+	}
 	if err != nil {
 		return err
 	}
@@ -587,6 +708,16 @@ func (p *Provider) certState() CertState {
 		return CertStateMismatch
 	}
 
+	if p.cfg.MustStaple && p.tlsCert != nil && p.tlsCert.Leaf != nil && !hasMustStaple(p.tlsCert.Leaf) {
+		log.Info().Msg("autocert must-staple enabled but cert is not must-staple")
+		return CertStateMismatch
+	}
+
+	if p.cfg.Provider == ProviderInternal && !p.issuedByInternalCA() {
+		log.Info().Msg("autocert cert is not issued by the internal CA")
+		return CertStateMismatch
+	}
+
 	for i := range len(p.cfg.Domains) {
 		if _, ok := p.certExpiries[p.cfg.Domains[i]]; !ok {
 			log.Info().Msgf("autocert domains mismatch: cert: %s, wanted: %s",
@@ -0,0 +1,112 @@
+package provider_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/autocert"
+)
+
+func TestObtainCertOnDemand(t *testing.T) {
+	acmeServer := newTestACMEServer(t)
+	defer acmeServer.Close()
+
+	dir := t.TempDir()
+	cfg := &autocert.Config{
+		Email:       "test@example.com",
+		Provider:    autocert.ProviderCustom,
+		CADirURL:    acmeServer.URL() + "/acme/acme/directory",
+		CertPath:    filepath.Join(dir, "cert.crt"),
+		KeyPath:     filepath.Join(dir, "priv.key"),
+		ACMEKeyPath: filepath.Join(dir, "acme.key"),
+		HTTPClient:  acmeServer.httpClient(),
+		OnDemand: &autocert.OnDemandConfig{
+			Dir:       filepath.Join(dir, "on_demand"),
+			RateLimit: 1,
+		},
+	}
+	require.NoError(t, cfg.Validate())
+
+	user, legoCfg, err := cfg.GetLegoConfig()
+	require.NoError(t, err)
+
+	provider, err := autocert.NewProvider(cfg, user, legoCfg)
+	require.NoError(t, err)
+	require.NoError(t, provider.ObtainCertIfNotExistsAll(), "no certificate to obtain without domains")
+
+	getLeaf := func(serverName string) *x509.Certificate {
+		cert, err := provider.GetCert(&tls.ClientHelloInfo{ServerName: serverName})
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf
+	}
+	isPending := func(leaf *x509.Certificate) bool {
+		return len(leaf.DNSNames) == 0
+	}
+
+	t.Run("not allowed before allow check is set", func(t *testing.T) {
+		require.True(t, isPending(getLeaf("a.example.com")))
+		require.Never(t, func() bool { return !isPending(getLeaf("a.example.com")) }, 200*time.Millisecond, 20*time.Millisecond)
+	})
+
+	provider.SetOnDemandAllow(func(host string) bool {
+		return host == "a.example.com" || host == "b.example.com"
+	})
+
+	t.Run("obtained in background", func(t *testing.T) {
+		require.True(t, isPending(getLeaf("a.example.com")))
+		require.Eventually(t, func() bool {
+			leaf := getLeaf("A.example.com")
+			return !isPending(leaf) && leaf.DNSNames[0] == "a.example.com"
+		}, 5*time.Second, 20*time.Millisecond)
+
+		infos, err := provider.GetCertInfos()
+		require.NoError(t, err)
+		require.Len(t, infos, 1)
+		require.Equal(t, []string{"a.example.com"}, infos[0].DNSNames)
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		require.True(t, isPending(getLeaf("b.example.com")))
+		require.Never(t, func() bool { return !isPending(getLeaf("b.example.com")) }, 200*time.Millisecond, 20*time.Millisecond)
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		for _, serverName := range []string{"c.example.com", "127.0.0.1", "localhost"} {
+			require.True(t, isPending(getLeaf(serverName)), serverName)
+		}
+	})
+}
+
+func TestOnDemandConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg := &autocert.Config{
+			Email:    "test@example.com",
+			Provider: autocert.ProviderCustom,
+			CADirURL: "https://ca.example.com/acme/directory",
+			OnDemand: &autocert.OnDemandConfig{},
+		}
+		require.NoError(t, cfg.Validate())
+		require.Equal(t, "certs/on_demand/", cfg.OnDemand.Dir)
+		require.Equal(t, 10, cfg.OnDemand.RateLimit)
+		require.Equal(t, time.Hour, cfg.OnDemand.Interval)
+	})
+
+	t.Run("local provider", func(t *testing.T) {
+		cfg := &autocert.Config{
+			Provider: autocert.ProviderLocal,
+			OnDemand: &autocert.OnDemandConfig{},
+		}
+		require.ErrorIs(t, cfg.Validate(), autocert.ErrOnDemand)
+	})
+
+	t.Run("extra providers", func(t *testing.T) {
+		merged := autocert.MergeExtraConfig(&autocert.Config{OnDemand: &autocert.OnDemandConfig{}}, &autocert.ConfigExtra{})
+		require.Nil(t, merged.OnDemand)
+	})
+}
@@ -0,0 +1,132 @@
+package provider_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/autocert"
+)
+
+// TestObtainCertFromPebble obtains certificates with http-01 and tls-alpn-01 challenges
+// from a local Pebble ACME server, e.g.
+//
+//	pebble-challtestsrv -defaultIPv4 127.0.0.1 &
+//	pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053 &
+//	PEBBLE_DIR_URL=https://127.0.0.1:14000/dir PEBBLE_CA_CERT=test/certs/pebble.minica.pem go test -run Pebble ./...
+//
+// The challenges are answered on PEBBLE_HTTP_PORT (default: 5002) and PEBBLE_TLS_PORT (default: 5001).
+func TestObtainCertFromPebble(t *testing.T) {
+	dirURL := os.Getenv("PEBBLE_DIR_URL")
+	if dirURL == "" {
+		t.Skip("PEBBLE_DIR_URL is not set")
+	}
+	caCert := os.Getenv("PEBBLE_CA_CERT")
+	require.NotEmpty(t, caCert, "PEBBLE_CA_CERT is not set")
+
+	tests := []struct {
+		challenge string
+		domain    string
+		serve     func(t *testing.T, provider *autocert.Provider)
+	}{
+		{
+			challenge: autocert.ChallengeHTTP01,
+			domain:    "http-01.godoxy.test",
+			serve:     serveHTTP01,
+		},
+		{
+			challenge: autocert.ChallengeTLSALPN01,
+			domain:    "tls-alpn-01.godoxy.test",
+			serve:     serveTLSALPN01,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.challenge, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &autocert.Config{
+				Email:       "test@example.com",
+				Domains:     []string{test.domain},
+				Challenge:   test.challenge,
+				CADirURL:    dirURL,
+				CACerts:     []string{caCert},
+				CertPath:    filepath.Join(dir, "cert.crt"),
+				KeyPath:     filepath.Join(dir, "priv.key"),
+				ACMEKeyPath: filepath.Join(dir, "acme.key"),
+			}
+			require.NoError(t, cfg.Validate())
+			require.Equal(t, autocert.ProviderACME, cfg.Provider)
+
+			user, legoCfg, err := cfg.GetLegoConfig()
+			require.NoError(t, err)
+
+			provider, err := autocert.NewProvider(cfg, user, legoCfg)
+			require.NoError(t, err)
+
+			test.serve(t, provider)
+			require.NoError(t, provider.ObtainCert())
+
+			cert, err := provider.GetCert(&tls.ClientHelloInfo{ServerName: test.domain})
+			require.NoError(t, err)
+			x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+			require.NoError(t, err)
+			require.Contains(t, x509Cert.DNSNames, test.domain)
+		})
+	}
+}
+
+func pebblePort(env, def string) string {
+	if port := os.Getenv(env); port != "" {
+		return port
+	}
+	return def
+}
+
+func serveHTTP01(t *testing.T, _ *autocert.Provider) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", pebblePort("PEBBLE_HTTP_PORT", "5002")))
+	require.NoError(t, err)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !autocert.ServeHTTP01Challenge(w, r) {
+			http.NotFound(w, r)
+		}
+	})}
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(func() { srv.Close() })
+}
+
+func serveTLSALPN01(t *testing.T, provider *autocert.Provider) {
+	t.Helper()
+
+	l, err := tls.Listen("tcp", net.JoinHostPort("127.0.0.1", pebblePort("PEBBLE_TLS_PORT", "5001")), &tls.Config{
+		NextProtos:     []string{autocert.TLSALPN01Protocol},
+		GetCertificate: provider.GetCert,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+}
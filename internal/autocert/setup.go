@@ -24,6 +24,7 @@ func (p *Provider) setupExtraProviders() error {
 			errs.Add(p.fmtError(err))
 			continue
 		}
+		ep.ocspStaples = p.ocspStaples
 		p.extraProviders = append(p.extraProviders, ep)
 	}
 	return errs.Error()
@@ -1,10 +1,45 @@
 package autocert
 
 type CertInfo struct {
-	Subject        string   `json:"subject"`
-	Issuer         string   `json:"issuer"`
-	NotBefore      int64    `json:"not_before"`
-	NotAfter       int64    `json:"not_after"`
-	DNSNames       []string `json:"dns_names"`
-	EmailAddresses []string `json:"email_addresses"`
+	Subject        string    `json:"subject"`
+	Issuer         string    `json:"issuer"`
+	NotBefore      int64     `json:"not_before"`
+	NotAfter       int64     `json:"not_after"`
+	DNSNames       []string  `json:"dns_names"`
+	EmailAddresses []string  `json:"email_addresses"`
+	MustStaple     bool      `json:"must_staple"`
+	OCSP           *OCSPInfo `json:"ocsp,omitempty"` // nil if the certificate has no OCSP responder
 } // @name CertInfo
+
+// OCSPInfo is the OCSP response stapled to a certificate.
+type OCSPInfo struct {
+	Status     string `json:"status" enums:"good,revoked,unknown,unavailable"` // unavailable if no response is stapled
+	ProducedAt int64  `json:"produced_at,omitempty"`
+	ThisUpdate int64  `json:"this_update,omitempty"`
+	NextUpdate int64  `json:"next_update,omitempty"`
+	Error      string `json:"error,omitempty"` // error of the last refresh
+} // @name CertOCSPInfo
+
+const (
+	OCSPStatusGood        = "good"
+	OCSPStatusRevoked     = "revoked"
+	OCSPStatusUnknown     = "unknown"
+	OCSPStatusUnavailable = "unavailable"
+)
+
+// CertInventoryItem is a certificate served by GoDoxy with its renewal status.
+type CertInventoryItem struct {
+	Provider    string   `json:"provider"` // main, extra[N] or on_demand
+	Type        string   `json:"type"`     // provider type, e.g. local, internal, acme, cloudflare
+	CertPath    string   `json:"cert_path"`
+	Subject     string   `json:"subject,omitempty"`
+	Issuer      string   `json:"issuer,omitempty"`
+	DNSNames    []string `json:"dns_names"`
+	KeyType     string   `json:"key_type,omitempty"` // e.g. ECDSA P-256, RSA 2048
+	NotBefore   int64    `json:"not_before,omitempty"`
+	NotAfter    int64    `json:"not_after,omitempty"`    // 0 if the certificate is not obtained yet
+	RenewAt     int64    `json:"renew_at,omitempty"`     // scheduled renewal, 0 if not renewed by GoDoxy
+	LastAttempt int64    `json:"last_attempt,omitempty"` // last obtain or renewal attempt since startup
+	LastFailure int64    `json:"last_failure,omitempty"` // last failed attempt, persisted across restarts
+	Error       string   `json:"error,omitempty"`        // error of the last attempt
+} // @name CertInventoryItem
@@ -10,6 +10,8 @@ import (
 type Provider interface {
 	GetCert(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
 	GetCertInfos() ([]CertInfo, error)
+	GetInternalCACert() ([]byte, error)
+	GetCertInventory() []CertInventoryItem
 	ScheduleRenewalAll(parent task.Parent)
 	ObtainCertAll() error
 	ForceExpiryAll() bool
@@ -16,6 +16,10 @@ const (
 
 	NamespaceHomepageOverrides = ".homepage"
 	NamespaceIconCache         = ".icon_cache"
+	NamespaceUsers             = ".users"
+	NamespaceAPITokens         = ".api_tokens"
+	NamespaceMFA               = ".mfa"
+	NamespaceACLBans           = ".acl_bans"
 
 	MiddlewareComposeBasePath = ConfigBasePath + "/middlewares"
 
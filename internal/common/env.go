@@ -57,6 +57,33 @@ var (
 	OIDCRateLimit       = env.GetEnvInt("OIDC_RATE_LIMIT", 10)
 	OIDCRateLimitPeriod = env.GetEnvDuation("OIDC_RATE_LIMIT_PERIOD", time.Second)
 
+	// OIDC group to role mapping, users in these groups are allowed as well.
+	OIDCAdminGroups    = env.GetEnvCommaSep("OIDC_ADMIN_GROUPS", "")
+	OIDCOperatorGroups = env.GetEnvCommaSep("OIDC_OPERATOR_GROUPS", "")
+	OIDCViewerGroups   = env.GetEnvCommaSep("OIDC_VIEWER_GROUPS", "")
+	OIDCDefaultRole    = env.GetEnvString("OIDC_DEFAULT_ROLE", "admin")
+
+	// LDAP Configuration, used instead of API_USER and API_PASSWORD if LDAP_URL is set.
+	LDAPURL                = env.GetEnvString("LDAP_URL", "") // ldap://host:389 or ldaps://host:636
+	LDAPStartTLS           = env.GetEnvBool("LDAP_START_TLS", false)
+	LDAPInsecureSkipVerify = env.GetEnvBool("LDAP_INSECURE_SKIP_VERIFY", false)
+	LDAPCAFile             = env.GetEnvString("LDAP_CA_FILE", "")
+	LDAPBindDN             = env.GetEnvString("LDAP_BIND_DN", "") // anonymous search if empty
+	LDAPBindPassword       = env.GetEnvString("LDAP_BIND_PASSWORD", "")
+	LDAPBaseDN             = env.GetEnvString("LDAP_BASE_DN", "")
+	LDAPUserFilter         = env.GetEnvString("LDAP_USER_FILTER", "(uid={username})")
+	LDAPGroupAttribute     = env.GetEnvString("LDAP_GROUP_ATTRIBUTE", "memberOf")
+	LDAPGroupBaseDN        = env.GetEnvString("LDAP_GROUP_BASE_DN", "")
+	LDAPGroupFilter        = env.GetEnvString("LDAP_GROUP_FILTER", "") // e.g. (&(objectClass=groupOfNames)(member={dn}))
+	LDAPAllowedUsers       = env.GetEnvCommaSep("LDAP_ALLOWED_USERS", "")
+	LDAPAllowedGroups      = env.GetEnvCommaSep("LDAP_ALLOWED_GROUPS", "")
+
+	// LDAP group to role mapping, users in these groups are allowed as well.
+	LDAPAdminGroups    = env.GetEnvCommaSep("LDAP_ADMIN_GROUPS", "")
+	LDAPOperatorGroups = env.GetEnvCommaSep("LDAP_OPERATOR_GROUPS", "")
+	LDAPViewerGroups   = env.GetEnvCommaSep("LDAP_VIEWER_GROUPS", "")
+	LDAPDefaultRole    = env.GetEnvString("LDAP_DEFAULT_ROLE", "admin")
+
 	// metrics configuration
 	MetricsDisableCPU     = env.GetEnvBool("METRICS_DISABLE_CPU", false)
 	MetricsDisableMemory  = env.GetEnvBool("METRICS_DISABLE_MEMORY", false)
@@ -64,5 +91,21 @@ var (
 	MetricsDisableNetwork = env.GetEnvBool("METRICS_DISABLE_NETWORK", false)
 	MetricsDisableSensors = env.GetEnvBool("METRICS_DISABLE_SENSORS", false)
 
+	// prometheus exporter, served on the API server at /metrics
+	// and on METRICS_PROMETHEUS_ADDR (without authentication) if set.
+	MetricsPrometheusEnabled = env.GetEnvBool("METRICS_PROMETHEUS_ENABLED", false)
+
+	MetricsPrometheusHTTPAddr,
+	MetricsPrometheusHTTPHost,
+	MetricsPrometheusHTTPPort,
+	MetricsPrometheusHTTPURL = env.GetAddrEnv("METRICS_PROMETHEUS_ADDR", "", "http")
+
+	// OpenTelemetry tracing, disabled when endpoint is empty
+	TracingOTLPEndpoint = env.GetEnvString("TRACING_OTLP_ENDPOINT", "")
+	TracingOTLPProtocol = env.GetEnvString("TRACING_OTLP_PROTOCOL", "http/protobuf") // http/protobuf or grpc
+	TracingOTLPHeaders  = env.GetEnvCommaSep("TRACING_OTLP_HEADERS", "")             // key=value,key2=value2
+	TracingSampleRatio  = env.GetEnvString("TRACING_SAMPLE_RATIO", "1")
+	TracingServiceName  = env.GetEnvString("TRACING_SERVICE_NAME", "godoxy")
+
 	ForceResolveCountry = env.GetEnvBool("FORCE_RESOLVE_COUNTRY", false)
 )
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/fs"
 	"iter"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -30,6 +31,7 @@ import (
 	homepage "github.com/yusing/godoxy/internal/homepage/types"
 	"github.com/yusing/godoxy/internal/logging"
 	"github.com/yusing/godoxy/internal/maxmind"
+	"github.com/yusing/godoxy/internal/metrics/prometheus"
 	"github.com/yusing/godoxy/internal/metrics/systeminfo"
 	"github.com/yusing/godoxy/internal/metrics/uptime"
 	"github.com/yusing/godoxy/internal/notif"
@@ -186,6 +188,7 @@ func (state *state) IterProviders() iter.Seq2[string, types.RouteProvider] {
 
 func (state *state) StartProviders() error {
 	errs := gperr.NewGroup("provider errors")
+	errs.Go(state.initACMEChallenges)
 	for _, p := range state.providers.Range {
 		errs.Go(func() error {
 			return p.Start(state.Task())
@@ -230,6 +233,20 @@ func (state *state) StartAPIServers() {
 func (state *state) StartMetrics() {
 	systeminfo.Poller.Start(state.task)
 	uptime.Poller.Start(state.task)
+
+	// Prometheus exporter on a dedicated listener for scrapers without API credentials.
+	if prometheus.Enabled() && common.MetricsPrometheusHTTPAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /metrics", prometheus.ServeHTTP)
+		_, err := server.StartServer(state.task.Subtask("prometheus_server", false), server.Options{
+			Name:     "prometheus",
+			HTTPAddr: common.MetricsPrometheusHTTPAddr,
+			Handler:  mux,
+		})
+		if err != nil {
+			log.Err(err).Msg("failed to start prometheus metrics server")
+		}
+	}
 }
 
 // initACL initializes the ACL.
@@ -261,6 +278,14 @@ func (state *state) initEntrypoint() error {
 		if domain := getAutoCertDefaultDomain(state.autocertProvider); domain != "" {
 			state.entrypoint.ShortLinkMatcher().SetDefaultDomainSuffix("." + domain)
 		}
+		// certificates are obtained on demand for the full hostnames of routes under match_domains,
+		// or hostnames allowed by the ask URL, see config.Validate
+		state.autocertProvider.SetOnDemandAllow(func(host string) bool {
+			if len(matchDomains) == 0 {
+				return true
+			}
+			return state.entrypoint.HasHTTPRoute(host)
+		})
 	}
 
 	entrypointctx.SetCtx(state.task, state.entrypoint)
@@ -333,15 +358,46 @@ func (state *state) initAutoCert() error {
 		return err
 	}
 
+	// challenges answered by the entrypoint need it to be started first, see initACMEChallenges
+	if http01, tlsALPN01 := p.EntrypointChallenges(); !http01 && !tlsALPN01 {
+		if err := startAutoCert(state.task, p); err != nil {
+			return err
+		}
+	}
+
+	state.autocertProvider = p
+	autocertctx.SetCtx(state.task, p)
+	return nil
+}
+
+// initACMEChallenges starts the entrypoint servers answering the http-01 and tls-alpn-01 challenges,
+// then obtains the certificates of the autocert provider using them.
+//
+// It is called by StartProviders, since the servers of the old config are stopped by then on reload.
+func (state *state) initACMEChallenges() error {
+	if state.autocertProvider == nil {
+		return nil
+	}
+	http01, tlsALPN01 := state.autocertProvider.EntrypointChallenges()
+	if !http01 && !tlsALPN01 {
+		return nil
+	}
+	if err := state.entrypoint.ListenACMEChallenges(http01, tlsALPN01); err != nil {
+		return gperr.PrependSubject(err, "autocert")
+	}
+	if err := startAutoCert(state.task, state.autocertProvider); err != nil {
+		return gperr.PrependSubject(err, "autocert")
+	}
+	return nil
+}
+
+func startAutoCert(parent task.Parent, p *autocert.Provider) error {
 	if err := p.ObtainCertIfNotExistsAll(); err != nil {
 		return err
 	}
 
-	p.ScheduleRenewalAll(state.task)
+	p.ScheduleRenewalAll(parent)
 	p.PrintCertExpiriesAll()
-
-	state.autocertProvider = p
-	autocertctx.SetCtx(state.task, p)
 	return nil
 }
 
@@ -15,6 +15,7 @@ import (
 	"github.com/yusing/godoxy/internal/proxmox"
 	"github.com/yusing/godoxy/internal/serialization"
 	"github.com/yusing/godoxy/internal/types"
+	gperr "github.com/yusing/goutils/errs"
 )
 
 type (
@@ -46,6 +47,17 @@ func Validate(data []byte) error {
 	return serialization.UnmarshalValidate(data, &model, yaml.Unmarshal)
 }
 
+// Validate rejects on demand certificates that could be obtained for any hostname.
+//
+// Without match_domains, routes are matched by the first label of hostnames only,
+// so hostnames must be allowed by the ask URL instead.
+func (cfg *Config) Validate() error {
+	if cfg.AutoCert != nil && cfg.AutoCert.OnDemand != nil && len(cfg.MatchDomains) == 0 && cfg.AutoCert.OnDemand.Ask == "" {
+		return gperr.New("autocert.on_demand requires match_domains or on_demand.ask")
+	}
+	return nil
+}
+
 func DefaultConfig() Config {
 	return Config{
 		TimeoutShutdown: 3,
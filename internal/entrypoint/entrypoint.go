@@ -3,6 +3,7 @@ package entrypoint
 import (
 	"net/http"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 
@@ -21,7 +22,10 @@ type HTTPRoutes interface {
 	Get(alias string) (types.HTTPRoute, bool)
 }
 
-type findRouteFunc func(HTTPRoutes, string) types.HTTPRoute
+// routeGetter looks up routes by alias, e.g. HTTPRoutes.
+type routeGetter[Route any] interface {
+	Get(alias string) (Route, bool)
+}
 
 type Entrypoint struct {
 	task *task.Task
@@ -31,7 +35,7 @@ type Entrypoint struct {
 	middleware       *middleware.Middleware
 	notFoundHandler  http.Handler
 	accessLogger     accesslog.AccessLogger
-	findRouteFunc    findRouteFunc
+	findRouteDomains []string // nil to match any domain
 	shortLinkMatcher *ShortLinkMatcher
 
 	streamRoutes   *pool.Pool[types.StreamRoute]
@@ -41,6 +45,10 @@ type Entrypoint struct {
 	httpPoolDisableLog atomic.Bool
 
 	servers *xsync.Map[string, *httpServer] // listen addr -> server
+
+	passthroughs *xsync.Map[string, *tlsPassthrough] // listen addr -> tls passthrough
+	// httpsListenMu serializes starting HTTPS servers and TLS passthroughs sharing an address.
+	httpsListenMu sync.Mutex
 }
 
 var _ entrypoint.Entrypoint = &Entrypoint{}
@@ -64,11 +72,11 @@ func NewEntrypoint(parent task.Parent, cfg *Config) *Entrypoint {
 	ep := &Entrypoint{
 		task:             parent.Subtask("entrypoint", false),
 		cfg:              cfg,
-		findRouteFunc:    findRouteAnyDomain,
 		shortLinkMatcher: newShortLinkMatcher(),
 		streamRoutes:     pool.New[types.StreamRoute]("stream_routes", "stream_routes"),
 		excludedRoutes:   pool.New[types.Route]("excluded_routes", "excluded_routes"),
 		servers:          xsync.NewMap[string, *httpServer](),
+		passthroughs:     xsync.NewMap[string, *tlsPassthrough](),
 	}
 	return ep
 }
@@ -112,16 +120,22 @@ func (ep *Entrypoint) GetServer(addr string) (HTTPServer, bool) {
 	return ep.servers.Load(addr)
 }
 
+// HasHTTPRoute reports whether requests to host are routed to an HTTP route, with the matching domains set by SetFindRouteDomains.
+func (ep *Entrypoint) HasHTTPRoute(host string) bool {
+	_, ok := findRoute(ep.HTTPRoutes(), ep.findRouteDomains, host)
+	return ok
+}
+
 func (ep *Entrypoint) SetFindRouteDomains(domains []string) {
 	if len(domains) == 0 {
-		ep.findRouteFunc = findRouteAnyDomain
+		ep.findRouteDomains = nil
 	} else {
 		for i, domain := range domains {
 			if !strings.HasPrefix(domain, ".") {
 				domains[i] = "." + domain
 			}
 		}
-		ep.findRouteFunc = findRouteByDomains(domains)
+		ep.findRouteDomains = domains
 	}
 }
 
@@ -161,41 +175,44 @@ func (ep *Entrypoint) SetAccessLogger(parent task.Parent, cfg *accesslog.Request
 	return nil
 }
 
-func findRouteAnyDomain(routes HTTPRoutes, host string) types.HTTPRoute {
+// findRoute finds the route of host by alias, with the matching domains set by SetFindRouteDomains.
+func findRoute[Route any](routes routeGetter[Route], domains []string, host string) (r Route, ok bool) {
+	if len(domains) == 0 {
+		return findRouteAnyDomain(routes, host)
+	}
+	return findRouteByDomains(routes, domains, host)
+}
+
+func findRouteAnyDomain[Route any](routes routeGetter[Route], host string) (r Route, ok bool) {
 	before, _, ok := strings.Cut(host, ".")
 	if ok {
 		target := before
 		if r, ok := routes.Get(target); ok {
-			return r
+			return r, true
 		}
 	}
 	if r, ok := routes.Get(host); ok {
-		return r
+		return r, true
 	}
 	// try striping the trailing :port from the host
 	if before, _, ok := strings.Cut(host, ":"); ok {
 		if r, ok := routes.Get(before); ok {
-			return r
+			return r, true
 		}
 	}
-	return nil
+	return r, false
 }
 
-func findRouteByDomains(domains []string) func(routes HTTPRoutes, host string) types.HTTPRoute {
-	return func(routes HTTPRoutes, host string) types.HTTPRoute {
-		host, _, _ = strings.Cut(host, ":") // strip the trailing :port
-		for _, domain := range domains {
-			if target, ok := strings.CutSuffix(host, domain); ok {
-				if r, ok := routes.Get(target); ok {
-					return r
-				}
+func findRouteByDomains[Route any](routes routeGetter[Route], domains []string, host string) (r Route, ok bool) {
+	host, _, _ = strings.Cut(host, ":") // strip the trailing :port
+	for _, domain := range domains {
+		if target, ok := strings.CutSuffix(host, domain); ok {
+			if r, ok := routes.Get(target); ok {
+				return r, true
 			}
 		}
-
-		// fallback to exact match
-		if r, ok := routes.Get(host); ok {
-			return r
-		}
-		return nil
 	}
+
+	// fallback to exact match
+	return routes.Get(host)
 }
@@ -7,10 +7,13 @@ import (
 	"strings"
 
 	"github.com/rs/zerolog/log"
-	acl "github.com/yusing/godoxy/internal/acl/types"
-	autocert "github.com/yusing/godoxy/internal/autocert/types"
+	"github.com/yusing/godoxy/internal/acl"
+	acltypes "github.com/yusing/godoxy/internal/acl/types"
+	"github.com/yusing/godoxy/internal/autocert"
+	autocertctx "github.com/yusing/godoxy/internal/autocert/types"
 	"github.com/yusing/godoxy/internal/common"
 	"github.com/yusing/godoxy/internal/logging/accesslog"
+	"github.com/yusing/godoxy/internal/metrics/prometheus"
 	"github.com/yusing/godoxy/internal/net/gphttp/middleware"
 	"github.com/yusing/godoxy/internal/net/gphttp/middleware/errorpage"
 	"github.com/yusing/godoxy/internal/route/routes"
@@ -34,6 +37,7 @@ type httpServer struct {
 	stopFunc func(reason any)
 
 	addr   string
+	proto  HTTPProto
 	routes *pool.Pool[types.HTTPRoute]
 }
 
@@ -53,24 +57,51 @@ func newHTTPServer(ep *Entrypoint) *httpServer {
 }
 
 // Listen starts the server and stop when entrypoint is stopped.
+//
+// HTTPS servers sharing addr with a TLS passthrough listen on a loopback address behind it instead.
 func (srv *httpServer) Listen(addr string, proto HTTPProto) error {
 	if srv.addr != "" {
 		return errors.New("server already started")
 	}
 
+	start := srv.start
+	if proto == HTTPProtoHTTPS {
+		if p, ok := srv.ep.passthroughs.Load(addr); ok {
+			start = func(string) error { return p.listenFallback(srv.start) }
+		}
+	}
+
+	srv.addr = addr
+	srv.proto = proto
+	if err := start(addr); err != nil {
+		srv.addr = ""
+		return err
+	}
+	srv.routes = pool.New[types.HTTPRoute](fmt.Sprintf("[%s] %s", proto, addr), "http_routes")
+	srv.routes.DisableLog(srv.ep.httpPoolDisableLog.Load())
+	return nil
+}
+
+func (srv *httpServer) start(listenAddr string) error {
 	opts := server.Options{
-		Name:                 addr,
+		Name:                 srv.addr,
 		Handler:              srv,
-		ACL:                  acl.FromCtx(srv.ep.task.Context()),
+		ACL:                  acltypes.FromCtx(srv.ep.task.Context()),
 		SupportProxyProtocol: srv.ep.cfg.SupportProxyProtocol,
 	}
+	if listenAddr != srv.addr {
+		// behind a TLS passthrough, which applies the ACL and
+		// sends the client address with PROXY protocol
+		opts.ACL = nil
+		opts.SupportProxyProtocol = true
+	}
 
-	switch proto {
+	switch srv.proto {
 	case HTTPProtoHTTP:
-		opts.HTTPAddr = addr
+		opts.HTTPAddr = listenAddr
 	case HTTPProtoHTTPS:
-		opts.HTTPSAddr = addr
-		opts.CertProvider = autocert.FromCtx(srv.ep.task.Context())
+		opts.HTTPSAddr = listenAddr
+		opts.CertProvider = autocertctx.FromCtx(srv.ep.task.Context())
 	}
 
 	task := srv.ep.task.Subtask("http_server", false)
@@ -79,12 +110,15 @@ func (srv *httpServer) Listen(addr string, proto HTTPProto) error {
 		return err
 	}
 	srv.stopFunc = task.FinishAndWait
-	srv.addr = addr
-	srv.routes = pool.New[types.HTTPRoute](fmt.Sprintf("[%s] %s", proto, addr), "http_routes")
-	srv.routes.DisableLog(srv.ep.httpPoolDisableLog.Load())
 	return nil
 }
 
+// relisten restarts the server on listenAddr.
+func (srv *httpServer) relisten(listenAddr string) error {
+	srv.Close()
+	return srv.start(listenAddr)
+}
+
 func (srv *httpServer) Close() {
 	if srv.stopFunc == nil {
 		return
@@ -101,29 +135,47 @@ func (srv *httpServer) DelRoute(route types.HTTPRoute) {
 }
 
 func (srv *httpServer) FindRoute(s string) types.HTTPRoute {
-	return srv.ep.findRouteFunc(srv.routes, s)
+	route, _ := findRoute(srv.routes, srv.ep.findRouteDomains, s)
+	return route
 }
 
 func (srv *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if srv.ep.accessLogger != nil {
+	// http-01 challenges are validated on the HTTP port, they bypass routes and middlewares
+	if srv.proto == HTTPProtoHTTP && autocert.ServeHTTP01Challenge(w, r) {
+		return
+	}
+
+	autoBan := acl.AutoBanEnabled()
+	if autoBan {
+		r = acl.WithAutoBanReport(r)
+	}
+	if srv.ep.accessLogger != nil || autoBan {
 		rec := accesslog.GetResponseRecorder(w)
 		w = rec
 		defer func() {
 			// there is no body to close
 			//nolint:bodyclose
-			srv.ep.accessLogger.LogRequest(r, rec.Response())
+			resp := rec.Response()
+			if srv.ep.accessLogger != nil {
+				srv.ep.accessLogger.LogRequest(r, resp)
+			}
+			if autoBan {
+				acl.ReportStatus(r, resp.StatusCode)
+			}
 			accesslog.PutResponseRecorder(rec)
 		}()
 	}
 
-	route := srv.ep.findRouteFunc(srv.routes, r.Host)
+	route, _ := findRoute(srv.routes, srv.ep.findRouteDomains, r.Host)
 	switch {
 	case route != nil:
 		r = routes.WithRouteContext(r, route)
-		if srv.ep.middleware != nil {
-			srv.ep.middleware.ServeHTTP(route.ServeHTTP, w, r)
+		if prometheus.Enabled() {
+			prometheus.ObserveRoute(route.Name(), w, r, func(w http.ResponseWriter, r *http.Request) {
+				srv.serveRoute(route, w, r)
+			})
 		} else {
-			route.ServeHTTP(w, r)
+			srv.serveRoute(route, w, r)
 		}
 	case srv.tryHandleShortLink(w, r):
 		return
@@ -134,6 +186,17 @@ func (srv *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (srv *httpServer) serveRoute(route types.HTTPRoute, w http.ResponseWriter, r *http.Request) {
+	if !checkMTLS(route, w, r) {
+		return
+	}
+	if srv.ep.middleware != nil {
+		srv.ep.middleware.ServeHTTP(route.ServeHTTP, w, r)
+	} else {
+		route.ServeHTTP(w, r)
+	}
+}
+
 func (srv *httpServer) tryHandleShortLink(w http.ResponseWriter, r *http.Request) (handled bool) {
 	host := r.Host
 	if before, _, ok := strings.Cut(host, ":"); ok {
@@ -0,0 +1,159 @@
+package entrypoint
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	stdlog "log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog/log"
+	autocert "github.com/yusing/godoxy/internal/autocert/types"
+	"github.com/yusing/godoxy/internal/mtls"
+	"github.com/yusing/godoxy/internal/types"
+)
+
+// mtlsServer serves the connections of a TLS passthrough with the SNI matching an HTTP route with mTLS.
+// They are terminated with the client certificate settings of the route, and served by the HTTPS server
+// on the same address, which rejects requests to mTLS routes from connections not terminated here.
+type mtlsServer struct {
+	p      *tlsPassthrough
+	server *http.Server
+
+	conns   chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+	configs *xsync.Map[*tls.Conn, *mtls.Config] // pending connections -> config
+}
+
+// timeouts of the mTLS server like those of the HTTPS server, so slow or idle clients do not hold connections.
+const (
+	mtlsReadHeaderTimeout = 10 * time.Second
+	mtlsIdleTimeout       = 120 * time.Second
+)
+
+func newMTLSServer(p *tlsPassthrough) *mtlsServer {
+	s := &mtlsServer{
+		p:       p,
+		conns:   make(chan net.Conn),
+		done:    make(chan struct{}),
+		configs: xsync.NewMap[*tls.Conn, *mtls.Config](),
+	}
+	errLog := log.Logger.With().Str("level", "error").Str("component", "mtls").Str("addr", p.addr).Logger()
+	s.server = &http.Server{
+		Handler: http.HandlerFunc(s.serveHTTP),
+		BaseContext: func(net.Listener) context.Context {
+			return p.task.Context()
+		},
+		ConnContext:       s.connContext,
+		ErrorLog:          stdlog.New(&errLog, "", 0),
+		ReadHeaderTimeout: mtlsReadHeaderTimeout,
+		IdleTimeout:       mtlsIdleTimeout,
+	}
+	return s
+}
+
+func (s *mtlsServer) start() {
+	s.p.task.OnCancel("close_mtls_server", func() {
+		_ = s.server.Close()
+	})
+	go func() {
+		err := s.server.Serve(s)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Err(err).Str("addr", s.p.addr).Msg("mtls server stopped with error")
+		}
+	}()
+}
+
+// mtlsConfig returns the mTLS config of the HTTP route matching serverName, nil if none.
+func (p *tlsPassthrough) mtlsConfig(serverName string) *mtls.Config {
+	srv, ok := p.ep.servers.Load(p.addr)
+	if !ok {
+		return nil
+	}
+	route, ok := findRoute(srv.routes, p.ep.findRouteDomains, serverName)
+	if !ok {
+		return nil
+	}
+	return route.MTLSConfig()
+}
+
+// deliver passes conn to the server to be terminated with cfg, and reports false if the server is closed.
+func (s *mtlsServer) deliver(conn net.Conn, cfg *mtls.Config) bool {
+	provider := autocert.FromCtx(s.p.ep.task.Context())
+	if provider == nil {
+		log.Warn().Str("addr", s.p.addr).Msg("mtls: no certificate provider, forwarding to https server")
+		return false
+	}
+	tlsConn := tls.Server(conn, cfg.ServerTLSConfig(provider.GetCert))
+	s.configs.Store(tlsConn, cfg)
+	select {
+	case s.conns <- tlsConn:
+		return true
+	case <-s.done:
+		s.configs.Delete(tlsConn)
+		return false
+	}
+}
+
+// connContext attaches the config the connection is terminated with to its context.
+func (s *mtlsServer) connContext(ctx context.Context, c net.Conn) context.Context {
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		if cfg, ok := s.configs.LoadAndDelete(tlsConn); ok {
+			return mtls.WithConfig(ctx, cfg)
+		}
+	}
+	return ctx
+}
+
+func (s *mtlsServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.p.ep.servers.Load(s.p.addr)
+	if !ok {
+		serveNotFound(w, r)
+		return
+	}
+	srv.ServeHTTP(w, r)
+}
+
+// Accept implements net.Listener.
+func (s *mtlsServer) Accept() (net.Conn, error) {
+	select {
+	case conn := <-s.conns:
+		return conn, nil
+	case <-s.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+func (s *mtlsServer) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// Addr implements net.Listener.
+func (s *mtlsServer) Addr() net.Addr {
+	return s.p.listener.Addr()
+}
+
+// checkMTLS rejects requests to routes with mTLS from connections not terminated with their config,
+// e.g. plain HTTP requests, or HTTP/2 connections reused for another host, and sets the forwarded
+// client certificate headers.
+func checkMTLS(route types.HTTPRoute, w http.ResponseWriter, r *http.Request) bool {
+	cfg := route.MTLSConfig()
+	if cfg == nil {
+		return true
+	}
+	if mtls.FromContext(r.Context()) != cfg {
+		http.Error(w, "client certificate required", http.StatusMisdirectedRequest)
+		return false
+	}
+	cfg.SetForwardHeaders(r)
+	return true
+}
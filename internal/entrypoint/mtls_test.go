@@ -0,0 +1,178 @@
+package entrypoint_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/autocert"
+	autocertctx "github.com/yusing/godoxy/internal/autocert/types"
+	. "github.com/yusing/godoxy/internal/entrypoint"
+	"github.com/yusing/godoxy/internal/mtls"
+	"github.com/yusing/godoxy/internal/route"
+	routeTypes "github.com/yusing/godoxy/internal/route/types"
+	"github.com/yusing/godoxy/internal/types"
+	"github.com/yusing/goutils/task"
+)
+
+// issueCert issues a certificate signed by parent, or a self-signed CA certificate if parent is nil.
+func issueCert(t *testing.T, parent *tls.Certificate, modify func(template *x509.Certificate)) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	modify(template)
+
+	signer, signerKey := template, any(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) string {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func TestMTLSRoute(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, nil, func(template *x509.Certificate) {
+		template.Subject = pkix.Name{CommonName: "Test CA"}
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	})
+	serverCert := issueCert(t, &ca, func(template *x509.Certificate) {
+		template.DNSNames = []string{"*.example.com"}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	})
+	clientCert := issueCert(t, &ca, func(template *x509.Certificate) {
+		template.Subject = pkix.Name{CommonName: "client"}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	})
+
+	caFile := writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", ca.Certificate[0])
+	certFile := writePEM(t, filepath.Join(dir, "cert.pem"), "CERTIFICATE", serverCert.Certificate[0])
+	keyDER, err := x509.MarshalPKCS8PrivateKey(serverCert.PrivateKey)
+	require.NoError(t, err)
+	keyFile := writePEM(t, filepath.Join(dir, "key.pem"), "PRIVATE KEY", keyDER)
+
+	autocertCfg := &autocert.Config{Provider: autocert.ProviderLocal, CertPath: certFile, KeyPath: keyFile}
+	require.NoError(t, autocertCfg.Validate())
+	provider, err := autocert.NewProvider(autocertCfg, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, provider.LoadCertAll())
+	// must be set before the entrypoint is created
+	autocertctx.SetCtx(task.GetTestTask(t), provider)
+
+	NewTestEntrypoint(t, nil)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get(mtls.HeaderClientCertSubject))
+	}))
+	t.Cleanup(upstream.Close)
+	upstreamPort, err := strconv.Atoi(upstream.URL[len("http://127.0.0.1:"):])
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listenPort := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	for _, alias := range []string{"app", "other"} {
+		r := &route.Route{
+			Alias:  alias,
+			Scheme: routeTypes.SchemeHTTP,
+			Host:   "127.0.0.1",
+			Port: route.Port{
+				Listening: listenPort,
+				Proxy:     upstreamPort,
+			},
+			HealthCheck: types.HealthCheckConfig{
+				Disable: true,
+			},
+		}
+		if alias == "app" {
+			r.MTLS = &mtls.Config{CAFile: caFile, ForwardHeaders: true}
+		}
+		_, err := route.NewStartedTestRoute(t, r)
+		require.NoError(t, err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	request := func(t *testing.T, serverName, host string, cert *tls.Certificate) (*http.Response, string, error) {
+		t.Helper()
+		tlsConfig := &tls.Config{ServerName: serverName, RootCAs: roots}
+		if cert != nil {
+			tlsConfig.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			Timeout:   5 * time.Second,
+		}
+		t.Cleanup(client.CloseIdleConnections)
+
+		req, err := http.NewRequest(http.MethodGet, "https://127.0.0.1:"+strconv.Itoa(listenPort), nil)
+		require.NoError(t, err)
+		req.Host = host
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp, string(body), err
+	}
+
+	t.Run("client certificate", func(t *testing.T) {
+		resp, body, err := request(t, "app.example.com", "app.example.com", &clientCert)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "CN=client", body)
+	})
+	t.Run("no client certificate", func(t *testing.T) {
+		_, _, err := request(t, "app.example.com", "app.example.com", nil)
+		require.Error(t, err)
+	})
+	t.Run("route without mtls", func(t *testing.T) {
+		resp, _, err := request(t, "other.example.com", "other.example.com", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	t.Run("sni mismatch", func(t *testing.T) {
+		resp, _, err := request(t, "other.example.com", "app.example.com", &clientCert)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusMisdirectedRequest, resp.StatusCode)
+	})
+}
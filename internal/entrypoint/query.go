@@ -1,6 +1,7 @@
 package entrypoint
 
 import (
+	"github.com/yusing/godoxy/internal/net/gphttp/middleware"
 	"github.com/yusing/godoxy/internal/types"
 )
 
@@ -53,19 +54,13 @@ func getHealthInfo(r types.Route) types.HealthInfo {
 	mon := r.HealthMonitor()
 	if mon == nil {
 		return types.HealthInfo{
-			HealthInfoWithoutDetail: types.HealthInfoWithoutDetail{
-				Status: types.StatusUnknown,
-			},
-			Detail: "n/a",
+			HealthInfoWithoutDetail: getHealthInfoWithoutDetail(r),
+			Detail:                  "n/a",
 		}
 	}
 	return types.HealthInfo{
-		HealthInfoWithoutDetail: types.HealthInfoWithoutDetail{
-			Status:  mon.Status(),
-			Uptime:  mon.Uptime(),
-			Latency: mon.Latency(),
-		},
-		Detail: mon.Detail(),
+		HealthInfoWithoutDetail: getHealthInfoWithoutDetail(r),
+		Detail:                  mon.Detail(),
 	}
 }
 
@@ -73,13 +68,15 @@ func getHealthInfoWithoutDetail(r types.Route) types.HealthInfoWithoutDetail {
 	mon := r.HealthMonitor()
 	if mon == nil {
 		return types.HealthInfoWithoutDetail{
-			Status: types.StatusUnknown,
+			Status:          types.StatusUnknown,
+			CircuitBreakers: middleware.CircuitBreakers(r.Name()),
 		}
 	}
 	return types.HealthInfoWithoutDetail{
-		Status:  mon.Status(),
-		Uptime:  mon.Uptime(),
-		Latency: mon.Latency(),
+		Status:          mon.Status(),
+		Uptime:          mon.Uptime(),
+		Latency:         mon.Latency(),
+		CircuitBreakers: middleware.CircuitBreakers(r.Name()),
 	}
 }
 
@@ -7,6 +7,7 @@ import (
 	"strconv"
 
 	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/metrics/prometheus"
 	"github.com/yusing/godoxy/internal/types"
 )
 
@@ -62,6 +63,7 @@ func (ep *Entrypoint) StartAddRoute(r types.Route) error {
 		r.Task().OnCancel("remove_route", func() {
 			ep.delHTTPRoute(r)
 			ep.shortLinkMatcher.DelRoute(r.Key())
+			prometheus.DeleteRoute(r.Name())
 		})
 	case types.StreamRoute:
 		err := r.ListenAndServe(r.Task().Context(), nil, nil)
@@ -113,6 +115,29 @@ func (ep *Entrypoint) AddHTTPRoute(route types.HTTPRoute) error {
 }
 
 func (ep *Entrypoint) addHTTPRoute(route types.HTTPRoute, addr string, proto HTTPProto) error {
+	if proto == HTTPProtoHTTPS {
+		ep.httpsListenMu.Lock()
+		defer ep.httpsListenMu.Unlock()
+
+		// client certificates are verified by the mTLS server behind the TLS passthrough
+		if route.MTLSConfig() != nil {
+			if _, err := ep.loadOrStartTLSPassthrough(addr); err != nil {
+				return fmt.Errorf("mtls: %w", err)
+			}
+		}
+	}
+
+	srv, err := ep.loadOrStartServer(addr, proto)
+	if err != nil {
+		return err
+	}
+
+	srv.AddRoute(route)
+	return nil
+}
+
+// loadOrStartServer returns the server on addr, starting it if needed.
+func (ep *Entrypoint) loadOrStartServer(addr string, proto HTTPProto) (*httpServer, error) {
 	var err error
 	srv, _ := ep.servers.LoadOrCompute(addr, func() (newSrv *httpServer, cancel bool) {
 		newSrv = newHTTPServer(ep)
@@ -120,12 +145,25 @@ func (ep *Entrypoint) addHTTPRoute(route types.HTTPRoute, addr string, proto HTT
 		cancel = err != nil
 		return
 	})
-	if err != nil {
-		return err
-	}
+	return srv, err
+}
 
-	srv.AddRoute(route)
-	return nil
+// ListenACMEChallenges starts the HTTP server on the HTTP port to serve http-01 challenges,
+// and the TLS passthrough on the HTTPS port to answer tls-alpn-01 challenges, if not started yet.
+//
+// They are started before routes are added, so certificates can be obtained without any route,
+// and the HTTPS server starts behind the passthrough instead of being moved.
+func (ep *Entrypoint) ListenACMEChallenges(http01, tlsALPN01 bool) error {
+	var httpErr, tlsErr error
+	if http01 {
+		_, httpErr = ep.loadOrStartServer(common.ProxyHTTPAddr, HTTPProtoHTTP)
+	}
+	if tlsALPN01 {
+		ep.httpsListenMu.Lock()
+		_, tlsErr = ep.loadOrStartTLSPassthrough(common.ProxyHTTPSAddr)
+		ep.httpsListenMu.Unlock()
+	}
+	return errors.Join(httpErr, tlsErr)
 }
 
 func (ep *Entrypoint) delHTTPRoute(route types.HTTPRoute) {
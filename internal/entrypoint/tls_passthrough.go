@@ -0,0 +1,364 @@
+package entrypoint
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog/log"
+	acl "github.com/yusing/godoxy/internal/acl/types"
+	"github.com/yusing/godoxy/internal/autocert"
+	autocertctx "github.com/yusing/godoxy/internal/autocert/types"
+	"github.com/yusing/godoxy/internal/common"
+	ioutils "github.com/yusing/goutils/io"
+	"github.com/yusing/goutils/task"
+)
+
+// tlsPassthrough accepts TLS connections on an address shared with the HTTPS server, and routes them
+// by the SNI of the ClientHello: connections matching a passthrough stream route are passed to it as-is,
+// connections matching an HTTP route with mTLS are terminated by the mTLS server, and the others are
+// forwarded to the HTTPS server listening on a loopback address, with the client address sent in a
+// PROXY protocol header. TLS-ALPN-01 challenge validations are answered by the passthrough itself.
+type tlsPassthrough struct {
+	ep   *Entrypoint
+	task *task.Task
+
+	addr         string
+	fallbackAddr atomic.Value // string, empty until the HTTPS server listens on it
+	listener     net.Listener
+
+	routes *xsync.Map[string, *passthroughListener] // alias -> listener
+	mtls   *mtlsServer
+}
+
+const clientHelloTimeout = 10 * time.Second
+
+var (
+	ErrPassthroughRouteExists = errors.New("tls passthrough route with the same alias already exists")
+
+	errClientHelloPeeked = errors.New("client hello peeked")
+)
+
+// ListenTLSPassthrough returns a listener of TLS connections to addr with the ClientHello SNI matching alias,
+// the same way as HTTP routes are matched by host. Other connections to addr are served by the HTTPS server.
+//
+// A zero port in addr stands for the HTTPS port. Closing the listener removes the route.
+func (ep *Entrypoint) ListenTLSPassthrough(alias, addr string) (net.Listener, error) {
+	addr = passthroughAddr(addr)
+
+	ep.httpsListenMu.Lock()
+	p, err := ep.loadOrStartTLSPassthrough(addr)
+	ep.httpsListenMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &passthroughListener{
+		addr:  p.listener.Addr(),
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	if _, loaded := p.routes.LoadOrStore(alias, l); loaded {
+		return nil, fmt.Errorf("%w: %s", ErrPassthroughRouteExists, alias)
+	}
+	l.onClose = func() { p.routes.Compute(alias, deleteIfSame(l)) }
+	return l, nil
+}
+
+// passthroughAddr returns addr with a zero port replaced by the HTTPS port, like getAddr for HTTP routes.
+func passthroughAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || (port != "" && port != "0") {
+		return addr
+	}
+	if host == "" {
+		return common.ProxyHTTPSAddr
+	}
+	return net.JoinHostPort(host, strconv.Itoa(common.ProxyHTTPSPort))
+}
+
+// loadOrStartTLSPassthrough returns the TLS passthrough on addr, starting it if needed.
+//
+// It must be called with httpsListenMu held.
+func (ep *Entrypoint) loadOrStartTLSPassthrough(addr string) (*tlsPassthrough, error) {
+	if p, ok := ep.passthroughs.Load(addr); ok {
+		return p, nil
+	}
+	p, err := ep.startTLSPassthrough(addr)
+	if err != nil {
+		return nil, err
+	}
+	ep.passthroughs.Store(addr, p)
+	return p, nil
+}
+
+// startTLSPassthrough binds addr, moving the HTTPS server on addr (if any) to a loopback address.
+//
+// It must be called with httpsListenMu held.
+func (ep *Entrypoint) startTLSPassthrough(addr string) (*tlsPassthrough, error) {
+	p := &tlsPassthrough{
+		ep:     ep,
+		addr:   addr,
+		routes: xsync.NewMap[string, *passthroughListener](),
+	}
+	p.fallbackAddr.Store("")
+
+	srv, hasServer := ep.servers.Load(addr)
+	if hasServer {
+		srv.Close()
+		if err := p.listenFallback(srv.start); err != nil {
+			if err := srv.start(addr); err != nil {
+				log.Err(err).Str("addr", addr).Msg("failed to restore https server")
+			}
+			return nil, fmt.Errorf("failed to move https server to loopback: %w", err)
+		}
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		if hasServer {
+			if err := srv.relisten(addr); err != nil {
+				log.Err(err).Str("addr", addr).Msg("failed to restore https server")
+			}
+		}
+		return nil, err
+	}
+	if ep.cfg.SupportProxyProtocol {
+		l = &proxyproto.Listener{Listener: l}
+	}
+	if aclCfg := acl.FromCtx(ep.task.Context()); aclCfg != nil {
+		l = aclCfg.WrapTCP(l)
+	}
+
+	p.listener = l
+	p.task = ep.task.Subtask("tls_passthrough", false)
+	p.task.OnCancel("close_listener", func() {
+		l.Close()
+	})
+	p.mtls = newMTLSServer(p)
+	p.mtls.start()
+	go p.serve()
+
+	log.Info().Str("addr", addr).Str("fallback", p.fallback()).Msg("tls passthrough started")
+	return p, nil
+}
+
+// maxLoopbackAttempts is the number of loopback addresses tried by listenFallback.
+const maxLoopbackAttempts = 5
+
+// listenFallback starts the HTTPS server behind p with start on a free loopback address, and forwards
+// connections to it. Another address is tried if the free one is taken before start listens on it.
+func (p *tlsPassthrough) listenFallback(start func(listenAddr string) error) error {
+	var err error
+	for range maxLoopbackAttempts {
+		var addr string
+		addr, err = loopbackAddr()
+		if err != nil {
+			return err
+		}
+		err = start(addr)
+		if err == nil {
+			p.fallbackAddr.Store(addr)
+			return nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return err
+		}
+	}
+	return err
+}
+
+// fallback returns the loopback address of the HTTPS server behind p, empty if there is none.
+func (p *tlsPassthrough) fallback() string {
+	return p.fallbackAddr.Load().(string)
+}
+
+// loopbackAddr returns a free loopback address for the HTTPS server behind a TLS passthrough.
+func loopbackAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+func (p *tlsPassthrough) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || p.task.Context().Err() != nil {
+				return
+			}
+			log.Err(err).Str("addr", p.addr).Msg("tls passthrough: failed to accept connection")
+			continue
+		}
+		go p.handle(conn)
+	}
+}
+
+func (p *tlsPassthrough) handle(conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(clientHelloTimeout))
+	hello, peeked, err := peekClientHello(conn)
+	_ = conn.SetReadDeadline(time.Time{})
+	if len(peeked) == 0 {
+		conn.Close()
+		return
+	}
+	conn = &replayConn{Conn: conn, r: io.MultiReader(bytes.NewReader(peeked), conn)}
+
+	if err == nil && autocert.IsTLSALPN01Hello(hello) {
+		p.answerTLSALPN01(conn)
+		return
+	}
+
+	// not TLS or without SNI, let the HTTPS server respond
+	if err == nil && hello.ServerName != "" {
+		if l, ok := findRoute(p, p.ep.findRouteDomains, hello.ServerName); ok && l.deliver(conn) {
+			return
+		}
+		if cfg := p.mtlsConfig(hello.ServerName); cfg != nil && p.mtls.deliver(conn, cfg) {
+			return
+		}
+	}
+	p.forward(conn)
+}
+
+// answerTLSALPN01 completes the handshake of a TLS-ALPN-01 challenge validation with the challenge
+// certificate from the certificate provider, since the HTTPS server does not negotiate acme-tls/1.
+func (p *tlsPassthrough) answerTLSALPN01(conn net.Conn) {
+	defer conn.Close()
+
+	provider := autocertctx.FromCtx(p.ep.task.Context())
+	if provider == nil {
+		return
+	}
+	tlsConn := tls.Server(conn, &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{autocert.TLSALPN01Protocol},
+		GetCertificate: provider.GetCert,
+	})
+	_ = tlsConn.SetDeadline(time.Now().Add(clientHelloTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		log.Debug().Err(err).Str("addr", p.addr).Msg("tls passthrough: tls-alpn-01 handshake failed")
+	}
+}
+
+// Get implements routeGetter.
+func (p *tlsPassthrough) Get(alias string) (*passthroughListener, bool) {
+	return p.routes.Load(alias)
+}
+
+// forward forwards conn to the HTTPS server with the client address in a PROXY protocol v2 header.
+func (p *tlsPassthrough) forward(conn net.Conn) {
+	defer conn.Close()
+
+	dst, err := net.Dial("tcp", p.fallback())
+	if err != nil {
+		log.Err(err).Str("addr", p.addr).Msg("tls passthrough: failed to dial https server")
+		return
+	}
+	defer dst.Close()
+
+	if _, err := proxyproto.HeaderProxyFromAddrs(2, conn.RemoteAddr(), conn.LocalAddr()).WriteTo(dst); err != nil {
+		log.Err(err).Str("addr", p.addr).Msg("tls passthrough: failed to write proxy protocol header")
+		return
+	}
+	_ = ioutils.NewBidirectionalPipe(p.task.Context(), conn, dst).Start()
+}
+
+// peekClientHello reads the ClientHello from conn and returns it and the bytes read.
+func peekClientHello(conn net.Conn) (hello *tls.ClientHelloInfo, peeked []byte, err error) {
+	var buf bytes.Buffer
+	err = tls.Server(readOnlyConn{Conn: conn, r: io.TeeReader(conn, &buf)}, &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = info
+			return nil, errClientHelloPeeked
+		},
+	}).Handshake()
+	if hello == nil {
+		return nil, buf.Bytes(), err
+	}
+	return hello, buf.Bytes(), nil
+}
+
+// readOnlyConn reads from r and discards writes, so a failed handshake sends nothing to the client.
+type readOnlyConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c readOnlyConn) Read(b []byte) (int, error)  { return c.r.Read(b) }
+func (c readOnlyConn) Write(b []byte) (int, error) { return 0, io.ErrClosedPipe }
+
+// replayConn replays the peeked bytes before reading from the connection.
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *replayConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// passthroughListener is the listener of a passthrough stream route, fed by tlsPassthrough.
+type passthroughListener struct {
+	addr    net.Addr
+	conns   chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+	onClose func()
+}
+
+// Accept implements net.Listener.
+func (l *passthroughListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+func (l *passthroughListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+		l.onClose()
+	})
+	return nil
+}
+
+// Addr implements net.Listener.
+func (l *passthroughListener) Addr() net.Addr {
+	return l.addr
+}
+
+// deliver passes conn to the stream route, and reports false if the listener is closed.
+func (l *passthroughListener) deliver(conn net.Conn) bool {
+	select {
+	case l.conns <- conn:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+// deleteIfSame returns a compute function removing the map entry if it is l,
+// so a closed listener does not remove the listener of a restarted route.
+func deleteIfSame(l *passthroughListener) func(old *passthroughListener, loaded bool) (*passthroughListener, xsync.ComputeOp) {
+	return func(old *passthroughListener, loaded bool) (*passthroughListener, xsync.ComputeOp) {
+		if loaded && old == l {
+			return nil, xsync.DeleteOp
+		}
+		return old, xsync.CancelOp
+	}
+}
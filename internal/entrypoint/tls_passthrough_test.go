@@ -0,0 +1,125 @@
+package entrypoint_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yusing/godoxy/internal/common"
+	. "github.com/yusing/godoxy/internal/entrypoint"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// dialTLS starts a TLS handshake to addr with serverName, and returns when the ClientHello is sent.
+func dialTLS(t *testing.T, addr, serverName string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		_ = tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+	}()
+	return conn
+}
+
+func acceptTimeout(l net.Listener, timeout time.Duration) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := l.Accept()
+		ch <- result{conn, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.conn, r.err
+	case <-time.After(timeout):
+		return nil, errors.New("accept timeout")
+	}
+}
+
+func TestTLSPassthrough(t *testing.T) {
+	ep := NewTestEntrypoint(t, nil)
+	ep.SetFindRouteDomains([]string{"example.com"})
+	addr := freeAddr(t)
+
+	l, err := ep.ListenTLSPassthrough("app", addr)
+	require.NoError(t, err)
+	defer l.Close()
+
+	_, err = ep.ListenTLSPassthrough("app", addr)
+	require.ErrorIs(t, err, ErrPassthroughRouteExists)
+
+	t.Run("matched", func(t *testing.T) {
+		dialTLS(t, addr, "app.example.com")
+		conn, err := acceptTimeout(l, time.Second)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// the ClientHello is replayed to the stream route
+		record := make([]byte, 1)
+		_, err = io.ReadFull(conn, record)
+		require.NoError(t, err)
+		assert.Equal(t, byte(0x16), record[0]) // TLS handshake record
+	})
+
+	t.Run("not matched", func(t *testing.T) {
+		dialTLS(t, addr, "other.example.com")
+		_, err := acceptTimeout(l, 100*time.Millisecond)
+		assert.Error(t, err)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		require.NoError(t, l.Close())
+		_, err := l.Accept()
+		assert.ErrorIs(t, err, net.ErrClosed)
+
+		// the alias can be reused after the listener is closed
+		l2, err := ep.ListenTLSPassthrough("app", addr)
+		require.NoError(t, err)
+		defer l2.Close()
+		dialTLS(t, addr, "app.example.com")
+		conn, err := acceptTimeout(l2, time.Second)
+		require.NoError(t, err)
+		conn.Close()
+	})
+}
+
+func TestTLSALPN01Passthrough(t *testing.T) {
+	httpsAddr := common.ProxyHTTPSAddr
+	common.ProxyHTTPSAddr = freeAddr(t)
+	t.Cleanup(func() { common.ProxyHTTPSAddr = httpsAddr })
+
+	listening := func() bool {
+		l, err := net.Listen("tcp", common.ProxyHTTPSAddr)
+		if err != nil {
+			return true
+		}
+		l.Close()
+		return false
+	}
+
+	ep := NewTestEntrypoint(t, nil)
+	require.NoError(t, ep.ListenACMEChallenges(false, true))
+	assert.True(t, listening())
+
+	l, err := ep.ListenTLSPassthrough("app", common.ProxyHTTPSAddr)
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	assert.True(t, listening(), "kept without passthrough routes")
+}
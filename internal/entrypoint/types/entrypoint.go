@@ -1,6 +1,8 @@
 package entrypoint
 
 import (
+	"net"
+
 	"github.com/yusing/godoxy/internal/types"
 )
 
@@ -29,6 +31,12 @@ type Entrypoint interface {
 	// the excluded pool only. Returns an error on listen/bind failure, stream
 	// listen failure, or unsupported route type.
 	StartAddRoute(r types.Route) error
+	// ListenTLSPassthrough returns a listener of TLS connections to addr whose
+	// ClientHello SNI matches alias, the same way as HTTP routes are matched
+	// by host. The connections are not terminated, other connections to addr
+	// are served by the HTTPS server. A zero port in addr stands for the
+	// HTTPS port. Closing the listener removes the route.
+	ListenTLSPassthrough(alias, addr string) (net.Listener, error)
 	IterRoutes(yield func(r types.Route) bool)
 	NumRoutes() int
 	RoutesByProvider() map[string][]types.Route
@@ -9,9 +9,12 @@ import (
 	"github.com/yusing/goutils/task"
 )
 
-var instance *MaxMind
+var (
+	instance    *MaxMind
+	asnInstance *MaxMind // nil if ASN is not enabled
+)
 
-var warnOnce sync.Once
+var warnOnce, warnASNOnce sync.Once
 
 func warnNotConfigured() {
 	log.Warn().Msg("MaxMind not configured, geo lookup will fail")
@@ -23,12 +26,30 @@ func warnNotConfigured() {
 	})
 }
 
+func warnASNNotConfigured() {
+	log.Warn().Msg("MaxMind ASN database not enabled, ASN lookup will fail")
+	notif.Notify(&notif.LogMessage{
+		Level: zerolog.WarnLevel,
+		Title: "MaxMind ASN database not enabled",
+		Body:  notif.MessageBody("set `asn: true` under providers.maxmind to enable ASN lookup"),
+		Color: notif.ColorError,
+	})
+}
+
 func SetInstance(parent task.Parent, cfg *Config) error {
 	newInstance := &MaxMind{Config: cfg}
 	if err := newInstance.LoadMaxMindDB(parent); err != nil {
 		return err
 	}
+	var newASNInstance *MaxMind
+	if cfg.ASN {
+		newASNInstance = &MaxMind{Config: cfg, kind: dbASN}
+		if err := newASNInstance.LoadMaxMindDB(parent); err != nil {
+			return err
+		}
+	}
 	instance = newInstance
+	asnInstance = newASNInstance
 	return nil
 }
 
@@ -43,3 +64,11 @@ func LookupCity(ip *IPInfo) (*City, bool) {
 	}
 	return instance.lookupCity(ip)
 }
+
+func LookupASN(ip *IPInfo) (*ASN, bool) {
+	if asnInstance == nil {
+		warnASNOnce.Do(warnASNNotConfigured)
+		return nil, false
+	}
+	return asnInstance.lookupASN(ip)
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/oschwald/maxminddb-golang"
+	"github.com/rs/zerolog"
 	"github.com/yusing/godoxy/internal/common"
 	maxmind "github.com/yusing/godoxy/internal/maxmind/types"
 	"github.com/yusing/goutils/task"
@@ -28,6 +29,7 @@ refactor(maxmind): switch to Country database
 
 type MaxMind struct {
 	*Config
+	kind dbKind
 
 	lastUpdate time.Time
 	db         struct {
@@ -40,6 +42,14 @@ type (
 	Config = maxmind.Config
 	IPInfo = maxmind.IPInfo
 	City   = maxmind.City
+	ASN    = maxmind.ASN
+)
+
+type dbKind uint8
+
+const (
+	dbCountry dbKind = iota
+	dbASN
 )
 
 const (
@@ -61,17 +71,30 @@ func (cfg *MaxMind) dbPath() string {
 }
 
 func (cfg *MaxMind) dbURL() string {
-	if cfg.Database == maxmind.MaxMindGeoLite {
-		return "https://download.maxmind.com/geoip/databases/GeoLite2-Country/download?suffix=tar.gz"
-	}
-	return "https://download.maxmind.com/geoip/databases/GeoIP2-Country/download?suffix=tar.gz"
+	return "https://download.maxmind.com/geoip/databases/" + cfg.edition() + "/download?suffix=tar.gz"
 }
 
 func (cfg *MaxMind) dbFilename() string {
-	if cfg.Database == maxmind.MaxMindGeoLite {
-		return "GeoLite2-Country.mmdb"
+	return cfg.edition() + ".mmdb"
+}
+
+// edition returns the MaxMind edition ID of the database.
+//
+// The ASN database is always GeoLite2-ASN, which is available to GeoIP2 accounts as well.
+func (cfg *MaxMind) edition() string {
+	switch {
+	case cfg.kind == dbASN:
+		return "GeoLite2-ASN"
+	case cfg.Database == maxmind.MaxMindGeoLite:
+		return "GeoLite2-Country"
+	default:
+		return "GeoIP2-Country"
 	}
-	return "GeoIP2-Country.mmdb"
+}
+
+func (cfg *MaxMind) Logger() *zerolog.Logger {
+	l := cfg.Config.Logger().With().Str("edition", cfg.edition()).Logger()
+	return &l
 }
 
 func (cfg *MaxMind) LoadMaxMindDB(parent task.Parent) error {
@@ -124,3 +124,25 @@ func Test_MaxMindConfig_loadMaxMindDB(t *testing.T) {
 		t.Error("expected db instance")
 	}
 }
+
+func Test_MaxMindConfig_edition(t *testing.T) {
+	tests := []struct {
+		database maxmind.DatabaseType
+		kind     dbKind
+		want     string
+	}{
+		{maxmind.MaxMindGeoLite, dbCountry, "GeoLite2-Country"},
+		{maxmind.MaxMindGeoIP2, dbCountry, "GeoIP2-Country"},
+		{maxmind.MaxMindGeoLite, dbASN, "GeoLite2-ASN"},
+		{maxmind.MaxMindGeoIP2, dbASN, "GeoLite2-ASN"},
+	}
+	for _, tt := range tests {
+		cfg := &MaxMind{Config: &Config{Database: tt.database}, kind: tt.kind}
+		if got := cfg.dbFilename(); got != tt.want+".mmdb" {
+			t.Errorf("dbFilename() = %s, want %s.mmdb", got, tt.want)
+		}
+		if got, want := cfg.dbURL(), "https://download.maxmind.com/geoip/databases/"+tt.want+"/download?suffix=tar.gz"; got != want {
+			t.Errorf("dbURL() = %s, want %s", got, want)
+		}
+	}
+}
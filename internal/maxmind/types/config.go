@@ -12,6 +12,8 @@ type (
 		AccountID  string            `json:"account_id" validate:"required"`
 		LicenseKey strutils.Redacted `json:"license_key" validate:"required"`
 		Database   DatabaseType      `json:"database" validate:"omitempty,oneof=geolite geoip2"`
+		// also download the GeoLite2-ASN database for ASN lookups
+		ASN bool `json:"asn,omitempty"`
 	}
 )
 
@@ -6,4 +6,5 @@ type IPInfo struct {
 	IP   net.IP
 	Str  string
 	City *City
+	ASN  *ASN
 }
@@ -0,0 +1,112 @@
+package prometheus
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+type (
+	metricType string
+
+	label struct {
+		name, value string
+	}
+
+	// expositionWriter writes metrics in the Prometheus text exposition format (version 0.0.4).
+	//
+	// See https://prometheus.io/docs/instrumenting/exposition_formats/
+	expositionWriter struct {
+		buf []byte
+	}
+)
+
+const (
+	metricTypeCounter   metricType = "counter"
+	metricTypeGauge     metricType = "gauge"
+	metricTypeHistogram metricType = "histogram"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func newExpositionWriter(size int) *expositionWriter {
+	return &expositionWriter{buf: make([]byte, 0, size)}
+}
+
+func (w *expositionWriter) Bytes() []byte {
+	return w.buf
+}
+
+// header writes the HELP and TYPE lines of a metric family.
+func (w *expositionWriter) header(name, help string, typ metricType) {
+	w.buf = append(w.buf, "# HELP "...)
+	w.buf = append(w.buf, name...)
+	w.buf = append(w.buf, ' ')
+	w.buf = append(w.buf, helpEscaper.Replace(help)...)
+	w.buf = append(w.buf, "\n# TYPE "...)
+	w.buf = append(w.buf, name...)
+	w.buf = append(w.buf, ' ')
+	w.buf = append(w.buf, typ...)
+	w.buf = append(w.buf, '\n')
+}
+
+// sample writes a single sample line.
+func (w *expositionWriter) sample(name string, value float64, labels ...label) {
+	w.buf = append(w.buf, name...)
+	if len(labels) > 0 {
+		w.buf = append(w.buf, '{')
+		for i, l := range labels {
+			if i > 0 {
+				w.buf = append(w.buf, ',')
+			}
+			w.buf = append(w.buf, l.name...)
+			w.buf = append(w.buf, `="`...)
+			w.buf = append(w.buf, labelEscaper.Replace(l.value)...)
+			w.buf = append(w.buf, '"')
+		}
+		w.buf = append(w.buf, '}')
+	}
+	w.buf = append(w.buf, ' ')
+	w.buf = appendFloat(w.buf, value)
+	w.buf = append(w.buf, '\n')
+}
+
+// histogram writes the buckets, sum and count samples of a histogram.
+//
+// counts must be cumulative and have the same length as upperBounds.
+func (w *expositionWriter) histogram(name string, upperBounds []float64, counts []uint64, sum float64, count uint64, labels ...label) {
+	bucketLabels := make([]label, len(labels)+1)
+	copy(bucketLabels, labels)
+	for i, ub := range upperBounds {
+		bucketLabels[len(labels)] = label{"le", string(appendFloat(nil, ub))}
+		w.sample(name+"_bucket", float64(counts[i]), bucketLabels...)
+	}
+	bucketLabels[len(labels)] = label{"le", "+Inf"}
+	w.sample(name+"_bucket", float64(count), bucketLabels...)
+	w.sample(name+"_sum", sum, labels...)
+	w.sample(name+"_count", float64(count), labels...)
+}
+
+func appendFloat(b []byte, v float64) []byte {
+	switch {
+	case math.IsInf(v, 1):
+		return append(b, "+Inf"...)
+	case math.IsInf(v, -1):
+		return append(b, "-Inf"...)
+	case math.IsNaN(v):
+		return append(b, "NaN"...)
+	}
+	return strconv.AppendFloat(b, v, 'g', -1, 64)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
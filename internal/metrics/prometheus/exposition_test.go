@@ -0,0 +1,73 @@
+package prometheus
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpositionWriter(t *testing.T) {
+	w := newExpositionWriter(0)
+	w.header("test_metric", "Help with \\ and\nnewline.", metricTypeGauge)
+	w.sample("test_metric", 1.5, label{"a", `quote " backslash \ newline` + "\n"})
+	w.sample("test_metric", math.Inf(1))
+
+	expected := `# HELP test_metric Help with \\ and\nnewline.
+# TYPE test_metric gauge
+test_metric{a="quote \" backslash \\ newline\n"} 1.5
+test_metric +Inf
+`
+	assert.Equal(t, expected, string(w.Bytes()))
+}
+
+func TestExpositionWriterHistogram(t *testing.T) {
+	w := newExpositionWriter(0)
+	w.histogram("h", []float64{0.1, 1}, []uint64{1, 3}, 2.5, 4, label{"route", "r"})
+
+	expected := `h_bucket{route="r",le="0.1"} 1
+h_bucket{route="r",le="1"} 3
+h_bucket{route="r",le="+Inf"} 4
+h_sum{route="r"} 2.5
+h_count{route="r"} 4
+`
+	assert.Equal(t, expected, string(w.Bytes()))
+}
+
+func TestObserveRequest(t *testing.T) {
+	route := t.Name()
+	ObserveRequest(route, 200, 3*time.Millisecond, 10, 100)
+	ObserveRequest(route, 503, 2*time.Second, 0, 20)
+	ObserveRequest(route, 0, 20*time.Second, 0, 0)
+
+	w := newExpositionWriter(0)
+	writeRouteMetrics(w)
+	out := string(w.Bytes())
+
+	for _, line := range []string{
+		`godoxy_route_requests_total{route="TestObserveRequest",status_class="2xx"} 1`,
+		`godoxy_route_requests_total{route="TestObserveRequest",status_class="5xx"} 1`,
+		`godoxy_route_requests_total{route="TestObserveRequest",status_class="other"} 1`,
+		`godoxy_route_request_duration_seconds_bucket{route="TestObserveRequest",le="0.005"} 1`,
+		`godoxy_route_request_duration_seconds_bucket{route="TestObserveRequest",le="2.5"} 2`,
+		`godoxy_route_request_duration_seconds_bucket{route="TestObserveRequest",le="10"} 2`,
+		`godoxy_route_request_duration_seconds_bucket{route="TestObserveRequest",le="+Inf"} 3`,
+		`godoxy_route_request_duration_seconds_count{route="TestObserveRequest"} 3`,
+		`godoxy_route_request_bytes_total{route="TestObserveRequest"} 10`,
+		`godoxy_route_response_bytes_total{route="TestObserveRequest"} 120`,
+	} {
+		assert.True(t, strings.Contains(out, line+"\n"), "missing line %q", line)
+	}
+}
+
+func TestDeleteRoute(t *testing.T) {
+	route := t.Name()
+	ObserveRequest(route, 200, time.Millisecond, 0, 0)
+	DeleteRoute(route)
+
+	w := newExpositionWriter(0)
+	writeRouteMetrics(w)
+	assert.False(t, strings.Contains(string(w.Bytes()), `route="TestDeleteRoute"`))
+}
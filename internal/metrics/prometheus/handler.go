@@ -0,0 +1,187 @@
+package prometheus
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	entrypoint "github.com/yusing/godoxy/internal/entrypoint/types"
+	"github.com/yusing/godoxy/internal/metrics/systeminfo"
+	"github.com/yusing/godoxy/internal/types"
+)
+
+type (
+	// loadBalancerPool is implemented by the load balancer health monitor.
+	loadBalancerPool interface {
+		Servers() types.LoadBalancerServers
+	}
+	// activeConnsCounter is implemented by stream implementations that track active connections.
+	activeConnsCounter interface {
+		ActiveConns() int64
+	}
+)
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+//
+// Route, health and load balancer metrics are read from the entrypoint in the request context.
+func ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ew := newExpositionWriter(16 * 1024)
+
+	writeRouteMetrics(ew)
+	if ep := entrypoint.FromCtx(r.Context()); ep != nil {
+		writeHealthMetrics(ew, ep)
+		writeLoadBalancerMetrics(ew, ep)
+		writeStreamMetrics(ew, ep)
+	}
+	writeSystemInfoMetrics(ew)
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(ew.Bytes()); err != nil {
+		log.Err(err).Msg("failed to write prometheus metrics")
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+var healthStatuses = []types.HealthStatus{
+	types.StatusHealthy,
+	types.StatusNapping,
+	types.StatusStarting,
+	types.StatusUnhealthy,
+	types.StatusError,
+	types.StatusUnknown,
+}
+
+func writeHealthMetrics(w *expositionWriter, ep entrypoint.Entrypoint) {
+	healthInfo := ep.GetHealthInfoWithoutDetail()
+	if len(healthInfo) == 0 {
+		return
+	}
+	aliases := sortedKeys(healthInfo)
+
+	w.header("godoxy_route_up", "Whether the route is considered healthy (1) or not (0).", metricTypeGauge)
+	for _, alias := range aliases {
+		w.sample("godoxy_route_up", boolToFloat(healthInfo[alias].Status.Good()), label{"route", alias})
+	}
+
+	w.header("godoxy_route_health_status", "Current health status of the route, 1 for the active status.", metricTypeGauge)
+	for _, alias := range aliases {
+		current := healthInfo[alias].Status
+		for _, status := range healthStatuses {
+			w.sample("godoxy_route_health_status", boolToFloat(current == status), label{"route", alias}, label{"status", status.String()})
+		}
+	}
+
+	w.header("godoxy_route_health_latency_seconds", "Latency of the last health check of the route.", metricTypeGauge)
+	for _, alias := range aliases {
+		w.sample("godoxy_route_health_latency_seconds", healthInfo[alias].Latency.Seconds(), label{"route", alias})
+	}
+
+	w.header("godoxy_route_uptime_seconds", "Time since the route became healthy.", metricTypeGauge)
+	for _, alias := range aliases {
+		w.sample("godoxy_route_uptime_seconds", healthInfo[alias].Uptime.Seconds(), label{"route", alias})
+	}
+}
+
+func writeLoadBalancerMetrics(w *expositionWriter, ep entrypoint.Entrypoint) {
+	pools := make(map[string]types.LoadBalancerServers)
+	for alias, r := range ep.HTTPRoutes().Iter {
+		if lb, ok := r.HealthMonitor().(loadBalancerPool); ok {
+			pools[alias] = lb.Servers()
+		}
+	}
+	if len(pools) == 0 {
+		return
+	}
+	links := sortedKeys(pools)
+
+	w.header("godoxy_loadbalancer_servers", "Number of servers in the load balancer pool.", metricTypeGauge)
+	for _, link := range links {
+		w.sample("godoxy_loadbalancer_servers", float64(len(pools[link])), label{"loadbalancer", link})
+	}
+
+	w.header("godoxy_loadbalancer_server_up", "Whether the load balancer server is available (1) or not (0).", metricTypeGauge)
+	for _, link := range links {
+		for _, srv := range pools[link] {
+			w.sample("godoxy_loadbalancer_server_up", boolToFloat(srv.Status().Good()), label{"loadbalancer", link}, label{"server", srv.Name()})
+		}
+	}
+
+	w.header("godoxy_loadbalancer_server_weight", "Weight of the load balancer server.", metricTypeGauge)
+	for _, link := range links {
+		for _, srv := range pools[link] {
+			w.sample("godoxy_loadbalancer_server_weight", float64(srv.Weight()), label{"loadbalancer", link}, label{"server", srv.Name()})
+		}
+	}
+}
+
+func writeStreamMetrics(w *expositionWriter, ep entrypoint.Entrypoint) {
+	conns := make(map[string]int64)
+	for alias, r := range ep.StreamRoutes().Iter {
+		if counter, ok := r.Stream().(activeConnsCounter); ok {
+			conns[alias] = counter.ActiveConns()
+		}
+	}
+	if len(conns) == 0 {
+		return
+	}
+
+	w.header("godoxy_stream_active_connections", "Number of active connections of a stream route.", metricTypeGauge)
+	for _, alias := range sortedKeys(conns) {
+		w.sample("godoxy_stream_active_connections", float64(conns[alias]), label{"route", alias})
+	}
+}
+
+func writeSystemInfoMetrics(w *expositionWriter) {
+	info := systeminfo.Poller.GetLastResult()
+	if info == nil {
+		return
+	}
+
+	if info.CPUAverage != nil {
+		w.header("godoxy_system_cpu_usage_percent", "Average CPU usage in percent.", metricTypeGauge)
+		w.sample("godoxy_system_cpu_usage_percent", *info.CPUAverage)
+	}
+
+	if info.Memory.Total > 0 {
+		w.header("godoxy_system_memory_used_bytes", "Used memory in bytes.", metricTypeGauge)
+		w.sample("godoxy_system_memory_used_bytes", float64(info.Memory.Used))
+		w.header("godoxy_system_memory_total_bytes", "Total memory in bytes.", metricTypeGauge)
+		w.sample("godoxy_system_memory_total_bytes", float64(info.Memory.Total))
+	}
+
+	if len(info.Disks) > 0 {
+		devices := sortedKeys(info.Disks)
+		w.header("godoxy_system_disk_used_bytes", "Used disk space in bytes.", metricTypeGauge)
+		for _, device := range devices {
+			w.sample("godoxy_system_disk_used_bytes", float64(info.Disks[device].Used), label{"device", device}, label{"path", info.Disks[device].Path})
+		}
+		w.header("godoxy_system_disk_total_bytes", "Total disk space in bytes.", metricTypeGauge)
+		for _, device := range devices {
+			w.sample("godoxy_system_disk_total_bytes", float64(info.Disks[device].Total), label{"device", device}, label{"path", info.Disks[device].Path})
+		}
+	}
+
+	if info.Network.BytesSent > 0 || info.Network.BytesRecv > 0 {
+		w.header("godoxy_system_network_sent_bytes_total", "Total bytes sent over the network.", metricTypeCounter)
+		w.sample("godoxy_system_network_sent_bytes_total", float64(info.Network.BytesSent))
+		w.header("godoxy_system_network_received_bytes_total", "Total bytes received over the network.", metricTypeCounter)
+		w.sample("godoxy_system_network_received_bytes_total", float64(info.Network.BytesRecv))
+	}
+
+	if len(info.Sensors) > 0 {
+		w.header("godoxy_system_sensor_temperature_celsius", "Hardware sensor temperature in celsius.", metricTypeGauge)
+		for _, sensor := range info.Sensors {
+			w.sample("godoxy_system_sensor_temperature_celsius", sensor.Temperature, label{"sensor", strings.TrimSpace(sensor.SensorKey)})
+		}
+	}
+}
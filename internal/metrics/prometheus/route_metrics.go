@@ -0,0 +1,165 @@
+package prometheus
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/logging/accesslog"
+)
+
+type routeMetrics struct {
+	requests [numStatusClasses]atomic.Uint64
+
+	latencyBuckets []atomic.Uint64 // non-cumulative, same length as LatencyBuckets
+	latencySumNs   atomic.Uint64
+	latencyCount   atomic.Uint64
+
+	bytesIn  atomic.Uint64
+	bytesOut atomic.Uint64
+}
+
+// LatencyBuckets are the upper bounds (in seconds) of the request latency histogram.
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const numStatusClasses = 6 // 1xx-5xx, others
+
+var statusClasses = [numStatusClasses]string{"other", "1xx", "2xx", "3xx", "4xx", "5xx"}
+
+var routeMetricsMap = xsync.NewMap[string, *routeMetrics]()
+
+// Enabled reports whether the prometheus exporter is enabled.
+//
+// When disabled, no per request metrics are collected.
+func Enabled() bool {
+	return common.MetricsPrometheusEnabled
+}
+
+func newRouteMetrics() *routeMetrics {
+	return &routeMetrics{
+		latencyBuckets: make([]atomic.Uint64, len(LatencyBuckets)),
+	}
+}
+
+func statusClass(status int) int {
+	if status < 100 || status >= 600 {
+		return 0
+	}
+	return status / 100
+}
+
+// ObserveRequest records a finished request of the given route.
+func ObserveRequest(route string, status int, latency time.Duration, bytesIn, bytesOut int64) {
+	m, _ := routeMetricsMap.LoadOrCompute(route, func() (*routeMetrics, bool) {
+		return newRouteMetrics(), false
+	})
+
+	m.requests[statusClass(status)].Add(1)
+
+	seconds := latency.Seconds()
+	if i, _ := slices.BinarySearch(LatencyBuckets, seconds); i < len(LatencyBuckets) {
+		m.latencyBuckets[i].Add(1)
+	}
+	m.latencySumNs.Add(uint64(max(latency, 0)))
+	m.latencyCount.Add(1)
+
+	if bytesIn > 0 {
+		m.bytesIn.Add(uint64(bytesIn))
+	}
+	if bytesOut > 0 {
+		m.bytesOut.Add(uint64(bytesOut))
+	}
+}
+
+// DeleteRoute removes the request metrics of a route, so removed and renamed routes are no longer exported.
+func DeleteRoute(route string) {
+	routeMetricsMap.Delete(route)
+}
+
+// ObserveRoute serves the request with next and records its status, latency and transferred bytes under the given route.
+func ObserveRoute(route string, w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+
+	rec := accesslog.GetResponseRecorder(w)
+	defer accesslog.PutResponseRecorder(rec)
+
+	var body *countingReadCloser
+	if r.Body != nil && r.Body != http.NoBody {
+		body = &countingReadCloser{ReadCloser: r.Body}
+		r.Body = body
+	}
+
+	next(rec, r)
+
+	var bytesIn int64
+	if body != nil {
+		bytesIn = body.n
+	}
+	resp := rec.Response()
+	ObserveRequest(route, resp.StatusCode, time.Since(start), bytesIn, resp.ContentLength)
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func writeRouteMetrics(w *expositionWriter) {
+	type entry struct {
+		route string
+		m     *routeMetrics
+	}
+	entries := make([]entry, 0, routeMetricsMap.Size())
+	for route, m := range routeMetricsMap.Range {
+		entries = append(entries, entry{route, m})
+	}
+	if len(entries) == 0 {
+		return
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return strings.Compare(a.route, b.route)
+	})
+
+	w.header("godoxy_route_requests_total", "Total number of HTTP requests served by a route, by status class.", metricTypeCounter)
+	for _, e := range entries {
+		for class := range e.m.requests {
+			if n := e.m.requests[class].Load(); n > 0 {
+				w.sample("godoxy_route_requests_total", float64(n), label{"route", e.route}, label{"status_class", statusClasses[class]})
+			}
+		}
+	}
+
+	w.header("godoxy_route_request_duration_seconds", "Latency of HTTP requests served by a route.", metricTypeHistogram)
+	counts := make([]uint64, len(LatencyBuckets))
+	for _, e := range entries {
+		var cumulative uint64
+		for i := range e.m.latencyBuckets {
+			cumulative += e.m.latencyBuckets[i].Load()
+			counts[i] = cumulative
+		}
+		count := max(e.m.latencyCount.Load(), cumulative)
+		sum := time.Duration(e.m.latencySumNs.Load()).Seconds()
+		w.histogram("godoxy_route_request_duration_seconds", LatencyBuckets, counts, sum, count, label{"route", e.route})
+	}
+
+	w.header("godoxy_route_request_bytes_total", "Total bytes received in HTTP request bodies of a route.", metricTypeCounter)
+	for _, e := range entries {
+		w.sample("godoxy_route_request_bytes_total", float64(e.m.bytesIn.Load()), label{"route", e.route})
+	}
+
+	w.header("godoxy_route_response_bytes_total", "Total bytes sent in HTTP response bodies of a route.", metricTypeCounter)
+	for _, e := range entries {
+		w.sample("godoxy_route_response_bytes_total", float64(e.m.bytesOut.Load()), label{"route", e.route})
+	}
+}
@@ -0,0 +1,239 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type (
+	// Config is the client certificate authentication of a route, enforced on TLS connections
+	// with the SNI matching the route.
+	Config struct {
+		// CAFile is the path to the PEM encoded CA bundle client certificates are verified against.
+		CAFile string `json:"ca_file" validate:"required"`
+		// Mode is "require" (default) to reject clients without a certificate,
+		// or "optional" to verify the certificate only if presented.
+		Mode Mode `json:"mode,omitempty" validate:"omitempty,oneof=require optional" swaggertype:"string" enums:"require,optional"`
+		// AllowedSubjects are the allowed subject common names or distinguished names (e.g. CN=client,O=Example).
+		AllowedSubjects []string `json:"allowed_subjects,omitempty"`
+		// AllowedSANs are the allowed DNS names, email addresses, URIs or IP addresses.
+		// If any allow-list is set, the certificate must match an entry of either.
+		AllowedSANs []string `json:"allowed_sans,omitempty"`
+		// CRLFiles are paths to PEM or DER encoded certificate revocation lists signed by the CA, reloaded on change.
+		CRLFiles []string `json:"crl_files,omitempty"`
+		// OCSP checks the revocation status of client certificates with the OCSP responder of the certificate.
+		OCSP bool `json:"ocsp,omitempty"`
+		// OCSPSoftFail accepts client certificates when the OCSP responder is unavailable.
+		OCSPSoftFail bool `json:"ocsp_soft_fail,omitempty"`
+		// ForwardHeaders forwards the client certificate details to the upstream as X-Client-Cert-* headers.
+		ForwardHeaders bool `json:"forward_headers,omitempty"`
+
+		pool *x509.CertPool
+		crls []*crlFile
+		ocsp *xsync.Map[string, *ocspEntry]
+
+		tlsConfigOnce sync.Once
+		tlsConfig     *tls.Config
+	} // @name MTLSConfig
+
+	Mode string
+)
+
+const (
+	ModeRequire  Mode = "require"
+	ModeOptional Mode = "optional"
+)
+
+var (
+	ErrNoCACertificates      = errors.New("no CA certificates found")
+	ErrCertificateNotAllowed = errors.New("client certificate not allowed")
+	ErrCertificateRevoked    = errors.New("client certificate revoked")
+)
+
+// Validate implements the serialization.CustomValidator interface.
+//
+// It loads the CA bundle and the CRL files, and does nothing if they are already loaded.
+func (c *Config) Validate() error {
+	if c.Mode == "" {
+		c.Mode = ModeRequire
+	}
+	if c.pool != nil {
+		return nil
+	}
+	if c.CAFile == "" {
+		return errors.New("ca_file is required")
+	}
+
+	data, err := os.ReadFile(c.CAFile)
+	if err != nil {
+		return gperr.PrependSubject(err, "ca_file")
+	}
+	cas, err := parseCertificates(data)
+	if err != nil {
+		return gperr.PrependSubject(err, "ca_file")
+	}
+
+	var errs gperr.Builder
+	crls := make([]*crlFile, 0, len(c.CRLFiles))
+	for i, path := range c.CRLFiles {
+		f := &crlFile{path: path, cas: cas}
+		if err := f.load(); err != nil {
+			errs.Add(gperr.PrependSubject(err, "crl_files."+strconv.Itoa(i)))
+			continue
+		}
+		crls = append(crls, f)
+	}
+	if errs.HasError() {
+		return errs.Error()
+	}
+
+	c.pool = x509.NewCertPool()
+	for _, ca := range cas {
+		c.pool.AddCert(ca)
+	}
+	c.crls = crls
+	if c.OCSP {
+		c.ocsp = xsync.NewMap[string, *ocspEntry]()
+	}
+	return nil
+}
+
+// ClientAuth returns the client authentication policy of the mode.
+func (c *Config) ClientAuth() tls.ClientAuthType {
+	if c.Mode == ModeOptional {
+		return tls.VerifyClientCertIfGiven
+	}
+	return tls.RequireAndVerifyClientCert
+}
+
+// ServerTLSConfig returns the TLS config to terminate connections with,
+// serving certificates from getCert and verifying client certificates.
+//
+// The config is built once, so TLS sessions can be resumed.
+func (c *Config) ServerTLSConfig(getCert func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	c.tlsConfigOnce.Do(func() {
+		c.tlsConfig = &tls.Config{
+			MinVersion:       tls.VersionTLS12,
+			NextProtos:       []string{"h2", "http/1.1"},
+			GetCertificate:   getCert,
+			ClientAuth:       c.ClientAuth(),
+			ClientCAs:        c.pool,
+			VerifyConnection: c.VerifyConnection,
+		}
+	})
+	return c.tlsConfig
+}
+
+// VerifyConnection checks the client certificate, already verified against the CA bundle,
+// against the allow-lists and the revocation lists.
+//
+// It implements tls.Config.VerifyConnection.
+func (c *Config) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return nil // rejected by the handshake when required
+	}
+	cert := cs.PeerCertificates[0]
+	if !c.isAllowed(cert) {
+		return fmt.Errorf("%w: %s", ErrCertificateNotAllowed, cert.Subject)
+	}
+
+	var issuer *x509.Certificate
+	if len(cs.VerifiedChains) > 0 && len(cs.VerifiedChains[0]) > 1 {
+		issuer = cs.VerifiedChains[0][1]
+	}
+	for _, crl := range c.crls {
+		if crl.isRevoked(cert) {
+			return fmt.Errorf("%w: serial %s", ErrCertificateRevoked, ClientCertSerialOf(cert))
+		}
+	}
+	if c.OCSP {
+		if err := c.checkOCSP(cert, issuer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) isAllowed(cert *x509.Certificate) bool {
+	if len(c.AllowedSubjects) == 0 && len(c.AllowedSANs) == 0 {
+		return true
+	}
+	if slices.Contains(c.AllowedSubjects, cert.Subject.CommonName) || slices.Contains(c.AllowedSubjects, cert.Subject.String()) {
+		return true
+	}
+	for _, name := range cert.DNSNames {
+		if slices.Contains(c.AllowedSANs, name) {
+			return true
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if slices.Contains(c.AllowedSANs, email) {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if slices.Contains(c.AllowedSANs, uri.String()) {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if slices.Contains(c.AllowedSANs, ip.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetForwardHeaders replaces the X-Client-Cert-* headers of r with the details
+// of the client certificate, if ForwardHeaders is enabled.
+//
+// The headers are always removed, so clients cannot spoof them.
+func (c *Config) SetForwardHeaders(r *http.Request) {
+	for _, h := range forwardHeaders {
+		r.Header.Del(h.name)
+	}
+	if !c.ForwardHeaders {
+		return
+	}
+	if ClientCert(r) == nil {
+		r.Header.Set(HeaderClientCertVerify, ClientCertVerify(r))
+		return
+	}
+	for _, h := range forwardHeaders {
+		r.Header.Set(h.name, h.get(r))
+	}
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, ErrNoCACertificates
+	}
+	return certs, nil
+}
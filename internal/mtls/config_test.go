@@ -0,0 +1,370 @@
+package mtls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+	file string
+}
+
+var serial atomic.Int64
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial.Add(1)),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+func (ca *testCA) issue(t *testing.T, modify func(template *x509.Certificate)) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial.Add(1)),
+		Subject:      pkix.Name{CommonName: "client", Organization: []string{"Example"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	if modify != nil {
+		modify(template)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+func (ca *testCA) writeCRL(t *testing.T, file string, revoked ...*x509.Certificate) {
+	t.Helper()
+	entries := make([]x509.RevocationListEntry, len(revoked))
+	for i, cert := range revoked {
+		entries[i] = x509.RevocationListEntry{SerialNumber: cert.SerialNumber, RevocationTime: time.Now()}
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(serial.Add(1)),
+		ThisUpdate:                time.Now().Add(-time.Minute),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, ca.cert, ca.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600))
+}
+
+func newConfig(t *testing.T, cfg *Config) *Config {
+	t.Helper()
+	require.NoError(t, cfg.Validate())
+	return cfg
+}
+
+// handshake performs a TLS handshake with cfg and returns the server side error and connection state.
+func handshake(t *testing.T, ca *testCA, cfg *Config, clientCert *tls.Certificate) (tls.ConnectionState, error) {
+	t.Helper()
+	serverCert := ca.issue(t, func(template *x509.Certificate) {
+		template.DNSNames = []string{"app.example.com"}
+	})
+	serverConfig := cfg.ServerTLSConfig(func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &serverCert, nil
+	})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientConfig := &tls.Config{ServerName: "app.example.com", RootCAs: roots}
+	if clientCert != nil {
+		clientConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		serverConn.Close()
+		clientConn.Close()
+	})
+	client := tls.Client(clientConn, clientConfig)
+	go func() {
+		// TLS 1.3 client certificates are verified after the client handshake completes
+		if client.Handshake() == nil {
+			_, _ = client.Read(make([]byte, 1))
+		}
+		client.Close()
+	}()
+	server := tls.Server(serverConn, serverConfig)
+	err := server.Handshake()
+	return server.ConnectionState(), err
+}
+
+func TestValidate(t *testing.T) {
+	ca := newTestCA(t)
+
+	cfg := newConfig(t, &Config{CAFile: ca.file})
+	assert.Equal(t, ModeRequire, cfg.Mode)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth())
+	assert.Equal(t, tls.VerifyClientCertIfGiven, newConfig(t, &Config{CAFile: ca.file, Mode: ModeOptional}).ClientAuth())
+
+	require.Error(t, (&Config{CAFile: filepath.Join(t.TempDir(), "missing.pem")}).Validate())
+
+	notCA := filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(notCA, []byte("not a certificate"), 0o600))
+	require.ErrorIs(t, (&Config{CAFile: notCA}).Validate(), ErrNoCACertificates)
+
+	otherCA := newTestCA(t)
+	crlFile := filepath.Join(t.TempDir(), "crl.pem")
+	otherCA.writeCRL(t, crlFile)
+	require.ErrorIs(t, (&Config{CAFile: ca.file, CRLFiles: []string{crlFile}}).Validate(), ErrCRLNotSignedByCA)
+}
+
+func TestClientCertVerification(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	clientCert := ca.issue(t, nil)
+
+	t.Run("require", func(t *testing.T) {
+		cfg := newConfig(t, &Config{CAFile: ca.file})
+		state, err := handshake(t, ca, cfg, &clientCert)
+		require.NoError(t, err)
+		require.Len(t, state.PeerCertificates, 1)
+		assert.Equal(t, "client", state.PeerCertificates[0].Subject.CommonName)
+
+		_, err = handshake(t, ca, cfg, nil)
+		require.Error(t, err)
+
+		untrusted := otherCA.issue(t, nil)
+		_, err = handshake(t, ca, cfg, &untrusted)
+		require.Error(t, err)
+	})
+	t.Run("optional", func(t *testing.T) {
+		cfg := newConfig(t, &Config{CAFile: ca.file, Mode: ModeOptional})
+		state, err := handshake(t, ca, cfg, nil)
+		require.NoError(t, err)
+		assert.Empty(t, state.PeerCertificates)
+
+		_, err = handshake(t, ca, cfg, &clientCert)
+		require.NoError(t, err)
+
+		// certificates presented are still verified
+		untrusted := otherCA.issue(t, nil)
+		_, err = handshake(t, ca, cfg, &untrusted)
+		require.Error(t, err)
+	})
+}
+
+func TestAllowLists(t *testing.T) {
+	ca := newTestCA(t)
+	clientCert := ca.issue(t, func(template *x509.Certificate) {
+		template.DNSNames = []string{"client.example.com"}
+		template.EmailAddresses = []string{"user@example.com"}
+		template.URIs = []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/client"}}
+	})
+
+	tests := []struct {
+		name    string
+		cfg     *Config
+		allowed bool
+	}{
+		{"common name", &Config{AllowedSubjects: []string{"client"}}, true},
+		{"distinguished name", &Config{AllowedSubjects: []string{"CN=client,O=Example"}}, true},
+		{"dns name", &Config{AllowedSANs: []string{"client.example.com"}}, true},
+		{"email", &Config{AllowedSANs: []string{"user@example.com"}}, true},
+		{"uri", &Config{AllowedSANs: []string{"spiffe://example.com/client"}}, true},
+		{"either list", &Config{AllowedSubjects: []string{"other"}, AllowedSANs: []string{"client.example.com"}}, true},
+		{"subject not allowed", &Config{AllowedSubjects: []string{"other"}}, false},
+		{"san not allowed", &Config{AllowedSANs: []string{"other.example.com"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.CAFile = ca.file
+			_, err := handshake(t, ca, newConfig(t, tt.cfg), &clientCert)
+			if tt.allowed {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, ErrCertificateNotAllowed)
+			}
+		})
+	}
+}
+
+func TestCRL(t *testing.T) {
+	crlCheckInterval = 0
+	t.Cleanup(func() {
+		crlCheckInterval = time.Minute
+	})
+
+	ca := newTestCA(t)
+	revokedCert := ca.issue(t, nil)
+	goodCert := ca.issue(t, nil)
+
+	crlFile := filepath.Join(t.TempDir(), "crl.pem")
+	ca.writeCRL(t, crlFile, revokedCert.Leaf)
+
+	cfg := newConfig(t, &Config{CAFile: ca.file, CRLFiles: []string{crlFile}})
+	_, err := handshake(t, ca, cfg, &revokedCert)
+	require.ErrorIs(t, err, ErrCertificateRevoked)
+	_, err = handshake(t, ca, cfg, &goodCert)
+	require.NoError(t, err)
+
+	// reloaded on change
+	ca.writeCRL(t, crlFile, goodCert.Leaf)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(crlFile, future, future))
+	_, err = handshake(t, ca, cfg, &goodCert)
+	require.ErrorIs(t, err, ErrCertificateRevoked)
+	_, err = handshake(t, ca, cfg, &revokedCert)
+	require.NoError(t, err)
+}
+
+func TestOCSP(t *testing.T) {
+	ca := newTestCA(t)
+
+	var revoked atomic.Pointer[big.Int]
+	var queries atomic.Int32
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req, err := ocsp.ParseRequest(body)
+		require.NoError(t, err)
+
+		status := ocsp.Good
+		if serial := revoked.Load(); serial != nil && serial.Cmp(req.SerialNumber) == 0 {
+			status = ocsp.Revoked
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, ca.key)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		_, _ = w.Write(resp)
+	}))
+	t.Cleanup(responder.Close)
+
+	withResponder := func(url string) func(template *x509.Certificate) {
+		return func(template *x509.Certificate) {
+			template.OCSPServer = []string{url}
+		}
+	}
+	goodCert := ca.issue(t, withResponder(responder.URL))
+	revokedCert := ca.issue(t, withResponder(responder.URL))
+	revoked.Store(revokedCert.Leaf.SerialNumber)
+
+	cfg := newConfig(t, &Config{CAFile: ca.file, OCSP: true})
+	_, err := handshake(t, ca, cfg, &goodCert)
+	require.NoError(t, err)
+	_, err = handshake(t, ca, cfg, &revokedCert)
+	require.ErrorIs(t, err, ErrCertificateRevoked)
+
+	// responses are cached until next update
+	_, err = handshake(t, ca, cfg, &goodCert)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), queries.Load())
+
+	t.Run("unavailable", func(t *testing.T) {
+		unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(unavailable.Close)
+		clientCert := ca.issue(t, withResponder(unavailable.URL))
+
+		_, err := handshake(t, ca, newConfig(t, &Config{CAFile: ca.file, OCSP: true}), &clientCert)
+		require.ErrorIs(t, err, ErrOCSPUnavailable)
+		_, err = handshake(t, ca, newConfig(t, &Config{CAFile: ca.file, OCSP: true, OCSPSoftFail: true}), &clientCert)
+		require.NoError(t, err)
+	})
+	t.Run("soft fail still rejects revoked", func(t *testing.T) {
+		_, err := handshake(t, ca, newConfig(t, &Config{CAFile: ca.file, OCSP: true, OCSPSoftFail: true}), &revokedCert)
+		require.ErrorIs(t, err, ErrCertificateRevoked)
+	})
+}
+
+func TestForwardHeaders(t *testing.T) {
+	ca := newTestCA(t)
+	clientCert := ca.issue(t, func(template *x509.Certificate) {
+		template.SerialNumber = big.NewInt(0xabcdef)
+		template.DNSNames = []string{"client.example.com"}
+		template.IPAddresses = []net.IP{net.ParseIP("10.0.0.1")}
+	})
+	cfg := newConfig(t, &Config{CAFile: ca.file, Mode: ModeOptional, ForwardHeaders: true})
+
+	req := httptest.NewRequest(http.MethodGet, "https://app.example.com/", nil)
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{clientCert.Leaf},
+		VerifiedChains:   [][]*x509.Certificate{{clientCert.Leaf, ca.cert}},
+	}
+	req.Header.Set(HeaderClientCertSubject, "CN=spoofed")
+	cfg.SetForwardHeaders(req)
+
+	assert.Equal(t, VerifySuccess, req.Header.Get(HeaderClientCertVerify))
+	assert.Equal(t, "CN=client,O=Example", req.Header.Get(HeaderClientCertSubject))
+	assert.Equal(t, "CN=Test CA", req.Header.Get(HeaderClientCertIssuer))
+	assert.Equal(t, "ABCDEF", req.Header.Get(HeaderClientCertSerial))
+	assert.Equal(t, "DNS:client.example.com,IP:10.0.0.1", req.Header.Get(HeaderClientCertSAN))
+	assert.Len(t, req.Header.Get(HeaderClientCertFingerprint), 64)
+	assert.Equal(t, clientCert.Leaf.NotAfter.UTC().Format(time.RFC3339), req.Header.Get(HeaderClientCertNotAfter))
+
+	escaped, err := url.QueryUnescape(req.Header.Get(HeaderClientCert))
+	require.NoError(t, err)
+	block, _ := pem.Decode([]byte(escaped))
+	require.NotNil(t, block)
+	assert.Equal(t, clientCert.Leaf.Raw, block.Bytes)
+
+	t.Run("without client certificate", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "https://app.example.com/", nil)
+		req.TLS = &tls.ConnectionState{}
+		req.Header.Set(HeaderClientCertSubject, "CN=spoofed")
+		cfg.SetForwardHeaders(req)
+		assert.Equal(t, VerifyNone, req.Header.Get(HeaderClientCertVerify))
+		assert.Empty(t, req.Header.Get(HeaderClientCertSubject))
+	})
+	t.Run("disabled", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "https://app.example.com/", nil)
+		req.Header.Set(HeaderClientCertSubject, "CN=spoofed")
+		(&Config{}).SetForwardHeaders(req)
+		assert.Empty(t, req.Header.Get(HeaderClientCertSubject))
+	})
+}
@@ -0,0 +1,161 @@
+package mtls
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type contextKey struct{}
+
+const (
+	HeaderClientCert            = "X-Client-Cert"
+	HeaderClientCertVerify      = "X-Client-Cert-Verify"
+	HeaderClientCertSubject     = "X-Client-Cert-Subject"
+	HeaderClientCertIssuer      = "X-Client-Cert-Issuer"
+	HeaderClientCertSerial      = "X-Client-Cert-Serial"
+	HeaderClientCertFingerprint = "X-Client-Cert-Fingerprint"
+	HeaderClientCertSAN         = "X-Client-Cert-SAN"
+	HeaderClientCertNotBefore   = "X-Client-Cert-Not-Before"
+	HeaderClientCertNotAfter    = "X-Client-Cert-Not-After"
+)
+
+const (
+	VerifySuccess = "SUCCESS"
+	VerifyNone    = "NONE"
+)
+
+var forwardHeaders = []struct {
+	name string
+	get  func(*http.Request) string
+}{
+	{HeaderClientCert, ClientCertEscaped},
+	{HeaderClientCertVerify, ClientCertVerify},
+	{HeaderClientCertSubject, ClientCertSubject},
+	{HeaderClientCertIssuer, ClientCertIssuer},
+	{HeaderClientCertSerial, ClientCertSerial},
+	{HeaderClientCertFingerprint, ClientCertFingerprint},
+	{HeaderClientCertSAN, ClientCertSAN},
+	{HeaderClientCertNotBefore, ClientCertNotBefore},
+	{HeaderClientCertNotAfter, ClientCertNotAfter},
+}
+
+// WithConfig returns a copy of ctx carrying the config the connection was terminated with.
+func WithConfig(ctx context.Context, cfg *Config) context.Context {
+	return context.WithValue(ctx, contextKey{}, cfg)
+}
+
+// FromContext returns the config the connection was terminated with,
+// nil if it was not terminated with client certificate authentication.
+func FromContext(ctx context.Context) *Config {
+	cfg, _ := ctx.Value(contextKey{}).(*Config)
+	return cfg
+}
+
+// ClientCert returns the verified client certificate of the request, nil if none.
+func ClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// ClientCertVerify returns SUCCESS if the request has a verified client certificate, NONE otherwise.
+func ClientCertVerify(r *http.Request) string {
+	if ClientCert(r) == nil {
+		return VerifyNone
+	}
+	return VerifySuccess
+}
+
+// ClientCertSubject returns the distinguished name of the client certificate subject.
+func ClientCertSubject(r *http.Request) string {
+	if cert := ClientCert(r); cert != nil {
+		return cert.Subject.String()
+	}
+	return ""
+}
+
+// ClientCertIssuer returns the distinguished name of the client certificate issuer.
+func ClientCertIssuer(r *http.Request) string {
+	if cert := ClientCert(r); cert != nil {
+		return cert.Issuer.String()
+	}
+	return ""
+}
+
+// ClientCertSerial returns the serial number of the client certificate in hex.
+func ClientCertSerial(r *http.Request) string {
+	if cert := ClientCert(r); cert != nil {
+		return ClientCertSerialOf(cert)
+	}
+	return ""
+}
+
+// ClientCertSerialOf returns the serial number of cert in upper case hex.
+func ClientCertSerialOf(cert *x509.Certificate) string {
+	return strings.ToUpper(cert.SerialNumber.Text(16))
+}
+
+// ClientCertFingerprint returns the SHA-256 fingerprint of the client certificate in hex.
+func ClientCertFingerprint(r *http.Request) string {
+	if cert := ClientCert(r); cert != nil {
+		sum := sha256.Sum256(cert.Raw)
+		return hex.EncodeToString(sum[:])
+	}
+	return ""
+}
+
+// ClientCertSAN returns the subject alternative names of the client certificate,
+// comma separated and prefixed by their type, e.g. DNS:client.example.com,email:user@example.com.
+func ClientCertSAN(r *http.Request) string {
+	cert := ClientCert(r)
+	if cert == nil {
+		return ""
+	}
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.URIs)+len(cert.IPAddresses))
+	for _, name := range cert.DNSNames {
+		sans = append(sans, "DNS:"+name)
+	}
+	for _, email := range cert.EmailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, "URI:"+uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	return strings.Join(sans, ",")
+}
+
+// ClientCertNotBefore returns the start of the client certificate validity in RFC 3339 format.
+func ClientCertNotBefore(r *http.Request) string {
+	if cert := ClientCert(r); cert != nil {
+		return cert.NotBefore.UTC().Format(time.RFC3339)
+	}
+	return ""
+}
+
+// ClientCertNotAfter returns the end of the client certificate validity in RFC 3339 format.
+func ClientCertNotAfter(r *http.Request) string {
+	if cert := ClientCert(r); cert != nil {
+		return cert.NotAfter.UTC().Format(time.RFC3339)
+	}
+	return ""
+}
+
+// ClientCertEscaped returns the URL escaped PEM encoded client certificate.
+func ClientCertEscaped(r *http.Request) string {
+	if cert := ClientCert(r); cert != nil {
+		escaped := url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+		return strings.ReplaceAll(escaped, "+", "%20")
+	}
+	return ""
+}
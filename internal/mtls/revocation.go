@@ -0,0 +1,221 @@
+package mtls
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ocsp"
+)
+
+// crlFile is a certificate revocation list file, reloaded when modified.
+type crlFile struct {
+	path string
+	cas  []*x509.Certificate
+
+	mu        sync.Mutex
+	modTime   time.Time
+	checkedAt time.Time
+	rawIssuer []byte
+	revoked   map[string]struct{} // serial number -> revoked
+}
+
+// ocspEntry is a cached OCSP check result, nil err for a good certificate.
+type ocspEntry struct {
+	err       error
+	expiresAt time.Time
+}
+
+const (
+	ocspTimeout         = 5 * time.Second
+	ocspMaxResponseSize = 1 << 20
+	// ocspDefaultTTL is how long responses without next update are cached.
+	ocspDefaultTTL = time.Hour
+	// ocspFailureTTL is how long failed lookups are cached, so an unavailable
+	// responder does not delay every handshake.
+	ocspFailureTTL = time.Minute
+)
+
+var (
+	ErrCRLNotSignedByCA  = errors.New("CRL is not signed by any of the CA certificates")
+	ErrOCSPUnavailable   = errors.New("OCSP status unavailable")
+	ErrUnknownCertIssuer = errors.New("unknown certificate issuer")
+)
+
+// crlCheckInterval limits how often CRL files are checked for modification.
+var crlCheckInterval = time.Minute
+
+var ocspClient = &http.Client{Timeout: ocspTimeout}
+
+func (f *crlFile) load() error {
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return err
+	}
+
+	signed := false
+	for _, ca := range f.cas {
+		if bytes.Equal(ca.RawSubject, crl.RawIssuer) && crl.CheckSignatureFrom(ca) == nil {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return ErrCRLNotSignedByCA
+	}
+
+	revoked := make(map[string]struct{}, len(crl.RevokedCertificateEntries))
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.String()] = struct{}{}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.modTime = stat.ModTime()
+	f.rawIssuer = crl.RawIssuer
+	f.revoked = revoked
+	return nil
+}
+
+// isRevoked returns true if cert is revoked by the CRL.
+//
+// The file is reloaded if modified, previously loaded entries are kept if reloading fails.
+func (f *crlFile) isRevoked(cert *x509.Certificate) bool {
+	f.reloadIfModified()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !bytes.Equal(cert.RawIssuer, f.rawIssuer) {
+		return false
+	}
+	_, ok := f.revoked[cert.SerialNumber.String()]
+	return ok
+}
+
+func (f *crlFile) reloadIfModified() {
+	f.mu.Lock()
+	now := time.Now()
+	if now.Sub(f.checkedAt) < crlCheckInterval {
+		f.mu.Unlock()
+		return
+	}
+	f.checkedAt = now
+	modTime := f.modTime
+	f.mu.Unlock()
+
+	stat, err := os.Stat(f.path)
+	if err != nil || stat.ModTime().Equal(modTime) {
+		return
+	}
+	if err := f.load(); err != nil {
+		log.Err(err).Str("path", f.path).Msg("failed to reload CRL file, keeping previously loaded entries")
+		return
+	}
+	log.Info().Str("path", f.path).Msg("CRL file reloaded")
+}
+
+// checkOCSP checks the revocation status of cert with its OCSP responder.
+//
+// Revoked certificates are always rejected, other failures are
+// only rejected when OCSPSoftFail is disabled.
+func (c *Config) checkOCSP(cert, issuer *x509.Certificate) error {
+	key := string(cert.Raw)
+	entry, ok := c.ocsp.Load(key)
+	if !ok || time.Now().After(entry.expiresAt) {
+		entry = queryOCSP(cert, issuer)
+		c.ocsp.Store(key, entry)
+	}
+	if entry.err == nil || errors.Is(entry.err, ErrCertificateRevoked) {
+		return entry.err
+	}
+	if c.OCSPSoftFail {
+		log.Warn().Err(entry.err).Str("subject", cert.Subject.String()).Msg("OCSP check failed, accepting client certificate")
+		return nil
+	}
+	return entry.err
+}
+
+func queryOCSP(cert, issuer *x509.Certificate) *ocspEntry {
+	resp, err := FetchOCSP(cert, issuer)
+	if err != nil {
+		return &ocspEntry{
+			err:       fmt.Errorf("%w: %w", ErrOCSPUnavailable, err),
+			expiresAt: time.Now().Add(ocspFailureTTL),
+		}
+	}
+
+	entry := &ocspEntry{expiresAt: resp.NextUpdate}
+	if entry.expiresAt.IsZero() {
+		entry.expiresAt = time.Now().Add(ocspDefaultTTL)
+	}
+	switch resp.Status {
+	case ocsp.Good:
+	case ocsp.Revoked:
+		entry.err = fmt.Errorf("%w: serial %s", ErrCertificateRevoked, ClientCertSerialOf(cert))
+	default:
+		entry.err = fmt.Errorf("%w: status unknown", ErrOCSPUnavailable)
+		entry.expiresAt = time.Now().Add(ocspFailureTTL)
+	}
+	return entry
+}
+
+// FetchOCSP fetches the OCSP response of cert from its OCSP responder,
+// the raw response is kept in Raw, e.g. for OCSP stapling.
+func FetchOCSP(cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	if issuer == nil {
+		return nil, ErrUnknownCertIssuer
+	}
+	if len(cert.OCSPServer) == 0 {
+		return nil, errors.New("certificate has no OCSP responder")
+	}
+
+	reqData, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ocspTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cert.OCSPServer[0], bytes.NewReader(reqData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+
+	resp, err := ocspClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, ocspMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	return ocsp.ParseResponseForCert(data, cert, issuer)
+}
@@ -0,0 +1,193 @@
+package httpcache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog/log"
+)
+
+type (
+	// Cache is an in-memory LRU cache of responses, optionally backed by the shared disk store.
+	Cache struct {
+		opts Options
+
+		mu      sync.Mutex
+		lru     *list.List                 // of *Entry, most recently used at front
+		items   map[string][]*list.Element // by primary key, one element per variant
+		entries int
+		size    int64
+
+		disk  *diskStore
+		stats *xsync.Map[string, *routeStats]
+
+		flightMu sync.Mutex
+		flights  map[string]*Flight
+	}
+
+	Options struct {
+		MaxEntries   int
+		MaxSize      int64
+		MaxEntrySize int64
+		DiskMaxSize  int64 // 0 to disable the disk store
+	}
+)
+
+// New creates a new cache and registers it for Purge and AllStats until it is garbage collected.
+func New(opts Options) *Cache {
+	c := &Cache{
+		opts:    opts,
+		lru:     list.New(),
+		items:   make(map[string][]*list.Element),
+		stats:   xsync.NewMap[string, *routeStats](),
+		flights: make(map[string]*Flight),
+	}
+	if opts.DiskMaxSize > 0 {
+		disk, err := sharedDiskStore(opts.DiskMaxSize)
+		if err != nil {
+			log.Err(err).Msg("failed to open http cache disk store, using memory only")
+		} else {
+			c.disk = disk
+		}
+	}
+	register(c)
+	return c
+}
+
+// MaxEntrySize returns the max size of a response body to be stored.
+func (c *Cache) MaxEntrySize() int64 {
+	return c.opts.MaxEntrySize
+}
+
+// Get returns the stored response that can be used for r, or nil if there is none.
+func (c *Cache) Get(route string, r *http.Request) *Entry {
+	key := Key(route, r)
+
+	c.mu.Lock()
+	for _, elem := range c.items[key] {
+		e := elem.Value.(*Entry)
+		if e.Matches(r) {
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+			return e
+		}
+	}
+	c.mu.Unlock()
+
+	if c.disk == nil {
+		return nil
+	}
+	for _, e := range c.disk.load(key) {
+		if e.Matches(r) {
+			c.put(e)
+			return e
+		}
+	}
+	return nil
+}
+
+// Put stores e, replacing the stored variant with the same Vary header values if any.
+func (c *Cache) Put(e *Entry) {
+	if int64(len(e.Body)) > c.opts.MaxEntrySize {
+		return
+	}
+	c.put(e)
+	if c.disk != nil {
+		c.disk.store(e)
+	}
+}
+
+func (c *Cache) put(e *Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := e.id()
+	elems := c.items[e.Key]
+	for i, elem := range elems {
+		if elem.Value.(*Entry).id() == id {
+			c.removeElement(elem)
+			elems = append(elems[:i], elems[i+1:]...)
+			break
+		}
+	}
+	c.items[e.Key] = append(elems, c.lru.PushFront(e))
+	c.entries++
+	c.size += e.size()
+	rs := c.routeStats(e.Route)
+	rs.entries.Add(1)
+	rs.size.Add(e.size())
+
+	for c.entries > c.opts.MaxEntries || c.size > c.opts.MaxSize {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			break
+		}
+		old := oldest.Value.(*Entry)
+		c.removeElement(oldest)
+		c.removeFromItems(old.Key, oldest)
+	}
+}
+
+// Delete removes all variants stored under the primary key of r, e.g. after an unsafe request to its URI.
+func (c *Cache) Delete(route string, r *http.Request) {
+	key := Key(route, r)
+	c.mu.Lock()
+	for _, elem := range c.items[key] {
+		c.removeElement(elem)
+	}
+	delete(c.items, key)
+	c.mu.Unlock()
+	if c.disk != nil {
+		c.disk.delete(key)
+	}
+}
+
+// Purge removes the entries of route whose request path matches match and returns the number of removed entries.
+func (c *Cache) Purge(route string, match func(path string) bool) int {
+	n := 0
+	c.mu.Lock()
+	for key, elems := range c.items {
+		e := elems[0].Value.(*Entry)
+		if e.Route != route || !match(e.Path) {
+			continue
+		}
+		for _, elem := range elems {
+			c.removeElement(elem)
+			n++
+		}
+		delete(c.items, key)
+	}
+	c.mu.Unlock()
+	if c.disk != nil {
+		n = max(n, c.disk.purge(route, match))
+	}
+	return n
+}
+
+// removeElement removes elem from the LRU list, c.mu must be held.
+func (c *Cache) removeElement(elem *list.Element) {
+	e := c.lru.Remove(elem).(*Entry)
+	c.entries--
+	c.size -= e.size()
+	rs := c.routeStats(e.Route)
+	rs.entries.Add(-1)
+	rs.size.Add(-e.size())
+}
+
+// removeFromItems removes elem from the variants of key, c.mu must be held.
+func (c *Cache) removeFromItems(key string, elem *list.Element) {
+	elems := c.items[key]
+	for i, v := range elems {
+		if v == elem {
+			elems = append(elems[:i], elems[i+1:]...)
+			break
+		}
+	}
+	if len(elems) == 0 {
+		delete(c.items, key)
+	} else {
+		c.items[key] = elems
+	}
+}
@@ -0,0 +1,104 @@
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yusing/goutils/http/httpheaders"
+)
+
+// CacheControl is the parsed Cache-Control header of a request or response.
+//
+// Durations that are not present are -1.
+type CacheControl struct {
+	NoStore         bool
+	NoCache         bool
+	Private         bool
+	Public          bool
+	MustRevalidate  bool
+	ProxyRevalidate bool
+	OnlyIfCached    bool
+
+	MaxAge               time.Duration
+	SMaxAge              time.Duration
+	MaxStale             time.Duration // request only, max-stale without value is treated as unlimited
+	MinFresh             time.Duration // request only
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+}
+
+const unlimited = time.Duration(1<<63 - 1)
+
+// ParseCacheControl parses the Cache-Control header of h, and Pragma: no-cache if Cache-Control is absent.
+//
+// Unknown directives are ignored, invalid durations are treated as absent.
+func ParseCacheControl(h http.Header) CacheControl {
+	cc := CacheControl{
+		MaxAge:               -1,
+		SMaxAge:              -1,
+		MaxStale:             -1,
+		MinFresh:             -1,
+		StaleWhileRevalidate: -1,
+		StaleIfError:         -1,
+	}
+	values := h.Values(httpheaders.HeaderCacheControl)
+	if len(values) == 0 {
+		if strings.Contains(strings.ToLower(h.Get("Pragma")), "no-cache") {
+			cc.NoCache = true
+		}
+		return cc
+	}
+	for _, v := range values {
+		for directive := range strings.SplitSeq(v, ",") {
+			name, arg, hasArg := strings.Cut(strings.TrimSpace(directive), "=")
+			arg = strings.Trim(arg, `"`)
+			switch strings.ToLower(name) {
+			case "no-store":
+				cc.NoStore = true
+			case "no-cache":
+				// no-cache with field names is treated as unqualified no-cache
+				cc.NoCache = true
+			case "private":
+				cc.Private = true
+			case "public":
+				cc.Public = true
+			case "must-revalidate":
+				cc.MustRevalidate = true
+			case "proxy-revalidate":
+				cc.ProxyRevalidate = true
+			case "only-if-cached":
+				cc.OnlyIfCached = true
+			case "max-age":
+				cc.MaxAge = parseDeltaSeconds(arg)
+			case "s-maxage":
+				cc.SMaxAge = parseDeltaSeconds(arg)
+			case "max-stale":
+				if hasArg {
+					cc.MaxStale = parseDeltaSeconds(arg)
+				} else {
+					cc.MaxStale = unlimited
+				}
+			case "min-fresh":
+				cc.MinFresh = parseDeltaSeconds(arg)
+			case "stale-while-revalidate":
+				cc.StaleWhileRevalidate = parseDeltaSeconds(arg)
+			case "stale-if-error":
+				cc.StaleIfError = parseDeltaSeconds(arg)
+			}
+		}
+	}
+	return cc
+}
+
+func parseDeltaSeconds(s string) time.Duration {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return -1
+	}
+	if n > int64(unlimited/time.Second) {
+		return unlimited
+	}
+	return time.Duration(n) * time.Second
+}
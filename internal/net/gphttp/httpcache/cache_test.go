@@ -0,0 +1,202 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newTestEntry(r *http.Request, header http.Header, body string, now time.Time) *Entry {
+	return NewEntry("test", r, http.StatusOK, header, []byte(body), now, now)
+}
+
+func TestParseCacheControl(t *testing.T) {
+	h := http.Header{}
+	h.Add("Cache-Control", `public, max-age=60, s-maxage="120"`)
+	h.Add("Cache-Control", "stale-while-revalidate=30, max-stale, no-cache=Set-Cookie")
+	cc := ParseCacheControl(h)
+	expect.True(t, cc.Public)
+	expect.True(t, cc.NoCache)
+	expect.False(t, cc.NoStore)
+	expect.Equal(t, cc.MaxAge, time.Minute)
+	expect.Equal(t, cc.SMaxAge, 2*time.Minute)
+	expect.Equal(t, cc.StaleWhileRevalidate, 30*time.Second)
+	expect.Equal(t, cc.MaxStale, unlimited)
+	expect.Equal(t, cc.StaleIfError, time.Duration(-1))
+
+	cc = ParseCacheControl(http.Header{"Pragma": {"no-cache"}})
+	expect.True(t, cc.NoCache)
+}
+
+func TestFreshness(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	now := time.Now().Truncate(time.Second)
+	date := now.UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		lifetime time.Duration
+	}{
+		{"s-maxage", http.Header{"Cache-Control": {"max-age=10, s-maxage=20"}}, 20 * time.Second},
+		{"max-age", http.Header{"Cache-Control": {"max-age=10"}}, 10 * time.Second},
+		{"no-cache", http.Header{"Cache-Control": {"no-cache, max-age=10"}}, 0},
+		{"expires", http.Header{"Date": {date}, "Expires": {now.Add(time.Hour).UTC().Format(http.TimeFormat)}}, time.Hour},
+		{"invalid expires", http.Header{"Expires": {"0"}}, 0},
+		{"heuristic", http.Header{"Date": {date}, "Last-Modified": {now.Add(-10 * time.Hour).UTC().Format(http.TimeFormat)}}, time.Hour},
+		{"default", http.Header{}, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEntry(r, tt.header, "", now)
+			expect.Equal(t, e.FreshnessLifetime(5*time.Second), tt.lifetime)
+		})
+	}
+
+	e := newTestEntry(r, http.Header{"Cache-Control": {"max-age=60"}, "Age": {"10"}}, "", now)
+	expect.Equal(t, e.Age(now.Add(5*time.Second)), 15*time.Second)
+	expect.Equal(t, e.TTL(now.Add(5*time.Second), 0), 45*time.Second)
+}
+
+func TestIsStorable(t *testing.T) {
+	get := httptest.NewRequest(http.MethodGet, "/", nil)
+	auth := httptest.NewRequest(http.MethodGet, "/", nil)
+	auth.Header.Set("Authorization", "Bearer token")
+
+	tests := []struct {
+		name     string
+		r        *http.Request
+		status   int
+		header   http.Header
+		storable bool
+	}{
+		{"cacheable by default", get, http.StatusOK, http.Header{}, true},
+		{"not cacheable by default", get, http.StatusInternalServerError, http.Header{}, false},
+		{"explicit max-age", get, http.StatusInternalServerError, http.Header{"Cache-Control": {"max-age=10"}}, true},
+		{"no-store", get, http.StatusOK, http.Header{"Cache-Control": {"no-store"}}, false},
+		{"private", get, http.StatusOK, http.Header{"Cache-Control": {"private, max-age=10"}}, false},
+		{"set-cookie", get, http.StatusOK, http.Header{"Set-Cookie": {"a=b"}}, false},
+		{"vary *", get, http.StatusOK, http.Header{"Vary": {"Accept, *"}}, false},
+		{"partial content", get, http.StatusPartialContent, http.Header{}, false},
+		{"authorization", auth, http.StatusOK, http.Header{"Cache-Control": {"max-age=10"}}, false},
+		{"authorization public", auth, http.StatusOK, http.Header{"Cache-Control": {"public, max-age=10"}}, true},
+		{"head", httptest.NewRequest(http.MethodHead, "/", nil), http.StatusOK, http.Header{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect.Equal(t, IsStorable(tt.r, tt.status, tt.header), tt.storable)
+		})
+	}
+}
+
+func TestCacheVariants(t *testing.T) {
+	c := New(Options{MaxEntries: 10, MaxSize: 1 << 20, MaxEntrySize: 1 << 10})
+	now := time.Now()
+
+	gzipReq := httptest.NewRequest(http.MethodGet, "/page", nil)
+	gzipReq.Header.Set("Accept-Encoding", "gzip,  br")
+	plainReq := httptest.NewRequest(http.MethodGet, "/page", nil)
+
+	c.Put(newTestEntry(gzipReq, http.Header{"Vary": {"accept-encoding"}}, "gzip", now))
+	c.Put(newTestEntry(plainReq, http.Header{"Vary": {"Accept-Encoding"}}, "plain", now))
+
+	req := httptest.NewRequest(http.MethodHead, "/page", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	e := c.Get("test", req)
+	expect.NotNil(t, e)
+	expect.Equal(t, string(e.Body), "gzip")
+
+	e = c.Get("test", httptest.NewRequest(http.MethodGet, "/page", nil))
+	expect.NotNil(t, e)
+	expect.Equal(t, string(e.Body), "plain")
+
+	req.Header.Set("Accept-Encoding", "zstd")
+	expect.Nil(t, c.Get("test", req))
+	expect.Nil(t, c.Get("other", plainReq))
+
+	// too large
+	c.Put(newTestEntry(httptest.NewRequest(http.MethodGet, "/large", nil), http.Header{}, strings.Repeat("x", 2<<10), now))
+	expect.Nil(t, c.Get("test", httptest.NewRequest(http.MethodGet, "/large", nil)))
+
+	c.Delete("test", httptest.NewRequest(http.MethodPost, "/page", nil))
+	expect.Nil(t, c.Get("test", plainReq))
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := New(Options{MaxEntries: 2, MaxSize: 1 << 20, MaxEntrySize: 1 << 10})
+	now := time.Now()
+	req := func(path string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, path, nil)
+	}
+
+	c.Put(newTestEntry(req("/1"), http.Header{}, "1", now))
+	c.Put(newTestEntry(req("/2"), http.Header{}, "2", now))
+	expect.NotNil(t, c.Get("test", req("/1"))) // /2 is now the least recently used
+	c.Put(newTestEntry(req("/3"), http.Header{}, "3", now))
+
+	expect.NotNil(t, c.Get("test", req("/1")))
+	expect.Nil(t, c.Get("test", req("/2")))
+	expect.NotNil(t, c.Get("test", req("/3")))
+	expect.Equal(t, c.entries, 2)
+}
+
+func TestPurgeAndStats(t *testing.T) {
+	c := New(Options{MaxEntries: 10, MaxSize: 1 << 20, MaxEntrySize: 1 << 10})
+	now := time.Now()
+	for _, path := range []string{"/static/a.js", "/static/b.css", "/index.html"} {
+		c.Put(NewEntry("purge-test", httptest.NewRequest(http.MethodGet, path, nil), http.StatusOK, http.Header{}, []byte(path), now, now))
+	}
+	c.Record("purge-test", OutcomeHit)
+	c.Record("purge-test", OutcomeStale)
+	c.Record("purge-test", OutcomeMiss)
+	c.Record("purge-test", OutcomeMiss)
+
+	n := Purge("purge-test", func(path string) bool { return strings.HasPrefix(path, "/static/") })
+	expect.Equal(t, n, 2)
+
+	var stats *Stats
+	for _, s := range AllStats() {
+		if s.Route == "purge-test" {
+			stats = &s
+		}
+	}
+	expect.NotNil(t, stats)
+	expect.Equal(t, stats.Entries, int64(1))
+	expect.Equal(t, stats.Size, c.size)
+	expect.Equal(t, stats.HitRatio, 0.5)
+}
+
+func TestDiskStore(t *testing.T) {
+	dir := t.TempDir()
+	d, err := openDiskStore(dir, 1<<20)
+	expect.NoError(t, err)
+
+	now := time.Now()
+	r := httptest.NewRequest(http.MethodGet, "/disk", nil)
+	r.Header.Set("Accept", "text/html")
+	e := newTestEntry(r, http.Header{"Vary": {"Accept"}, "Etag": {`"v1"`}}, "hello", now)
+	d.store(e)
+
+	// reopen to rebuild the index from files
+	d, err = openDiskStore(dir, 1<<20)
+	expect.NoError(t, err)
+	entries := d.load(e.Key)
+	expect.Equal(t, len(entries), 1)
+	expect.Equal(t, string(entries[0].Body), "hello")
+	expect.Equal(t, entries[0].ETag(), `"v1"`)
+	expect.True(t, entries[0].Matches(r))
+	expect.True(t, entries[0].ResponseTime.Equal(now))
+
+	expect.Equal(t, d.purge("test", func(path string) bool { return path == "/disk" }), 1)
+	expect.Equal(t, len(d.load(e.Key)), 0)
+	expect.Equal(t, d.size, int64(0))
+
+	// evict least recently used files over the size limit
+	d.maxSize = 1
+	d.store(e)
+	expect.Equal(t, len(d.files), 0)
+}
@@ -0,0 +1,295 @@
+package httpcache
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/common"
+)
+
+type (
+	// diskStore stores entries as files under a directory, evicting least recently used files
+	// when the total size exceeds maxSize.
+	//
+	// Each file holds a gob encoded diskMeta followed by the gob encoded Entry,
+	// so the index can be rebuilt on startup without decoding the bodies.
+	diskStore struct {
+		dir string
+
+		mu      sync.Mutex
+		maxSize int64
+		size    int64
+		files   map[string]*diskItem // by file name
+		byKey   map[string][]string  // primary key to file names
+	}
+
+	diskItem struct {
+		diskMeta
+		name  string
+		size  int64
+		atime time.Time
+	}
+
+	diskMeta struct {
+		Key   string
+		Route string
+		Path  string
+	}
+)
+
+const diskFileExt = ".cache"
+
+var (
+	sharedDisk   *diskStore
+	sharedDiskMu sync.Mutex
+)
+
+// sharedDiskStore returns the disk store under common.DataDir shared by all caches,
+// its size limit is the largest one requested.
+func sharedDiskStore(maxSize int64) (*diskStore, error) {
+	sharedDiskMu.Lock()
+	defer sharedDiskMu.Unlock()
+
+	if sharedDisk != nil {
+		sharedDisk.mu.Lock()
+		sharedDisk.maxSize = max(sharedDisk.maxSize, maxSize)
+		sharedDisk.mu.Unlock()
+		return sharedDisk, nil
+	}
+	disk, err := openDiskStore(filepath.Join(common.DataDir, "http_cache"), maxSize)
+	if err != nil {
+		return nil, err
+	}
+	sharedDisk = disk
+	return disk, nil
+}
+
+func openDiskStore(dir string, maxSize int64) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &diskStore{
+		dir:     dir,
+		maxSize: maxSize,
+		files:   make(map[string]*diskItem, len(files)),
+		byKey:   make(map[string][]string, len(files)),
+	}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, diskFileExt) {
+			continue
+		}
+		item, err := d.readItem(name)
+		if err != nil {
+			log.Warn().Err(err).Str("file", name).Msg("removing invalid http cache file")
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		d.add(item)
+	}
+	d.mu.Lock()
+	d.evict()
+	d.mu.Unlock()
+	return d, nil
+}
+
+func (d *diskStore) readItem(name string) (*diskItem, error) {
+	f, err := os.Open(filepath.Join(d.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	item := &diskItem{name: name, size: stat.Size(), atime: stat.ModTime()}
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&item.diskMeta); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// add adds item to the index, d.mu must be held if d is shared.
+func (d *diskStore) add(item *diskItem) {
+	d.files[item.name] = item
+	d.byKey[item.Key] = append(d.byKey[item.Key], item.name)
+	d.size += item.size
+}
+
+// remove removes the file of item, d.mu must be held.
+func (d *diskStore) remove(item *diskItem) {
+	if err := os.Remove(filepath.Join(d.dir, item.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Err(err).Str("file", item.name).Msg("failed to remove http cache file")
+	}
+	delete(d.files, item.name)
+	names := slices.DeleteFunc(d.byKey[item.Key], func(n string) bool { return n == item.name })
+	if len(names) == 0 {
+		delete(d.byKey, item.Key)
+	} else {
+		d.byKey[item.Key] = names
+	}
+	d.size -= item.size
+}
+
+// evict removes least recently used files until the size is within maxSize, d.mu must be held.
+func (d *diskStore) evict() {
+	for d.size > d.maxSize {
+		var oldest *diskItem
+		for _, item := range d.files {
+			if oldest == nil || item.atime.Before(oldest.atime) {
+				oldest = item
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		d.remove(oldest)
+	}
+}
+
+func diskFileName(e *Entry) string {
+	sum := sha256.Sum256([]byte(e.id()))
+	return hex.EncodeToString(sum[:]) + diskFileExt
+}
+
+func (d *diskStore) store(e *Entry) {
+	name := diskFileName(e)
+	path := filepath.Join(d.dir, name)
+	size, err := writeEntry(path, e)
+	if err != nil {
+		log.Err(err).Str("key", e.Key).Msg("failed to write http cache file")
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if old, ok := d.files[name]; ok {
+		// the file is already replaced, only update the index
+		delete(d.files, name)
+		d.size -= old.size
+		d.byKey[old.Key] = slices.DeleteFunc(d.byKey[old.Key], func(n string) bool { return n == name })
+	}
+	d.add(&diskItem{
+		diskMeta: diskMeta{Key: e.Key, Route: e.Route, Path: e.Path},
+		name:     name,
+		size:     size,
+		atime:    time.Now(),
+	})
+	d.evict()
+}
+
+func writeEntry(path string, e *Entry) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := gob.NewEncoder(w)
+	err = enc.Encode(diskMeta{Key: e.Key, Route: e.Route, Path: e.Path})
+	if err == nil {
+		err = enc.Encode(e)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	var size int64
+	if err == nil {
+		var stat os.FileInfo
+		stat, err = tmp.Stat()
+		if stat != nil {
+			size = stat.Size()
+		}
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, os.Rename(tmp.Name(), path)
+}
+
+// load returns all stored variants of key.
+func (d *diskStore) load(key string) []*Entry {
+	d.mu.Lock()
+	names := append([]string(nil), d.byKey[key]...)
+	now := time.Now()
+	for _, name := range names {
+		d.files[name].atime = now
+	}
+	d.mu.Unlock()
+
+	entries := make([]*Entry, 0, len(names))
+	for _, name := range names {
+		e, err := readEntry(filepath.Join(d.dir, name))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Err(err).Str("file", name).Msg("failed to read http cache file")
+			}
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func readEntry(path string) (*Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(bufio.NewReader(f))
+	var meta diskMeta
+	if err := dec.Decode(&meta); err != nil {
+		return nil, err
+	}
+	e := new(Entry)
+	if err := dec.Decode(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// delete removes all variants of key.
+func (d *diskStore) delete(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, name := range append([]string(nil), d.byKey[key]...) {
+		d.remove(d.files[name])
+	}
+}
+
+// purge removes the entries of route whose request path matches match and returns the number of removed entries.
+func (d *diskStore) purge(route string, match func(path string) bool) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, item := range d.files {
+		if item.Route == route && match(item.Path) {
+			d.remove(item)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,265 @@
+package httpcache
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is a stored response.
+//
+// Fields are exported for gob encoding of the disk store,
+// entries must not be modified after being stored.
+type Entry struct {
+	Key   string // primary cache key, see Key
+	Route string
+	Path  string // request path, for purging
+
+	// VaryHeaders holds the request header values nominated by the Vary response header,
+	// with canonical header names as keys.
+	VaryHeaders map[string]string
+
+	Status int
+	Header http.Header
+	Body   []byte
+
+	RequestTime  time.Time
+	ResponseTime time.Time
+}
+
+// statusCacheableByDefault is the set of status codes that are heuristically cacheable (RFC 9110 15.1).
+var statusCacheableByDefault = map[int]struct{}{
+	http.StatusOK:                   {},
+	http.StatusNonAuthoritativeInfo: {},
+	http.StatusNoContent:            {},
+	http.StatusMultipleChoices:      {},
+	http.StatusMovedPermanently:     {},
+	http.StatusPermanentRedirect:    {},
+	http.StatusNotFound:             {},
+	http.StatusMethodNotAllowed:     {},
+	http.StatusGone:                 {},
+	http.StatusRequestURITooLong:    {},
+	http.StatusNotImplemented:       {},
+}
+
+const (
+	heuristicFraction = 10 // heuristic freshness is 10% of the time since Last-Modified
+	heuristicMax      = 24 * time.Hour
+)
+
+// Key returns the primary cache key of r.
+//
+// HEAD requests share the key of GET requests so they can be served from stored GET responses.
+func Key(route string, r *http.Request) string {
+	return route + "|" + strings.ToLower(r.Host) + r.URL.RequestURI()
+}
+
+// NewEntry returns a new entry of the response to r, received at respTime for a request sent at reqTime.
+func NewEntry(route string, r *http.Request, status int, header http.Header, body []byte, reqTime, respTime time.Time) *Entry {
+	e := &Entry{
+		Key:          Key(route, r),
+		Route:        route,
+		Path:         r.URL.Path,
+		Status:       status,
+		Header:       header,
+		Body:         body,
+		RequestTime:  reqTime,
+		ResponseTime: respTime,
+	}
+	for _, name := range varyNames(header) {
+		if e.VaryHeaders == nil {
+			e.VaryHeaders = make(map[string]string)
+		}
+		e.VaryHeaders[name] = normalizeHeaderValues(r.Header.Values(name))
+	}
+	return e
+}
+
+// id returns the identifier of the variant.
+func (e *Entry) id() string {
+	if len(e.VaryHeaders) == 0 {
+		return e.Key
+	}
+	names := make([]string, 0, len(e.VaryHeaders))
+	for name := range e.VaryHeaders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var b strings.Builder
+	b.WriteString(e.Key)
+	for _, name := range names {
+		b.WriteByte('\n')
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(e.VaryHeaders[name])
+	}
+	return b.String()
+}
+
+// size returns the approximate memory size of the entry.
+func (e *Entry) size() int64 {
+	n := len(e.Key) + len(e.Route) + len(e.Path) + len(e.Body)
+	for k, vs := range e.Header {
+		n += len(k)
+		for _, v := range vs {
+			n += len(v)
+		}
+	}
+	for k, v := range e.VaryHeaders {
+		n += len(k) + len(v)
+	}
+	return int64(n)
+}
+
+// Matches reports whether the entry can be used for r, i.e. the request headers nominated by Vary match.
+func (e *Entry) Matches(r *http.Request) bool {
+	for name, v := range e.VaryHeaders {
+		if normalizeHeaderValues(r.Header.Values(name)) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// CacheControl returns the parsed Cache-Control of the stored response.
+func (e *Entry) CacheControl() CacheControl {
+	return ParseCacheControl(e.Header)
+}
+
+// ETag returns the entity tag of the stored response.
+func (e *Entry) ETag() string {
+	return e.Header.Get("ETag")
+}
+
+// LastModified returns the Last-Modified of the stored response.
+func (e *Entry) LastModified() string {
+	return e.Header.Get("Last-Modified")
+}
+
+// HasValidator reports whether the entry can be revalidated.
+func (e *Entry) HasValidator() bool {
+	return e.ETag() != "" || e.LastModified() != ""
+}
+
+// FreshnessLifetime returns the freshness lifetime of the stored response (RFC 9111 4.2.1),
+// or defaultTTL if the response has no explicit expiration time and no Last-Modified for the heuristic.
+func (e *Entry) FreshnessLifetime(defaultTTL time.Duration) time.Duration {
+	cc := e.CacheControl()
+	switch {
+	case cc.NoCache:
+		return 0
+	case cc.SMaxAge >= 0:
+		return cc.SMaxAge
+	case cc.MaxAge >= 0:
+		return cc.MaxAge
+	}
+	if expires := e.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0 // invalid Expires means already expired
+		}
+		return max(t.Sub(e.date()), 0)
+	}
+	if _, ok := statusCacheableByDefault[e.Status]; !ok {
+		return 0
+	}
+	if lm, err := http.ParseTime(e.LastModified()); err == nil {
+		return min(max(e.date().Sub(lm)/heuristicFraction, 0), heuristicMax)
+	}
+	return defaultTTL
+}
+
+// Age returns the current age of the stored response at now (RFC 9111 4.2.3).
+func (e *Entry) Age(now time.Time) time.Duration {
+	apparentAge := max(e.ResponseTime.Sub(e.date()), 0)
+	var ageValue time.Duration
+	if age := parseDeltaSeconds(e.Header.Get("Age")); age > 0 {
+		ageValue = age
+	}
+	responseDelay := e.ResponseTime.Sub(e.RequestTime)
+	correctedInitialAge := max(apparentAge, ageValue+responseDelay)
+	return correctedInitialAge + now.Sub(e.ResponseTime)
+}
+
+// TTL returns the remaining freshness lifetime at now, negative if the response is stale.
+func (e *Entry) TTL(now time.Time, defaultTTL time.Duration) time.Duration {
+	return e.FreshnessLifetime(defaultTTL) - e.Age(now)
+}
+
+func (e *Entry) date() time.Time {
+	if t, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		return t
+	}
+	return e.ResponseTime
+}
+
+// varyNames returns the canonical header names nominated by the Vary header.
+func varyNames(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for name := range strings.SplitSeq(v, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// normalizeHeaderValues combines header values and removes insignificant whitespace (RFC 9111 4.1).
+func normalizeHeaderValues(values []string) string {
+	var b strings.Builder
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		for j, part := range strings.Split(v, ",") {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strings.TrimSpace(part))
+		}
+	}
+	return b.String()
+}
+
+// IsStorable reports whether the response to r with the status and header can be stored in a shared cache (RFC 9111 3).
+func IsStorable(r *http.Request, status int, header http.Header) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	if status < 200 || status == http.StatusPartialContent || status == http.StatusNotModified {
+		return false
+	}
+	reqCC := ParseCacheControl(r.Header)
+	if reqCC.NoStore {
+		return false
+	}
+	cc := ParseCacheControl(header)
+	if cc.NoStore || cc.Private {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" && !cc.Public && !cc.MustRevalidate && cc.SMaxAge < 0 {
+		return false
+	}
+	// responses setting cookies are never shared
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	if slices.Contains(varyNames(header), "*") {
+		return false
+	}
+	if cc.Public || cc.MaxAge >= 0 || cc.SMaxAge >= 0 || header.Get("Expires") != "" {
+		return true
+	}
+	_, ok := statusCacheableByDefault[status]
+	return ok
+}
+
+// FormatAge formats d as delta-seconds for the Age header.
+func FormatAge(d time.Duration) string {
+	return strconv.FormatInt(int64(max(d, 0)/time.Second), 10)
+}
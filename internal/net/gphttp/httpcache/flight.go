@@ -0,0 +1,54 @@
+package httpcache
+
+import (
+	"context"
+	"sync"
+)
+
+// Flight is an upstream request in flight, concurrent requests with the same key wait for it
+// instead of sending their own upstream requests.
+type Flight struct {
+	key   string
+	done  chan struct{}
+	once  sync.Once
+	entry *Entry
+}
+
+// Join returns the flight of key, and whether the caller is the leader that sends the upstream request.
+//
+// The leader must call Cache.Land when the response is stored, or as soon as it knows it will not be.
+func (c *Cache) Join(key string) (f *Flight, leader bool) {
+	c.flightMu.Lock()
+	defer c.flightMu.Unlock()
+	if f, ok := c.flights[key]; ok {
+		return f, false
+	}
+	f = &Flight{key: key, done: make(chan struct{})}
+	c.flights[key] = f
+	return f, true
+}
+
+// Land releases the requests waiting for f with the stored entry, or nil if the response was not stored.
+//
+// Subsequent calls are no-ops.
+func (c *Cache) Land(f *Flight, e *Entry) {
+	f.once.Do(func() {
+		c.flightMu.Lock()
+		if c.flights[f.key] == f {
+			delete(c.flights, f.key)
+		}
+		c.flightMu.Unlock()
+		f.entry = e
+		close(f.done)
+	})
+}
+
+// Wait waits for f to land and returns the stored entry, or nil if it was not stored or ctx is done first.
+func (f *Flight) Wait(ctx context.Context) *Entry {
+	select {
+	case <-f.done:
+		return f.entry
+	case <-ctx.Done():
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+package httpcache
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"weak"
+
+	"github.com/puzpuzpuz/xsync/v4"
+)
+
+type (
+	// Stats is the cache statistics of a route.
+	Stats struct {
+		Route string `json:"route"`
+		// responses served fresh from the cache
+		Hits uint64 `json:"hits"`
+		// responses served stale from the cache, while revalidating or because the upstream failed
+		Stale uint64 `json:"stale"`
+		// stored responses revalidated with the upstream and served from the cache
+		Revalidated uint64 `json:"revalidated"`
+		// responses fetched from the upstream
+		Misses uint64 `json:"misses"`
+		// number of responses stored in memory
+		Entries int64 `json:"entries"`
+		// size of responses stored in memory, in bytes
+		Size int64 `json:"size"`
+		// ratio of responses served from the cache, including stale and revalidated responses
+		HitRatio float64 `json:"hit_ratio"`
+	} // @name HTTPCacheStats
+
+	// Outcome is the outcome of a cache lookup.
+	Outcome uint8
+
+	routeStats struct {
+		hits, stale, revalidated, misses atomic.Uint64
+		entries, size                    atomic.Int64
+	}
+)
+
+const (
+	OutcomeHit Outcome = iota
+	OutcomeStale
+	OutcomeRevalidated
+	OutcomeMiss
+)
+
+// Record records the outcome of a request to route.
+func (c *Cache) Record(route string, outcome Outcome) {
+	rs := c.routeStats(route)
+	switch outcome {
+	case OutcomeHit:
+		rs.hits.Add(1)
+	case OutcomeStale:
+		rs.stale.Add(1)
+	case OutcomeRevalidated:
+		rs.revalidated.Add(1)
+	case OutcomeMiss:
+		rs.misses.Add(1)
+	}
+}
+
+func (c *Cache) routeStats(route string) *routeStats {
+	rs, _ := c.stats.LoadOrCompute(route, func() (*routeStats, bool) {
+		return new(routeStats), false
+	})
+	return rs
+}
+
+func (s *Stats) add(rs *routeStats) {
+	s.Hits += rs.hits.Load()
+	s.Stale += rs.stale.Load()
+	s.Revalidated += rs.revalidated.Load()
+	s.Misses += rs.misses.Load()
+	s.Entries += rs.entries.Load()
+	s.Size += rs.size.Load()
+}
+
+var (
+	registry   = xsync.NewMap[uint64, weak.Pointer[Cache]]()
+	registryID atomic.Uint64
+)
+
+// register makes c visible to Purge and AllStats until it is garbage collected,
+// i.e. when the middleware is gone with its route.
+func register(c *Cache) {
+	id := registryID.Add(1)
+	registry.Store(id, weak.Make(c))
+	runtime.AddCleanup(c, func(id uint64) {
+		registry.Delete(id)
+	}, id)
+}
+
+func allCaches() []*Cache {
+	var caches []*Cache
+	for _, wp := range registry.Range {
+		if c := wp.Value(); c != nil {
+			caches = append(caches, c)
+		}
+	}
+	return caches
+}
+
+// Purge removes the stored responses of route whose request path matches match from all caches,
+// and returns the number of removed responses.
+func Purge(route string, match func(path string) bool) int {
+	n := 0
+	for _, c := range allCaches() {
+		n += c.Purge(route, match)
+	}
+	return n
+}
+
+// AllStats returns the cache statistics of all routes, sorted by route name.
+func AllStats() []Stats {
+	byRoute := make(map[string]*Stats)
+	for _, c := range allCaches() {
+		for route, rs := range c.stats.Range {
+			s, ok := byRoute[route]
+			if !ok {
+				s = &Stats{Route: route}
+				byRoute[route] = s
+			}
+			s.add(rs)
+		}
+	}
+	stats := make([]Stats, 0, len(byRoute))
+	for _, s := range byRoute {
+		if total := s.Hits + s.Stale + s.Revalidated + s.Misses; total > 0 {
+			s.HitRatio = float64(total-s.Misses) / float64(total)
+		}
+		stats = append(stats, *s)
+	}
+	slices.SortFunc(stats, func(a, b Stats) int {
+		return strings.Compare(a.Route, b.Route)
+	})
+	return stats
+}
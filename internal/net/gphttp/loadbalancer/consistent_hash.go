@@ -0,0 +1,260 @@
+package loadbalancer
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bytedance/gopkg/util/xxhash3"
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/yusing/godoxy/internal/route/rules"
+	"github.com/yusing/godoxy/internal/serialization"
+	"github.com/yusing/godoxy/internal/types"
+)
+
+type (
+	// consistentHash maps requests to servers with a hash ring, so only the keys of
+	// a joining or leaving server are remapped.
+	//
+	// With bounded load enabled, a server never takes more than
+	// ceil(BoundedLoad * average load) active requests; the excess goes to the
+	// next server on the ring ("Consistent Hashing with Bounded Loads", Mirrokni et al.).
+	consistentHash struct {
+		*LoadBalancer
+
+		opts ConsistentHashOptions
+
+		ring []ringNode                       // sorted by hash
+		ids  map[types.LoadBalancerServer]int // dense server ids, indexes of the availability bitset
+		mu   sync.RWMutex
+
+		nConn     *xsync.Map[types.LoadBalancerServer, *atomic.Int64]
+		totalConn atomic.Int64
+	}
+
+	ConsistentHashOptions struct {
+		// Key is a template of rule variables, e.g. `$header(X-User)`, `$cookie(session)` or `$req_path`.
+		// Requests with an empty key are hashed by client IP.
+		Key string `json:"key"`
+		// BoundedLoad is the maximum load of a server relative to the average, 0 to disable.
+		BoundedLoad float64 `json:"bounded_load" validate:"omitempty,gt=1"`
+		// Replicas is the number of virtual nodes of each server on the ring.
+		Replicas int `json:"replicas" validate:"omitempty,gt=0"`
+	}
+
+	ringNode struct {
+		hash uint64
+		srv  types.LoadBalancerServer
+		id   int
+	}
+
+	// serverSet is a bitset of server ids.
+	serverSet []uint64
+)
+
+const consistentHashReplicasDefault = 100
+
+var (
+	_ impl            = (*consistentHash)(nil)
+	_ customServeHTTP = (*consistentHash)(nil)
+)
+
+func (lb *LoadBalancer) newConsistentHash() impl {
+	impl := &consistentHash{
+		LoadBalancer: lb,
+		ids:          make(map[types.LoadBalancerServer]int),
+		nConn:        xsync.NewMap[types.LoadBalancerServer, *atomic.Int64](),
+	}
+	if len(lb.Options) > 0 {
+		var opts ConsistentHashOptions
+		if err := serialization.MapUnmarshalValidate(lb.Options, &opts); err != nil {
+			impl.l.Err(err).Msg("invalid consistent_hash options, ignoring")
+		} else if err := rules.ValidateRequestVars(opts.Key); err != nil {
+			impl.l.Err(err).Msg("invalid consistent_hash key, ignoring")
+		} else {
+			impl.opts = opts
+		}
+	}
+	if impl.opts.Replicas == 0 {
+		impl.opts.Replicas = consistentHashReplicasDefault
+	}
+	return impl
+}
+
+func (impl *consistentHash) OnAddServer(srv types.LoadBalancerServer) {
+	impl.nConn.Store(srv, new(atomic.Int64))
+
+	impl.mu.Lock()
+	defer impl.mu.Unlock()
+
+	// virtual nodes are derived from the server key, so they are stable across restarts and pool changes
+	id := len(impl.ids)
+	impl.ids[srv] = id
+	key := srv.Key()
+	for i := range impl.opts.Replicas {
+		impl.ring = append(impl.ring, ringNode{
+			hash: xxhash3.HashString(key + "#" + strconv.Itoa(i)),
+			srv:  srv,
+			id:   id,
+		})
+	}
+	slices.SortFunc(impl.ring, func(a, b ringNode) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		}
+		return strings.Compare(a.srv.Key(), b.srv.Key())
+	})
+}
+
+func (impl *consistentHash) OnRemoveServer(srv types.LoadBalancerServer) {
+	impl.nConn.Delete(srv)
+
+	impl.mu.Lock()
+	defer impl.mu.Unlock()
+
+	impl.ring = slices.DeleteFunc(impl.ring, func(node ringNode) bool {
+		return node.srv == srv
+	})
+
+	// keep the ids dense
+	clear(impl.ids)
+	for i := range impl.ring {
+		node := &impl.ring[i]
+		id, ok := impl.ids[node.srv]
+		if !ok {
+			id = len(impl.ids)
+			impl.ids[node.srv] = id
+		}
+		node.id = id
+	}
+}
+
+func (impl *consistentHash) ServeHTTP(srvs types.LoadBalancerServers, rw http.ResponseWriter, r *http.Request) {
+	srv := impl.ChooseServer(srvs, r)
+	if srv == nil {
+		http.Error(rw, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	if nConn, ok := impl.nConn.Load(srv); ok {
+		nConn.Add(1)
+		impl.totalConn.Add(1)
+		defer func() {
+			nConn.Add(-1)
+			impl.totalConn.Add(-1)
+		}()
+	}
+	srv.ServeHTTP(rw, r)
+}
+
+// ChooseServer walks the ring clockwise from the hash of the request key,
+// and returns the first available server that is not overloaded.
+func (impl *consistentHash) ChooseServer(srvs types.LoadBalancerServers, r *http.Request) types.LoadBalancerServer {
+	if len(srvs) == 0 {
+		return nil
+	}
+
+	impl.mu.RLock()
+	defer impl.mu.RUnlock()
+
+	if len(impl.ring) == 0 {
+		return nil
+	}
+
+	hash := xxhash3.HashString(impl.requestKey(r))
+	start, _ := slices.BinarySearchFunc(impl.ring, hash, func(node ringNode, hash uint64) int {
+		switch {
+		case node.hash < hash:
+			return -1
+		case node.hash > hash:
+			return 1
+		}
+		return 0
+	})
+
+	maxLoad := int64(math.MaxInt64)
+	if impl.opts.BoundedLoad > 0 {
+		maxLoad = int64(math.Ceil(impl.opts.BoundedLoad * float64(impl.totalConn.Load()+1) / float64(len(srvs))))
+	}
+
+	// up to 256 servers without allocation
+	var buf [4]uint64
+	available := newServerSet(buf[:], len(impl.ids))
+	nAvailable := 0
+	for _, srv := range srvs {
+		if id, ok := impl.ids[srv]; ok && !available.has(id) {
+			available.add(id)
+			nAvailable++
+		}
+	}
+
+	var fallback types.LoadBalancerServer
+	for i := 0; i < len(impl.ring) && nAvailable > 0; i++ {
+		node := impl.ring[(start+i)%len(impl.ring)]
+		// skip unhealthy servers, their keys go to the next server on the ring
+		if !available.has(node.id) {
+			continue
+		}
+		if fallback == nil {
+			fallback = node.srv
+		}
+		if impl.conns(node.srv) < maxLoad {
+			return node.srv
+		}
+		// overloaded, skip its other virtual nodes
+		available.remove(node.id)
+		nAvailable--
+	}
+	return fallback
+}
+
+func (impl *consistentHash) requestKey(r *http.Request) string {
+	if impl.opts.Key != "" {
+		var key strings.Builder
+		if err := rules.ExpandRequestVars(r, impl.opts.Key, &key); err == nil && key.Len() > 0 {
+			return key.String()
+		}
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+func (impl *consistentHash) conns(srv types.LoadBalancerServer) int64 {
+	if nConn, ok := impl.nConn.Load(srv); ok {
+		return nConn.Load()
+	}
+	return 0
+}
+
+func newServerSet(buf []uint64, n int) serverSet {
+	words := (n + 63) / 64
+	if words > cap(buf) {
+		return make(serverSet, words)
+	}
+	set := buf[:words]
+	clear(set)
+	return set
+}
+
+func (set serverSet) add(id int) {
+	set[id/64] |= 1 << (id % 64)
+}
+
+func (set serverSet) remove(id int) {
+	set[id/64] &^= 1 << (id % 64)
+}
+
+func (set serverSet) has(id int) bool {
+	return set[id/64]&(1<<(id%64)) != 0
+}
@@ -0,0 +1,130 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	nettypes "github.com/yusing/godoxy/internal/net/types"
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newConsistentHashTest(t *testing.T, options map[string]any, n int) (*consistentHash, types.LoadBalancerServers) {
+	t.Helper()
+	lb := New(&types.LoadBalancerConfig{Mode: types.LoadbalanceModeConsistentHash, Options: options})
+	impl, ok := lb.impl.(*consistentHash)
+	expect.True(t, ok)
+
+	srvs := make(types.LoadBalancerServers, n)
+	for i := range n {
+		srvs[i] = NewServer(fmt.Sprintf("srv%d", i), nettypes.MustParseURL(fmt.Sprintf("http://10.0.0.%d:80", i)), 1, nil, nil)
+		impl.OnAddServer(srvs[i])
+	}
+	return impl, srvs
+}
+
+func userRequest(user string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User", user)
+	return req
+}
+
+func TestConsistentHashKey(t *testing.T) {
+	impl, srvs := newConsistentHashTest(t, map[string]any{"key": "$header(X-User)"}, 5)
+
+	for i := range 100 {
+		user := fmt.Sprintf("user%d", i)
+		first := impl.ChooseServer(srvs, userRequest(user))
+		expect.NotNil(t, first)
+		for range 3 {
+			expect.Equal(t, impl.ChooseServer(srvs, userRequest(user)), first)
+		}
+	}
+
+	// all servers should get some keys
+	picks := make(map[types.LoadBalancerServer]int)
+	for i := range 1000 {
+		picks[impl.ChooseServer(srvs, userRequest(fmt.Sprintf("user%d", i)))]++
+	}
+	expect.Equal(t, len(picks), len(srvs))
+}
+
+func TestConsistentHashPoolChange(t *testing.T) {
+	impl, srvs := newConsistentHashTest(t, map[string]any{"key": "$header(X-User)"}, 5)
+
+	before := make(map[string]types.LoadBalancerServer)
+	for i := range 1000 {
+		user := fmt.Sprintf("user%d", i)
+		before[user] = impl.ChooseServer(srvs, userRequest(user))
+	}
+
+	removed := srvs[2]
+	impl.OnRemoveServer(removed)
+	remaining := append(append(types.LoadBalancerServers{}, srvs[:2]...), srvs[3:]...)
+
+	for user, prev := range before {
+		cur := impl.ChooseServer(remaining, userRequest(user))
+		if prev != removed {
+			expect.Equal(t, cur, prev)
+		} else {
+			expect.True(t, cur != removed)
+		}
+	}
+
+	// unhealthy servers (not in available servers) are skipped the same way
+	impl.OnAddServer(removed)
+	for user, prev := range before {
+		expect.Equal(t, impl.ChooseServer(srvs, userRequest(user)), prev)
+		if prev != removed {
+			expect.Equal(t, impl.ChooseServer(remaining, userRequest(user)), prev)
+		}
+	}
+}
+
+func TestConsistentHashBoundedLoad(t *testing.T) {
+	impl, srvs := newConsistentHashTest(t, map[string]any{"key": "$header(X-User)", "bounded_load": 1.25}, 4)
+
+	req := userRequest("hot-user")
+	target := impl.ChooseServer(srvs, req)
+
+	nConn, _ := impl.nConn.Load(target)
+	nConn.Store(10)
+	impl.totalConn.Store(10)
+
+	// ceil(1.25 * 11 / 4) = 4, the target is overloaded
+	next := impl.ChooseServer(srvs, req)
+	expect.True(t, next != target)
+
+	nConn.Store(0)
+	impl.totalConn.Store(0)
+	expect.Equal(t, impl.ChooseServer(srvs, req), target)
+}
+
+func TestConsistentHashFallbackToClientIP(t *testing.T) {
+	impl, srvs := newConsistentHashTest(t, map[string]any{"key": "$header(X-User)"}, 5)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.168.1.10:12345"
+	first := impl.ChooseServer(srvs, req)
+
+	req.RemoteAddr = "192.168.1.10:54321"
+	expect.Equal(t, impl.ChooseServer(srvs, req), first)
+}
+
+func TestConsistentHashInvalidKey(t *testing.T) {
+	impl, _ := newConsistentHashTest(t, map[string]any{"key": "$status_code"}, 1)
+	expect.Equal(t, impl.opts.Key, "")
+	expect.Equal(t, impl.opts.Replicas, consistentHashReplicasDefault)
+}
+
+func TestConsistentHashNoAlloc(t *testing.T) {
+	impl, srvs := newConsistentHashTest(t, nil, 5)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	allocs := testing.AllocsPerRun(100, func() {
+		impl.ChooseServer(srvs[1:], req)
+	})
+	expect.Equal(t, allocs, 0.0)
+}
@@ -0,0 +1,134 @@
+package loadbalancer
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/yusing/godoxy/internal/types"
+)
+
+// ewmaLatency sends requests to the server with the lowest expected latency.
+//
+// Each server keeps an exponentially weighted moving average of its time to first
+// response byte. The score of a server is its average latency multiplied by its
+// active connections plus one, divided by its weight, so a fast server is not
+// overloaded and heavier servers take proportionally more requests.
+type ewmaLatency struct {
+	*LoadBalancer
+	stats *xsync.Map[types.LoadBalancerServer, *ewmaStats]
+}
+
+type ewmaStats struct {
+	nConn atomic.Int64
+
+	mu   sync.Mutex
+	ewma float64 // in nanoseconds, 0 if no sample yet
+	last time.Time
+}
+
+// ewmaDecay is the time for an old sample to lose ~63% of its influence.
+const ewmaDecay = 10 * time.Second
+
+var (
+	_ impl            = (*ewmaLatency)(nil)
+	_ customServeHTTP = (*ewmaLatency)(nil)
+	_ weightedImpl    = (*ewmaLatency)(nil)
+)
+
+func (lb *LoadBalancer) newEWMALatency() impl {
+	return &ewmaLatency{
+		LoadBalancer: lb,
+		stats:        xsync.NewMap[types.LoadBalancerServer, *ewmaStats](),
+	}
+}
+
+func (impl *ewmaLatency) OnAddServer(srv types.LoadBalancerServer) {
+	impl.stats.Store(srv, new(ewmaStats))
+}
+
+func (impl *ewmaLatency) OnRemoveServer(srv types.LoadBalancerServer) {
+	impl.stats.Delete(srv)
+}
+
+func (impl *ewmaLatency) ServeHTTP(srvs types.LoadBalancerServers, rw http.ResponseWriter, r *http.Request) {
+	srv := impl.ChooseServer(srvs, r)
+	if srv == nil {
+		http.Error(rw, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	stats, ok := impl.stats.Load(srv)
+	if !ok {
+		srv.ServeHTTP(rw, r)
+		return
+	}
+
+	stats.nConn.Add(1)
+	defer stats.nConn.Add(-1)
+
+	start := time.Now()
+	rec := &responseRecorder{ResponseWriter: rw}
+	srv.ServeHTTP(rec, r)
+	if rec.ttfb.IsZero() {
+		// no response was written, e.g. client disconnected
+		return
+	}
+	stats.observe(rec.ttfb.Sub(start), rec.ttfb)
+}
+
+func (impl *ewmaLatency) ChooseServer(srvs types.LoadBalancerServers, r *http.Request) types.LoadBalancerServer {
+	if len(srvs) == 0 {
+		return nil
+	}
+
+	var (
+		best      types.LoadBalancerServer
+		bestScore = math.Inf(1)
+	)
+	for _, srv := range srvs {
+		stats, ok := impl.stats.Load(srv)
+		if !ok {
+			continue
+		}
+		score := stats.score(srv)
+		if best == nil || score < bestScore {
+			best = srv
+			bestScore = score
+		}
+	}
+	if best == nil {
+		return srvs[0]
+	}
+	return best
+}
+
+func (impl *ewmaLatency) choosesByWeight() {}
+
+func (s *ewmaStats) observe(latency time.Duration, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ewma == 0 {
+		s.ewma = float64(latency)
+	} else {
+		w := math.Exp(-float64(now.Sub(s.last)) / float64(ewmaDecay))
+		s.ewma = s.ewma*w + float64(latency)*(1-w)
+	}
+	s.last = now
+}
+
+func (s *ewmaStats) score(srv types.LoadBalancerServer) float64 {
+	s.mu.Lock()
+	ewma := s.ewma
+	s.mu.Unlock()
+
+	if ewma == 0 {
+		// no request served yet, use the health check latency as a baseline
+		ewma = float64(srv.Latency())
+	}
+	return ewma * float64(s.nConn.Load()+1) / float64(effectiveWeight(srv))
+}
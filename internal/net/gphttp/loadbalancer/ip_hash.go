@@ -65,7 +65,7 @@ func (impl *ipHash) ServeHTTP(_ types.LoadBalancerServers, rw http.ResponseWrite
 	}
 
 	srv := impl.ChooseServer(impl.pool, r)
-	if srv == nil || srv.Status().Bad() {
+	if srv == nil || srv.Status().Bad() || impl.isEjected(srv) {
 		http.Error(rw, "Service unavailable", http.StatusServiceUnavailable)
 		return
 	}
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/types"
+	"github.com/yusing/godoxy/internal/net/gphttp/retry"
 	"github.com/yusing/godoxy/internal/types"
 	gperr "github.com/yusing/goutils/errs"
 	"github.com/yusing/goutils/pool"
@@ -16,7 +18,6 @@ import (
 )
 
 // TODO: stats of each server.
-// TODO: support weighted mode.
 type (
 	impl interface {
 		OnAddServer(srv types.LoadBalancerServer)
@@ -26,6 +27,11 @@ type (
 	customServeHTTP interface {
 		ServeHTTP(srvs types.LoadBalancerServers, rw http.ResponseWriter, r *http.Request)
 	}
+	// weightedImpl is implemented by the modes choosing servers by effectiveWeight,
+	// which ramps the weight of servers in slow start.
+	weightedImpl interface {
+		choosesByWeight()
+	}
 
 	LoadBalancer struct {
 		impl
@@ -39,6 +45,8 @@ type (
 		sumWeight int
 		startTime time.Time
 
+		passive atomic.Pointer[passiveHealth]
+
 		l zerolog.Logger
 	}
 )
@@ -88,6 +96,16 @@ func (lb *LoadBalancer) updateImpl() {
 		lb.impl = lb.newLeastConn()
 	case types.LoadbalanceModeIPHash:
 		lb.impl = lb.newIPHash()
+	case types.LoadbalanceModeWeightedRoundRobin:
+		lb.impl = lb.newWeightedRoundRobin()
+	case types.LoadbalanceModeRandom:
+		lb.impl = lb.newRandom()
+	case types.LoadbalanceModeP2C:
+		lb.impl = lb.newPowerOfTwoChoices()
+	case types.LoadbalanceModeEWMALatency:
+		lb.impl = lb.newEWMALatency()
+	case types.LoadbalanceModeConsistentHash:
+		lb.impl = lb.newConsistentHash()
 	default: // should happen in test only
 		lb.impl = lb.newRoundRobin()
 	}
@@ -114,27 +132,57 @@ func (lb *LoadBalancer) UpdateConfigIfNeeded(cfg *types.LoadBalancerConfig) {
 		if len(lb.Options) == 0 && len(cfg.Options) > 0 {
 			lb.Options = cfg.Options
 		}
+
+		if lb.PassiveHealth == nil && cfg.PassiveHealth != nil {
+			lb.PassiveHealth = cfg.PassiveHealth
+		}
 	}
 
 	if lb.impl == nil {
 		lb.updateImpl()
 	}
+	if lb.PassiveHealth != nil && lb.passive.Load() == nil {
+		lb.enablePassiveHealth()
+	}
+}
+
+func (lb *LoadBalancer) enablePassiveHealth() {
+	p := newPassiveHealth(lb.PassiveHealth, lb.l)
+	for _, srv := range lb.pool.Iter {
+		p.addServer(srv)
+		attachPassiveHealth(srv, p)
+	}
+	lb.passive.Store(p)
+}
+
+func attachPassiveHealth(srv types.LoadBalancerServer, p *passiveHealth) {
+	if srv, ok := srv.(*server); ok {
+		srv.passive.Store(p)
+	}
 }
 
 func (lb *LoadBalancer) AddServer(srv types.LoadBalancerServer) {
 	lb.poolMu.Lock()
 	defer lb.poolMu.Unlock()
 
+	p := lb.passive.Load()
 	if old, ok := lb.pool.Get(srv.Key()); ok { // FIXME: this should be a warning
 		lb.sumWeight -= old.Weight()
 		lb.impl.OnRemoveServer(old)
 		lb.pool.Del(old)
+		if p != nil {
+			p.removeServer(old)
+		}
 	}
 	lb.pool.Add(srv)
 	lb.sumWeight += srv.Weight()
 
 	lb.rebalance()
 	lb.impl.OnAddServer(srv)
+	if p != nil {
+		p.addServer(srv)
+		attachPassiveHealth(srv, p)
+	}
 }
 
 func (lb *LoadBalancer) RemoveServer(srv types.LoadBalancerServer) {
@@ -150,6 +198,9 @@ func (lb *LoadBalancer) RemoveServer(srv types.LoadBalancerServer) {
 	lb.sumWeight -= srv.Weight()
 	lb.rebalance()
 	lb.impl.OnRemoveServer(srv)
+	if p := lb.passive.Load(); p != nil {
+		p.removeServer(srv)
+	}
 
 	lb.l.Debug().
 		Str("action", "remove").
@@ -238,6 +289,9 @@ func (lb *LoadBalancer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// fail over to servers not tried by previous attempts when the request is retried
+	srvs = retry.Exclude(r.Context(), srvs)
+
 	// Check for idlewatcher requests or sticky sessions
 	if lb.Sticky || isIdlewatcherRequest(r) {
 		if selectedServer := getStickyServer(r, srvs); selectedServer != nil {
@@ -343,6 +397,21 @@ func (lb *LoadBalancer) String() string {
 	return lb.Name()
 }
 
+// Servers returns all servers in the pool, regardless of their health status.
+func (lb *LoadBalancer) Servers() types.LoadBalancerServers {
+	srvs := make(types.LoadBalancerServers, 0, lb.pool.Size())
+	for _, srv := range lb.pool.Iter {
+		srvs = append(srvs, srv)
+	}
+	return srvs
+}
+
+// isEjected reports whether srv is ejected by passive health checking.
+func (lb *LoadBalancer) isEjected(srv types.LoadBalancerServer) bool {
+	p := lb.passive.Load()
+	return p != nil && p.isEjected(srv, time.Now())
+}
+
 func (lb *LoadBalancer) availServers() []types.LoadBalancerServer {
 	avail := make([]types.LoadBalancerServer, 0, lb.pool.Size())
 	for _, srv := range lb.pool.Iter {
@@ -350,6 +419,13 @@ func (lb *LoadBalancer) availServers() []types.LoadBalancerServer {
 			avail = append(avail, srv)
 		}
 	}
+	if p := lb.passive.Load(); p != nil {
+		now := time.Now()
+		avail = p.filter(avail, now)
+		if _, ok := lb.impl.(weightedImpl); !ok {
+			avail = p.slowStartFilter(avail, now)
+		}
+	}
 	return avail
 }
 
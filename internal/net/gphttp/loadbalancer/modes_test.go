@@ -0,0 +1,130 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+type testServer struct {
+	types.LoadBalancerServer
+	latency time.Duration
+}
+
+func (srv *testServer) Latency() time.Duration {
+	return srv.latency
+}
+
+func newTestServer(weight int, latency time.Duration) *testServer {
+	return &testServer{LoadBalancerServer: TestNewServer(weight), latency: latency}
+}
+
+func countPicks(impl impl, srvs types.LoadBalancerServers, n int) map[types.LoadBalancerServer]int {
+	for _, srv := range srvs {
+		impl.OnAddServer(srv)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	picks := make(map[types.LoadBalancerServer]int)
+	for range n {
+		picks[impl.ChooseServer(srvs, req)]++
+	}
+	return picks
+}
+
+func TestModeValidateUpdate(t *testing.T) {
+	tests := map[string]types.LoadBalancerMode{
+		"weighted_round_robin": types.LoadbalanceModeWeightedRoundRobin,
+		"WeightedRoundRobin":   types.LoadbalanceModeWeightedRoundRobin,
+		"random":               types.LoadbalanceModeRandom,
+		"p2c":                  types.LoadbalanceModeP2C,
+		"ewma_latency":         types.LoadbalanceModeEWMALatency,
+	}
+	for input, want := range tests {
+		mode := types.LoadBalancerMode(input)
+		expect.True(t, mode.ValidateUpdate())
+		expect.Equal(t, mode, want)
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	a, b, c := TestNewServer(5), TestNewServer(1), TestNewServer(1)
+	srvs := types.LoadBalancerServers{a, b, c}
+	impl := new(LoadBalancer).newWeightedRoundRobin()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	var order types.LoadBalancerServers
+	for range 7 {
+		order = append(order, impl.ChooseServer(srvs, req))
+	}
+	// same as the nginx example, heavier server is not picked in bursts
+	expect.Equal(t, order, types.LoadBalancerServers{a, a, b, a, c, a, a})
+
+	picks := countPicks(impl, srvs, 700)
+	expect.Equal(t, picks[a], 500)
+	expect.Equal(t, picks[b], 100)
+	expect.Equal(t, picks[c], 100)
+}
+
+func TestRandomWeighted(t *testing.T) {
+	heavy, light := TestNewServer(90), TestNewServer(10)
+	picks := countPicks(new(LoadBalancer).newRandom(), types.LoadBalancerServers{heavy, light}, 10000)
+	expect.True(t, picks[heavy] > 8500 && picks[heavy] < 9500)
+	expect.Equal(t, picks[heavy]+picks[light], 10000)
+}
+
+func TestPowerOfTwoChoices(t *testing.T) {
+	busy, idle := newTestServer(1, 0), newTestServer(1, 0)
+	srvs := types.LoadBalancerServers{busy, idle}
+	impl := new(LoadBalancer).newPowerOfTwoChoices().(*powerOfTwoChoices)
+	for _, srv := range srvs {
+		impl.OnAddServer(srv)
+	}
+	conns, _ := impl.nConn.Load(busy)
+	conns.Store(10)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for range 100 {
+		expect.Equal(t, impl.ChooseServer(srvs, req), types.LoadBalancerServer(idle))
+	}
+
+	// tie on connections, lower latency wins
+	conns.Store(0)
+	busy.latency = time.Second
+	idle.latency = time.Millisecond
+	for range 100 {
+		expect.Equal(t, impl.ChooseServer(srvs, req), types.LoadBalancerServer(idle))
+	}
+}
+
+func TestEWMALatency(t *testing.T) {
+	slow, fast := newTestServer(1, 0), newTestServer(1, 0)
+	srvs := types.LoadBalancerServers{slow, fast}
+	impl := new(LoadBalancer).newEWMALatency().(*ewmaLatency)
+	for _, srv := range srvs {
+		impl.OnAddServer(srv)
+	}
+
+	now := time.Now()
+	slowStats, _ := impl.stats.Load(slow)
+	fastStats, _ := impl.stats.Load(fast)
+	slowStats.observe(100*time.Millisecond, now)
+	fastStats.observe(10*time.Millisecond, now)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	expect.Equal(t, impl.ChooseServer(srvs, req), types.LoadBalancerServer(fast))
+
+	// the fast server gets overloaded
+	fastStats.nConn.Store(20)
+	expect.Equal(t, impl.ChooseServer(srvs, req), types.LoadBalancerServer(slow))
+
+	// recent samples dominate the average
+	fastStats.nConn.Store(0)
+	for i := range 10 {
+		fastStats.observe(time.Second, now.Add(time.Duration(i+1)*ewmaDecay))
+	}
+	expect.Equal(t, impl.ChooseServer(srvs, req), types.LoadBalancerServer(slow))
+}
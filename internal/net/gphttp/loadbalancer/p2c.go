@@ -0,0 +1,86 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/yusing/godoxy/internal/types"
+)
+
+// powerOfTwoChoices picks two random servers (weighted) and sends the request to
+// the less loaded one, using active connections and the health check latency
+// as the tie breaker.
+type powerOfTwoChoices struct {
+	*LoadBalancer
+	nConn *xsync.Map[types.LoadBalancerServer, *atomic.Int64]
+}
+
+var (
+	_ impl            = (*powerOfTwoChoices)(nil)
+	_ customServeHTTP = (*powerOfTwoChoices)(nil)
+	_ weightedImpl    = (*powerOfTwoChoices)(nil)
+)
+
+func (lb *LoadBalancer) newPowerOfTwoChoices() impl {
+	return &powerOfTwoChoices{
+		LoadBalancer: lb,
+		nConn:        xsync.NewMap[types.LoadBalancerServer, *atomic.Int64](),
+	}
+}
+
+func (impl *powerOfTwoChoices) OnAddServer(srv types.LoadBalancerServer) {
+	impl.nConn.Store(srv, new(atomic.Int64))
+}
+
+func (impl *powerOfTwoChoices) OnRemoveServer(srv types.LoadBalancerServer) {
+	impl.nConn.Delete(srv)
+}
+
+func (impl *powerOfTwoChoices) ServeHTTP(srvs types.LoadBalancerServers, rw http.ResponseWriter, r *http.Request) {
+	srv := impl.ChooseServer(srvs, r)
+	if srv == nil {
+		http.Error(rw, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	if nConn, ok := impl.nConn.Load(srv); ok {
+		nConn.Add(1)
+		defer nConn.Add(-1)
+	}
+	srv.ServeHTTP(rw, r)
+}
+
+func (impl *powerOfTwoChoices) ChooseServer(srvs types.LoadBalancerServers, r *http.Request) types.LoadBalancerServer {
+	switch len(srvs) {
+	case 0:
+		return nil
+	case 1:
+		return srvs[0]
+	}
+
+	i := weightedRandomIndex(srvs, -1)
+	j := weightedRandomIndex(srvs, i)
+	a, b := srvs[i], srvs[j]
+
+	connA, connB := impl.conns(a), impl.conns(b)
+	switch {
+	case connA < connB:
+		return a
+	case connB < connA:
+		return b
+	case b.Latency() < a.Latency():
+		return b
+	default:
+		return a
+	}
+}
+
+func (impl *powerOfTwoChoices) choosesByWeight() {}
+
+func (impl *powerOfTwoChoices) conns(srv types.LoadBalancerServer) int64 {
+	if nConn, ok := impl.nConn.Load(srv); ok {
+		return nConn.Load()
+	}
+	return 0
+}
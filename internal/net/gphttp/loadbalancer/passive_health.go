@@ -0,0 +1,214 @@
+package loadbalancer
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog"
+	"github.com/yusing/godoxy/internal/types"
+)
+
+type (
+	// passiveHealth tracks the responses of each server and ejects servers
+	// that keep failing, without waiting for the next health check.
+	passiveHealth struct {
+		cfg *types.PassiveHealthConfig
+
+		servers *xsync.Map[types.LoadBalancerServer, *serverHealth]
+		mu      sync.Mutex // guards the fields of serverHealth other than reinstatedAt
+
+		l zerolog.Logger
+	}
+
+	serverHealth struct {
+		consecutiveFailures int
+		ejections           int // consecutive ejections, for exponential backoff
+		ejectedUntil        time.Time
+		reinstatedAt        atomic.Int64 // unix nano, 0 if not reinstated, read on every pick by slowStartRatio
+	}
+)
+
+// minSlowStartRatio is the ratio of its weight a server has right after reinstated.
+const minSlowStartRatio = 0.1
+
+func newPassiveHealth(cfg *types.PassiveHealthConfig, l zerolog.Logger) *passiveHealth {
+	_ = cfg.Validate() // fill defaults, never fails
+	return &passiveHealth{
+		cfg:     cfg,
+		servers: xsync.NewMap[types.LoadBalancerServer, *serverHealth](),
+		l:       l,
+	}
+}
+
+func (p *passiveHealth) addServer(srv types.LoadBalancerServer) {
+	p.servers.Store(srv, new(serverHealth))
+}
+
+func (p *passiveHealth) removeServer(srv types.LoadBalancerServer) {
+	p.servers.Delete(srv)
+}
+
+func isFailureStatus(status int) bool {
+	return status >= http.StatusInternalServerError && status != http.StatusNotImplemented
+}
+
+// observe records the response status of a request served by srv.
+//
+// Connection errors are reported by the reverse proxy as 502, so they are counted as 5xx.
+func (p *passiveHealth) observe(srv types.LoadBalancerServer, status int, now time.Time) {
+	if status == 0 { // no response written, e.g. hijacked or client disconnected
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h, ok := p.servers.Load(srv)
+	if !ok {
+		return
+	}
+
+	if !isFailureStatus(status) {
+		h.consecutiveFailures = 0
+		// forget previous ejections once the server has been stable for a while
+		if reinstatedAt := h.reinstatedAt.Load(); h.ejections > 0 && reinstatedAt != 0 && now.Sub(time.Unix(0, reinstatedAt)) > p.cfg.MaxEjectionTime {
+			h.ejections = 0
+		}
+		return
+	}
+
+	h.consecutiveFailures++
+	if h.consecutiveFailures < p.cfg.ConsecutiveFailures || now.Before(h.ejectedUntil) {
+		return
+	}
+	if p.numEjected(now) >= p.maxEjected() {
+		p.l.Debug().Str("server", srv.Name()).Msg("max ejection percent reached, not ejecting server")
+		return
+	}
+
+	ejectionTime := min(p.cfg.EjectionTime<<h.ejections, p.cfg.MaxEjectionTime)
+	if ejectionTime <= 0 { // overflow
+		ejectionTime = p.cfg.MaxEjectionTime
+	}
+	h.ejections++
+	h.consecutiveFailures = 0
+	h.ejectedUntil = now.Add(ejectionTime)
+	h.reinstatedAt.Store(0)
+
+	p.l.Warn().
+		Str("server", srv.Name()).
+		Int("status", status).
+		Dur("ejection_time", ejectionTime).
+		Msg("server ejected after consecutive failures")
+}
+
+// filter returns the servers in srvs that should receive traffic.
+//
+// Ejected servers are removed, servers whose ejection time elapsed are reinstated
+// and start their slow start. If no server is left, srvs is returned as is.
+func (p *passiveHealth) filter(srvs types.LoadBalancerServers, now time.Time) types.LoadBalancerServers {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	filtered := make(types.LoadBalancerServers, 0, len(srvs))
+	for _, srv := range srvs {
+		h, ok := p.servers.Load(srv)
+		if !ok {
+			filtered = append(filtered, srv)
+			continue
+		}
+		if !h.ejectedUntil.IsZero() {
+			if now.Before(h.ejectedUntil) {
+				continue
+			}
+			h.reinstatedAt.Store(h.ejectedUntil.UnixNano())
+			h.ejectedUntil = time.Time{}
+			p.l.Info().Str("server", srv.Name()).Msg("server reinstated")
+		}
+		filtered = append(filtered, srv)
+	}
+	if len(filtered) == 0 {
+		return srvs
+	}
+	return filtered
+}
+
+// slowStartFilter removes the servers in slow start from srvs with a probability ramping linearly
+// from 1-minSlowStartRatio to 0, so their share of traffic grows gradually in the modes not choosing
+// by weight. If no server is left, srvs is returned as is.
+func (p *passiveHealth) slowStartFilter(srvs types.LoadBalancerServers, now time.Time) types.LoadBalancerServers {
+	if p.cfg.SlowStart <= 0 {
+		return srvs
+	}
+
+	filtered := make(types.LoadBalancerServers, 0, len(srvs))
+	for _, srv := range srvs {
+		if ratio := p.slowStartRatio(srv, now); ratio < 1 && rand.Float64() >= ratio {
+			continue
+		}
+		filtered = append(filtered, srv)
+	}
+	if len(filtered) == 0 {
+		return srvs
+	}
+	return filtered
+}
+
+// slowStartRatio returns the ratio of the weight of srv, ramping linearly from minSlowStartRatio
+// to 1 during the slow start after reinstated, so its share of traffic grows gradually.
+func (p *passiveHealth) slowStartRatio(srv types.LoadBalancerServer, now time.Time) float64 {
+	if p.cfg.SlowStart <= 0 {
+		return 1
+	}
+
+	h, ok := p.servers.Load(srv)
+	if !ok {
+		return 1
+	}
+	reinstatedAt := h.reinstatedAt.Load()
+	if reinstatedAt == 0 {
+		return 1
+	}
+	elapsed := now.Sub(time.Unix(0, reinstatedAt))
+	if elapsed >= p.cfg.SlowStart {
+		return 1
+	}
+	return max(float64(elapsed)/float64(p.cfg.SlowStart), minSlowStartRatio)
+}
+
+func (p *passiveHealth) numEjected(now time.Time) int {
+	n := 0
+	for _, h := range p.servers.Range {
+		if now.Before(h.ejectedUntil) {
+			n++
+		}
+	}
+	return n
+}
+
+// maxEjected returns the maximum number of servers that can be ejected at the same time.
+// The last server is never ejected.
+func (p *passiveHealth) maxEjected() int {
+	size := p.servers.Size()
+	n := size * p.cfg.MaxEjectionPercent / 100
+	if n == 0 && size > 1 {
+		n = 1
+	}
+	if n >= size {
+		n = size - 1
+	}
+	return n
+}
+
+// isEjected reports whether srv is currently ejected.
+func (p *passiveHealth) isEjected(srv types.LoadBalancerServer, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h, ok := p.servers.Load(srv)
+	return ok && now.Before(h.ejectedUntil)
+}
@@ -0,0 +1,158 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newPassiveHealthTest(n int, cfg types.PassiveHealthConfig) (*passiveHealth, types.LoadBalancerServers) {
+	p := newPassiveHealth(&cfg, zerolog.Nop())
+	srvs := make(types.LoadBalancerServers, n)
+	for i := range n {
+		srvs[i] = TestNewServer(1)
+		p.addServer(srvs[i])
+	}
+	return p, srvs
+}
+
+func TestPassiveHealthDefaults(t *testing.T) {
+	p, _ := newPassiveHealthTest(1, types.PassiveHealthConfig{})
+	expect.Equal(t, p.cfg.ConsecutiveFailures, types.PassiveHealthConsecutiveFailuresDefault)
+	expect.Equal(t, p.cfg.EjectionTime, types.PassiveHealthEjectionTimeDefault)
+	expect.Equal(t, p.cfg.MaxEjectionTime, types.PassiveHealthMaxEjectionTimeDefault)
+	expect.Equal(t, p.cfg.MaxEjectionPercent, types.PassiveHealthMaxEjectionPercentDefault)
+	expect.Equal(t, p.cfg.SlowStart, types.PassiveHealthSlowStartDefault)
+}
+
+func TestPassiveHealthEjection(t *testing.T) {
+	p, srvs := newPassiveHealthTest(4, types.PassiveHealthConfig{
+		ConsecutiveFailures: 3,
+		EjectionTime:        10 * time.Second,
+		MaxEjectionTime:     time.Minute,
+		SlowStart:           -1,
+	})
+	now := time.Now()
+	bad := srvs[0]
+
+	p.observe(bad, http.StatusBadGateway, now)
+	p.observe(bad, http.StatusBadGateway, now)
+	p.observe(bad, http.StatusOK, now) // success resets the counter
+	p.observe(bad, http.StatusBadGateway, now)
+	p.observe(bad, http.StatusServiceUnavailable, now)
+	expect.False(t, p.isEjected(bad, now))
+
+	p.observe(bad, http.StatusGatewayTimeout, now)
+	expect.True(t, p.isEjected(bad, now))
+	expect.Equal(t, len(p.filter(srvs, now)), 3)
+
+	// reinstated after ejection time
+	later := now.Add(10 * time.Second)
+	expect.False(t, p.isEjected(bad, later))
+	expect.Equal(t, len(p.filter(srvs, later)), 4)
+
+	// ejection time doubles on consecutive ejections
+	for range 3 {
+		p.observe(bad, http.StatusBadGateway, later)
+	}
+	expect.True(t, p.isEjected(bad, later.Add(19*time.Second)))
+	expect.False(t, p.isEjected(bad, later.Add(20*time.Second)))
+}
+
+func TestPassiveHealthMaxEjectionPercent(t *testing.T) {
+	p, srvs := newPassiveHealthTest(4, types.PassiveHealthConfig{
+		ConsecutiveFailures: 1,
+		MaxEjectionPercent:  50,
+	})
+	now := time.Now()
+	for _, srv := range srvs {
+		p.observe(srv, http.StatusInternalServerError, now)
+	}
+	expect.Equal(t, p.numEjected(now), 2)
+	expect.Equal(t, len(p.filter(srvs, now)), 2)
+}
+
+func TestPassiveHealthNeverEjectsLastServer(t *testing.T) {
+	p, srvs := newPassiveHealthTest(1, types.PassiveHealthConfig{ConsecutiveFailures: 1})
+	now := time.Now()
+	p.observe(srvs[0], http.StatusBadGateway, now)
+	expect.False(t, p.isEjected(srvs[0], now))
+	expect.Equal(t, len(p.filter(srvs, now)), 1)
+}
+
+func TestPassiveHealthSlowStart(t *testing.T) {
+	p, srvs := newPassiveHealthTest(2, types.PassiveHealthConfig{
+		ConsecutiveFailures: 1,
+		EjectionTime:        time.Second,
+		SlowStart:           10 * time.Second,
+	})
+	now := time.Now()
+	p.observe(srvs[0], http.StatusBadGateway, now)
+
+	// kept by filter once reinstated, with its weight ramping up
+	reinstated := now.Add(time.Second)
+	expect.Equal(t, len(p.filter(srvs, reinstated)), 2)
+
+	// 10% right after reinstated, 50% half way, 100% after slow start
+	expect.Equal(t, p.slowStartRatio(srvs[0], reinstated), minSlowStartRatio)
+	expect.Equal(t, p.slowStartRatio(srvs[0], reinstated.Add(5*time.Second)), 0.5)
+	expect.Equal(t, p.slowStartRatio(srvs[0], reinstated.Add(10*time.Second)), 1.0)
+	expect.Equal(t, p.slowStartRatio(srvs[1], reinstated), 1.0)
+}
+
+func TestPassiveHealthSlowStartFilter(t *testing.T) {
+	p, srvs := newPassiveHealthTest(2, types.PassiveHealthConfig{
+		ConsecutiveFailures: 1,
+		EjectionTime:        time.Second,
+		SlowStart:           10 * time.Second,
+	})
+	now := time.Now()
+	p.observe(srvs[0], http.StatusBadGateway, now)
+
+	reinstated := now.Add(time.Second)
+	p.filter(srvs, reinstated)
+
+	count := func(at time.Time) int {
+		n := 0
+		for range 10000 {
+			for _, srv := range p.slowStartFilter(srvs, at) {
+				if srv == srvs[0] {
+					n++
+				}
+			}
+		}
+		return n
+	}
+
+	// 10% right after reinstated, 50% half way, 100% after slow start
+	expect.True(t, count(reinstated) < 1500)
+	half := count(reinstated.Add(5 * time.Second))
+	expect.True(t, half > 4000 && half < 6000)
+	expect.Equal(t, count(reinstated.Add(10*time.Second)), 10000)
+}
+
+func TestPassiveHealthSlowStartWeight(t *testing.T) {
+	p, srvs := newPassiveHealthTest(2, types.PassiveHealthConfig{
+		ConsecutiveFailures: 1,
+		EjectionTime:        time.Second,
+		SlowStart:           time.Hour,
+	})
+	for _, srv := range srvs {
+		attachPassiveHealth(srv, p)
+	}
+	// reinstated half way through slow start
+	now := time.Now()
+	p.observe(srvs[0], http.StatusBadGateway, now.Add(-31*time.Minute))
+	p.filter(srvs, now)
+
+	expect.Equal(t, effectiveWeight(srvs[1]), weightScale)
+	weight := effectiveWeight(srvs[0])
+	expect.True(t, weight > weightScale/2-5 && weight < weightScale/2+5)
+
+	picks := countPicks(new(LoadBalancer).newWeightedRoundRobin(), srvs, 3000)
+	expect.True(t, picks[srvs[0]] > 900 && picks[srvs[0]] < 1100)
+}
@@ -0,0 +1,54 @@
+package loadbalancer
+
+import (
+	"math/rand/v2"
+	"net/http"
+
+	"github.com/yusing/godoxy/internal/types"
+)
+
+type random struct{}
+
+var (
+	_ impl         = (*random)(nil)
+	_ weightedImpl = (*random)(nil)
+)
+
+func (*LoadBalancer) newRandom() impl                          { return &random{} }
+func (lb *random) OnAddServer(srv types.LoadBalancerServer)    {}
+func (lb *random) OnRemoveServer(srv types.LoadBalancerServer) {}
+
+// ChooseServer picks a random server with probability proportional to its weight.
+func (lb *random) ChooseServer(srvs types.LoadBalancerServers, r *http.Request) types.LoadBalancerServer {
+	if len(srvs) == 0 {
+		return nil
+	}
+	return srvs[weightedRandomIndex(srvs, -1)]
+}
+
+func (lb *random) choosesByWeight() {}
+
+// weightedRandomIndex returns the index of a random server with probability
+// proportional to its weight, skipping the server at index exclude (-1 for none).
+func weightedRandomIndex(srvs types.LoadBalancerServers, exclude int) int {
+	total := 0
+	for i, srv := range srvs {
+		if i != exclude {
+			total += effectiveWeight(srv)
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	n := rand.IntN(total)
+	for i, srv := range srvs {
+		if i == exclude {
+			continue
+		}
+		n -= effectiveWeight(srv)
+		if n < 0 {
+			return i
+		}
+	}
+	return len(srvs) - 1
+}
@@ -3,9 +3,13 @@ package loadbalancer
 import (
 	"context"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/types"
+	"github.com/yusing/godoxy/internal/net/gphttp/retry"
 	nettypes "github.com/yusing/godoxy/internal/net/types"
+	"github.com/yusing/godoxy/internal/tracing"
 	"github.com/yusing/godoxy/internal/types"
 )
 
@@ -16,6 +20,8 @@ type server struct {
 
 	http.Handler `json:"-"`
 	types.HealthMonitor
+
+	passive atomic.Pointer[passiveHealth]
 }
 
 func NewServer(name string, url *nettypes.URL, weight int, handler http.Handler, healthMon types.HealthMonitor) types.LoadBalancerServer {
@@ -61,6 +67,37 @@ func (srv *server) String() string {
 	return srv.name
 }
 
+// ServeHTTP implements http.Handler.
+//
+// It reports the response status to passive health checking if enabled.
+func (srv *server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	retry.MarkTried(r.Context(), srv.Key())
+
+	p := srv.passive.Load()
+	if p == nil {
+		srv.serveHTTP(rw, r)
+		return
+	}
+	rec := &responseRecorder{ResponseWriter: rw}
+	srv.serveHTTP(rec, r)
+	p.observe(srv, rec.status, time.Now())
+}
+
+// serveHTTP records the selected server as a span so that load balancer decisions are visible in traces.
+func (srv *server) serveHTTP(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartSpan(r.Context(), "loadbalancer "+srv.name, tracing.SpanKindInternal,
+		tracing.String("godoxy.loadbalancer.server", srv.name),
+		tracing.String("godoxy.loadbalancer.server_url", srv.url.String()),
+		tracing.Int("godoxy.loadbalancer.server_weight", srv.weight),
+	)
+	if span == nil {
+		srv.Handler.ServeHTTP(rw, r)
+		return
+	}
+	defer span.End()
+	srv.Handler.ServeHTTP(rw, r.WithContext(ctx))
+}
+
 func (srv *server) TryWake() error {
 	waker, ok := srv.Handler.(idlewatcher.Waker)
 	if ok {
@@ -0,0 +1,84 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yusing/godoxy/internal/types"
+)
+
+// weightedRoundRobin implements the smooth weighted round robin algorithm of nginx.
+//
+// Every pick, each server's current weight is increased by its weight, the server
+// with the highest current weight is chosen and its current weight is decreased
+// by the total weight. This spreads picks of heavier servers evenly instead of
+// sending them in bursts.
+type weightedRoundRobin struct {
+	current map[types.LoadBalancerServer]int
+	mu      sync.Mutex
+}
+
+var (
+	_ impl         = (*weightedRoundRobin)(nil)
+	_ weightedImpl = (*weightedRoundRobin)(nil)
+)
+
+func (*LoadBalancer) newWeightedRoundRobin() impl {
+	return &weightedRoundRobin{current: make(map[types.LoadBalancerServer]int)}
+}
+
+func (lb *weightedRoundRobin) OnAddServer(srv types.LoadBalancerServer) {}
+
+func (lb *weightedRoundRobin) OnRemoveServer(srv types.LoadBalancerServer) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	delete(lb.current, srv)
+}
+
+func (lb *weightedRoundRobin) ChooseServer(srvs types.LoadBalancerServers, r *http.Request) types.LoadBalancerServer {
+	if len(srvs) == 0 {
+		return nil
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	var (
+		best        types.LoadBalancerServer
+		bestCurrent int
+		total       int
+	)
+	for _, srv := range srvs {
+		weight := effectiveWeight(srv)
+		cur := lb.current[srv] + weight
+		lb.current[srv] = cur
+		total += weight
+		if best == nil || cur > bestCurrent {
+			best = srv
+			bestCurrent = cur
+		}
+	}
+	lb.current[best] -= total
+	return best
+}
+
+func (lb *weightedRoundRobin) choosesByWeight() {}
+
+// weightScale scales effective weights, so the weights of servers in slow start ramp up gradually
+// even if they are small.
+const weightScale = 100
+
+// effectiveWeight returns the weight of srv scaled by weightScale, servers with non-positive weight
+// are treated as weight 1. Servers in slow start of passive health checking have their weight
+// scaled down linearly.
+func effectiveWeight(srv types.LoadBalancerServer) int {
+	weight := max(srv.Weight(), 1) * weightScale
+	if s, ok := srv.(*server); ok {
+		if p := s.passive.Load(); p != nil {
+			weight = max(int(float64(weight)*p.slowStartRatio(srv, time.Now())), 1)
+		}
+	}
+	return weight
+}
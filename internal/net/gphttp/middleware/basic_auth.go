@@ -0,0 +1,335 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobwas/glob"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/watcher"
+	watcherEvents "github.com/yusing/godoxy/internal/watcher/events"
+	gperr "github.com/yusing/goutils/errs"
+	httpevents "github.com/yusing/goutils/events/http"
+	"github.com/yusing/goutils/task"
+)
+
+type (
+	basicAuth struct {
+		BasicAuthOpts
+
+		file      *htpasswdFile
+		users     htpasswdUsers // inline users, take precedence over users in htpasswd file
+		userPaths map[string][]glob.Glob
+	}
+	BasicAuthOpts struct {
+		// HtpasswdFile is the path to an htpasswd file, reloaded on change.
+		HtpasswdFile string `json:"htpasswd_file"`
+		// Users are inline htpasswd lines (user:hash).
+		Users []string `json:"users"`
+		// Realm is the realm shown in the browser prompt.
+		Realm string `json:"realm"`
+		// UserPaths restricts users to the matching path globs,
+		// users not listed here can access all paths.
+		UserPaths map[string][]string `json:"user_paths"`
+		// SessionTTL is the lifetime of the session cookie issued after a successful login,
+		// 0 to verify credentials on every request.
+		SessionTTL time.Duration `json:"session_ttl" validate:"gte=0"`
+	}
+
+	// htpasswdFile is an htpasswd file shared between middlewares,
+	// users are reloaded when the file changes.
+	htpasswdFile struct {
+		path  string
+		users atomic.Pointer[htpasswdUsers]
+	}
+)
+
+const basicAuthSessionCookie = "godoxy_basic_auth_session"
+
+var (
+	BasicAuth         = NewMiddleware[basicAuth]()
+	basicAuthDefaults = BasicAuthOpts{
+		Realm:      "Restricted",
+		SessionTTL: time.Hour,
+	}
+
+	// basicAuthSessionKey signs session cookies, sessions do not survive restarts.
+	basicAuthSessionKey = func() []byte {
+		key := make([]byte, 32)
+		_, _ = rand.Read(key)
+		return key
+	}()
+
+	htpasswdFiles   = make(map[string]*htpasswdFile)
+	htpasswdFilesMu sync.Mutex
+)
+
+var (
+	ErrMissingHtpasswd        = errors.New("htpasswd_file or users must be specified")
+	ErrInvalidBasicAuthCookie = errors.New("invalid session cookie")
+)
+
+// setup implements MiddlewareWithSetup.
+func (m *basicAuth) setup() {
+	m.BasicAuthOpts = basicAuthDefaults
+}
+
+// finalize implements MiddlewareFinalizerWithError.
+func (m *basicAuth) finalize() error {
+	if m.HtpasswdFile == "" && len(m.Users) == 0 {
+		return ErrMissingHtpasswd
+	}
+
+	var errs gperr.Builder
+	if len(m.Users) > 0 {
+		users, err := parseHtpasswd([]byte(strings.Join(m.Users, "\n")))
+		if err != nil {
+			errs.Add(gperr.PrependSubject(err, "users"))
+		}
+		m.users = users
+	}
+	if m.HtpasswdFile != "" {
+		file, err := loadHtpasswdFile(m.HtpasswdFile)
+		if err != nil {
+			errs.Add(gperr.PrependSubject(err, "htpasswd_file"))
+		}
+		m.file = file
+	}
+
+	m.userPaths = make(map[string][]glob.Glob, len(m.UserPaths))
+	for username, patterns := range m.UserPaths {
+		globs := make([]glob.Glob, 0, len(patterns))
+		for _, pattern := range patterns {
+			g, err := glob.Compile(pattern)
+			if err != nil {
+				errs.Add(gperr.PrependSubject(err, "user_paths."+username))
+				continue
+			}
+			globs = append(globs, g)
+		}
+		m.userPaths[username] = globs
+	}
+	return errs.Error()
+}
+
+// before implements RequestModifier.
+func (m *basicAuth) before(w http.ResponseWriter, r *http.Request) (proceed bool) {
+	username, user, ok := m.checkSession(r)
+	if !ok {
+		var password string
+		username, password, ok = r.BasicAuth()
+		if !ok {
+			m.unauthorized(w)
+			return false
+		}
+		user = m.lookup(username)
+		if user == nil || !user.verify([]byte(password)) {
+			m.unauthorized(w)
+			httpevents.Blocked(r, "BasicAuth", "invalid credentials")
+			return false
+		}
+		if m.SessionTTL > 0 {
+			m.setSession(w, r, username, user)
+		}
+	}
+
+	if !m.isPathAllowed(username, r.URL.Path) {
+		http.Error(w, "path not allowed", http.StatusForbidden)
+		httpevents.Blocked(r, "BasicAuth", "path not allowed for user "+username)
+		return false
+	}
+	return true
+}
+
+func (m *basicAuth) unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+strings.ReplaceAll(m.Realm, `"`, `\"`)+`", charset="UTF-8"`)
+	http.Error(w, "authentication is required", http.StatusUnauthorized)
+}
+
+func (m *basicAuth) lookup(username string) *htpasswdUser {
+	if user, ok := m.users[username]; ok {
+		return user
+	}
+	if m.file != nil {
+		if user, ok := (*m.file.users.Load())[username]; ok {
+			return user
+		}
+	}
+	return nil
+}
+
+// isPathAllowed reports whether username may access reqPath.
+//
+// Paths of restricted users must be clean, e.g. /public/../admin and //admin are rejected,
+// so they cannot be used to get around the globs.
+func (m *basicAuth) isPathAllowed(username, reqPath string) bool {
+	globs, ok := m.userPaths[username]
+	if !ok {
+		return true
+	}
+	cleaned := path.Clean(reqPath)
+	if strings.HasSuffix(reqPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if cleaned != reqPath {
+		return false
+	}
+	for _, g := range globs {
+		if g.Match(reqPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionMAC signs the username and expiry with the user's password hash,
+// so sessions are invalidated when the password is changed or the user is removed.
+func (m *basicAuth) sessionMAC(username, expiry string, user *htpasswdUser) []byte {
+	mac := hmac.New(sha256.New, basicAuthSessionKey)
+	mac.Write([]byte(m.Realm))
+	mac.Write([]byte{0})
+	mac.Write([]byte(username))
+	mac.Write([]byte{0})
+	mac.Write([]byte(expiry))
+	mac.Write([]byte{0})
+	mac.Write([]byte(user.hash))
+	return mac.Sum(nil)
+}
+
+// setSession issues a session cookie in the format of base64(username).expiry.base64(mac).
+func (m *basicAuth) setSession(w http.ResponseWriter, r *http.Request, username string, user *htpasswdUser) {
+	expiry := strconv.FormatInt(time.Now().Add(m.SessionTTL).Unix(), 10)
+	value := base64.RawURLEncoding.EncodeToString([]byte(username)) + "." +
+		expiry + "." +
+		base64.RawURLEncoding.EncodeToString(m.sessionMAC(username, expiry, user))
+	http.SetCookie(w, &http.Cookie{
+		Name:     basicAuthSessionCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(m.SessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (m *basicAuth) checkSession(r *http.Request) (username string, user *htpasswdUser, ok bool) {
+	if m.SessionTTL <= 0 {
+		return "", nil, false
+	}
+	cookie, err := r.Cookie(basicAuthSessionCookie)
+	if err != nil {
+		return "", nil, false
+	}
+	username, user, err = m.parseSession(cookie.Value)
+	if err != nil {
+		return "", nil, false
+	}
+	return username, user, true
+}
+
+func (m *basicAuth) parseSession(value string) (username string, user *htpasswdUser, err error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return "", nil, ErrInvalidBasicAuthCookie
+	}
+	usernameBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", nil, ErrInvalidBasicAuthCookie
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= expiry {
+		return "", nil, ErrInvalidBasicAuthCookie
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, ErrInvalidBasicAuthCookie
+	}
+	username = string(usernameBytes)
+	user = m.lookup(username)
+	if user == nil || !hmac.Equal(mac, m.sessionMAC(username, parts[1], user)) {
+		return "", nil, ErrInvalidBasicAuthCookie
+	}
+	return username, user, nil
+}
+
+// loadHtpasswdFile loads the htpasswd file at the given path and watches it for changes,
+// files are shared between middlewares using the same path.
+func loadHtpasswdFile(path string) (*htpasswdFile, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	htpasswdFilesMu.Lock()
+	defer htpasswdFilesMu.Unlock()
+
+	if f, ok := htpasswdFiles[path]; ok {
+		return f, nil
+	}
+
+	f := &htpasswdFile{path: path}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	htpasswdFiles[path] = f
+
+	t := task.RootTask("htpasswd_file", false)
+	w := watcher.NewDirectoryWatcher(t, filepath.Dir(path)).Add(filepath.Base(path))
+	go f.watch(w)
+	return f, nil
+}
+
+func (f *htpasswdFile) load() error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	users, err := parseHtpasswd(data)
+	if err != nil {
+		return err
+	}
+	f.users.Store(&users)
+	return nil
+}
+
+func (f *htpasswdFile) watch(w watcher.Watcher) {
+	eventCh, errCh := w.Events(task.RootContext())
+	for {
+		select {
+		case <-task.RootContextCanceled():
+			return
+		case event, ok := <-eventCh:
+			if !ok {
+				return
+			}
+			switch event.Action {
+			case watcherEvents.ActionFileDeleted:
+				log.Warn().Str("path", f.path).Msg("htpasswd file deleted, keeping previously loaded users")
+			default:
+				if err := f.load(); err != nil {
+					log.Err(err).Str("path", f.path).Msg("failed to reload htpasswd file, keeping previously loaded users")
+					continue
+				}
+				log.Info().Str("path", f.path).Msg("htpasswd file reloaded")
+			}
+		case err, ok := <-errCh:
+			if !ok {
+				return
+			}
+			log.Err(err).Str("path", f.path).Msg("error watching htpasswd file")
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	expect "github.com/yusing/goutils/testing"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func argon2idHash(password string) string {
+	salt := []byte("somesalt")
+	key := argon2.IDKey([]byte(password), salt, 1, 1024, 1, 32)
+	return "$argon2id$v=19$m=1024,t=1,p=1$" + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(key)
+}
+
+func TestHtpasswdHashes(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	expect.NoError(t, err)
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"bcrypt", string(bcryptHash)},
+		{"argon2id", argon2idHash("password")},
+		{"sha", "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="},
+		{"apr1", "$apr1$r31....$kMmt8Ia8qcWk4vKKEhpgx1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, err := parseHtpasswd([]byte("# comment\n\nuser:" + tt.hash + "\n"))
+			expect.NoError(t, err)
+			expect.Equal(t, len(users), 1)
+			expect.True(t, users["user"].verify([]byte("password")))
+			expect.False(t, users["user"].verify([]byte("wrong")))
+		})
+	}
+
+	t.Run("md5-crypt", func(t *testing.T) {
+		users, err := parseHtpasswd([]byte("user:$1$saltsalt$9xy1btjgzLYfb7hivXtC//"))
+		expect.NoError(t, err)
+		expect.True(t, users["user"].verify([]byte("secret")))
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := parseHtpasswd([]byte("user:plaintext"))
+		expect.ErrorIs(t, ErrUnsupportedPasswordHash, err)
+		_, err = parseHtpasswd([]byte("invalid line"))
+		expect.HasError(t, err)
+	})
+}
+
+func serveBasicAuth(mid *Middleware, path, username, password string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	mid.ServeHTTP(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, rec, req)
+	return rec
+}
+
+func TestBasicAuth(t *testing.T) {
+	mid, err := BasicAuth.New(OptionsRaw{
+		"users": []string{
+			"alice:" + argon2idHash("alice-password"),
+			"bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+		},
+		"realm": "Tools",
+		"user_paths": map[string]any{
+			"bob": []string{"/public/*"},
+		},
+	})
+	expect.NoError(t, err)
+
+	t.Run("missing credentials", func(t *testing.T) {
+		rec := serveBasicAuth(mid, "/", "", "")
+		expect.Equal(t, rec.Code, http.StatusUnauthorized)
+		expect.Equal(t, rec.Header().Get("WWW-Authenticate"), `Basic realm="Tools", charset="UTF-8"`)
+	})
+	t.Run("invalid credentials", func(t *testing.T) {
+		expect.Equal(t, serveBasicAuth(mid, "/", "alice", "wrong").Code, http.StatusUnauthorized)
+		expect.Equal(t, serveBasicAuth(mid, "/", "carol", "password").Code, http.StatusUnauthorized)
+	})
+	t.Run("valid credentials", func(t *testing.T) {
+		rec := serveBasicAuth(mid, "/admin", "alice", "alice-password")
+		expect.Equal(t, rec.Code, http.StatusOK)
+		expect.Equal(t, len(rec.Result().Cookies()), 1)
+	})
+	t.Run("path restriction", func(t *testing.T) {
+		expect.Equal(t, serveBasicAuth(mid, "/public/index.html", "bob", "password").Code, http.StatusOK)
+		expect.Equal(t, serveBasicAuth(mid, "/admin", "bob", "password").Code, http.StatusForbidden)
+	})
+	t.Run("path traversal", func(t *testing.T) {
+		for _, path := range []string{"/public/../admin", "/public/./../admin", "//admin", "/public//../../admin"} {
+			expect.Equal(t, serveBasicAuth(mid, path, "bob", "password").Code, http.StatusForbidden)
+		}
+		// unrestricted users are not affected
+		expect.Equal(t, serveBasicAuth(mid, "/public/../admin", "alice", "alice-password").Code, http.StatusOK)
+	})
+	t.Run("session cookie", func(t *testing.T) {
+		cookies := serveBasicAuth(mid, "/", "bob", "password").Result().Cookies()
+		expect.Equal(t, len(cookies), 1)
+		expect.Equal(t, cookies[0].Name, basicAuthSessionCookie)
+
+		rec := serveBasicAuth(mid, "/public/", "", "", cookies[0])
+		expect.Equal(t, rec.Code, http.StatusOK)
+		expect.Equal(t, len(rec.Result().Cookies()), 0) // not reissued
+		// path restrictions still apply
+		expect.Equal(t, serveBasicAuth(mid, "/admin", "", "", cookies[0]).Code, http.StatusForbidden)
+
+		tampered := *cookies[0]
+		tampered.Value = base64.RawURLEncoding.EncodeToString([]byte("alice")) + tampered.Value[len("Ym9i"):]
+		expect.Equal(t, serveBasicAuth(mid, "/admin", "", "", &tampered).Code, http.StatusUnauthorized)
+	})
+}
+
+func TestBasicAuthHtpasswdFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".htpasswd")
+	expect.NoError(t, os.WriteFile(file, []byte("user:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"), 0o600))
+
+	mid, err := BasicAuth.New(OptionsRaw{"htpasswd_file": file})
+	expect.NoError(t, err)
+
+	cookies := serveBasicAuth(mid, "/", "user", "password").Result().Cookies()
+	expect.Equal(t, len(cookies), 1)
+
+	// password changed, old password and sessions are no longer valid
+	newHash, err := bcrypt.GenerateFromPassword([]byte("new-password"), bcrypt.MinCost)
+	expect.NoError(t, err)
+	expect.NoError(t, os.WriteFile(file, []byte("user:"+string(newHash)+"\n"), 0o600))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for serveBasicAuth(mid, "/", "user", "new-password").Code != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("htpasswd file was not reloaded")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	expect.Equal(t, serveBasicAuth(mid, "/", "user", "password").Code, http.StatusUnauthorized)
+	expect.Equal(t, serveBasicAuth(mid, "/", "", "", cookies[0]).Code, http.StatusUnauthorized)
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := BasicAuth.New(OptionsRaw{"htpasswd_file": filepath.Join(t.TempDir(), "missing")})
+		expect.HasError(t, err)
+	})
+	t.Run("no users", func(t *testing.T) {
+		_, err := BasicAuth.New(OptionsRaw{})
+		expect.ErrorIs(t, ErrMissingHtpasswd, err)
+	})
+}
@@ -28,9 +28,10 @@ func (b Bypass) ShouldBypass(w http.ResponseWriter, r *http.Request) bool {
 type checkBypass struct {
 	name string
 
-	bypass Bypass
-	modReq RequestModifier
-	modRes ResponseModifier
+	bypass  Bypass
+	modReq  RequestModifier
+	modRes  ResponseModifier
+	handler RequestHandler
 
 	modReqCheckEnforceFuncs []checkReqFunc
 	modReqCheckBypassFuncs  []checkReqFunc
@@ -42,6 +43,7 @@ type checkBypass struct {
 var (
 	_ RequestModifier  = (*checkBypass)(nil)
 	_ ResponseModifier = (*checkBypass)(nil)
+	_ RequestHandler   = (*checkBypass)(nil)
 )
 
 // shouldModReqEnforce checks if the modify request should be enforced.
@@ -113,6 +115,15 @@ func (c *checkBypass) before(w http.ResponseWriter, r *http.Request) (proceedNex
 	return c.modReq.before(w, r)
 }
 
+// handle runs the request handler if the request should not be bypassed.
+func (c *checkBypass) handle(next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	if c.handler == nil || c.shouldModReqBypass(w, r) {
+		next(w, r)
+		return
+	}
+	c.handler.handle(next, w, r)
+}
+
 // modifyResponse modifies the response if the response should be modified.
 func (c *checkBypass) modifyResponse(resp *http.Response) error {
 	if c.modRes == nil || c.shouldModResBypass(resp) {
@@ -126,11 +137,13 @@ func (m *Middleware) withCheckBypass() any {
 	if len(m.Bypass) > 0 {
 		modReq, _ := m.impl.(RequestModifier)
 		modRes, _ := m.impl.(ResponseModifier)
+		handler, _ := m.impl.(RequestHandler)
 		return &checkBypass{
 			name:                    m.Name(),
 			bypass:                  m.Bypass,
 			modReq:                  modReq,
 			modRes:                  modRes,
+			handler:                 handler,
 			modReqCheckEnforceFuncs: getModReqCheckEnforceFuncs(modReq),
 			modReqCheckBypassFuncs:  getModReqCheckBypassFuncs(modReq),
 			modResCheckEnforceFuncs: getModResCheckEnforceFuncs(modRes),
@@ -144,8 +157,11 @@ func getModReqCheckEnforceFuncs(modReq RequestModifier) (checks []checkReqFunc)
 	if modReq == nil {
 		return nil
 	}
-	if _, ok := modReq.(*oidcMiddleware); ok {
+	switch modReq.(type) {
+	case *oidcMiddleware:
 		checks = append(checks, isOIDCAuthPath)
+	case *ldapMiddleware:
+		checks = append(checks, isLDAPAuthPath)
 	}
 	return checks
 }
@@ -155,7 +171,7 @@ func getModReqCheckBypassFuncs(modReq RequestModifier) (checks []checkReqFunc) {
 		return nil
 	}
 	switch modReq.(type) {
-	case *oidcMiddleware, *forwardAuthMiddleware, *crowdsecMiddleware, *hCaptcha:
+	case *oidcMiddleware, *ldapMiddleware, *forwardAuthMiddleware, *crowdsecMiddleware, *hCaptcha:
 		checks = append(checks, isStaticAssetPath)
 	}
 	return checks
@@ -0,0 +1,363 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yusing/godoxy/internal/logging/accesslog"
+	"github.com/yusing/godoxy/internal/net/gphttp/httpcache"
+	"github.com/yusing/godoxy/internal/route/routes"
+	"github.com/yusing/goutils/http/httpheaders"
+)
+
+type (
+	cache struct {
+		CacheOpts
+
+		cache *httpcache.Cache
+	}
+
+	CacheOpts struct {
+		// MaxEntries is the max number of responses stored in memory.
+		MaxEntries int `json:"max_entries" validate:"omitempty,gt=0"`
+		// MaxSize is the max total size of responses stored in memory, in bytes.
+		MaxSize int64 `json:"max_size" validate:"omitempty,gt=0"`
+		// MaxEntrySize is the max size of a response body to be stored, in bytes.
+		MaxEntrySize int64 `json:"max_entry_size" validate:"omitempty,gt=0"`
+		// DefaultTTL is the freshness lifetime of responses without an explicit expiration time
+		// or Last-Modified, 0 to store them only if they can be revalidated.
+		DefaultTTL time.Duration `json:"default_ttl"`
+		// StaleIfError is the duration a stale response can be served when the upstream fails,
+		// if the response has no stale-if-error directive.
+		StaleIfError time.Duration `json:"stale_if_error"`
+		// DiskMaxSize is the max total size of responses stored on disk under the data directory, in bytes, 0 to disable.
+		DiskMaxSize int64 `json:"disk_max_size"`
+	}
+)
+
+const (
+	headerCacheStatus = "Cache-Status"
+	cacheStatusName   = "godoxy"
+)
+
+var (
+	Cache            = NewMiddleware[cache]()
+	cacheOptsDefault = CacheOpts{
+		MaxEntries:   10000,
+		MaxSize:      64 << 20,
+		MaxEntrySize: 8 << 20,
+	}
+)
+
+// setup implements MiddlewareWithSetup.
+func (m *cache) setup() {
+	m.CacheOpts = cacheOptsDefault
+}
+
+// finalize implements MiddlewareFinalizerWithError.
+func (m *cache) finalize() error {
+	if m.MaxEntrySize > m.MaxSize {
+		return fmt.Errorf("max_entry_size (%d) must not be greater than max_size (%d)", m.MaxEntrySize, m.MaxSize)
+	}
+	m.cache = httpcache.New(httpcache.Options{
+		MaxEntries:   m.MaxEntries,
+		MaxSize:      m.MaxSize,
+		MaxEntrySize: m.MaxEntrySize,
+		DiskMaxSize:  m.DiskMaxSize,
+	})
+	return nil
+}
+
+// handle implements RequestHandler.
+func (m *cache) handle(next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	route := routes.TryGetUpstreamName(r)
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	default:
+		m.invalidate(next, w, r, route)
+		return
+	}
+	if r.Header.Get("Range") != "" || httpheaders.IsWebsocket(r.Header) {
+		w.Header().Add(headerCacheStatus, cacheStatusName+"; fwd=bypass")
+		next(w, r)
+		return
+	}
+
+	reqCC := httpcache.ParseCacheControl(r.Header)
+	now := time.Now()
+	if e := m.cache.Get(route, r); e != nil {
+		ttl := e.TTL(now, m.DefaultTTL)
+		if m.isUsable(e, reqCC, ttl, now) {
+			m.cache.Record(route, httpcache.OutcomeHit)
+			serveCached(w, r, e, now, "hit; ttl="+strconv.FormatInt(int64(ttl/time.Second), 10))
+			return
+		}
+		if m.canServeWhileRevalidate(e, reqCC, ttl) {
+			m.cache.Record(route, httpcache.OutcomeStale)
+			m.revalidateInBackground(next, r, route, e)
+			serveCached(w, r, e, now, "hit; ttl="+strconv.FormatInt(int64(ttl/time.Second), 10)+"; detail=stale-while-revalidate")
+			return
+		}
+		if reqCC.OnlyIfCached {
+			serveOnlyIfCachedMiss(w)
+			return
+		}
+		fwd := "stale"
+		if reqCC.NoCache {
+			fwd = "request"
+		}
+		m.cache.Record(route, m.forward(next, w, r, route, e, fwd))
+		return
+	}
+
+	if reqCC.OnlyIfCached {
+		serveOnlyIfCachedMiss(w)
+		return
+	}
+	m.cache.Record(route, m.fetch(next, w, r, route))
+}
+
+// isUsable reports whether e can be served without contacting the upstream (RFC 9111 4.2, 5.2.1).
+func (m *cache) isUsable(e *httpcache.Entry, reqCC httpcache.CacheControl, ttl time.Duration, now time.Time) bool {
+	if reqCC.NoCache {
+		return false
+	}
+	if reqCC.MaxAge >= 0 && e.Age(now) > reqCC.MaxAge {
+		return false
+	}
+	if ttl > 0 {
+		return reqCC.MinFresh < 0 || ttl >= reqCC.MinFresh
+	}
+	cc := e.CacheControl()
+	if mustRevalidate(cc) {
+		return false
+	}
+	return reqCC.MaxStale >= 0 && -ttl <= reqCC.MaxStale
+}
+
+// canServeWhileRevalidate reports whether stale e can be served while it is revalidated in the background (RFC 5861).
+func (m *cache) canServeWhileRevalidate(e *httpcache.Entry, reqCC httpcache.CacheControl, ttl time.Duration) bool {
+	if reqCC.NoCache || reqCC.MaxAge >= 0 {
+		return false
+	}
+	cc := e.CacheControl()
+	return !mustRevalidate(cc) && cc.StaleWhileRevalidate > 0 && -ttl <= cc.StaleWhileRevalidate
+}
+
+// canServeIfError reports whether stale e can be served when the upstream fails (RFC 5861).
+func (m *cache) canServeIfError(e *httpcache.Entry, reqCC httpcache.CacheControl, now time.Time) bool {
+	cc := e.CacheControl()
+	if mustRevalidate(cc) {
+		return false
+	}
+	staleIfError := cc.StaleIfError
+	if staleIfError < 0 {
+		staleIfError = m.StaleIfError
+	}
+	staleIfError = max(staleIfError, reqCC.StaleIfError)
+	return staleIfError > 0 && -e.TTL(now, m.DefaultTTL) <= staleIfError
+}
+
+// mustRevalidate reports whether a stale response must not be served without revalidation.
+//
+// s-maxage implies proxy-revalidate for shared caches (RFC 9111 5.2.2.10).
+func mustRevalidate(cc httpcache.CacheControl) bool {
+	return cc.MustRevalidate || cc.ProxyRevalidate || cc.NoCache || cc.SMaxAge >= 0
+}
+
+// fetch forwards a request without a usable stored response. Concurrent GET requests with the same key
+// wait for the first one and are served from its stored response.
+func (m *cache) fetch(next http.HandlerFunc, w http.ResponseWriter, r *http.Request, route string) httpcache.Outcome {
+	if r.Method != http.MethodGet {
+		return m.forward(next, w, r, route, nil, "uri-miss")
+	}
+
+	f, leader := m.cache.Join(httpcache.Key(route, r))
+	if leader {
+		return m.forwardFlight(next, w, r, route, nil, "uri-miss", f)
+	}
+	if e := f.Wait(r.Context()); e != nil && e.Matches(r) {
+		serveCached(w, r, e, time.Now(), "hit; detail=coalesced")
+		return httpcache.OutcomeHit
+	}
+	if r.Context().Err() != nil {
+		return httpcache.OutcomeMiss
+	}
+	// the response of the leader was not stored or is another variant
+	return m.forward(next, w, r, route, nil, "uri-miss")
+}
+
+func (m *cache) forward(next http.HandlerFunc, w http.ResponseWriter, r *http.Request, route string, stale *httpcache.Entry, fwd string) httpcache.Outcome {
+	return m.forwardFlight(next, w, r, route, stale, fwd, nil)
+}
+
+// forwardFlight forwards r to the upstream and stores the response if possible.
+//
+// If stale is not nil, the request is made conditional to revalidate it,
+// and stale is served if the upstream responds 304 Not Modified or fails within stale-if-error.
+func (m *cache) forwardFlight(next http.HandlerFunc, w http.ResponseWriter, r *http.Request, route string, stale *httpcache.Entry, fwd string, f *httpcache.Flight) httpcache.Outcome {
+	reqCC := httpcache.ParseCacheControl(r.Header)
+	upReq := r
+	if stale != nil && stale.HasValidator() {
+		upReq = r.Clone(r.Context())
+		upReq.Header.Del("If-None-Match")
+		upReq.Header.Del("If-Modified-Since")
+		if etag := stale.ETag(); etag != "" {
+			upReq.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := stale.LastModified(); lastModified != "" {
+			upReq.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	reqTime := time.Now()
+	cw := newCacheWriter(w, m.MaxEntrySize, func(status int, header http.Header) cacheWriteMode {
+		if stale != nil {
+			if status == http.StatusNotModified && upReq != r {
+				return cacheWriteIntercept
+			}
+			if status >= http.StatusInternalServerError && m.canServeIfError(stale, reqCC, time.Now()) {
+				return cacheWriteIntercept
+			}
+		}
+		if httpcache.IsStorable(r, status, header) {
+			return cacheWriteTee
+		}
+		return cacheWritePass
+	})
+	cw.cacheStatus = "fwd=" + fwd
+	if f != nil {
+		cw.abandon = func() { m.cache.Land(f, nil) }
+		defer m.cache.Land(f, nil)
+	}
+
+	next(cw, upReq)
+	store := cw.finish()
+	respTime := time.Now()
+
+	if cw.mode == cacheWriteIntercept {
+		if cw.status == http.StatusNotModified {
+			e := freshen(stale, cw.header, reqTime, respTime)
+			m.cache.Put(e)
+			serveCached(w, r, e, respTime, "fwd="+fwd+"; fwd-status=304")
+			return httpcache.OutcomeRevalidated
+		}
+		serveCached(w, r, stale, respTime, "fwd="+fwd+"; fwd-status="+strconv.Itoa(cw.status)+"; detail=stale-if-error")
+		return httpcache.OutcomeStale
+	}
+	if store {
+		e := httpcache.NewEntry(route, r, cw.status, cw.header.Clone(), cw.body.Bytes(), reqTime, respTime)
+		if e.FreshnessLifetime(m.DefaultTTL) > 0 || e.HasValidator() {
+			m.cache.Put(e)
+			if f != nil {
+				m.cache.Land(f, e)
+			}
+		}
+	}
+	return httpcache.OutcomeMiss
+}
+
+// revalidateInBackground revalidates stale e with a detached request, concurrent revalidations of e are coalesced.
+func (m *cache) revalidateInBackground(next http.HandlerFunc, r *http.Request, route string, e *httpcache.Entry) {
+	f, leader := m.cache.Join("revalidate|" + httpcache.Key(route, r))
+	if !leader {
+		return
+	}
+	r = r.Clone(context.WithoutCancel(r.Context()))
+	r.Method = http.MethodGet
+	go func() {
+		defer m.cache.Land(f, nil)
+		m.forward(next, discardResponseWriter{make(http.Header)}, r, route, e, "stale")
+	}()
+}
+
+// invalidate forwards an unsafe request and removes the stored responses of its URI if it succeeds (RFC 9111 4.4).
+func (m *cache) invalidate(next http.HandlerFunc, w http.ResponseWriter, r *http.Request, route string) {
+	rec := accesslog.GetResponseRecorder(w)
+	defer accesslog.PutResponseRecorder(rec)
+
+	next(rec, r)
+	if status := rec.Response().StatusCode; status < http.StatusBadRequest && r.Method != http.MethodOptions && r.Method != http.MethodTrace {
+		m.cache.Delete(route, r)
+	}
+}
+
+// freshen returns a copy of e with its header updated by the header of a 304 response (RFC 9111 4.3.4).
+func freshen(e *httpcache.Entry, header http.Header, reqTime, respTime time.Time) *httpcache.Entry {
+	updated := *e
+	updated.Header = e.Header.Clone()
+	for k, v := range header {
+		switch k {
+		case httpheaders.HeaderContentLength, "Content-Encoding", "Transfer-Encoding", "Content-Range":
+			continue
+		}
+		updated.Header[k] = slices.Clone(v)
+	}
+	updated.RequestTime = reqTime
+	updated.ResponseTime = respTime
+	return &updated
+}
+
+// serveCached serves the stored response e, or 304 Not Modified if the conditional request r matches it.
+func serveCached(w http.ResponseWriter, r *http.Request, e *httpcache.Entry, now time.Time, cacheStatus string) {
+	h := w.Header()
+	for k, v := range e.Header {
+		h[k] = slices.Clone(v)
+	}
+	h.Set("Age", httpcache.FormatAge(e.Age(now)))
+	h.Add(headerCacheStatus, cacheStatusName+"; "+cacheStatus)
+
+	if e.Status == http.StatusOK && isNotModified(r, e) {
+		h.Del(httpheaders.HeaderContentLength)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set(httpheaders.HeaderContentLength, strconv.Itoa(len(e.Body)))
+	w.WriteHeader(e.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(e.Body)
+	}
+}
+
+// serveOnlyIfCachedMiss serves 504 Gateway Timeout for an only-if-cached request without a usable stored response (RFC 9111 5.2.1.7).
+func serveOnlyIfCachedMiss(w http.ResponseWriter) {
+	w.Header().Add(headerCacheStatus, cacheStatusName+"; fwd=miss; detail=only-if-cached")
+	http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+}
+
+// isNotModified evaluates the conditional headers of r against e (RFC 9110 13.2.2).
+func isNotModified(r *http.Request, e *httpcache.Entry) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := e.ETag()
+		if etag == "" {
+			return false
+		}
+		for tag := range strings.SplitSeq(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(e.LastModified())
+	return err == nil && !lastModified.After(ims)
+}
+
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header         { return w.header }
+func (w discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardResponseWriter) WriteHeader(int)             {}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+type cacheTest struct {
+	mid   *Middleware
+	calls atomic.Int32
+}
+
+func newCacheTest(t *testing.T, upstream http.HandlerFunc) (*cacheTest, func(r *http.Request) *httptest.ResponseRecorder) {
+	t.Helper()
+	mid, err := Cache.New(OptionsRaw{"max_entry_size": 1 << 10})
+	expect.NoError(t, err)
+	ct := &cacheTest{mid: mid}
+	return ct, func(r *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mid.ServeHTTP(func(w http.ResponseWriter, r *http.Request) {
+			ct.calls.Add(1)
+			upstream(w, r)
+		}, rec, r)
+		return rec
+	}
+}
+
+func TestCacheHit(t *testing.T) {
+	ct, serve := newCacheTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	rec := serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	expect.Equal(t, rec.Code, http.StatusOK)
+	expect.Equal(t, rec.Body.String(), "hello")
+	expect.Equal(t, rec.Header().Get(headerCacheStatus), "godoxy; fwd=uri-miss")
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	expect.Equal(t, rec.Code, http.StatusOK)
+	expect.Equal(t, rec.Body.String(), "hello")
+	expect.True(t, strings.HasPrefix(rec.Header().Get(headerCacheStatus), "godoxy; hit; ttl="))
+	expect.Equal(t, rec.Header().Get("Age"), "0")
+	expect.Equal(t, ct.calls.Load(), int32(1))
+
+	// HEAD requests are served from the stored GET response
+	rec = serve(httptest.NewRequest(http.MethodHead, "/", nil))
+	expect.Equal(t, rec.Code, http.StatusOK)
+	expect.Equal(t, rec.Body.Len(), 0)
+	expect.Equal(t, rec.Header().Get("Content-Length"), "5")
+
+	// conditional requests are answered from the stored response
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", `W/"v1"`)
+	rec = serve(req)
+	expect.Equal(t, rec.Code, http.StatusNotModified)
+
+	// request no-cache forces revalidation
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Cache-Control", "no-cache")
+	rec = serve(req)
+	expect.Equal(t, rec.Header().Get(headerCacheStatus), "godoxy; fwd=request")
+	expect.Equal(t, ct.calls.Load(), int32(2))
+
+	// successful unsafe requests invalidate stored responses
+	serve(httptest.NewRequest(http.MethodPost, "/", nil))
+	serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	expect.Equal(t, ct.calls.Load(), int32(4))
+}
+
+func TestCacheNotStored(t *testing.T) {
+	ct, serve := newCacheTest(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/large":
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = w.Write([]byte(strings.Repeat("x", 2<<10)))
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	for _, path := range []string{"/private", "/no-validator", "/large"} {
+		serve(httptest.NewRequest(http.MethodGet, path, nil))
+		rec := serve(httptest.NewRequest(http.MethodGet, path, nil))
+		expect.Equal(t, rec.Header().Get(headerCacheStatus), "godoxy; fwd=uri-miss")
+	}
+	expect.Equal(t, ct.calls.Load(), int32(6))
+
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set("Cache-Control", "only-if-cached")
+	expect.Equal(t, serve(req).Code, http.StatusGatewayTimeout)
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	var fail atomic.Bool
+	ct, serve := newCacheTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	rec := serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	expect.Equal(t, rec.Code, http.StatusOK)
+	expect.Equal(t, rec.Body.String(), "hello")
+	expect.Equal(t, rec.Header().Get(headerCacheStatus), "godoxy; fwd=stale; fwd-status=304")
+	expect.Equal(t, ct.calls.Load(), int32(2))
+
+	fail.Store(true)
+	rec = serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	expect.Equal(t, rec.Code, http.StatusOK)
+	expect.Equal(t, rec.Body.String(), "hello")
+	expect.Equal(t, rec.Header().Get(headerCacheStatus), "godoxy; fwd=stale; fwd-status=502; detail=stale-if-error")
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var version atomic.Int32
+	revalidated := make(chan struct{}, 1)
+	_, serve := newCacheTest(t, func(w http.ResponseWriter, r *http.Request) {
+		v := version.Add(1)
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte{'0' + byte(v)})
+		if v > 1 {
+			select {
+			case revalidated <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	expect.Equal(t, serve(httptest.NewRequest(http.MethodGet, "/", nil)).Body.String(), "1")
+	rec := serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	expect.Equal(t, rec.Body.String(), "1")
+	expect.True(t, strings.HasSuffix(rec.Header().Get(headerCacheStatus), "; detail=stale-while-revalidate"))
+
+	select {
+	case <-revalidated:
+	case <-time.After(time.Second):
+		t.Fatal("stale response was not revalidated in the background")
+	}
+	// wait for the revalidated response to be stored
+	expect.True(t, waitFor(func() bool {
+		return serve(httptest.NewRequest(http.MethodGet, "/", nil)).Body.String() != "1"
+	}))
+}
+
+func TestCacheCoalescing(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	ct, serve := newCacheTest(t, func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(started) })
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Go(func() {
+			bodies[i] = serve(httptest.NewRequest(http.MethodGet, "/", nil)).Body.String()
+		})
+		if i == 0 {
+			<-started
+		}
+	}
+	time.Sleep(50 * time.Millisecond) // let the other requests join the flight
+	close(release)
+	wg.Wait()
+
+	expect.Equal(t, ct.calls.Load(), int32(1))
+	for _, body := range bodies {
+		expect.Equal(t, body, "hello")
+	}
+}
+
+func waitFor(cond func() bool) bool {
+	for range 100 {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
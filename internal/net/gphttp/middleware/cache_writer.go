@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"maps"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/yusing/goutils/http/httpheaders"
+)
+
+type cacheWriteMode uint8
+
+const (
+	cacheWritePass      cacheWriteMode = iota // write to the client only
+	cacheWriteTee                             // write to the client and buffer the body for storing
+	cacheWriteIntercept                       // discard, the handler serves a stored response instead
+)
+
+// cacheWriter holds back the response header until the write mode is decided.
+type cacheWriter struct {
+	rw     http.ResponseWriter
+	header http.Header
+
+	decide func(status int, header http.Header) cacheWriteMode
+	// abandon is called once when the response will not be stored.
+	abandon func()
+	// cacheStatus is added to the Cache-Status header of the response to the client.
+	cacheStatus string
+
+	maxBodySize int64
+
+	status int
+	mode   cacheWriteMode
+	body   bytes.Buffer
+}
+
+func newCacheWriter(rw http.ResponseWriter, maxBodySize int64, decide func(status int, header http.Header) cacheWriteMode) *cacheWriter {
+	return &cacheWriter{
+		rw:          rw,
+		header:      make(http.Header),
+		decide:      decide,
+		maxBodySize: maxBodySize,
+	}
+}
+
+func (w *cacheWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+	if code < http.StatusOK { // informational responses, e.g. 103 Early Hints
+		maps.Copy(w.rw.Header(), w.header)
+		w.rw.WriteHeader(code)
+		return
+	}
+	w.status = code
+	w.mode = w.decide(code, w.header)
+	if w.mode == cacheWriteTee {
+		if n, err := strconv.ParseInt(w.header.Get(httpheaders.HeaderContentLength), 10, 64); err == nil && n > w.maxBodySize {
+			w.mode = cacheWritePass
+		}
+	}
+	if w.mode != cacheWriteTee {
+		w.abandonStore()
+	}
+	if w.mode == cacheWriteIntercept {
+		return
+	}
+	w.commitHeader()
+	w.rw.WriteHeader(code)
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	switch w.mode {
+	case cacheWriteIntercept:
+		return len(b), nil
+	case cacheWriteTee:
+		if int64(w.body.Len()+len(b)) > w.maxBodySize {
+			w.mode = cacheWritePass
+			w.body = bytes.Buffer{}
+			w.abandonStore()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.rw.Write(b)
+}
+
+func (w *cacheWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.mode != cacheWriteIntercept {
+		_ = http.NewResponseController(w.rw).Flush()
+	}
+}
+
+func (w *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.rw).Hijack()
+}
+
+// finish writes the header if the handler has written nothing, and reports whether the body can be stored.
+func (w *cacheWriter) finish() bool {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.mode == cacheWriteTee
+}
+
+func (w *cacheWriter) abandonStore() {
+	if w.abandon != nil {
+		w.abandon()
+		w.abandon = nil
+	}
+}
+
+func (w *cacheWriter) commitHeader() {
+	dst := w.rw.Header()
+	maps.Copy(dst, w.header)
+	if w.cacheStatus != "" {
+		dst.Add(headerCacheStatus, cacheStatusName+"; "+w.cacheStatus)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"text/template"
 
 	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/acl"
 	"github.com/yusing/godoxy/internal/auth"
 	httputils "github.com/yusing/goutils/http"
 
@@ -47,6 +48,7 @@ func PreRequest(p Provider, w http.ResponseWriter, r *http.Request) (proceed boo
 		}
 
 		log.Warn().Err(err).Str("url", r.URL.String()).Str("remote_addr", r.RemoteAddr).Msg("failed to verify captcha")
+		acl.Report(r, acl.AutoBanCaptcha)
 		http.Error(w, "Failed to verify captcha", http.StatusUnauthorized)
 		return false
 	}
@@ -0,0 +1,346 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"weak"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/logging/accesslog"
+	"github.com/yusing/godoxy/internal/net/gphttp/middleware/errorpage"
+	"github.com/yusing/godoxy/internal/notif"
+	"github.com/yusing/godoxy/internal/route/routes"
+	"github.com/yusing/godoxy/internal/types"
+	"github.com/yusing/goutils/events"
+	"github.com/yusing/goutils/http/httpheaders"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+type (
+	circuitBreaker struct {
+		CircuitBreakerOpts
+
+		breakers *xsync.Map[string, *circuitBreakerState]
+	}
+
+	CircuitBreakerOpts struct {
+		// Scope is "route" for one breaker per route, or "upstream" for one breaker per upstream address.
+		Scope string `json:"scope" validate:"omitempty,oneof=route upstream"`
+		// Window is the duration of the sliding window of request outcomes.
+		Window time.Duration `json:"window" validate:"omitempty,min=1s"`
+		// MinRequests is the minimum number of requests in the window before the breaker can trip.
+		MinRequests int `json:"min_requests" validate:"omitempty,gt=0"`
+		// ErrorRatio trips the breaker when the ratio of 5xx responses in the window reaches it.
+		ErrorRatio float64 `json:"error_ratio" validate:"omitempty,gt=0,lte=1"`
+		// Latency trips the breaker when the latency percentile in the window reaches it, 0 to disable.
+		Latency time.Duration `json:"latency"`
+		// LatencyPercentile is the percentile of latency to compare against Latency.
+		LatencyPercentile float64 `json:"latency_percentile" validate:"omitempty,gt=0,lte=100"`
+		// OpenDuration is the duration to reject requests before probing the upstream again.
+		OpenDuration time.Duration `json:"open_duration" validate:"omitempty,min=1s"`
+		// HalfOpenRequests is the number of probe requests that must succeed to close the breaker.
+		HalfOpenRequests int `json:"half_open_requests" validate:"omitempty,gt=0"`
+	}
+
+	circuitBreakerState struct {
+		opts     *CircuitBreakerOpts
+		route    string
+		upstream string
+
+		mu        sync.Mutex
+		state     types.CircuitBreakerState
+		since     time.Time
+		reason    string
+		window    cbWindow
+		epoch     uint64 // incremented on every transition, to ignore probes of previous half-open states
+		probes    int    // probes in flight
+		successes int    // successful probes
+	}
+)
+
+const (
+	CircuitBreakerScopeRoute    = "route"
+	CircuitBreakerScopeUpstream = "upstream"
+)
+
+var (
+	CircuitBreaker            = NewMiddleware[circuitBreaker]()
+	circuitBreakerOptsDefault = CircuitBreakerOpts{
+		Scope:             CircuitBreakerScopeRoute,
+		Window:            10 * time.Second,
+		MinRequests:       20,
+		ErrorRatio:        0.5,
+		LatencyPercentile: 99,
+		OpenDuration:      30 * time.Second,
+		HalfOpenRequests:  3,
+	}
+)
+
+var circuitBreakerNotify notif.NotifyFunc = notif.Notify
+
+// setup implements MiddlewareWithSetup.
+func (m *circuitBreaker) setup() {
+	m.CircuitBreakerOpts = circuitBreakerOptsDefault
+	m.breakers = xsync.NewMap[string, *circuitBreakerState]()
+}
+
+// handle implements RequestHandler.
+func (m *circuitBreaker) handle(next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	b := m.breaker(r)
+
+	start := time.Now()
+	probe, ok := b.allow(start)
+	if !ok {
+		b.serveOpen(w, r, start)
+		return
+	}
+
+	rec := accesslog.GetResponseRecorder(w)
+	defer accesslog.PutResponseRecorder(rec)
+
+	next(rec, r)
+
+	// the latency and outcome of upgraded connections and streams are not of the upstream response
+	if isStreaming(r, rec.Response()) {
+		b.release(probe)
+		return
+	}
+	b.record(time.Now(), start, rec.Response().StatusCode, probe)
+}
+
+// isStreaming reports whether r is a websocket upgrade or an SSE request, or resp is an SSE response.
+func isStreaming(r *http.Request, resp *http.Response) bool {
+	return httpheaders.IsWebsocket(r.Header) ||
+		r.Header.Get("Accept") == "text/event-stream" ||
+		strings.HasPrefix(resp.Header.Get(httpheaders.HeaderContentType), "text/event-stream")
+}
+
+func (m *circuitBreaker) breaker(r *http.Request) *circuitBreakerState {
+	route := routes.TryGetUpstreamName(r)
+	var upstream string
+	key := route
+	if m.Scope == CircuitBreakerScopeUpstream {
+		upstream = routes.TryGetUpstreamAddr(r)
+		key = route + "|" + upstream
+	}
+	b, _ := m.breakers.LoadOrCompute(key, func() (*circuitBreakerState, bool) {
+		b := &circuitBreakerState{
+			opts:     &m.CircuitBreakerOpts,
+			route:    route,
+			upstream: upstream,
+			state:    types.CircuitBreakerClosed,
+			since:    time.Now(),
+			epoch:    1,
+			window:   newCBWindow(m.Window),
+		}
+		registerCircuitBreaker(b)
+		return b, false
+	})
+	return b
+}
+
+// allow reports whether a request can be sent to the upstream.
+// If the request is a probe, probe is the epoch of the half-open state, otherwise 0.
+func (b *circuitBreakerState) allow(now time.Time) (probe uint64, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case types.CircuitBreakerClosed:
+		return 0, true
+	case types.CircuitBreakerOpen:
+		if now.Sub(b.since) < b.opts.OpenDuration {
+			return 0, false
+		}
+		b.transition(types.CircuitBreakerHalfOpen, now, b.reason)
+	}
+
+	// half open
+	if b.probes+b.successes >= b.opts.HalfOpenRequests {
+		return 0, false
+	}
+	b.probes++
+	return b.epoch, true
+}
+
+// record records the outcome of a request started at start.
+func (b *circuitBreakerState) record(now, start time.Time, status int, probe uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := status >= http.StatusInternalServerError && status != http.StatusNotImplemented
+	latency := now.Sub(start)
+
+	if probe != 0 {
+		if probe != b.epoch {
+			return
+		}
+		b.probes--
+		switch {
+		case failed:
+			b.transition(types.CircuitBreakerOpen, now, fmt.Sprintf("probe request failed with status %d", status))
+		case b.opts.Latency > 0 && latency >= b.opts.Latency:
+			b.transition(types.CircuitBreakerOpen, now, "probe request took "+strutils.FormatDuration(latency))
+		default:
+			b.successes++
+			if b.successes >= b.opts.HalfOpenRequests {
+				b.window.reset()
+				b.transition(types.CircuitBreakerClosed, now, "")
+			}
+		}
+		return
+	}
+
+	if b.state != types.CircuitBreakerClosed {
+		return
+	}
+
+	b.window.add(now, failed, latency)
+	requests, failures, p := b.window.stats(now, b.opts.LatencyPercentile)
+	if requests < b.opts.MinRequests {
+		return
+	}
+	errorRatio := float64(failures) / float64(requests)
+	switch {
+	case errorRatio >= b.opts.ErrorRatio:
+		b.transition(types.CircuitBreakerOpen, now, fmt.Sprintf("error ratio %.2f of %d requests", errorRatio, requests))
+	case b.opts.Latency > 0 && p >= b.opts.Latency:
+		b.transition(types.CircuitBreakerOpen, now, fmt.Sprintf("p%s latency %s of %d requests",
+			strconv.FormatFloat(b.opts.LatencyPercentile, 'f', -1, 64), strutils.FormatDuration(p), requests))
+	}
+}
+
+// release ends a request allowed without recording its outcome.
+func (b *circuitBreakerState) release(probe uint64) {
+	if probe == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe == b.epoch {
+		b.probes--
+	}
+}
+
+// transition changes the state of the breaker, b.mu must be held.
+func (b *circuitBreakerState) transition(state types.CircuitBreakerState, now time.Time, reason string) {
+	b.state = state
+	b.since = now
+	b.reason = reason
+	b.epoch++
+	b.probes = 0
+	b.successes = 0
+
+	l := log.With().Str("route", b.route).Str("upstream", b.upstream).Logger()
+	switch state {
+	case types.CircuitBreakerOpen:
+		l.Warn().Str("reason", reason).Msg("circuit breaker opened")
+		b.notify(zerolog.WarnLevel, "⚡ Circuit breaker opened ⚡", notif.ColorError, reason)
+		events.Global.Add(events.NewEvent(events.LevelWarn, "circuit_breaker", "open", b.info(now)))
+	case types.CircuitBreakerHalfOpen:
+		l.Info().Msg("circuit breaker half-open, probing upstream")
+	case types.CircuitBreakerClosed:
+		l.Info().Msg("circuit breaker closed")
+		b.notify(zerolog.InfoLevel, "✅ Circuit breaker closed ✅", notif.ColorSuccess, "")
+		events.Global.Add(events.NewEvent(events.LevelInfo, "circuit_breaker", "closed", b.info(now)))
+	}
+}
+
+func (b *circuitBreakerState) notify(level zerolog.Level, title string, color notif.Color, reason string) {
+	body := notif.FieldsBody{
+		{Name: "Service Name", Value: b.route},
+		{Name: "Time", Value: strutils.FormatTime(b.since)},
+	}
+	if b.upstream != "" {
+		body.Add("Upstream", b.upstream)
+	}
+	if reason != "" {
+		body.Add("Reason", reason)
+	}
+	// b.mu is held, do not block on the dispatcher
+	go circuitBreakerNotify(&notif.LogMessage{
+		Level: level,
+		Title: title,
+		Body:  body,
+		Color: color,
+	})
+}
+
+// serveOpen serves a fast 503, or the custom 503 error page if available, while the breaker is open.
+func (b *circuitBreakerState) serveOpen(w http.ResponseWriter, r *http.Request, now time.Time) {
+	b.mu.Lock()
+	retryAfter := max(b.opts.OpenDuration-now.Sub(b.since), time.Second)
+	b.mu.Unlock()
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second).Seconds())))
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		if page, ok := errorpage.GetStaticFile("503.html"); ok {
+			w.Header().Set(httpheaders.HeaderContentType, "text/html; charset=utf-8")
+			w.Header().Set(httpheaders.HeaderContentLength, strconv.Itoa(len(page)))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write(page)
+			return
+		}
+	}
+	http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+}
+
+func (b *circuitBreakerState) info(now time.Time) types.CircuitBreakerInfo {
+	requests, failures, p := b.window.stats(now, b.opts.LatencyPercentile)
+	var errorRatio float64
+	if requests > 0 {
+		errorRatio = float64(failures) / float64(requests)
+	}
+	return types.CircuitBreakerInfo{
+		Upstream:   b.upstream,
+		State:      b.state,
+		Since:      b.since,
+		Requests:   requests,
+		ErrorRatio: errorRatio,
+		Latency:    p.Milliseconds(),
+		Reason:     b.reason,
+	}
+}
+
+var (
+	circuitBreakerRegistry = xsync.NewMap[uint64, weak.Pointer[circuitBreakerState]]()
+	circuitBreakerID       atomic.Uint64
+)
+
+// registerCircuitBreaker makes b visible to CircuitBreakers until it is garbage collected,
+// i.e. when the middleware is gone with its route.
+func registerCircuitBreaker(b *circuitBreakerState) {
+	id := circuitBreakerID.Add(1)
+	circuitBreakerRegistry.Store(id, weak.Make(b))
+	runtime.AddCleanup(b, func(id uint64) {
+		circuitBreakerRegistry.Delete(id)
+	}, id)
+}
+
+// CircuitBreakers returns the circuit breakers of a route, sorted by upstream.
+func CircuitBreakers(route string) []types.CircuitBreakerInfo {
+	var infos []types.CircuitBreakerInfo
+	now := time.Now()
+	for _, wp := range circuitBreakerRegistry.Range {
+		b := wp.Value()
+		if b == nil || b.route != route {
+			continue
+		}
+		b.mu.Lock()
+		infos = append(infos, b.info(now))
+		b.mu.Unlock()
+	}
+	slices.SortFunc(infos, func(a, b types.CircuitBreakerInfo) int {
+		return strings.Compare(a.Upstream, b.Upstream)
+	})
+	return infos
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yusing/godoxy/internal/notif"
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newCircuitBreakerTest(t *testing.T, opts OptionsRaw) (*Middleware, chan *notif.LogMessage) {
+	t.Helper()
+	notifications := make(chan *notif.LogMessage, 10)
+	circuitBreakerNotify = func(msg *notif.LogMessage) {
+		notifications <- msg
+	}
+	t.Cleanup(func() {
+		circuitBreakerNotify = notif.Notify
+	})
+
+	mid, err := CircuitBreaker.New(opts)
+	expect.NoError(t, err)
+	return mid, notifications
+}
+
+func TestCircuitBreakerErrorRatio(t *testing.T) {
+	mid, notifications := newCircuitBreakerTest(t, OptionsRaw{
+		"min_requests": 4,
+		"error_ratio":  0.5,
+	})
+
+	calls := 0
+	serve := func(status int) int {
+		rec := httptest.NewRecorder()
+		mid.ServeHTTP(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(status)
+		}, rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	expect.Equal(t, serve(http.StatusOK), http.StatusOK)
+	expect.Equal(t, serve(http.StatusOK), http.StatusOK)
+	expect.Equal(t, serve(http.StatusBadGateway), http.StatusBadGateway)
+	expect.Equal(t, serve(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	expect.Equal(t, calls, 4)
+
+	// open, requests are rejected without reaching the upstream
+	expect.Equal(t, serve(http.StatusOK), http.StatusServiceUnavailable)
+	expect.Equal(t, calls, 4)
+
+	msg := <-notifications
+	expect.Equal(t, msg.Title, "⚡ Circuit breaker opened ⚡")
+
+	infos := CircuitBreakers("")
+	found := false
+	for _, info := range infos {
+		if info.State == types.CircuitBreakerOpen && info.Requests == 4 && info.ErrorRatio == 0.5 {
+			found = true
+		}
+	}
+	expect.True(t, found)
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	mid, notifications := newCircuitBreakerTest(t, OptionsRaw{
+		"min_requests":       1,
+		"open_duration":      "10s",
+		"half_open_requests": 2,
+	})
+	b := mid.impl.(*circuitBreaker).breaker(httptest.NewRequest(http.MethodGet, "/", nil))
+
+	now := time.Now()
+	_, ok := b.allow(now)
+	expect.True(t, ok)
+	b.record(now, now, http.StatusInternalServerError, 0)
+	expect.Equal(t, b.state, types.CircuitBreakerOpen)
+	<-notifications
+
+	_, ok = b.allow(now.Add(5 * time.Second))
+	expect.False(t, ok)
+
+	// half open after open duration, only half_open_requests probes are allowed
+	now = now.Add(10 * time.Second)
+	probe1, ok := b.allow(now)
+	expect.True(t, ok)
+	expect.Equal(t, b.state, types.CircuitBreakerHalfOpen)
+	probe2, ok := b.allow(now)
+	expect.True(t, ok)
+	_, ok = b.allow(now)
+	expect.False(t, ok)
+
+	// a failed probe opens the breaker again
+	b.record(now, now, http.StatusBadGateway, probe1)
+	expect.Equal(t, b.state, types.CircuitBreakerOpen)
+	<-notifications
+	// outcome of a probe from the previous half-open state is ignored
+	b.record(now, now, http.StatusOK, probe2)
+	expect.Equal(t, b.state, types.CircuitBreakerOpen)
+
+	now = now.Add(10 * time.Second)
+	probe1, _ = b.allow(now)
+	probe2, _ = b.allow(now)
+	b.record(now, now, http.StatusOK, probe1)
+	expect.Equal(t, b.state, types.CircuitBreakerHalfOpen)
+	b.record(now, now, http.StatusOK, probe2)
+	expect.Equal(t, b.state, types.CircuitBreakerClosed)
+
+	msg := <-notifications
+	expect.Equal(t, msg.Title, "✅ Circuit breaker closed ✅")
+}
+
+func TestCircuitBreakerLatency(t *testing.T) {
+	mid, _ := newCircuitBreakerTest(t, OptionsRaw{
+		"min_requests":       10,
+		"latency":            "100ms",
+		"latency_percentile": 90,
+	})
+	b := mid.impl.(*circuitBreaker).breaker(httptest.NewRequest(http.MethodGet, "/", nil))
+
+	now := time.Now()
+	for range 9 {
+		b.record(now, now.Add(-10*time.Millisecond), http.StatusOK, 0)
+	}
+	b.record(now, now.Add(-time.Second), http.StatusOK, 0)
+	expect.Equal(t, b.state, types.CircuitBreakerClosed) // p90 is still fast
+
+	b.record(now, now.Add(-time.Second), http.StatusOK, 0)
+	expect.Equal(t, b.state, types.CircuitBreakerOpen)
+}
+
+func TestCircuitBreakerStreaming(t *testing.T) {
+	mid, _ := newCircuitBreakerTest(t, OptionsRaw{
+		"min_requests": 1,
+		"latency":      "10ms",
+	})
+	b := mid.impl.(*circuitBreaker).breaker(httptest.NewRequest(http.MethodGet, "/", nil))
+
+	serve := func(r *http.Request, contentType string) {
+		mid.ServeHTTP(func(w http.ResponseWriter, r *http.Request) {
+			if contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			}
+			time.Sleep(20 * time.Millisecond)
+			w.WriteHeader(http.StatusBadGateway)
+		}, httptest.NewRecorder(), r)
+	}
+
+	ws := httptest.NewRequest(http.MethodGet, "/", nil)
+	ws.Header.Set("Connection", "Upgrade")
+	ws.Header.Set("Upgrade", "websocket")
+	serve(ws, "")
+	sse := httptest.NewRequest(http.MethodGet, "/", nil)
+	serve(sse, "text/event-stream; charset=utf-8")
+
+	requests, _, _ := b.window.stats(time.Now(), 99)
+	expect.Equal(t, requests, 0)
+	expect.Equal(t, b.state, types.CircuitBreakerClosed)
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	w := newCBWindow(10 * time.Second)
+	now := time.Now()
+	for i := range 100 {
+		w.add(now, i%10 == 0, time.Duration(i+1)*time.Millisecond)
+	}
+
+	requests, failures, p50 := w.stats(now, 50)
+	expect.Equal(t, requests, 100)
+	expect.Equal(t, failures, 10)
+	expect.True(t, p50 >= 50*time.Millisecond && p50 < 75*time.Millisecond)
+
+	// outcomes expire after the window
+	requests, _, _ = w.stats(now.Add(10*time.Second), 50)
+	expect.Equal(t, requests, 0)
+}
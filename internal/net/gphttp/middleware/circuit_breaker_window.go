@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"math"
+	"time"
+)
+
+// cbWindow is a sliding window of request outcomes, divided into buckets
+// so old outcomes expire gradually instead of all at once.
+type cbWindow struct {
+	buckets    [cbWindowBuckets]cbBucket
+	bucketSize time.Duration
+}
+
+type cbBucket struct {
+	start    int64 // bucket start in bucketSize units
+	requests int
+	failures int
+	latency  [cbLatencyBins]int
+}
+
+const (
+	cbWindowBuckets = 10
+
+	// latency histogram bins grow by a factor of sqrt(2) from 1ms, the last bin is ~46s and above.
+	cbLatencyBins    = 32
+	cbLatencyBinBase = time.Millisecond
+)
+
+func newCBWindow(size time.Duration) cbWindow {
+	return cbWindow{bucketSize: max(size/cbWindowBuckets, time.Millisecond)}
+}
+
+func latencyBin(d time.Duration) int {
+	if d <= cbLatencyBinBase {
+		return 0
+	}
+	bin := int(math.Ceil(2 * math.Log2(float64(d)/float64(cbLatencyBinBase))))
+	return min(bin, cbLatencyBins-1)
+}
+
+// latencyBinUpperBound returns the upper bound of latencies in bin.
+func latencyBinUpperBound(bin int) time.Duration {
+	return time.Duration(float64(cbLatencyBinBase) * math.Pow(2, float64(bin)/2))
+}
+
+func (w *cbWindow) bucket(now time.Time) *cbBucket {
+	start := now.UnixNano() / int64(w.bucketSize)
+	b := &w.buckets[start%cbWindowBuckets]
+	if b.start != start {
+		*b = cbBucket{start: start}
+	}
+	return b
+}
+
+func (w *cbWindow) add(now time.Time, failed bool, latency time.Duration) {
+	b := w.bucket(now)
+	b.requests++
+	if failed {
+		b.failures++
+	}
+	b.latency[latencyBin(latency)]++
+}
+
+func (w *cbWindow) reset() {
+	w.buckets = [cbWindowBuckets]cbBucket{}
+}
+
+// stats returns the number of requests, failures and the latency at percentile p (0-100) in the window.
+func (w *cbWindow) stats(now time.Time, p float64) (requests, failures int, latency time.Duration) {
+	oldest := now.UnixNano()/int64(w.bucketSize) - cbWindowBuckets + 1
+	var hist [cbLatencyBins]int
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.start < oldest {
+			continue
+		}
+		requests += b.requests
+		failures += b.failures
+		for bin, n := range b.latency {
+			hist[bin] += n
+		}
+	}
+	if requests == 0 {
+		return 0, 0, 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(requests)))
+	seen := 0
+	for bin, n := range hist {
+		seen += n
+		if seen >= rank {
+			return requests, failures, latencyBinUpperBound(bin)
+		}
+	}
+	return requests, failures, latencyBinUpperBound(cbLatencyBins - 1)
+}
@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yusing/godoxy/internal/route/routes"
+	"github.com/yusing/godoxy/internal/types"
+	"github.com/yusing/goutils/http/httpheaders"
+)
+
+type (
+	compress struct {
+		CompressOpts
+
+		encoders map[string]*encoderPool
+	}
+
+	CompressOpts struct {
+		// Encodings are the enabled content codings in order of preference.
+		Encodings []string `json:"encodings" validate:"omitempty,dive,oneof=zstd br gzip"`
+		// Level is the compression level of all encodings.
+		Level string `json:"level" validate:"omitempty,oneof=fastest default best"`
+		// MinSize is the min size of a response body to be compressed, in bytes.
+		MinSize int `json:"min_size" validate:"omitempty,gte=0"`
+		// ContentTypes are the media types to compress, `*` matches any sequence of characters, e.g. `text/*`.
+		ContentTypes []string `json:"content_types"`
+		// Precompressed enables serving precompressed sibling files (e.g. `app.js.br`) for fileserver routes.
+		Precompressed bool `json:"precompressed"`
+	}
+
+	precompressedKey struct{}
+)
+
+const (
+	encodingZstd = "zstd"
+	encodingBr   = "br"
+	encodingGzip = "gzip"
+)
+
+var (
+	Compress            = NewMiddleware[compress]()
+	compressOptsDefault = CompressOpts{
+		Encodings: []string{encodingZstd, encodingBr, encodingGzip},
+		Level:     "default",
+		MinSize:   1024,
+		ContentTypes: []string{
+			"text/*",
+			"application/json",
+			"application/*+json",
+			"application/javascript",
+			"application/x-javascript",
+			"application/xml",
+			"application/*+xml",
+			"application/wasm",
+			"application/vnd.ms-fontobject",
+			"font/otf",
+			"font/ttf",
+			"image/svg+xml",
+			"image/x-icon",
+		},
+		Precompressed: true,
+	}
+	// precompressedExts are the file extensions of precompressed files by content coding.
+	precompressedExts = map[string]string{
+		encodingZstd: ".zst",
+		encodingBr:   ".br",
+		encodingGzip: ".gz",
+	}
+)
+
+// setup implements MiddlewareWithSetup.
+func (m *compress) setup() {
+	m.CompressOpts = compressOptsDefault
+	// the slices must not share the backing arrays of the defaults
+	m.Encodings = slices.Clone(m.Encodings)
+	m.ContentTypes = slices.Clone(m.ContentTypes)
+}
+
+// finalize implements MiddlewareFinalizer.
+func (m *compress) finalize() {
+	m.Encodings = slices.Compact(m.Encodings)
+	for i, contentType := range m.ContentTypes {
+		m.ContentTypes[i] = strings.ToLower(contentType)
+	}
+	m.encoders = make(map[string]*encoderPool, len(m.Encodings))
+	for _, encoding := range m.Encodings {
+		m.encoders[encoding] = newEncoderPool(encoding, m.Level)
+	}
+}
+
+// handle implements RequestHandler.
+func (m *compress) handle(next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	if httpheaders.IsWebsocket(r.Header) {
+		next(w, r)
+		return
+	}
+	accepted := m.negotiate(r.Header.Get("Accept-Encoding"))
+	if len(accepted) > 0 && m.Precompressed && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		if _, ok := routes.TryGetRoute(r).(types.FileServerRoute); ok {
+			r = r.WithContext(context.WithValue(r.Context(), precompressedKey{}, accepted))
+		}
+	}
+
+	cw := newCompressWriter(w, m, r, accepted)
+	defer cw.Close()
+	next(cw, r)
+}
+
+// negotiate returns the enabled encodings accepted by the client, in order of
+// the client's preference (q-value), then the server's preference (RFC 9110 12.5.3).
+func (m *compress) negotiate(acceptEncoding string) []string {
+	if acceptEncoding == "" {
+		return nil
+	}
+	qvalues := parseAcceptEncoding(acceptEncoding)
+	accepted := make([]string, 0, len(m.Encodings))
+	for _, encoding := range m.Encodings {
+		if qvalueOf(qvalues, encoding) > 0 {
+			accepted = append(accepted, encoding)
+		}
+	}
+	slices.SortStableFunc(accepted, func(a, b string) int {
+		qa, qb := qvalueOf(qvalues, a), qvalueOf(qvalues, b)
+		switch {
+		case qa > qb:
+			return -1
+		case qa < qb:
+			return 1
+		}
+		return 0
+	})
+	return accepted
+}
+
+// isCompressible reports whether responses of contentType should be compressed.
+func (m *compress) isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return false
+	}
+	for _, pattern := range m.ContentTypes {
+		if ok, _ := path.Match(pattern, mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAcceptEncoding parses the Accept-Encoding header into q-values by content coding.
+func parseAcceptEncoding(acceptEncoding string) map[string]float64 {
+	qvalues := make(map[string]float64)
+	for coding := range strings.SplitSeq(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(coding, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				continue
+			}
+			q = parsed
+		}
+		if coding == "x-gzip" {
+			coding = encodingGzip
+		}
+		qvalues[coding] = q
+	}
+	return qvalues
+}
+
+// qvalueOf returns the q-value of coding, or of `*` if coding is not listed.
+func qvalueOf(qvalues map[string]float64, coding string) float64 {
+	if q, ok := qvalues[coding]; ok {
+		return q
+	}
+	return qvalues["*"]
+}
+
+// ServePrecompressed serves the precompressed sibling of the file name (e.g. `name.br`) if r passed through
+// a compress middleware with precompressed enabled, and the client accepts its encoding.
+//
+// It reports whether the response is served.
+func ServePrecompressed(w http.ResponseWriter, r *http.Request, name string) bool {
+	accepted, _ := r.Context().Value(precompressedKey{}).([]string)
+	if len(accepted) == 0 {
+		return false
+	}
+	stat, err := os.Stat(name)
+	if err != nil || !stat.Mode().IsRegular() {
+		return false
+	}
+	// the content type of the compressed file cannot be sniffed
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		return false
+	}
+	for _, encoding := range accepted {
+		f, err := os.Open(name + precompressedExts[encoding])
+		if err != nil {
+			continue
+		}
+		stat, err := f.Stat()
+		if err != nil || !stat.Mode().IsRegular() {
+			f.Close()
+			continue
+		}
+		h := w.Header()
+		h.Set(httpheaders.HeaderContentType, contentType)
+		h.Set("Content-Encoding", encoding)
+		h.Add("Vary", "Accept-Encoding")
+		http.ServeContent(w, r, name, stat.ModTime(), f)
+		f.Close()
+		return true
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"io"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoder is a reusable compressor.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoderPool pools encoders of one content coding and level.
+type encoderPool struct {
+	pool sync.Pool
+}
+
+func newEncoderPool(encoding, level string) *encoderPool {
+	var newEncoder func() encoder
+	switch encoding {
+	case encodingZstd:
+		zstdLevel := zstd.SpeedDefault
+		switch level {
+		case "fastest":
+			zstdLevel = zstd.SpeedFastest
+		case "best":
+			zstdLevel = zstd.SpeedBestCompression
+		}
+		newEncoder = func() encoder {
+			// never fails with valid options
+			enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstdLevel), zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+			return enc
+		}
+	case encodingBr:
+		brLevel := brotli.DefaultCompression
+		switch level {
+		case "fastest":
+			brLevel = brotli.BestSpeed
+		case "best":
+			brLevel = brotli.BestCompression
+		}
+		newEncoder = func() encoder {
+			return brotli.NewWriterLevel(nil, brLevel)
+		}
+	default:
+		gzipLevel := gzip.DefaultCompression
+		switch level {
+		case "fastest":
+			gzipLevel = gzip.BestSpeed
+		case "best":
+			gzipLevel = gzip.BestCompression
+		}
+		newEncoder = func() encoder {
+			// never fails with a valid level
+			enc, _ := gzip.NewWriterLevel(nil, gzipLevel)
+			return enc
+		}
+	}
+	return &encoderPool{pool: sync.Pool{New: func() any { return newEncoder() }}}
+}
+
+// get returns an encoder writing to w.
+func (p *encoderPool) get(w io.Writer) encoder {
+	enc := p.pool.Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+// put returns a closed encoder to the pool.
+func (p *encoderPool) put(enc encoder) {
+	enc.Reset(nil)
+	p.pool.Put(enc)
+}
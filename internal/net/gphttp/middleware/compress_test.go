@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yusing/godoxy/internal/route/routes"
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+type fakeFileServerRoute struct {
+	types.FileServerRoute
+}
+
+func serveCompress(t *testing.T, opts OptionsRaw, r *http.Request, next http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	mid, err := Compress.New(opts)
+	expect.NoError(t, err)
+	rec := httptest.NewRecorder()
+	mid.ServeHTTP(next, rec, r)
+	return rec
+}
+
+func gunzip(t *testing.T, body io.Reader) string {
+	t.Helper()
+	zr, err := gzip.NewReader(body)
+	expect.NoError(t, err)
+	b, err := io.ReadAll(zr)
+	expect.NoError(t, err)
+	return string(b)
+}
+
+func TestCompressNegotiate(t *testing.T) {
+	mid, err := Compress.New(nil)
+	expect.NoError(t, err)
+	m := mid.impl.(*compress)
+
+	tests := []struct {
+		acceptEncoding string
+		want           []string
+	}{
+		{"", nil},
+		{"identity", []string{}},
+		{"gzip", []string{"gzip"}},
+		{"gzip, deflate, br, zstd", []string{"zstd", "br", "gzip"}},
+		{"gzip;q=1.0, br;q=0.8", []string{"gzip", "br"}},
+		{"br;q=0, *", []string{"zstd", "gzip"}},
+		{"x-gzip", []string{"gzip"}},
+		{"*;q=0.5, gzip", []string{"gzip", "zstd", "br"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			expect.Equal(t, m.negotiate(tt.acceptEncoding), tt.want)
+		})
+	}
+}
+
+func TestCompressGzip(t *testing.T) {
+	body := strings.Repeat("hello world ", 200)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := serveCompress(t, nil, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Length", "2400")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(body))
+	})
+
+	expect.Equal(t, rec.Header().Get("Content-Encoding"), "gzip")
+	expect.Equal(t, rec.Header().Get("Vary"), "Accept-Encoding")
+	expect.Equal(t, rec.Header().Get("Content-Length"), "")
+	expect.Equal(t, rec.Header().Get("ETag"), `W/"v1"`)
+	expect.True(t, rec.Body.Len() < len(body))
+	expect.Equal(t, gunzip(t, rec.Body), body)
+}
+
+func TestCompressSkip(t *testing.T) {
+	large := strings.Repeat("x", 2048)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		header         http.Header
+		body           string
+		vary           bool
+	}{
+		{"not accepted", "", http.Header{"Content-Type": {"text/plain"}}, large, true},
+		{"too small", "gzip", http.Header{"Content-Type": {"text/plain"}}, "small", true},
+		{"content type", "gzip", http.Header{"Content-Type": {"image/png"}}, large, false},
+		{"no content type", "gzip", http.Header{}, large, false},
+		{"already encoded", "gzip", http.Header{"Content-Type": {"text/plain"}, "Content-Encoding": {"br"}}, large, false},
+		{"no-transform", "gzip", http.Header{"Content-Type": {"text/plain"}, "Cache-Control": {"no-transform"}}, large, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := serveCompress(t, nil, req, func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header()[k] = v
+				}
+				_, _ = w.Write([]byte(tt.body))
+			})
+			expect.Equal(t, rec.Header().Get("Content-Encoding"), tt.header.Get("Content-Encoding"))
+			expect.Equal(t, rec.Header().Get("Vary") != "", tt.vary)
+			expect.Equal(t, rec.Body.String(), tt.body)
+		})
+	}
+}
+
+func TestCompressStreaming(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := serveCompress(t, OptionsRaw{"encodings": []string{"gzip"}}, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("data: 2\n\n"))
+	})
+
+	expect.True(t, rec.Flushed)
+	expect.Equal(t, rec.Header().Get("Content-Encoding"), "gzip")
+	expect.Equal(t, gunzip(t, rec.Body), "data: 1\n\ndata: 2\n\n")
+}
+
+func TestServePrecompressed(t *testing.T) {
+	dir := t.TempDir()
+	expect.NoError(t, os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1)"), 0o644))
+	expect.NoError(t, os.WriteFile(filepath.Join(dir, "app.js.br"), []byte("brotli"), 0o644))
+	expect.NoError(t, os.WriteFile(filepath.Join(dir, "app.js.gz"), []byte("gzip"), 0o644))
+
+	next := func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Join(dir, filepath.FromSlash(r.URL.Path))
+		if ServePrecompressed(w, r, name) {
+			return
+		}
+		http.ServeFile(w, r, name)
+	}
+	serve := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		return serveCompress(t, nil, routes.WithRouteContext(req, fakeFileServerRoute{}), next)
+	}
+
+	rec := serve("gzip, br")
+	expect.Equal(t, rec.Header().Get("Content-Encoding"), "br")
+	expect.Equal(t, rec.Header().Get("Content-Type"), "text/javascript; charset=utf-8")
+	expect.Equal(t, rec.Header().Get("Vary"), "Accept-Encoding")
+	expect.Equal(t, rec.Body.String(), "brotli")
+
+	rec = serve("gzip")
+	expect.Equal(t, rec.Header().Get("Content-Encoding"), "gzip")
+	expect.Equal(t, rec.Body.String(), "gzip")
+
+	rec = serve("")
+	expect.Equal(t, rec.Header().Get("Content-Encoding"), "")
+	expect.Equal(t, rec.Body.String(), "console.log(1)")
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yusing/goutils/http/httpheaders"
+)
+
+// compressWriter holds back the response header until it is decided whether to compress the body.
+//
+// The decision is made when the header is written if Content-Length is known, otherwise when min_size
+// bytes are buffered, the handler flushes (e.g. server-sent events) or returns.
+type compressWriter struct {
+	rw http.ResponseWriter
+	m  *compress
+	r  *http.Request
+
+	// accepted are the encodings accepted by the client in order of preference.
+	accepted []string
+
+	status  int
+	decided bool
+	buf     []byte
+
+	enc  encoder
+	pool *encoderPool
+}
+
+func newCompressWriter(rw http.ResponseWriter, m *compress, r *http.Request, accepted []string) *compressWriter {
+	return &compressWriter{
+		rw:       rw,
+		m:        m,
+		r:        r,
+		accepted: accepted,
+	}
+}
+
+func (w *compressWriter) Header() http.Header {
+	return w.rw.Header()
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+	if code < http.StatusOK { // informational responses, e.g. 103 Early Hints
+		w.rw.WriteHeader(code)
+		return
+	}
+	w.status = code
+	if !w.isEligible() {
+		w.decide(false)
+		return
+	}
+	if contentLength := w.Header().Get(httpheaders.HeaderContentLength); contentLength != "" {
+		n, err := strconv.ParseInt(contentLength, 10, 64)
+		w.decide(err == nil && n >= int64(w.m.MinSize))
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) >= w.m.MinSize {
+			w.decide(true)
+		}
+		return len(b), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.rw.Write(b)
+}
+
+func (w *compressWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		// streaming response, compress it regardless of the size
+		w.decide(true)
+	}
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	}
+	_ = http.NewResponseController(w.rw).Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.rw).Hijack()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.rw
+}
+
+// Close writes the buffered body if the response is not decided yet, and finishes the compressed stream.
+func (w *compressWriter) Close() {
+	if w.status == 0 { // nothing written
+		return
+	}
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.enc != nil {
+		_ = w.enc.Close()
+		w.pool.put(w.enc)
+		w.enc = nil
+	}
+}
+
+// isEligible reports whether the response can be compressed, and adds Vary if the
+// representation depends on Accept-Encoding.
+func (w *compressWriter) isEligible() bool {
+	switch w.status {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || !w.m.isCompressible(h.Get(httpheaders.HeaderContentType)) {
+		return false
+	}
+	if !hasHeaderToken(h, "Vary", "Accept-Encoding") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if len(w.accepted) == 0 || w.r.Method == http.MethodHead || hasHeaderToken(h, httpheaders.HeaderCacheControl, "no-transform") {
+		return false
+	}
+	return true
+}
+
+// decide writes the header with the compression headers if compress is true, and the buffered body.
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	if compress {
+		encoding := w.accepted[0]
+		h := w.Header()
+		h.Set("Content-Encoding", encoding)
+		h.Del(httpheaders.HeaderContentLength)
+		h.Del("Accept-Ranges")
+		// the compressed representation is not byte-for-byte identical (RFC 9110 8.8.3)
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.pool = w.m.encoders[encoding]
+		w.enc = w.pool.get(w.rw)
+	}
+	w.rw.WriteHeader(w.status)
+	if len(w.buf) > 0 {
+		if w.enc != nil {
+			_, _ = w.enc.Write(w.buf)
+		} else {
+			_, _ = w.rw.Write(w.buf)
+		}
+		w.buf = nil
+	}
+}
+
+// hasHeaderToken reports whether a comma-separated header contains token, case-insensitively.
+func hasHeaderToken(h http.Header, key, token string) bool {
+	for _, v := range h.Values(key) {
+		for t := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
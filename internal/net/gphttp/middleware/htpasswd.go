@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gperr "github.com/yusing/goutils/errs"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type (
+	htpasswdUser struct {
+		// hash is the hash as it appears in the htpasswd file,
+		// used to invalidate sessions when the password changes.
+		hash   string
+		verify func(password []byte) bool
+	}
+	htpasswdUsers map[string]*htpasswdUser
+)
+
+var ErrUnsupportedPasswordHash = errors.New("unsupported password hash")
+
+// parseHtpasswd parses htpasswd formatted lines (user:hash).
+//
+// Empty lines and lines starting with # are ignored.
+//
+// Supported hashes:
+//   - bcrypt ($2y$, $2a$, $2b$), htpasswd -B
+//   - argon2id and argon2i in PHC string format ($argon2id$v=19$m=...,t=...,p=...$salt$hash)
+//   - SHA-1 ({SHA}), htpasswd -s
+//   - Apache MD5 ($apr1$), htpasswd -m (the default of htpasswd)
+//   - MD5-crypt ($1$)
+func parseHtpasswd(data []byte) (htpasswdUsers, error) {
+	users := make(htpasswdUsers)
+	var errs gperr.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || username == "" || hash == "" {
+			errs.Add(gperr.PrependSubject(errors.New("invalid htpasswd line, expect user:hash"), "line "+strconv.Itoa(lineNum)))
+			continue
+		}
+		verify, err := newPasswordVerifier(hash)
+		if err != nil {
+			errs.Add(gperr.PrependSubject(err, "line "+strconv.Itoa(lineNum)))
+			continue
+		}
+		users[username] = &htpasswdUser{hash: hash, verify: verify}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := errs.Error(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func newPasswordVerifier(hash string) (func(password []byte) bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2y$"), strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"):
+		hashed := []byte(hash)
+		if _, err := bcrypt.Cost(hashed); err != nil {
+			return nil, err
+		}
+		return func(password []byte) bool {
+			return bcrypt.CompareHashAndPassword(hashed, password) == nil
+		}, nil
+	case strings.HasPrefix(hash, "$argon2id$"), strings.HasPrefix(hash, "$argon2i$"):
+		return newArgon2Verifier(hash)
+	case strings.HasPrefix(hash, "{SHA}"):
+		expected, err := base64.StdEncoding.DecodeString(hash[len("{SHA}"):])
+		if err != nil || len(expected) != sha1.Size {
+			return nil, fmt.Errorf("%w: invalid SHA hash", ErrUnsupportedPasswordHash)
+		}
+		return func(password []byte) bool {
+			sum := sha1.Sum(password)
+			return subtle.ConstantTimeCompare(sum[:], expected) == 1
+		}, nil
+	case strings.HasPrefix(hash, "$apr1$"), strings.HasPrefix(hash, "$1$"):
+		return newMD5CryptVerifier(hash)
+	}
+	return nil, fmt.Errorf("%w: plain text and crypt(3) passwords are not allowed", ErrUnsupportedPasswordHash)
+}
+
+// newArgon2Verifier parses $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>.
+func newArgon2Verifier(hash string) (func(password []byte) bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("%w: invalid argon2 hash", ErrUnsupportedPasswordHash)
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("%w: unsupported argon2 version %q", ErrUnsupportedPasswordHash, parts[2])
+	}
+	var memory, iterations uint32
+	var parallelism uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return nil, fmt.Errorf("%w: invalid argon2 parameters %q", ErrUnsupportedPasswordHash, parts[3])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid argon2 salt", ErrUnsupportedPasswordHash)
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(expected) == 0 {
+		return nil, fmt.Errorf("%w: invalid argon2 hash", ErrUnsupportedPasswordHash)
+	}
+	if iterations == 0 || parallelism == 0 {
+		return nil, fmt.Errorf("%w: invalid argon2 parameters %q", ErrUnsupportedPasswordHash, parts[3])
+	}
+	keyFunc := argon2.IDKey
+	if parts[1] == "argon2i" {
+		keyFunc = argon2.Key
+	}
+	return func(password []byte) bool {
+		key := keyFunc(password, salt, iterations, memory, parallelism, uint32(len(expected)))
+		return subtle.ConstantTimeCompare(key, expected) == 1
+	}, nil
+}
+
+// newMD5CryptVerifier parses $apr1$<salt>$<hash> and $1$<salt>$<hash>.
+func newMD5CryptVerifier(hash string) (func(password []byte) bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || len(parts[2]) > 8 || len(parts[3]) != 22 {
+		return nil, fmt.Errorf("%w: invalid MD5 hash", ErrUnsupportedPasswordHash)
+	}
+	magic := []byte("$" + parts[1] + "$")
+	salt := []byte(parts[2])
+	expected := []byte(parts[3])
+	return func(password []byte) bool {
+		return subtle.ConstantTimeCompare(md5Crypt(password, salt, magic), expected) == 1
+	}, nil
+}
+
+const cryptItoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// md5Crypt implements the MD5 based crypt algorithm used by $1$ and $apr1$ hashes,
+// returning the encoded hash without the magic and salt.
+func md5Crypt(password, salt, magic []byte) []byte {
+	d := md5.New()
+	d.Write(password)
+	d.Write(magic)
+	d.Write(salt)
+
+	d2 := md5.New()
+	d2.Write(password)
+	d2.Write(salt)
+	d2.Write(password)
+	mixin := d2.Sum(nil)
+	for i := len(password); i > 0; i -= md5.Size {
+		d.Write(mixin[:min(i, md5.Size)])
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(password[:1])
+		}
+	}
+	final := d.Sum(nil)
+
+	for i := range 1000 {
+		d3 := md5.New()
+		if i&1 == 1 {
+			d3.Write(password)
+		} else {
+			d3.Write(final)
+		}
+		if i%3 != 0 {
+			d3.Write(salt)
+		}
+		if i%7 != 0 {
+			d3.Write(password)
+		}
+		if i&1 == 1 {
+			d3.Write(final)
+		} else {
+			d3.Write(password)
+		}
+		final = d3.Sum(nil)
+	}
+
+	out := make([]byte, 0, 22)
+	encode := func(a, b, c byte, n int) {
+		v := uint(a)<<16 | uint(b)<<8 | uint(c)
+		for range n {
+			out = append(out, cryptItoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	encode(final[0], final[6], final[12], 4)
+	encode(final[1], final[7], final[13], 4)
+	encode(final[2], final[8], final[14], 4)
+	encode(final[3], final[9], final[15], 4)
+	encode(final[4], final[10], final[5], 4)
+	encode(0, 0, final[11], 2)
+	return out
+}
@@ -0,0 +1,311 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/golang-jwt/jwt/v5"
+	gperr "github.com/yusing/goutils/errs"
+	httpevents "github.com/yusing/goutils/events/http"
+)
+
+type (
+	jwtMiddleware struct {
+		JWTOpts
+
+		secret     []byte
+		publicKeys []jwt.VerificationKey
+		jwks       *jwks
+		parser     *jwt.Parser
+	}
+	JWTOpts struct {
+		// JWKSURL is the URL of the JSON Web Key Set to verify tokens with.
+		JWKSURL string `json:"jwks_url" validate:"omitempty,url"`
+		// JWKSRefreshInterval is the interval to refresh the JSON Web Key Set.
+		JWKSRefreshInterval time.Duration `json:"jwks_refresh_interval" validate:"gte=0"`
+		// PublicKeys are PEM encoded RSA, ECDSA or Ed25519 public keys or certificates to verify tokens with.
+		PublicKeys []string `json:"public_keys"`
+		// Secret is the HMAC secret to verify HS256, HS384 and HS512 tokens with.
+		Secret string `json:"secret"`
+		// Algorithms are the allowed signing algorithms, defaults to all algorithms of the configured keys.
+		Algorithms []string `json:"algorithms"`
+		// Issuer is the expected iss claim.
+		Issuer string `json:"issuer"`
+		// Audience is the expected aud claim, any of them is accepted.
+		Audience []string `json:"audience"`
+		// Leeway is the allowed clock skew when validating exp, nbf and iat.
+		Leeway time.Duration `json:"leeway" validate:"gte=0"`
+		// RequiredClaims are claims the token must have, with allowed values (any of them), or any value if empty.
+		RequiredClaims map[string][]string `json:"required_claims"`
+		// ForwardClaims maps claims to request headers forwarded to the upstream.
+		ForwardClaims map[string]string `json:"forward_claims"`
+	}
+)
+
+var (
+	JWT         = NewMiddleware[jwtMiddleware]()
+	jwtDefaults = JWTOpts{
+		JWKSRefreshInterval: time.Hour,
+	}
+
+	jwtHMACAlgorithms       = []string{"HS256", "HS384", "HS512"}
+	jwtAsymmetricAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+)
+
+var (
+	ErrMissingJWTKeys     = errors.New("jwks_url, public_keys or secret must be specified")
+	ErrMissingBearerToken = errors.New("missing bearer token")
+	ErrNoMatchingJWTKey   = errors.New("no matching key")
+	ErrMissingClaim       = errors.New("missing required claim")
+	ErrClaimNotAllowed    = errors.New("claim value not allowed")
+)
+
+// setup implements MiddlewareWithSetup.
+func (m *jwtMiddleware) setup() {
+	m.JWTOpts = jwtDefaults
+}
+
+// finalize implements MiddlewareFinalizerWithError.
+func (m *jwtMiddleware) finalize() error {
+	if m.JWKSURL == "" && len(m.PublicKeys) == 0 && m.Secret == "" {
+		return ErrMissingJWTKeys
+	}
+
+	var errs gperr.Builder
+	for i, key := range m.PublicKeys {
+		publicKey, err := parseJWTPublicKey([]byte(key))
+		if err != nil {
+			errs.Add(gperr.PrependSubject(err, "public_keys."+strconv.Itoa(i)))
+			continue
+		}
+		m.publicKeys = append(m.publicKeys, publicKey)
+	}
+	if m.Secret != "" {
+		m.secret = []byte(m.Secret)
+	}
+	if m.JWKSURL != "" {
+		m.jwks = newJWKS(m.JWKSURL, m.JWKSRefreshInterval)
+	}
+
+	algorithms := m.Algorithms
+	if len(algorithms) == 0 {
+		if m.secret != nil {
+			algorithms = append(algorithms, jwtHMACAlgorithms...)
+		}
+		if m.jwks != nil || len(m.PublicKeys) > 0 {
+			algorithms = append(algorithms, jwtAsymmetricAlgorithms...)
+		}
+	}
+	for _, alg := range algorithms {
+		if jwt.GetSigningMethod(alg) == nil || alg == jwt.SigningMethodNone.Alg() {
+			errs.Add(gperr.PrependSubject(errors.New("unsupported algorithm"), alg))
+		}
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(m.Leeway),
+	}
+	if m.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(m.Issuer))
+	}
+	if len(m.Audience) > 0 {
+		opts = append(opts, jwt.WithAudience(m.Audience...))
+	}
+	m.parser = jwt.NewParser(opts...)
+	return errs.Error()
+}
+
+// before implements RequestModifier.
+func (m *jwtMiddleware) before(w http.ResponseWriter, r *http.Request) (proceed bool) {
+	// never trust the forwarded claim headers from the client
+	for _, header := range m.ForwardClaims {
+		r.Header.Del(header)
+	}
+
+	tokenString, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, ErrMissingBearerToken.Error(), http.StatusUnauthorized)
+		return false
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := m.parser.ParseWithClaims(tokenString, claims, m.keyFunc); err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		httpevents.Blocked(r, "JWT", err.Error())
+		return false
+	}
+
+	if err := m.checkRequiredClaims(claims); err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		httpevents.Blocked(r, "JWT", err.Error())
+		return false
+	}
+
+	for claim, header := range m.ForwardClaims {
+		if value, ok := lookupClaim(claims, claim); ok {
+			r.Header.Set(header, claimString(value))
+		}
+	}
+	return true
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// keyFunc implements jwt.Keyfunc.
+//
+// HMAC tokens are verified with the secret, others with the static public keys
+// and the JWKS keys matching the kid and alg of the token.
+func (m *jwtMiddleware) keyFunc(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if m.secret == nil {
+			return nil, ErrNoMatchingJWTKey
+		}
+		return m.secret, nil
+	}
+
+	keys := slices.Clone(m.publicKeys)
+	if m.jwks != nil {
+		kid, _ := token.Header["kid"].(string)
+		jwkKeys, err := m.jwks.Keys(kid)
+		if err != nil && len(keys) == 0 {
+			return nil, fmt.Errorf("%w: %w", ErrNoMatchingJWTKey, err)
+		}
+		alg := token.Method.Alg()
+		for _, key := range jwkKeys {
+			if kid != "" && key.KeyID != kid {
+				continue
+			}
+			if key.Algorithm != "" && key.Algorithm != alg {
+				continue
+			}
+			keys = append(keys, key.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoMatchingJWTKey
+	}
+	return jwt.VerificationKeySet{Keys: keys}, nil
+}
+
+func (m *jwtMiddleware) checkRequiredClaims(claims jwt.MapClaims) error {
+	for claim, allowed := range m.RequiredClaims {
+		value, ok := lookupClaim(claims, claim)
+		if !ok {
+			return gperr.PrependSubject(ErrMissingClaim, claim)
+		}
+		if len(allowed) > 0 && !claimContainsAny(value, allowed) {
+			return gperr.PrependSubject(ErrClaimNotAllowed, claim)
+		}
+	}
+	return nil
+}
+
+// lookupClaim returns the claim with the given name,
+// or the nested claim for dot separated names (e.g. realm_access.roles).
+func lookupClaim(claims jwt.MapClaims, name string) (any, bool) {
+	if value, ok := claims[name]; ok {
+		return value, true
+	}
+	var current any = map[string]any(claims)
+	for part := range strings.SplitSeq(name, ".") {
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// claimContainsAny returns true if the claim value, any of its elements for arrays,
+// or any of its space separated values for strings (e.g. scope), is allowed.
+func claimContainsAny(value any, allowed []string) bool {
+	switch v := value.(type) {
+	case string:
+		if slices.Contains(allowed, v) {
+			return true
+		}
+		for field := range strings.FieldsSeq(v) {
+			if slices.Contains(allowed, field) {
+				return true
+			}
+		}
+		return false
+	case []any:
+		for _, elem := range v {
+			if claimContainsAny(elem, allowed) {
+				return true
+			}
+		}
+		return false
+	default:
+		return slices.Contains(allowed, claimString(v))
+	}
+}
+
+// claimString formats the claim value as a header value,
+// arrays are joined with commas and objects are encoded as JSON.
+func claimString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		values := make([]string, len(v))
+		for i, elem := range v {
+			values[i] = claimString(elem)
+		}
+		return strings.Join(values, ",")
+	default:
+		data, err := sonic.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+}
+
+// parseJWTPublicKey parses a PEM encoded public key or certificate.
+func parseJWTPublicKey(data []byte) (jwt.VerificationKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// jwks is a JSON Web Key Set fetched from a URL, refreshed every refreshInterval
+// and when a token is signed by an unknown key ID.
+type jwks struct {
+	url             string
+	refreshInterval time.Duration
+	client          *http.Client
+
+	mu          sync.Mutex
+	keys        []jose.JSONWebKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	err         error
+	refreshing  chan struct{} // closed when the ongoing refresh is done, nil if none
+}
+
+const jwksMaxSize = 1 << 20
+
+// jwksMinRefreshInterval limits how often the key set is fetched,
+// e.g. when tokens have unknown key IDs or the URL is unavailable.
+var jwksMinRefreshInterval = time.Minute
+
+func newJWKS(url string, refreshInterval time.Duration) *jwks {
+	return &jwks{
+		url:             url,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Keys returns the keys of the set, refreshing it if needed.
+//
+// The set is fetched without holding the lock, and only by one caller at a time. Other callers get the
+// previously fetched keys meanwhile, or wait for the first fetch. If the refresh fails, the previously
+// fetched keys are returned.
+func (s *jwks) Keys(kid string) ([]jose.JSONWebKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	needRefresh := s.keys == nil || now.Sub(s.fetchedAt) >= s.refreshInterval || (kid != "" && !s.hasKeyID(kid))
+	switch {
+	case needRefresh && s.refreshing == nil && now.Sub(s.attemptedAt) >= jwksMinRefreshInterval:
+		s.attemptedAt = now
+		done := make(chan struct{})
+		s.refreshing = done
+
+		s.mu.Unlock()
+		keys, err := s.fetch()
+		s.mu.Lock()
+
+		if err == nil {
+			s.keys, s.fetchedAt = keys, now
+		}
+		s.err = err
+		s.refreshing = nil
+		close(done)
+	case s.keys == nil && s.refreshing != nil:
+		done := s.refreshing
+		s.mu.Unlock()
+		<-done
+		s.mu.Lock()
+	}
+	if s.keys == nil {
+		return nil, s.err
+	}
+	return s.keys, nil
+}
+
+func (s *jwks) hasKeyID(kid string) bool {
+	for _, key := range s.keys {
+		if key.KeyID == kid {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *jwks) fetch() ([]jose.JSONWebKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, jwksMaxSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var set jose.JSONWebKeySet
+	if err := sonic.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	// only public signing keys are used
+	keys := make([]jose.JSONWebKey, 0, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if !key.IsPublic() {
+			key = key.Public()
+		}
+		if key.Key == nil || !key.Valid() {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
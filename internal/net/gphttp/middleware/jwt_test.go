@@ -0,0 +1,260 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	expect "github.com/yusing/goutils/testing"
+)
+
+const testJWTSecret = "test-secret-at-least-32-bytes-long"
+
+func signJWT(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	expect.NoError(t, err)
+	return signed
+}
+
+func validJWTClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss": "https://issuer.example.com",
+		"aud": "api",
+		"sub": "service-a",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func serveJWT(mid *Middleware, token string, headers ...string) (*httptest.ResponseRecorder, http.Header) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	var upstreamHeaders http.Header
+	rec := httptest.NewRecorder()
+	mid.ServeHTTP(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeaders = r.Header
+		w.WriteHeader(http.StatusOK)
+	}, rec, req)
+	return rec, upstreamHeaders
+}
+
+func TestJWTSecret(t *testing.T) {
+	mid, err := JWT.New(OptionsRaw{
+		"secret":   testJWTSecret,
+		"issuer":   "https://issuer.example.com",
+		"audience": []string{"api", "api2"},
+		"required_claims": map[string]any{
+			"scope": []string{"read"},
+			"sub":   []string{},
+		},
+		"forward_claims": map[string]any{
+			"sub":                "X-User-ID",
+			"realm_access.roles": "X-User-Roles",
+		},
+	})
+	expect.NoError(t, err)
+
+	sign := func(modify func(claims jwt.MapClaims)) string {
+		claims := validJWTClaims()
+		claims["scope"] = "read write"
+		modify(claims)
+		return signJWT(t, jwt.SigningMethodHS256, []byte(testJWTSecret), "", claims)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		token := sign(func(claims jwt.MapClaims) {
+			claims["realm_access"] = map[string]any{"roles": []any{"admin", "user"}}
+		})
+		rec, headers := serveJWT(mid, token, "X-User-ID", "spoofed")
+		expect.Equal(t, rec.Code, http.StatusOK)
+		expect.Equal(t, headers.Get("X-User-ID"), "service-a")
+		expect.Equal(t, headers.Get("X-User-Roles"), "admin,user")
+	})
+	t.Run("spoofed headers are removed", func(t *testing.T) {
+		token := sign(func(claims jwt.MapClaims) {})
+		rec, headers := serveJWT(mid, token, "X-User-Roles", "admin")
+		expect.Equal(t, rec.Code, http.StatusOK)
+		expect.Equal(t, headers.Get("X-User-Roles"), "")
+	})
+	t.Run("missing token", func(t *testing.T) {
+		rec, _ := serveJWT(mid, "")
+		expect.Equal(t, rec.Code, http.StatusUnauthorized)
+		expect.Equal(t, rec.Header().Get("WWW-Authenticate"), "Bearer")
+	})
+	t.Run("invalid claims", func(t *testing.T) {
+		tests := map[string]func(claims jwt.MapClaims){
+			"expired":          func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+			"missing exp":      func(claims jwt.MapClaims) { delete(claims, "exp") },
+			"not before":       func(claims jwt.MapClaims) { claims["nbf"] = time.Now().Add(time.Hour).Unix() },
+			"wrong issuer":     func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+			"wrong audience":   func(claims jwt.MapClaims) { claims["aud"] = []string{"other"} },
+			"missing audience": func(claims jwt.MapClaims) { delete(claims, "aud") },
+		}
+		for name, modify := range tests {
+			t.Run(name, func(t *testing.T) {
+				rec, _ := serveJWT(mid, sign(modify))
+				expect.Equal(t, rec.Code, http.StatusUnauthorized)
+				expect.Equal(t, rec.Header().Get("WWW-Authenticate"), `Bearer error="invalid_token"`)
+			})
+		}
+	})
+	t.Run("required claims", func(t *testing.T) {
+		rec, _ := serveJWT(mid, sign(func(claims jwt.MapClaims) { claims["scope"] = "write" }))
+		expect.Equal(t, rec.Code, http.StatusForbidden)
+		rec, _ = serveJWT(mid, sign(func(claims jwt.MapClaims) { delete(claims, "sub") }))
+		expect.Equal(t, rec.Code, http.StatusForbidden)
+		rec, _ = serveJWT(mid, sign(func(claims jwt.MapClaims) { claims["scope"] = []any{"write", "read"} }))
+		expect.Equal(t, rec.Code, http.StatusOK)
+	})
+	t.Run("wrong secret", func(t *testing.T) {
+		token := signJWT(t, jwt.SigningMethodHS256, []byte("another-secret-at-least-32-bytes"), "", validJWTClaims())
+		rec, _ := serveJWT(mid, token)
+		expect.Equal(t, rec.Code, http.StatusUnauthorized)
+	})
+	t.Run("none algorithm", func(t *testing.T) {
+		token := signJWT(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", validJWTClaims())
+		rec, _ := serveJWT(mid, token)
+		expect.Equal(t, rec.Code, http.StatusUnauthorized)
+	})
+}
+
+func TestJWTPublicKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	expect.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	expect.NoError(t, err)
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	mid, err := JWT.New(OptionsRaw{
+		"public_keys": []string{string(publicKeyPEM)},
+	})
+	expect.NoError(t, err)
+
+	rec, _ := serveJWT(mid, signJWT(t, jwt.SigningMethodRS256, rsaKey, "", validJWTClaims()))
+	expect.Equal(t, rec.Code, http.StatusOK)
+
+	// HMAC signed with the public key must not be accepted
+	rec, _ = serveJWT(mid, signJWT(t, jwt.SigningMethodHS256, publicKeyPEM, "", validJWTClaims()))
+	expect.Equal(t, rec.Code, http.StatusUnauthorized)
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := JWT.New(OptionsRaw{})
+		expect.ErrorIs(t, ErrMissingJWTKeys, err)
+		_, err = JWT.New(OptionsRaw{"public_keys": []string{"not a key"}})
+		expect.HasError(t, err)
+		_, err = JWT.New(OptionsRaw{"secret": testJWTSecret, "algorithms": []string{"none"}})
+		expect.HasError(t, err)
+	})
+}
+
+func TestJWTJWKS(t *testing.T) {
+	jwksMinRefreshInterval = 0
+	t.Cleanup(func() {
+		jwksMinRefreshInterval = time.Minute
+	})
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	expect.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	expect.NoError(t, err)
+
+	ecJWK := jose.JSONWebKey{Key: &ecKey.PublicKey, KeyID: "ec", Algorithm: "ES256", Use: "sig"}
+	edJWK := jose.JSONWebKey{Key: edPub, KeyID: "ed", Algorithm: "EdDSA", Use: "sig"}
+
+	var keySet atomic.Pointer[jose.JSONWebKeySet]
+	keySet.Store(&jose.JSONWebKeySet{Keys: []jose.JSONWebKey{ecJWK}})
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		data, err := sonic.Marshal(keySet.Load())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	mid, err := JWT.New(OptionsRaw{"jwks_url": srv.URL})
+	expect.NoError(t, err)
+
+	rec, _ := serveJWT(mid, signJWT(t, jwt.SigningMethodES256, ecKey, "ec", validJWTClaims()))
+	expect.Equal(t, rec.Code, http.StatusOK)
+	rec, _ = serveJWT(mid, signJWT(t, jwt.SigningMethodES256, ecKey, "ec", validJWTClaims()))
+	expect.Equal(t, rec.Code, http.StatusOK)
+	expect.Equal(t, fetches.Load(), int32(1))
+
+	// rotated key is fetched on unknown key ID
+	keySet.Store(&jose.JSONWebKeySet{Keys: []jose.JSONWebKey{ecJWK, edJWK}})
+	rec, _ = serveJWT(mid, signJWT(t, jwt.SigningMethodEdDSA, edKey, "ed", validJWTClaims()))
+	expect.Equal(t, rec.Code, http.StatusOK)
+	expect.Equal(t, fetches.Load(), int32(2))
+
+	// key ID and algorithm must match the key
+	rec, _ = serveJWT(mid, signJWT(t, jwt.SigningMethodES256, ecKey, "ed", validJWTClaims()))
+	expect.Equal(t, rec.Code, http.StatusUnauthorized)
+}
+
+func TestJWKSRefreshUnlocked(t *testing.T) {
+	jwksMinRefreshInterval = 0
+	t.Cleanup(func() {
+		jwksMinRefreshInterval = time.Minute
+	})
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	expect.NoError(t, err)
+	data, err := sonic.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &ecKey.PublicKey, KeyID: "ec", Algorithm: "ES256", Use: "sig"},
+	}})
+	expect.NoError(t, err)
+
+	block := make(chan struct{})
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-block
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(block) })
+
+	set := newJWKS(srv.URL, time.Hour)
+	keys, err := set.Keys("ec")
+	expect.NoError(t, err)
+	expect.Equal(t, len(keys), 1)
+
+	// the refresh of an unknown key ID blocks in fetch
+	go func() { _, _ = set.Keys("unknown") }()
+	for fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// other callers get the previously fetched keys without waiting
+	keys, err = set.Keys("unknown")
+	expect.NoError(t, err)
+	expect.Equal(t, len(keys), 1)
+	expect.Equal(t, fetches.Load(), int32(2))
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/yusing/godoxy/internal/auth"
+	httpevents "github.com/yusing/goutils/events/http"
+	httputils "github.com/yusing/goutils/http"
+	"github.com/yusing/goutils/http/httpheaders"
+)
+
+type ldapMiddleware struct {
+	AllowedUsers  []string `json:"allowed_users"`
+	AllowedGroups []string `json:"allowed_groups"`
+
+	auth *auth.LDAPProvider
+
+	isInitialized int32
+	initMu        sync.Mutex
+}
+
+var LDAP = NewMiddleware[ldapMiddleware]()
+
+func isLDAPAuthPath(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, auth.LDAPAuthBasePath)
+}
+
+func (amw *ldapMiddleware) finalize() error {
+	if !auth.IsLDAPEnabled() {
+		return errors.New("LDAP not enabled but LDAP middleware is used, set LDAP_URL")
+	}
+	return nil
+}
+
+func (amw *ldapMiddleware) init() error {
+	if atomic.LoadInt32(&amw.isInitialized) == 1 {
+		return nil
+	}
+
+	return amw.initSlow()
+}
+
+func (amw *ldapMiddleware) initSlow() error {
+	amw.initMu.Lock()
+	defer amw.initMu.Unlock()
+	if amw.isInitialized == 1 {
+		return nil
+	}
+
+	authProvider, err := auth.NewLDAPProviderFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// Apply per-route user/group restrictions (these always override global)
+	if len(amw.AllowedUsers) > 0 {
+		authProvider.SetAllowedUsers(amw.AllowedUsers)
+	}
+	if len(amw.AllowedGroups) > 0 {
+		authProvider.SetAllowedGroups(amw.AllowedGroups)
+	}
+
+	amw.auth = authProvider
+	// retried on the next request if failed
+	atomic.StoreInt32(&amw.isInitialized, 1)
+	return nil
+}
+
+func (amw *ldapMiddleware) before(w http.ResponseWriter, r *http.Request) (proceed bool) {
+	if err := amw.init(); err != nil {
+		// no need to log here, main LDAP should've already failed and logged
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if r.URL.Path == auth.LDAPLoginPath || r.URL.Path == auth.LDAPLogoutPath {
+		amw.auth.HandleAuth(w, r)
+		return false
+	}
+
+	err := amw.auth.CheckToken(r)
+	if err == nil {
+		return true
+	}
+
+	emitBlockedEvent := func() {
+		if r.Method != http.MethodHead {
+			httpevents.Blocked(r, "LDAP", err.Error())
+		}
+	}
+
+	isGet := r.Method == http.MethodGet
+	isWS := httpheaders.IsWebsocket(r.Header)
+	switch {
+	case r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case !isGet, isWS:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		reqType := r.Method
+		if isWS {
+			reqType = "WebSocket"
+		}
+		LDAP.LogWarn(r).Msgf("[LDAP] %s request blocked.\nConsider adding bypass rule for this path if needed", reqType)
+		emitBlockedEvent()
+	case errors.Is(err, auth.ErrUserNotAllowed):
+		auth.WriteBlockPage(w, http.StatusForbidden, err.Error(), "Logout", auth.LDAPLogoutPath)
+		emitBlockedEvent()
+	case !httputils.GetAccept(r.Header).AcceptHTML():
+		http.Error(w, "authentication is required", http.StatusUnauthorized)
+	default:
+		// missing, invalid or expired session
+		amw.auth.HandleAuth(w, r)
+	}
+	return false
+}
@@ -52,6 +52,13 @@ type (
 	MiddlewareFinalizerWithError interface {
 		finalize() error
 	}
+	// RequestHandler wraps the rest of the chain, for middlewares that need to observe
+	// the outcome of a request, e.g. the final status code and latency.
+	//
+	// handle must call next to proceed.
+	RequestHandler interface {
+		handle(next http.HandlerFunc, w http.ResponseWriter, r *http.Request)
+	}
 )
 
 const DefaultPriority = 10
@@ -66,8 +73,9 @@ func NewMiddleware[ImplType any]() *Middleware {
 	switch t.(type) {
 	case RequestModifier:
 	case ResponseModifier:
+	case RequestHandler:
 	default:
-		panic("must implement RequestModifier or ResponseModifier")
+		panic("must implement RequestModifier, ResponseModifier or RequestHandler")
 	}
 	_, hasFinializer := t.(MiddlewareFinalizer)
 	_, hasFinializerWithError := t.(MiddlewareFinalizerWithError)
@@ -190,6 +198,13 @@ func (m *Middleware) ServeHTTP(next http.HandlerFunc, w http.ResponseWriter, r *
 		}
 	}
 
+	if exec, ok := m.impl.(RequestHandler); ok {
+		ori := next
+		next = func(w http.ResponseWriter, r *http.Request) {
+			exec.handle(ori, w, r)
+		}
+	}
+
 	if httpheaders.IsWebsocket(r.Header) || r.Header.Get("Accept") == "text/event-stream" {
 		next(w, r)
 		return
@@ -324,6 +339,14 @@ func patchReverseProxy(rp *ReverseProxy, middlewares []*Middleware) {
 
 	mid := NewMiddlewareChain(rp.TargetName, middlewares)
 
+	// request handlers wrap the proxy handler, inside request modifiers
+	if handler, ok := mid.impl.(*middlewareChain); ok && len(handler.handlers) > 0 {
+		next := rp.HandlerFunc
+		rp.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+			handler.handle(next, w, r)
+		}
+	}
+
 	if before, ok := mid.impl.(RequestModifier); ok {
 		next := rp.HandlerFunc
 		rp.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
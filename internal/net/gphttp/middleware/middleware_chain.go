@@ -5,12 +5,17 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/yusing/godoxy/internal/tracing"
 	gperr "github.com/yusing/goutils/errs"
 )
 
 type middlewareChain struct {
-	befores  []RequestModifier
-	modResps []ResponseModifier
+	befores      []RequestModifier
+	beforeNames  []string
+	modResps     []ResponseModifier
+	modRespNames []string
+	handlers     []RequestHandler
+	handlerNames []string
 }
 
 // TODO: check conflict or duplicates.
@@ -21,9 +26,15 @@ func NewMiddlewareChain(name string, chain []*Middleware) *Middleware {
 	for _, comp := range chain {
 		if before, ok := comp.impl.(RequestModifier); ok {
 			chainMid.befores = append(chainMid.befores, before)
+			chainMid.beforeNames = append(chainMid.beforeNames, comp.name)
 		}
 		if mr, ok := comp.impl.(ResponseModifier); ok {
 			chainMid.modResps = append(chainMid.modResps, mr)
+			chainMid.modRespNames = append(chainMid.modRespNames, comp.name)
+		}
+		if h, ok := comp.impl.(RequestHandler); ok {
+			chainMid.handlers = append(chainMid.handlers, h)
+			chainMid.handlerNames = append(chainMid.handlerNames, comp.name)
 		}
 	}
 	return m
@@ -34,14 +45,31 @@ func (m *middlewareChain) before(w http.ResponseWriter, r *http.Request) (procee
 	if len(m.befores) == 0 {
 		return true
 	}
-	for _, b := range m.befores {
-		if proceedNext = b.before(w, r); !proceedNext {
+	for i, b := range m.befores {
+		_, span := tracing.StartSpan(r.Context(), "middleware "+m.beforeNames[i], tracing.SpanKindInternal)
+		proceedNext = b.before(w, r)
+		span.SetAttributes(tracing.Bool("godoxy.middleware.proceed", proceedNext))
+		span.End()
+		if !proceedNext {
 			return false
 		}
 	}
 	return true
 }
 
+// handle implements RequestHandler.
+//
+// Handlers are nested in order, the first handler is the outermost.
+func (m *middlewareChain) handle(next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	for i := len(m.handlers) - 1; i >= 0; i-- {
+		h, inner := m.handlers[i], next
+		next = func(w http.ResponseWriter, r *http.Request) {
+			h.handle(inner, w, r)
+		}
+	}
+	next(w, r)
+}
+
 // modifyResponse implements ResponseModifier.
 func (m *middlewareChain) modifyResponse(resp *http.Response) error {
 	if len(m.modResps) == 0 {
@@ -55,7 +83,14 @@ func (m *middlewareChain) modifyResponse(resp *http.Response) error {
 			shadow.Body = eofReader{}
 			respToModify = &shadow
 		}
-		if err := mr.modifyResponse(respToModify); err != nil {
+		var span *tracing.Span
+		if resp.Request != nil {
+			_, span = tracing.StartSpan(resp.Request.Context(), "middleware "+m.modRespNames[i]+" response", tracing.SpanKindInternal)
+		}
+		err := mr.modifyResponse(respToModify)
+		span.RecordError(err)
+		span.End()
+		if err != nil {
 			return gperr.PrependSubject(err, strconv.Itoa(i))
 		}
 		if !allowBodyModification {
@@ -18,6 +18,9 @@ var allMiddlewares = map[string]*Middleware{
 	"redirecthttp": RedirectHTTP,
 
 	"oidc":        OIDC,
+	"ldap":        LDAP,
+	"basicauth":   BasicAuth,
+	"jwt":         JWT,
 	"forwardauth": ForwardAuth,
 	"crowdsec":    Crowdsec,
 
@@ -37,8 +40,12 @@ var allMiddlewares = map[string]*Middleware{
 	"realip":           RealIP,
 	"cloudflarerealip": CloudflareRealIP,
 
-	"cidrwhitelist": CIDRWhiteList,
-	"ratelimit":     RateLimiter,
+	"cidrwhitelist":  CIDRWhiteList,
+	"ratelimit":      RateLimiter,
+	"circuitbreaker": CircuitBreaker,
+
+	"cache":    Cache,
+	"compress": Compress,
 
 	"hcaptcha": HCaptcha,
 }
@@ -0,0 +1,93 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+)
+
+type (
+	// attempt is the retry state of a request, shared by all its attempts.
+	attempt struct {
+		n       int                 // current attempt number, starting from 1
+		tried   map[string]struct{} // keys of upstreams tried by previous attempts
+		current string              // key of the upstream serving the current attempt
+		untried int                 // number of upstreams not tried yet after the current attempt
+		err     error               // upstream error of the current attempt
+	}
+
+	attemptKey struct{}
+
+	// Upstream is a server that a request can be retried on, e.g. a load balancer server.
+	Upstream interface {
+		Key() string
+	}
+)
+
+func withAttempt(ctx context.Context, a *attempt) context.Context {
+	return context.WithValue(ctx, attemptKey{}, a)
+}
+
+func fromContext(ctx context.Context) *attempt {
+	a, _ := ctx.Value(attemptKey{}).(*attempt)
+	return a
+}
+
+// next resets the per attempt state before the next attempt.
+func (a *attempt) next() {
+	if a.current != "" {
+		a.tried[a.current] = struct{}{}
+	}
+	a.n++
+	a.current = ""
+	a.untried = 0
+	a.err = nil
+}
+
+// Exclude returns upstreams not tried by previous attempts of the request.
+//
+// srvs is returned as is if the request is not retried, or all upstreams have been tried.
+func Exclude[S ~[]E, E Upstream](ctx context.Context, srvs S) S {
+	a := fromContext(ctx)
+	if a == nil || len(a.tried) == 0 {
+		if a != nil {
+			a.untried = len(srvs) - 1
+		}
+		return srvs
+	}
+	untried := slices.DeleteFunc(slices.Clone(srvs), func(srv E) bool {
+		_, ok := a.tried[srv.Key()]
+		return ok
+	})
+	if len(untried) == 0 {
+		a.untried = 0
+		return srvs
+	}
+	a.untried = len(untried) - 1
+	return untried
+}
+
+// MarkTried records the upstream serving the current attempt of the request.
+func MarkTried(ctx context.Context, key string) {
+	if a := fromContext(ctx); a != nil {
+		a.current = key
+	}
+}
+
+// recordError records the upstream error of the current attempt.
+func recordError(ctx context.Context, err error) {
+	if a := fromContext(ctx); a != nil && a.err == nil {
+		a.err = err
+	}
+}
+
+// isConnectError reports whether err happened before the request is sent to the upstream.
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "dial"
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
@@ -0,0 +1,69 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+// budget limits the ratio of retries to requests in a time window,
+// so retries do not amplify the load of an overloaded upstream.
+type budget struct {
+	ratio float64
+
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    int
+	retries     int
+}
+
+const (
+	budgetWindow = 10 * time.Second
+	// budgetMinRetries is the number of retries always allowed in a window,
+	// so routes with low traffic can still retry.
+	budgetMinRetries = 3
+)
+
+func newBudget(ratio float64) *budget {
+	if ratio <= 0 {
+		return nil
+	}
+	return &budget{ratio: ratio}
+}
+
+func (b *budget) rotate(now time.Time) {
+	if now.Sub(b.windowStart) >= budgetWindow {
+		b.windowStart = now
+		b.requests = 0
+		b.retries = 0
+	}
+}
+
+// request records a new request.
+func (b *budget) request(now time.Time) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate(now)
+	b.requests++
+}
+
+// withdraw reports whether a retry is allowed, and records it if so.
+func (b *budget) withdraw(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate(now)
+	if b.retries >= budgetMinRetries && float64(b.retries) >= b.ratio*float64(b.requests) {
+		return false
+	}
+	b.retries++
+	return true
+}
@@ -0,0 +1,132 @@
+package retry
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+	route "github.com/yusing/godoxy/internal/route/types"
+)
+
+type handler struct {
+	cfg    *route.RetryConfig
+	next   http.Handler
+	budget *budget
+	l      zerolog.Logger
+}
+
+// NewHandler returns a handler that retries failed requests to next.
+//
+// cfg must have been validated. If next is a load balancer, it should call Exclude and MarkTried
+// so that retries go to servers not tried yet. Otherwise requests are retried with backoff.
+func NewHandler(cfg *route.RetryConfig, next http.Handler, l zerolog.Logger) http.Handler {
+	return &handler{
+		cfg:    cfg,
+		next:   next,
+		budget: newBudget(cfg.Budget),
+		l:      l,
+	}
+}
+
+func (h *handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if !h.cfg.CanRetryMethod(r.Method) || r.Header.Get("Upgrade") != "" || fromContext(r.Context()) != nil {
+		h.next.ServeHTTP(rw, r)
+		return
+	}
+
+	h.budget.request(time.Now())
+
+	body, ok := h.bufferBody(r)
+	if !ok {
+		h.next.ServeHTTP(rw, r)
+		return
+	}
+
+	a := &attempt{tried: make(map[string]struct{})}
+	ctx := withAttempt(r.Context(), a)
+	retryable := func(status int) bool {
+		return h.shouldRetry(r, a, status) && h.budget.withdraw(time.Now())
+	}
+
+	backoff := h.cfg.Backoff
+	for {
+		a.next()
+
+		req := r.WithContext(ctx)
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+		}
+
+		var w *attemptWriter
+		if a.n < h.cfg.Attempts {
+			w = newAttemptWriter(rw, retryable)
+		} else {
+			w = newAttemptWriter(rw, nil)
+		}
+		h.next.ServeHTTP(w, req)
+		if !w.discard {
+			return
+		}
+
+		h.l.Debug().
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("attempt", a.n).
+			Int("status", w.status).
+			AnErr("upstream_error", a.err).
+			Msg("retrying request")
+
+		// no other upstream to fail over to, retry on the same one after backoff
+		if _, tried := a.tried[a.current]; a.untried == 0 || tried {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			backoff = min(backoff*2, route.RetryMaxBackoff)
+		}
+	}
+}
+
+func (h *handler) shouldRetry(r *http.Request, a *attempt, status int) bool {
+	if r.Context().Err() != nil { // client gone
+		return false
+	}
+	if a.err != nil && (h.cfg.RetryOnError() || (h.cfg.RetryOnConnectError() && isConnectError(a.err))) {
+		return true
+	}
+	return h.cfg.RetryOnStatus(status)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bufferBody reads the request body into memory so it can be replayed on retries.
+//
+// It returns false if the body is larger than MaxBodySize, the request body is then
+// restored to stream as is and the request should not be retried.
+func (h *handler) bufferBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	if r.ContentLength > h.cfg.MaxBodySize {
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, h.cfg.MaxBodySize+1))
+	if err != nil || int64(len(body)) > h.cfg.MaxBodySize {
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false
+	}
+	_ = r.Body.Close()
+	return body, true
+}
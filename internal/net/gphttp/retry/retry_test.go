@@ -0,0 +1,194 @@
+package retry
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	route "github.com/yusing/godoxy/internal/route/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newTestHandler(t *testing.T, cfg route.RetryConfig, next http.HandlerFunc) http.Handler {
+	t.Helper()
+	cfg.Backoff = time.Millisecond
+	expect.NoError(t, cfg.Validate())
+	return NewHandler(&cfg, next, zerolog.Nop())
+}
+
+type upstream string
+
+func (u upstream) Key() string {
+	return string(u)
+}
+
+func TestRetryConfigValidate(t *testing.T) {
+	cfg := route.RetryConfig{}
+	expect.NoError(t, cfg.Validate())
+	expect.Equal(t, cfg.Attempts, route.RetryAttemptsDefault)
+	expect.Equal(t, cfg.MaxBodySize, route.RetryMaxBodySizeDefault)
+	expect.True(t, cfg.RetryOnConnectError())
+	expect.False(t, cfg.RetryOnError())
+	expect.False(t, cfg.RetryOnStatus(http.StatusBadGateway))
+	expect.True(t, cfg.CanRetryMethod(http.MethodGet))
+	expect.False(t, cfg.CanRetryMethod(http.MethodPost))
+
+	cfg = route.RetryConfig{On: []string{"502", "503", "error"}, Methods: []string{"post"}}
+	expect.NoError(t, cfg.Validate())
+	expect.True(t, cfg.RetryOnStatus(http.StatusServiceUnavailable))
+	expect.True(t, cfg.RetryOnError())
+	expect.True(t, cfg.CanRetryMethod(http.MethodPost))
+
+	cfg = route.RetryConfig{On: []string{"timeout", "200"}}
+	expect.ErrorIs(t, route.ErrInvalidRetryOn, cfg.Validate())
+}
+
+func TestRetryOnStatus(t *testing.T) {
+	calls := 0
+	h := newTestHandler(t, route.RetryConfig{On: []string{"503"}}, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-Attempt", "bad")
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("unavailable"))
+			return
+		}
+		w.Header().Set("X-Attempt", "good")
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	expect.Equal(t, calls, 3)
+	expect.Equal(t, rec.Code, http.StatusOK)
+	expect.Equal(t, rec.Body.String(), "ok")
+	expect.Equal(t, rec.Header().Get("X-Attempt"), "good")
+}
+
+func TestRetryGivesUpAfterAttempts(t *testing.T) {
+	calls := 0
+	h := newTestHandler(t, route.RetryConfig{Attempts: 2, On: []string{"503"}}, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	expect.Equal(t, calls, 2)
+	expect.Equal(t, rec.Code, http.StatusServiceUnavailable)
+	expect.Equal(t, rec.Body.String(), "unavailable\n")
+}
+
+func TestRetryOnConnectError(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+	for _, tt := range []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{"dial", dialErr, 2},
+		{"read", readErr, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			h := newTestHandler(t, route.RetryConfig{}, func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls == 1 {
+					recordError(r.Context(), tt.err)
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			})
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			expect.Equal(t, calls, tt.calls)
+		})
+	}
+}
+
+func TestRetryMethods(t *testing.T) {
+	calls := 0
+	h := newTestHandler(t, route.RetryConfig{On: []string{"503"}}, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	expect.Equal(t, calls, 1)
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	var bodies []string
+	h := newTestHandler(t, route.RetryConfig{On: []string{"503"}, Methods: []string{http.MethodPut}}, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/", strings.NewReader("payload")))
+	expect.Equal(t, bodies, []string{"payload", "payload"})
+}
+
+func TestRetryBodyTooLarge(t *testing.T) {
+	var bodies []string
+	h := newTestHandler(t, route.RetryConfig{On: []string{"503"}, Methods: []string{http.MethodPut}, MaxBodySize: 4}, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("payload"))
+	req.ContentLength = -1 // unknown length, body is read to find out
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	expect.Equal(t, bodies, []string{"payload"})
+	expect.Equal(t, rec.Code, http.StatusServiceUnavailable)
+}
+
+func TestRetryFailover(t *testing.T) {
+	srvs := []upstream{"a", "b", "c"}
+	var served []string
+	h := newTestHandler(t, route.RetryConfig{Attempts: 5, On: []string{"502"}}, func(w http.ResponseWriter, r *http.Request) {
+		avail := Exclude(r.Context(), srvs)
+		srv := avail[0]
+		MarkTried(r.Context(), srv.Key())
+		served = append(served, srv.Key())
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	// all servers are tried before retrying on a tried one
+	expect.Equal(t, served, []string{"a", "b", "c", "a", "a"})
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := newBudget(0.1)
+	now := time.Now()
+	for range 10 {
+		b.request(now)
+	}
+	// minimum retries are always allowed
+	for range budgetMinRetries {
+		expect.True(t, b.withdraw(now))
+	}
+	expect.False(t, b.withdraw(now))
+
+	for range 30 {
+		b.request(now)
+	}
+	expect.True(t, b.withdraw(now))
+
+	// new window
+	expect.True(t, b.withdraw(now.Add(budgetWindow)))
+}
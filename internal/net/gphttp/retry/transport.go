@@ -0,0 +1,23 @@
+package retry
+
+import "net/http"
+
+type transport struct {
+	base http.RoundTripper
+}
+
+// NewTransport returns a transport that records upstream errors for the retry handler.
+//
+// The reverse proxy writes a 502 response on upstream errors,
+// so the error is recorded to tell connection errors apart from upstream 502 responses.
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	return &transport{base: base}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		recordError(req.Context(), err)
+	}
+	return resp, err
+}
@@ -0,0 +1,81 @@
+package retry
+
+import (
+	"bufio"
+	"maps"
+	"net"
+	"net/http"
+)
+
+// attemptWriter holds back the response header of an attempt until it is known
+// whether the attempt will be retried. Responses of retried attempts are discarded.
+type attemptWriter struct {
+	rw     http.ResponseWriter
+	header http.Header
+
+	// retryable reports whether the response with status should be discarded and retried,
+	// nil for the last attempt.
+	retryable func(status int) bool
+
+	status  int
+	discard bool
+}
+
+func newAttemptWriter(rw http.ResponseWriter, retryable func(status int) bool) *attemptWriter {
+	return &attemptWriter{
+		rw:        rw,
+		header:    rw.Header().Clone(),
+		retryable: retryable,
+	}
+}
+
+func (w *attemptWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *attemptWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+	if code < http.StatusOK { // informational responses, e.g. 103 Early Hints
+		w.commitHeader()
+		w.rw.WriteHeader(code)
+		return
+	}
+	w.status = code
+	if w.retryable != nil && w.retryable(code) {
+		w.discard = true
+		return
+	}
+	w.commitHeader()
+	w.rw.WriteHeader(code)
+}
+
+func (w *attemptWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.discard {
+		return len(b), nil
+	}
+	return w.rw.Write(b)
+}
+
+func (w *attemptWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.discard {
+		_ = http.NewResponseController(w.rw).Flush()
+	}
+}
+
+func (w *attemptWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.rw).Hijack()
+}
+
+func (w *attemptWriter) commitHeader() {
+	dst := w.rw.Header()
+	clear(dst)
+	maps.Copy(dst, w.header)
+}
@@ -8,6 +8,7 @@ const (
 	ColorError   Color = 0xff0000
 	ColorSuccess Color = 0x00ff00
 	ColorInfo    Color = 0x0000ff
+	ColorWarning Color = 0xffa500
 )
 
 func (c Color) HexString() string {
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 	entrypoint "github.com/yusing/godoxy/internal/entrypoint/types"
@@ -32,25 +33,43 @@ var _ types.FileServerRoute = (*FileServer)(nil)
 
 func handler(root string, spa bool, index string) http.Handler {
 	if !spa {
-		return http.FileServer(http.Dir(root))
+		fs := http.FileServer(http.Dir(root))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// directories and index.html are redirected by http.FileServer
+			if !strings.HasSuffix(r.URL.Path, "/") && !strings.HasSuffix(r.URL.Path, "/index.html") {
+				fullPath := filepath.Join(root, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+				if middleware.ServePrecompressed(w, r, fullPath) {
+					return
+				}
+			}
+			fs.ServeHTTP(w, r)
+		})
 	}
 	indexPath := filepath.Join(root, index)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		urlPath := path.Clean(r.URL.Path)
 		if urlPath == "/" {
-			http.ServeFile(w, r, indexPath)
+			serveFile(w, r, indexPath)
 			return
 		}
 		fullPath := filepath.Join(root, filepath.FromSlash(urlPath))
 		stat, err := os.Stat(fullPath)
 		if err == nil && !stat.IsDir() {
-			http.ServeFile(w, r, fullPath)
+			serveFile(w, r, fullPath)
 			return
 		}
-		http.ServeFile(w, r, indexPath)
+		serveFile(w, r, indexPath)
 	})
 }
 
+// serveFile serves the precompressed sibling of the file if accepted, or the file itself.
+func serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	if middleware.ServePrecompressed(w, r, name) {
+		return
+	}
+	http.ServeFile(w, r, name)
+}
+
 func NewFileServer(base *Route) (*FileServer, error) {
 	s := &FileServer{Route: base}
 
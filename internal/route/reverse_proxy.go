@@ -15,8 +15,10 @@ import (
 	gphttp "github.com/yusing/godoxy/internal/net/gphttp"
 	"github.com/yusing/godoxy/internal/net/gphttp/loadbalancer"
 	"github.com/yusing/godoxy/internal/net/gphttp/middleware"
+	"github.com/yusing/godoxy/internal/net/gphttp/retry"
 	nettypes "github.com/yusing/godoxy/internal/net/types"
 	route "github.com/yusing/godoxy/internal/route/types"
+	"github.com/yusing/godoxy/internal/tracing"
 	"github.com/yusing/godoxy/internal/types"
 	"github.com/yusing/goutils/http/reverseproxy"
 	"github.com/yusing/goutils/task"
@@ -59,8 +61,16 @@ func NewReverseProxyRoute(base *Route) (*ReverseProxyRoute, error) {
 		}
 	}
 
+	var rt http.RoundTripper = trans
+	if tracing.Enabled() {
+		rt = tracing.NewTransport(trans)
+	}
+	if httpConfig.Retry != nil || base.UseLoadBalance() {
+		rt = retry.NewTransport(rt)
+	}
+
 	service := base.Name()
-	rp := reverseproxy.NewReverseProxy(service, &proxyURL.URL, trans)
+	rp := reverseproxy.NewReverseProxy(service, &proxyURL.URL, rt)
 
 	scheme := base.Scheme
 	retried := false
@@ -145,6 +155,11 @@ func (r *ReverseProxyRoute) Start(parent task.Parent) error {
 		r.handler = r.rp
 	}
 
+	// load balanced routes are retried by the load balancer route instead
+	if r.Retry != nil && !r.UseLoadBalance() {
+		r.handler = retry.NewHandler(r.Retry, r.handler, log.With().EmbedObject(r).Logger())
+	}
+
 	if r.UseAccessLog() {
 		var err error
 		r.rp.AccessLogger, err = accesslog.NewAccessLogger(r.task, r.AccessLog)
@@ -189,7 +204,18 @@ func (r *ReverseProxyRoute) Start(parent task.Parent) error {
 
 func (r *ReverseProxyRoute) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// req.Header.Set("Accept-Encoding", "identity")
-	r.handler.ServeHTTP(w, req)
+	req, span := tracing.StartHTTPServerSpan(req, r.Name())
+	if span == nil {
+		r.handler.ServeHTTP(w, req)
+		return
+	}
+	defer span.End()
+
+	rec := accesslog.GetResponseRecorder(w)
+	defer accesslog.PutResponseRecorder(rec)
+
+	r.handler.ServeHTTP(rec, req)
+	span.SetHTTPStatus(rec.Response().StatusCode)
 }
 
 var lbLock sync.Mutex
@@ -212,6 +238,10 @@ func (r *ReverseProxyRoute) addToLoadBalancer(parent task.Parent, ep entrypoint.
 	} else {
 		lb = loadbalancer.New(cfg)
 		_ = lb.Start(parent) // always return nil
+		var handler http.Handler = lb
+		if r.Retry != nil { // retry on other servers in the pool
+			handler = retry.NewHandler(r.Retry, lb, log.With().Str("name", cfg.Link).Logger())
+		}
 		linked = &ReverseProxyRoute{
 			Route: &Route{
 				Alias:    cfg.Link,
@@ -223,7 +253,7 @@ func (r *ReverseProxyRoute) addToLoadBalancer(parent task.Parent, ep entrypoint.
 				},
 			},
 			loadBalancer: lb,
-			handler:      lb,
+			handler:      handler,
 		}
 		linked.SetHealthMonitor(lb)
 		if err := ep.StartAddRoute(linked); err != nil {
@@ -24,6 +24,7 @@ import (
 	"github.com/yusing/godoxy/internal/homepage"
 	iconlist "github.com/yusing/godoxy/internal/homepage/icons/list"
 	homepagecfg "github.com/yusing/godoxy/internal/homepage/types"
+	"github.com/yusing/godoxy/internal/mtls"
 	netutils "github.com/yusing/godoxy/internal/net"
 	nettypes "github.com/yusing/godoxy/internal/net/types"
 	"github.com/yusing/godoxy/internal/proxmox"
@@ -49,6 +50,12 @@ type (
 
 		Bind string `json:"bind,omitempty" validate:"omitempty,ip_addr" extensions:"x-nullable"`
 
+		// TLSPassthrough shares the HTTPS port (or the listening port) with HTTPS routes for tcp routes,
+		// TLS connections with the SNI matching the alias are forwarded without termination.
+		TLSPassthrough bool `json:"tls_passthrough,omitempty"`
+		// MTLS requires client certificates on HTTPS connections with the SNI matching the route.
+		MTLS *mtls.Config `json:"mtls,omitempty" extensions:"x-nullable"`
+
 		Root  string `json:"root,omitempty"`
 		SPA   bool   `json:"spa,omitempty"`   // Single-page app mode: serves index for non-existent paths
 		Index string `json:"index,omitempty"` // Index file to serve for single-page app mode
@@ -268,6 +275,16 @@ func (r *Route) validate() error {
 	if err := r.validateRules(); err != nil {
 		errs.Add(err)
 	}
+	if r.TLSPassthrough && r.Scheme != route.SchemeTCP {
+		errs.Adds("tls_passthrough is only supported for tcp routes")
+	}
+	if r.MTLS != nil {
+		if r.Scheme.IsStream() {
+			errs.Adds("mtls is only supported for http routes")
+		} else if err := r.MTLS.Validate(); err != nil {
+			errs.AddSubject(err, "mtls")
+		}
+	}
 
 	if r.ShouldExclude() {
 		r.ProxyURL = gperr.Collect(&errs, nettypes.ParseURL, fmt.Sprintf("%s://%s", r.Scheme, net.JoinHostPort(r.Host, strconv.Itoa(r.Port.Proxy))))
@@ -654,6 +671,10 @@ func (r *Route) IdlewatcherConfig() *types.IdlewatcherConfig {
 	return r.Idlewatcher
 }
 
+func (r *Route) MTLSConfig() *mtls.Config {
+	return r.MTLS
+}
+
 func (r *Route) HealthCheckConfig() types.HealthCheckConfig {
 	return r.HealthCheck
 }
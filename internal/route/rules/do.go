@@ -9,9 +9,11 @@ import (
 	"strings"
 
 	"github.com/rs/zerolog"
+	"github.com/yusing/godoxy/internal/acl"
 	entrypoint "github.com/yusing/godoxy/internal/entrypoint/types"
 	"github.com/yusing/godoxy/internal/logging"
 	gphttp "github.com/yusing/godoxy/internal/net/gphttp"
+	"github.com/yusing/godoxy/internal/net/gphttp/httpcache"
 	nettypes "github.com/yusing/godoxy/internal/net/types"
 	"github.com/yusing/godoxy/internal/notif"
 	"github.com/yusing/godoxy/internal/route/routes"
@@ -47,6 +49,7 @@ const (
 	CommandRemove           = "remove"
 	CommandLog              = "log"
 	CommandNotify           = "notify"
+	CommandPurgeCache       = "purge_cache"
 )
 
 type AuthHandler func(w http.ResponseWriter, r *http.Request) (proceed bool)
@@ -285,6 +288,7 @@ var commands = map[string]struct {
 		build: func(args any) HandlerFunc {
 			code, textTmpl := args.(*Tuple[int, templateString]).Unpack()
 			return func(w *httputils.ResponseModifier, r *http.Request, upstream http.HandlerFunc) error {
+				acl.Report(r, acl.AutoBanRuleError)
 				// error command should overwrite the response body
 				w.ResetBody()
 				w.WriteHeader(code)
@@ -570,6 +574,44 @@ var commands = map[string]struct {
 			}
 		},
 	},
+	CommandPurgeCache: {
+		help: Help{
+			command: CommandPurgeCache,
+			description: makeLines(
+				"Purge the responses of the route stored by the cache middleware, e.g.:",
+				helpExample(CommandPurgeCache),
+				helpExample(CommandPurgeCache, helpFuncCall("glob", "/static/*")),
+			),
+			args: map[string]string{
+				"path": "optional, the path or path matcher of responses to purge, defaults to the request path",
+			},
+		},
+		validate: func(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+			phase = PhasePre
+			switch len(args) {
+			case 0:
+				return phase, nil, nil
+			case 1:
+				parsedArgs, err = validateURLPathMatcher(args)
+				return phase, parsedArgs, err
+			default:
+				return phase, nil, ErrExpectNoOrOneArg
+			}
+		},
+		build: func(args any) HandlerFunc {
+			match, _ := args.(Matcher)
+			return func(w *httputils.ResponseModifier, r *http.Request, upstream http.HandlerFunc) error {
+				route := routes.TryGetUpstreamName(r)
+				if match != nil {
+					httpcache.Purge(route, match)
+				} else {
+					reqPath := r.URL.Path
+					httpcache.Purge(route, func(path string) bool { return path == reqPath })
+				}
+				return nil
+			}
+		},
+	},
 }
 
 type (
@@ -123,6 +123,22 @@ func TestParseCommands(t *testing.T) {
 			input:   "proxy invalid_url",
 			wantErr: ErrInvalidArguments,
 		},
+		// purge_cache tests
+		{
+			name:    "purge_cache_valid",
+			input:   "purge_cache",
+			wantErr: nil,
+		},
+		{
+			name:    "purge_cache_valid_glob",
+			input:   "purge_cache glob(/static/*)",
+			wantErr: nil,
+		},
+		{
+			name:    "purge_cache_too_many_args",
+			input:   "purge_cache / /",
+			wantErr: ErrInvalidArguments,
+		},
 		// unknown directive test
 		{
 			name:    "unknown_directive",
@@ -23,7 +23,10 @@ var (
 	ErrUnexpectedVar   = gperr.New("unexpected variable")
 	ErrUnexpectedQuote = gperr.New("unexpected quote")
 
+	ErrResponseVarNotAllowed = gperr.New("response variables are not allowed here")
+
 	ErrExpectNoArg          = gperr.Wrap(ErrInvalidArguments, "expect no arg")
+	ErrExpectNoOrOneArg     = gperr.Wrap(ErrInvalidArguments, "expect no arg or 1 arg")
 	ErrExpectOneArg         = gperr.Wrap(ErrInvalidArguments, "expect 1 arg")
 	ErrExpectOneOrTwoArgs   = gperr.Wrap(ErrInvalidArguments, "expect 1 or 2 args")
 	ErrExpectTwoArgs        = gperr.Wrap(ErrInvalidArguments, "expect 2 args")
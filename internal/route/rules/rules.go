@@ -13,6 +13,7 @@ import (
 	"github.com/quic-go/quic-go/http3"
 	"github.com/rs/zerolog/log"
 	"github.com/yusing/godoxy/internal/serialization"
+	"github.com/yusing/godoxy/internal/tracing"
 	gperr "github.com/yusing/goutils/errs"
 	httputils "github.com/yusing/goutils/http"
 	"golang.org/x/net/http2"
@@ -320,12 +321,30 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 		}
 	}
 
-	execPreCommand := func(cmd Command, w *httputils.ResponseModifier, r *http.Request) error {
-		return cmd.pre.ServeHTTP(w, r, up)
+	execPreCommand := func(rule *Rule, w *httputils.ResponseModifier, r *http.Request) error {
+		_, span := tracing.StartSpan(r.Context(), "rule "+rule.Name, tracing.SpanKindInternal,
+			tracing.String("godoxy.rule.phase", "pre"),
+			tracing.String("godoxy.rule.do", rule.Do.raw),
+		)
+		defer span.End()
+		err := rule.Do.pre.ServeHTTP(w, r, up)
+		if err != nil && !errors.Is(err, errTerminateRule) && isUnexpectedError(err) {
+			span.RecordError(err)
+		}
+		return err
 	}
 
-	execPostCommand := func(cmd Command, w *httputils.ResponseModifier, r *http.Request) error {
-		return cmd.post.ServeHTTP(w, r, up)
+	execPostCommand := func(rule *Rule, w *httputils.ResponseModifier, r *http.Request) error {
+		_, span := tracing.StartSpan(r.Context(), "rule "+rule.Name, tracing.SpanKindInternal,
+			tracing.String("godoxy.rule.phase", "post"),
+			tracing.String("godoxy.rule.do", rule.Do.raw),
+		)
+		defer span.End()
+		err := rule.Do.post.ServeHTTP(w, r, up)
+		if err != nil && !errors.Is(err, errTerminateRule) && isUnexpectedError(err) {
+			span.RecordError(err)
+		}
+		return err
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -357,7 +376,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 			}
 
 			executedPre[i] = true
-			if err := execPreCommand(rule.Do, rm, r); err != nil {
+			if err := execPreCommand(&rule, rm, r); err != nil {
 				if errors.Is(err, errTerminateRule) {
 					terminatedInPre[i] = true
 					preTerminated = true
@@ -376,7 +395,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 		defaultTerminatedInPre := false
 		if defaultRule != nil && !matchedNonDefaultPre && !defaultRule.On.phase.IsPostRule() && defaultRule.On.Check(rm, r) {
 			defaultExecutedPre = true
-			if err := execPreCommand(defaultRule.Do, rm, r); err != nil {
+			if err := execPreCommand(defaultRule, rm, r); err != nil {
 				if errors.Is(err, errTerminateRule) {
 					defaultTerminatedInPre = true
 				} else {
@@ -403,7 +422,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 			if !executedPre[i] || terminatedInPre[i] {
 				continue
 			}
-			if err := execPostCommand(rule.Do, rm, r); err != nil {
+			if err := execPostCommand(&rule, rm, r); err != nil {
 				if errors.Is(err, errTerminateRule) {
 					continue
 				}
@@ -414,7 +433,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 			}
 		}
 		if defaultExecutedPre && !defaultTerminatedInPre {
-			if err := execPostCommand(defaultRule.Do, rm, r); err != nil {
+			if err := execPostCommand(defaultRule, rm, r); err != nil {
 				if !errors.Is(err, errTerminateRule) && isUnexpectedError(err) {
 					// will logged by logFlushError after FlushRelease
 					rm.AppendError("executing post rule (%s): %w", defaultRule.Do.raw, err)
@@ -429,7 +448,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 			}
 			// Post-rule matchers are only evaluated after upstream, so commands parsed
 			// as "pre" for requirement purposes still need to run in this phase.
-			if err := rule.Do.pre.ServeHTTP(rm, r, up); err != nil {
+			if err := execPreCommand(&rule, rm, r); err != nil {
 				if errors.Is(err, errTerminateRule) {
 					continue
 				}
@@ -438,7 +457,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 					rm.AppendError("executing pre rule (%s): %w", rule.Do.raw, err)
 				}
 			}
-			if err := execPostCommand(rule.Do, rm, r); err != nil {
+			if err := execPostCommand(&rule, rm, r); err != nil {
 				if errors.Is(err, errTerminateRule) {
 					continue
 				}
@@ -89,6 +89,28 @@ func ValidateVars(s string) (phase PhaseFlag, err error) {
 	return ExpandVars(voidResponseModifier, &dummyRequest, s, io.Discard)
 }
 
+// ValidateRequestVars validates the variables in the given string,
+// and returns an error if any of them is only available after the response, e.g. $status_code.
+func ValidateRequestVars(s string) error {
+	phase, err := ValidateVars(s)
+	if err != nil {
+		return err
+	}
+	if phase.IsPostRule() {
+		return ErrResponseVarNotAllowed.Subject(s)
+	}
+	return nil
+}
+
+// ExpandRequestVars expands the variables in the given string with only the request,
+// for templates that are evaluated before there is a response.
+//
+// The string should be validated with ValidateRequestVars beforehand.
+func ExpandRequestVars(req *http.Request, src string, dstW io.Writer) error {
+	_, err := ExpandVars(voidResponseModifier, req, src, dstW)
+	return err
+}
+
 // ExpandVars expands the variables in the given string and writes the result to the given writer.
 // It returns the phase that the variables require and an error if any error occurs.
 //
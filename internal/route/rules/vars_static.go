@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/yusing/godoxy/internal/mtls"
 	"github.com/yusing/godoxy/internal/route/routes"
 	httputils "github.com/yusing/goutils/http"
 )
@@ -33,6 +34,15 @@ const (
 	VarUpstreamAddr   = "upstream_addr"
 	VarUpstreamURL    = "upstream_url"
 
+	VarClientCertVerify      = "client_cert_verify"
+	VarClientCertSubject     = "client_cert_subject"
+	VarClientCertIssuer      = "client_cert_issuer"
+	VarClientCertSerial      = "client_cert_serial"
+	VarClientCertFingerprint = "client_cert_fingerprint"
+	VarClientCertSAN         = "client_cert_san"
+	VarClientCertNotBefore   = "client_cert_not_before"
+	VarClientCertNotAfter    = "client_cert_not_after"
+
 	VarRespContentType = "resp_content_type"
 	VarRespContentLen  = "resp_content_length"
 	VarRespStatusCode  = "status_code"
@@ -85,6 +95,15 @@ var staticReqVarSubsMap = map[string]reqVarGetter{
 	VarUpstreamPort:   routes.TryGetUpstreamPort,
 	VarUpstreamAddr:   routes.TryGetUpstreamAddr,
 	VarUpstreamURL:    routes.TryGetUpstreamURL,
+
+	VarClientCertVerify:      mtls.ClientCertVerify,
+	VarClientCertSubject:     mtls.ClientCertSubject,
+	VarClientCertIssuer:      mtls.ClientCertIssuer,
+	VarClientCertSerial:      mtls.ClientCertSerial,
+	VarClientCertFingerprint: mtls.ClientCertFingerprint,
+	VarClientCertSAN:         mtls.ClientCertSAN,
+	VarClientCertNotBefore:   mtls.ClientCertNotBefore,
+	VarClientCertNotAfter:    mtls.ClientCertNotAfter,
 }
 
 var staticRespVarSubsMap = map[string]respVarGetter{
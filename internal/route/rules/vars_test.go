@@ -2,12 +2,21 @@ package rules
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	httputils "github.com/yusing/goutils/http"
@@ -684,6 +693,56 @@ func TestExpandVars_UpstreamVariables(t *testing.T) {
 	}
 }
 
+func TestExpandVars_ClientCertVariables(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(0x1f),
+		Subject:      pkix.Name{CommonName: "client"},
+		DNSNames:     []string{"client.example.com"},
+		NotBefore:    time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	testRequest := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	testRequest.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	testResponseModifier := httputils.NewResponseModifier(httptest.NewRecorder())
+
+	tests := map[string]string{
+		"$client_cert_verify":      "SUCCESS",
+		"$client_cert_subject":     "CN=client",
+		"$client_cert_issuer":      "CN=client",
+		"$client_cert_serial":      "1F",
+		"$client_cert_san":         "DNS:client.example.com",
+		"$client_cert_not_before":  "2026-01-01T00:00:00Z",
+		"$client_cert_not_after":   "2027-01-01T00:00:00Z",
+		"$client_cert_fingerprint": fmt.Sprintf("%x", sha256.Sum256(der)),
+	}
+	for varExpr, expected := range tests {
+		t.Run(varExpr, func(t *testing.T) {
+			var out strings.Builder
+			_, err := ExpandVars(testResponseModifier, testRequest, varExpr, &out)
+			require.NoError(t, err)
+			require.Equal(t, expected, out.String())
+		})
+	}
+
+	t.Run("without client certificate", func(t *testing.T) {
+		testRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+		var out strings.Builder
+		_, err := ExpandVars(testResponseModifier, testRequest, "$client_cert_verify:$client_cert_subject", &out)
+		require.NoError(t, err)
+		require.Equal(t, "NONE:", out.String())
+	})
+}
+
 func TestExpandVars_NoHostPort(t *testing.T) {
 	// Test request without port in Host header
 	testRequest := httptest.NewRequest(http.MethodGet, "/", nil)
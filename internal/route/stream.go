@@ -110,6 +110,9 @@ func (r *StreamRoute) initStream() (nettypes.Stream, error) {
 
 	switch rScheme {
 	case "tcp":
+		if r.TLSPassthrough {
+			return stream.NewTLSPassthroughStream(r.Alias, lurl.Scheme, rurl.Scheme, laddr, rurl.Host, r.GetAgent())
+		}
 		return stream.NewTCPTCPStream(lurl.Scheme, rurl.Scheme, laddr, rurl.Host, r.GetAgent())
 	case "udp":
 		return stream.NewUDPUDPStream(lurl.Scheme, rurl.Scheme, laddr, rurl.Host, r.GetAgent())
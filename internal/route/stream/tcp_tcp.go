@@ -2,6 +2,7 @@ package stream
 
 import (
 	"context"
+	"errors"
 	"net"
 
 	"github.com/pires/go-proxyproto"
@@ -25,10 +26,14 @@ type TCPTCPStream struct {
 	dst   *net.TCPAddr
 	agent *agentpool.Agent
 
+	// passthroughAlias is the alias to match the TLS SNI with, if the stream shares the HTTPS port.
+	passthroughAlias string
+
 	preDial nettypes.HookFunc
 	onRead  nettypes.HookFunc
 
-	closed atomic.Bool
+	activeConns atomic.Int64
+	closed      atomic.Bool
 }
 
 func NewTCPTCPStream(network, dstNetwork, listenAddr, dstAddr string, agent *agentpool.Agent) (nettypes.Stream, error) {
@@ -43,7 +48,22 @@ func NewTCPTCPStream(network, dstNetwork, listenAddr, dstAddr string, agent *age
 	return &TCPTCPStream{network: network, dstNetwork: dstNetwork, laddr: laddr, dst: dst, agent: agent}, nil
 }
 
+// NewTLSPassthroughStream returns a TCP stream that receives TLS connections to the entrypoint
+// with the SNI matching alias, instead of listening on its own.
+func NewTLSPassthroughStream(alias, network, dstNetwork, listenAddr, dstAddr string, agent *agentpool.Agent) (nettypes.Stream, error) {
+	stream, err := NewTCPTCPStream(network, dstNetwork, listenAddr, dstAddr, agent)
+	if err != nil {
+		return nil, err
+	}
+	stream.(*TCPTCPStream).passthroughAlias = alias
+	return stream, nil
+}
+
 func (s *TCPTCPStream) ListenAndServe(ctx context.Context, preDial, onRead nettypes.HookFunc) error {
+	if s.passthroughAlias != "" {
+		return s.listenTLSPassthrough(ctx, preDial, onRead)
+	}
+
 	var err error
 	s.listener, err = net.ListenTCP(s.network, s.laddr)
 	if err != nil {
@@ -68,6 +88,25 @@ func (s *TCPTCPStream) ListenAndServe(ctx context.Context, preDial, onRead netty
 	return nil
 }
 
+// listenTLSPassthrough serves connections passed by the entrypoint,
+// which applies PROXY protocol and ACL on the shared listener.
+func (s *TCPTCPStream) listenTLSPassthrough(ctx context.Context, preDial, onRead nettypes.HookFunc) error {
+	ep := entrypoint.FromCtx(ctx)
+	if ep == nil {
+		return errors.New("entrypoint not initialized")
+	}
+	var err error
+	s.listener, err = ep.ListenTLSPassthrough(s.passthroughAlias, s.laddr.String())
+	if err != nil {
+		return err
+	}
+
+	s.preDial = preDial
+	s.onRead = onRead
+	go s.listen(ctx)
+	return nil
+}
+
 func (s *TCPTCPStream) Close() error {
 	if s.closed.Swap(true) || s.listener == nil {
 		return nil
@@ -82,8 +121,16 @@ func (s *TCPTCPStream) LocalAddr() net.Addr {
 	return s.listener.Addr()
 }
 
+// ActiveConns returns the number of connections currently being proxied.
+func (s *TCPTCPStream) ActiveConns() int64 {
+	return s.activeConns.Load()
+}
+
 func (s *TCPTCPStream) MarshalZerologObject(e *zerolog.Event) {
 	e.Str("protocol", s.network+"->"+s.dstNetwork)
+	if s.passthroughAlias != "" {
+		e.Bool("tls_passthrough", true)
+	}
 
 	if s.listener != nil {
 		e.Str("listen", s.listener.Addr().String())
@@ -125,6 +172,9 @@ func (s *TCPTCPStream) listen(ctx context.Context) {
 func (s *TCPTCPStream) handle(ctx context.Context, conn net.Conn) {
 	defer conn.Close()
 
+	s.activeConns.Inc()
+	defer s.activeConns.Dec()
+
 	if s.preDial != nil {
 		if err := s.preDial(ctx); err != nil {
 			if !s.closed.Load() {
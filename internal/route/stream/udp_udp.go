@@ -121,6 +121,13 @@ func (s *UDPUDPStream) LocalAddr() net.Addr {
 	return s.listener.LocalAddr()
 }
 
+// ActiveConns returns the number of UDP sessions that have not yet expired.
+func (s *UDPUDPStream) ActiveConns() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.conns))
+}
+
 func (s *UDPUDPStream) MarshalZerologObject(e *zerolog.Event) {
 	e.Str("protocol", s.network+"->"+s.dstNetwork)
 	if s.dst != nil {
@@ -16,6 +16,8 @@ type HTTPConfig struct {
 	NoTLSVerify           bool          `json:"no_tls_verify,omitempty"`
 	ResponseHeaderTimeout time.Duration `json:"response_header_timeout,omitempty" swaggertype:"primitive,integer"`
 	DisableCompression    bool          `json:"disable_compression,omitempty"`
+	// Retry retries failed requests on another load balancer server or the same server with backoff.
+	Retry *RetryConfig `json:"retry,omitempty" extensions:"x-nullable"`
 
 	// SSL/TLS proxy options (nginx-like)
 	SSLServerName         *string  `json:"ssl_server_name,omitempty"`         // SNI server name
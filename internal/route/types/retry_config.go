@@ -0,0 +1,114 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type RetryConfig struct {
+	// total number of attempts, including the first one
+	Attempts int `json:"attempts" validate:"omitempty,gt=1"`
+	// conditions to retry on: connect_error, error (any upstream error), or a status code
+	On []string `json:"on,omitempty"`
+	// request methods that can be retried, only idempotent methods by default
+	Methods []string `json:"methods,omitempty"`
+	// delay before retrying on the same server, doubled on every retry
+	Backoff time.Duration `json:"backoff,omitempty" swaggertype:"primitive,integer"`
+	// maximum ratio of retries to requests, 0 for no limit
+	Budget float64 `json:"budget,omitempty" validate:"omitempty,gt=0,lte=1"`
+	// maximum request body size to buffer for retrying, larger requests are not retried
+	MaxBodySize int64 `json:"max_body_size,omitempty" validate:"omitempty,gt=0"`
+
+	onConnectError bool
+	onError        bool
+	onStatus       map[int]struct{}
+	methods        map[string]struct{}
+} // @name RetryConfig
+
+const (
+	RetryConditionConnectError = "connect_error"
+	RetryConditionError        = "error"
+
+	RetryAttemptsDefault    = 3
+	RetryBackoffDefault     = 100 * time.Millisecond
+	RetryMaxBodySizeDefault = 64 << 10 // 64 KiB
+	RetryMaxBackoff         = 2 * time.Second
+)
+
+var (
+	RetryOnDefault      = []string{RetryConditionConnectError}
+	RetryMethodsDefault = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+)
+
+var ErrInvalidRetryOn = errors.New("invalid retry condition")
+
+// Validate implements serialization.CustomValidator.
+func (cfg *RetryConfig) Validate() error {
+	if cfg.Attempts == 0 {
+		cfg.Attempts = RetryAttemptsDefault
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = RetryBackoffDefault
+	}
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = RetryMaxBodySizeDefault
+	}
+	if len(cfg.On) == 0 {
+		cfg.On = RetryOnDefault
+	}
+	if len(cfg.Methods) == 0 {
+		cfg.Methods = RetryMethodsDefault
+	}
+
+	var errs gperr.Builder
+	cfg.onConnectError, cfg.onError = false, false
+	cfg.onStatus = make(map[int]struct{})
+	for _, on := range cfg.On {
+		switch on = strings.ToLower(strings.TrimSpace(on)); on {
+		case RetryConditionConnectError:
+			cfg.onConnectError = true
+		case RetryConditionError:
+			cfg.onError = true
+		default:
+			status, err := strconv.Atoi(on)
+			if err != nil || status < 400 || status > 599 {
+				errs.Add(gperr.PrependSubject(ErrInvalidRetryOn, on))
+				continue
+			}
+			cfg.onStatus[status] = struct{}{}
+		}
+	}
+
+	cfg.methods = make(map[string]struct{}, len(cfg.Methods))
+	for _, method := range cfg.Methods {
+		cfg.methods[strings.ToUpper(method)] = struct{}{}
+	}
+	return errs.Error()
+}
+
+// RetryOnStatus reports whether a response with status should be retried.
+func (cfg *RetryConfig) RetryOnStatus(status int) bool {
+	_, ok := cfg.onStatus[status]
+	return ok
+}
+
+// RetryOnConnectError reports whether requests failed to connect to the upstream should be retried.
+func (cfg *RetryConfig) RetryOnConnectError() bool {
+	return cfg.onConnectError || cfg.onError
+}
+
+// RetryOnError reports whether requests failed with any upstream error should be retried.
+func (cfg *RetryConfig) RetryOnError() bool {
+	return cfg.onError
+}
+
+// CanRetryMethod reports whether requests with method can be retried.
+func (cfg *RetryConfig) CanRetryMethod(method string) bool {
+	_, ok := cfg.methods[method]
+	return ok
+}
@@ -0,0 +1,37 @@
+package tracing
+
+type (
+	Attribute struct {
+		Key   string
+		Value AttributeValue
+	}
+	AttributeValue struct {
+		kind attributeKind
+		str  string
+		num  int64
+		b    bool
+	}
+	attributeKind uint8
+)
+
+const (
+	attributeKindString attributeKind = iota
+	attributeKindInt
+	attributeKindBool
+)
+
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: AttributeValue{kind: attributeKindString, str: value}}
+}
+
+func Int(key string, value int) Attribute {
+	return Int64(key, int64(value))
+}
+
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: AttributeValue{kind: attributeKindInt, num: value}}
+}
+
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: AttributeValue{kind: attributeKindBool, b: value}}
+}
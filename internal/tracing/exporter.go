@@ -0,0 +1,178 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+type (
+	// exporter sends encoded ExportTraceServiceRequest messages to an OTLP collector.
+	exporter interface {
+		export(ctx context.Context, req []byte) error
+		close() error
+	}
+
+	httpExporter struct {
+		url     string
+		headers http.Header
+		client  *http.Client
+	}
+
+	grpcExporter struct {
+		conn    *grpc.ClientConn
+		headers metadata.MD
+	}
+
+	// rawCodec passes pre-encoded protobuf bytes through gRPC unchanged.
+	rawCodec struct{}
+)
+
+const (
+	ProtocolHTTPProtobuf = "http/protobuf"
+	ProtocolGRPC         = "grpc"
+
+	otlpHTTPTracesPath = "/v1/traces"
+	otlpGRPCMethod     = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+
+	exportTimeout = 10 * time.Second
+)
+
+func newExporter(protocol, endpoint string, headers map[string]string) (exporter, error) {
+	switch protocol {
+	case "", ProtocolHTTPProtobuf:
+		return newHTTPExporter(endpoint, headers)
+	case ProtocolGRPC:
+		return newGRPCExporter(endpoint, headers)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q, expect %q or %q", protocol, ProtocolHTTPProtobuf, ProtocolGRPC)
+	}
+}
+
+func newHTTPExporter(endpoint string, headers map[string]string) (*httpExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: scheme must be http or https", endpoint)
+	}
+	// like OTEL_EXPORTER_OTLP_ENDPOINT, append the signal path if not specified
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpHTTPTracesPath
+	}
+	h := make(http.Header, len(headers)+1)
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	h.Set("Content-Type", "application/x-protobuf")
+	return &httpExporter{
+		url:     u.String(),
+		headers: h,
+		client:  &http.Client{Timeout: exportTimeout},
+	}, nil
+}
+
+func (e *httpExporter) export(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = e.headers.Clone()
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("OTLP collector returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (e *httpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// newGRPCExporter creates an OTLP gRPC exporter.
+//
+// endpoint can be host:port (plaintext), or a http:// or https:// URL.
+func newGRPCExporter(endpoint string, headers map[string]string) (*grpcExporter, error) {
+	target := endpoint
+	creds := insecure.NewCredentials()
+	if scheme, rest, ok := strings.Cut(endpoint, "://"); ok {
+		switch scheme {
+		case "http":
+		case "https":
+			creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		default:
+			return nil, fmt.Errorf("invalid OTLP endpoint %q: scheme must be http or https", endpoint)
+		}
+		target = strings.TrimSuffix(rest, "/")
+	}
+	if target == "" {
+		return nil, errors.New("OTLP endpoint is empty")
+	}
+
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})),
+	)
+	if err != nil {
+		return nil, err
+	}
+	md := metadata.New(nil)
+	for k, v := range headers {
+		md.Set(strings.ToLower(k), v)
+	}
+	return &grpcExporter{conn: conn, headers: md}, nil
+}
+
+func (e *grpcExporter) export(ctx context.Context, req []byte) error {
+	if len(e.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, e.headers)
+	}
+	var resp []byte
+	return e.conn.Invoke(ctx, otlpGRPCMethod, req, &resp)
+}
+
+func (e *grpcExporter) close() error {
+	return e.conn.Close()
+}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("rawCodec: unexpected type %T", v)
+	}
+	return b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("rawCodec: unexpected type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// Name must be "proto" so the content-type is application/grpc+proto.
+func (rawCodec) Name() string {
+	return "proto"
+}
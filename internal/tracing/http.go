@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+type transport struct {
+	base http.RoundTripper
+}
+
+// StartHTTPServerSpan starts the server span of an incoming request, continuing
+// the trace of the caller if the request carries a valid traceparent header.
+//
+// It returns r unchanged and a nil span if tracing is disabled or the trace is not sampled.
+func StartHTTPServerSpan(r *http.Request, route string) (*http.Request, *Span) {
+	if !Enabled() {
+		return r, nil
+	}
+	remote, _ := Extract(r.Header)
+	ctx, span := startRootSpan(r.Context(), r.Method+" "+route, SpanKindServer, remote, []Attribute{
+		String("http.request.method", r.Method),
+		String("url.path", r.URL.Path),
+		String("url.scheme", requestScheme(r)),
+		String("server.address", r.Host),
+		String("client.address", r.RemoteAddr),
+		String("user_agent.original", r.UserAgent()),
+		String("godoxy.route", route),
+	})
+	if span == nil {
+		return r, nil
+	}
+	return r.WithContext(ctx), span
+}
+
+// SetHTTPStatus records the response status code, and marks the span as failed on 5xx.
+func (s *Span) SetHTTPStatus(code int) {
+	if s == nil {
+		return
+	}
+	s.SetAttributes(Int("http.response.status_code", code))
+	if code >= http.StatusInternalServerError {
+		s.SetStatus(StatusError, http.StatusText(code))
+	}
+}
+
+// NewTransport wraps base so that every upstream round trip is recorded as a client span
+// and the trace context is propagated to the upstream.
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	return &transport{base: base}
+}
+
+// Unwrap returns the underlying round tripper.
+func (t *transport) Unwrap() http.RoundTripper {
+	return t.base
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := StartSpan(req.Context(), "upstream "+req.Method, SpanKindClient,
+		String("http.request.method", req.Method),
+		String("url.full", req.URL.String()),
+		String("server.address", req.URL.Host),
+	)
+	if span == nil {
+		return t.base.RoundTrip(req)
+	}
+	defer span.End()
+
+	// RoundTrip must not modify the original request
+	req = req.Clone(ctx)
+	Inject(span, req.Header)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetHTTPStatus(resp.StatusCode)
+	return resp, nil
+}
+
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
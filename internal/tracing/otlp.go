@@ -0,0 +1,145 @@
+package tracing
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the OTLP trace protobuf messages,
+// see https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+const (
+	// ExportTraceServiceRequest
+	fieldRequestResourceSpans protowire.Number = 1
+
+	// ResourceSpans
+	fieldResourceSpansResource   protowire.Number = 1
+	fieldResourceSpansScopeSpans protowire.Number = 2
+
+	// Resource
+	fieldResourceAttributes protowire.Number = 1
+
+	// ScopeSpans
+	fieldScopeSpansScope protowire.Number = 1
+	fieldScopeSpansSpans protowire.Number = 2
+
+	// InstrumentationScope
+	fieldScopeName    protowire.Number = 1
+	fieldScopeVersion protowire.Number = 2
+
+	// Span
+	fieldSpanTraceID      protowire.Number = 1
+	fieldSpanSpanID       protowire.Number = 2
+	fieldSpanTraceState   protowire.Number = 3
+	fieldSpanParentSpanID protowire.Number = 4
+	fieldSpanName         protowire.Number = 5
+	fieldSpanKind         protowire.Number = 6
+	fieldSpanStartTime    protowire.Number = 7
+	fieldSpanEndTime      protowire.Number = 8
+	fieldSpanAttributes   protowire.Number = 9
+	fieldSpanStatus       protowire.Number = 15
+
+	// Status
+	fieldStatusMessage protowire.Number = 2
+	fieldStatusCode    protowire.Number = 3
+
+	// KeyValue
+	fieldKeyValueKey   protowire.Number = 1
+	fieldKeyValueValue protowire.Number = 2
+
+	// AnyValue
+	fieldAnyValueString protowire.Number = 1
+	fieldAnyValueBool   protowire.Number = 2
+	fieldAnyValueInt    protowire.Number = 3
+)
+
+const instrumentationScopeName = "github.com/yusing/godoxy"
+
+// marshalExportRequest encodes spans as an OTLP ExportTraceServiceRequest.
+func marshalExportRequest(resource []Attribute, scopeVersion string, spans []*Span) []byte {
+	var scopeSpans []byte
+	scopeSpans = appendMessage(scopeSpans, fieldScopeSpansScope, func(b []byte) []byte {
+		b = appendString(b, fieldScopeName, instrumentationScopeName)
+		return appendString(b, fieldScopeVersion, scopeVersion)
+	})
+	for _, span := range spans {
+		scopeSpans = appendMessage(scopeSpans, fieldScopeSpansSpans, span.appendProto)
+	}
+
+	var resourceSpans []byte
+	resourceSpans = appendMessage(resourceSpans, fieldResourceSpansResource, func(b []byte) []byte {
+		return appendAttributes(b, fieldResourceAttributes, resource)
+	})
+	resourceSpans = protowire.AppendTag(resourceSpans, fieldResourceSpansScopeSpans, protowire.BytesType)
+	resourceSpans = protowire.AppendBytes(resourceSpans, scopeSpans)
+
+	req := protowire.AppendTag(nil, fieldRequestResourceSpans, protowire.BytesType)
+	return protowire.AppendBytes(req, resourceSpans)
+}
+
+func (s *Span) appendProto(b []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b = protowire.AppendTag(b, fieldSpanTraceID, protowire.BytesType)
+	b = protowire.AppendBytes(b, s.TraceID[:])
+	b = protowire.AppendTag(b, fieldSpanSpanID, protowire.BytesType)
+	b = protowire.AppendBytes(b, s.SpanID[:])
+	if s.TraceState != "" {
+		b = appendString(b, fieldSpanTraceState, s.TraceState)
+	}
+	if s.parent.IsValid() {
+		b = protowire.AppendTag(b, fieldSpanParentSpanID, protowire.BytesType)
+		b = protowire.AppendBytes(b, s.parent[:])
+	}
+	b = appendString(b, fieldSpanName, s.name)
+	b = protowire.AppendTag(b, fieldSpanKind, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(s.kind))
+	b = protowire.AppendTag(b, fieldSpanStartTime, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(s.start.UnixNano()))
+	b = protowire.AppendTag(b, fieldSpanEndTime, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(s.end.UnixNano()))
+	b = appendAttributes(b, fieldSpanAttributes, s.attrs)
+	if s.statusCode != StatusUnset {
+		b = appendMessage(b, fieldSpanStatus, func(b []byte) []byte {
+			if s.statusMsg != "" {
+				b = appendString(b, fieldStatusMessage, s.statusMsg)
+			}
+			b = protowire.AppendTag(b, fieldStatusCode, protowire.VarintType)
+			return protowire.AppendVarint(b, uint64(s.statusCode))
+		})
+	}
+	return b
+}
+
+func appendAttributes(b []byte, num protowire.Number, attrs []Attribute) []byte {
+	for _, attr := range attrs {
+		b = appendMessage(b, num, func(b []byte) []byte {
+			b = appendString(b, fieldKeyValueKey, attr.Key)
+			return appendMessage(b, fieldKeyValueValue, attr.Value.appendProto)
+		})
+	}
+	return b
+}
+
+func (v AttributeValue) appendProto(b []byte) []byte {
+	switch v.kind {
+	case attributeKindInt:
+		b = protowire.AppendTag(b, fieldAnyValueInt, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v.num))
+	case attributeKindBool:
+		b = protowire.AppendTag(b, fieldAnyValueBool, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v.b))
+	default:
+		return appendString(b, fieldAnyValueString, v.str)
+	}
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendMessage appends a length-delimited embedded message produced by encode.
+func appendMessage(b []byte, num protowire.Number, encode func([]byte) []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, encode(nil))
+}
@@ -0,0 +1,171 @@
+package tracing
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// field is a decoded protobuf field, either a varint, fixed64 or bytes.
+type field struct {
+	num   protowire.Number
+	value uint64
+	bytes []byte
+}
+
+func decodeFields(t *testing.T, b []byte) []field {
+	t.Helper()
+	var fields []field
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		f := field{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.value, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func findField(t *testing.T, fields []field, num protowire.Number) field {
+	t.Helper()
+	for _, f := range fields {
+		if f.num == num {
+			return f
+		}
+	}
+	t.Fatalf("field %d not found", num)
+	return field{}
+}
+
+func testSpan() *Span {
+	parent := SpanID{1, 2, 3, 4, 5, 6, 7, 8}
+	span := newSpan("GET app", SpanKindServer, TraceID{1}, parent, "", []Attribute{
+		String("http.request.method", "GET"),
+		Int("http.response.status_code", 502),
+	})
+	span.start = time.Unix(1, 0)
+	span.end = time.Unix(2, 0)
+	span.SetHTTPStatus(http.StatusBadGateway)
+	return span
+}
+
+func TestMarshalExportRequest(t *testing.T) {
+	span := testSpan()
+	req := marshalExportRequest([]Attribute{String("service.name", "godoxy")}, "v1.0.0", []*Span{span})
+
+	resourceSpans := decodeFields(t, findField(t, decodeFields(t, req), fieldRequestResourceSpans).bytes)
+
+	resource := decodeFields(t, findField(t, resourceSpans, fieldResourceSpansResource).bytes)
+	kv := decodeFields(t, findField(t, resource, fieldResourceAttributes).bytes)
+	assert.Equal(t, "service.name", string(findField(t, kv, fieldKeyValueKey).bytes))
+	value := decodeFields(t, findField(t, kv, fieldKeyValueValue).bytes)
+	assert.Equal(t, "godoxy", string(findField(t, value, fieldAnyValueString).bytes))
+
+	scopeSpans := decodeFields(t, findField(t, resourceSpans, fieldResourceSpansScopeSpans).bytes)
+	scope := decodeFields(t, findField(t, scopeSpans, fieldScopeSpansScope).bytes)
+	assert.Equal(t, instrumentationScopeName, string(findField(t, scope, fieldScopeName).bytes))
+	assert.Equal(t, "v1.0.0", string(findField(t, scope, fieldScopeVersion).bytes))
+
+	encoded := decodeFields(t, findField(t, scopeSpans, fieldScopeSpansSpans).bytes)
+	assert.Equal(t, span.TraceID[:], findField(t, encoded, fieldSpanTraceID).bytes)
+	assert.Equal(t, span.SpanID[:], findField(t, encoded, fieldSpanSpanID).bytes)
+	assert.Equal(t, span.parent[:], findField(t, encoded, fieldSpanParentSpanID).bytes)
+	assert.Equal(t, "GET app", string(findField(t, encoded, fieldSpanName).bytes))
+	assert.Equal(t, uint64(SpanKindServer), findField(t, encoded, fieldSpanKind).value)
+	assert.Equal(t, uint64(time.Second), findField(t, encoded, fieldSpanStartTime).value)
+	assert.Equal(t, uint64(2*time.Second), findField(t, encoded, fieldSpanEndTime).value)
+
+	var numAttrs int
+	for _, f := range encoded {
+		if f.num == fieldSpanAttributes {
+			numAttrs++
+		}
+	}
+	assert.Equal(t, 2, numAttrs, "status code attribute should be overridden, not duplicated")
+
+	status := decodeFields(t, findField(t, encoded, fieldSpanStatus).bytes)
+	assert.Equal(t, uint64(StatusError), findField(t, status, fieldStatusCode).value)
+	assert.Equal(t, "Bad Gateway", string(findField(t, status, fieldStatusMessage).bytes))
+}
+
+func TestHTTPExporter(t *testing.T) {
+	var (
+		received    []byte
+		contentType string
+		auth        string
+		path        string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		contentType = r.Header.Get("Content-Type")
+		auth = r.Header.Get("Authorization")
+		path = r.URL.Path
+	}))
+	defer collector.Close()
+
+	exp, err := newExporter(ProtocolHTTPProtobuf, collector.URL, map[string]string{"Authorization": "Bearer token"})
+	require.NoError(t, err)
+	defer exp.close()
+
+	body := marshalExportRequest(nil, "", []*Span{testSpan()})
+	require.NoError(t, exp.export(t.Context(), body))
+	assert.Equal(t, body, received)
+	assert.Equal(t, "application/x-protobuf", contentType)
+	assert.Equal(t, "Bearer token", auth)
+	assert.Equal(t, otlpHTTPTracesPath, path)
+}
+
+func TestHTTPExporterError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer collector.Close()
+
+	exp, err := newExporter(ProtocolHTTPProtobuf, collector.URL+"/custom/path", nil)
+	require.NoError(t, err)
+	defer exp.close()
+
+	assert.ErrorContains(t, exp.export(t.Context(), nil), "bad request")
+}
+
+func TestNewExporterInvalid(t *testing.T) {
+	_, err := newExporter("thrift", "http://localhost:4318", nil)
+	assert.Error(t, err)
+	_, err = newExporter(ProtocolHTTPProtobuf, "localhost:4318", nil)
+	assert.Error(t, err)
+	_, err = newExporter(ProtocolGRPC, "ftp://localhost:4317", nil)
+	assert.Error(t, err)
+}
+
+func TestSampleThreshold(t *testing.T) {
+	assert.Equal(t, uint64(math.MaxUint64), sampleThreshold(1))
+	assert.Equal(t, uint64(0), sampleThreshold(0))
+	assert.Equal(t, uint64(0), sampleThreshold(-1))
+
+	never := &tracer{sampleThreshold: sampleThreshold(0)}
+	always := &tracer{sampleThreshold: sampleThreshold(1)}
+	for range 100 {
+		id := newTraceID()
+		assert.False(t, never.shouldSample(id))
+		assert.True(t, always.shouldSample(id))
+	}
+}
@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context headers, see https://www.w3.org/TR/trace-context/
+const (
+	HeaderTraceParent = "Traceparent"
+	HeaderTraceState  = "Tracestate"
+)
+
+const (
+	traceParentVersion        = "00"
+	traceParentLen            = 55 // 2 + 1 + 32 + 1 + 16 + 1 + 2
+	traceFlagSampled          = 0x01
+	maxTraceStateLength       = 512
+	invalidTraceParentVersion = "ff"
+)
+
+// ParseTraceParent parses a W3C traceparent header value.
+func ParseTraceParent(value string) (sc SpanContext, ok bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < traceParentLen {
+		return sc, false
+	}
+	version := value[:2]
+	if !isLowerHex(version) || version == invalidTraceParentVersion {
+		return sc, false
+	}
+	// version 00 must be exactly traceParentLen, future versions may append fields
+	if version == traceParentVersion && len(value) != traceParentLen {
+		return sc, false
+	}
+	if len(value) > traceParentLen && value[traceParentLen] != '-' {
+		return sc, false
+	}
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return sc, false
+	}
+
+	traceIDHex, spanIDHex, flagsHex := value[3:35], value[36:52], value[53:55]
+	if !isLowerHex(traceIDHex) || !isLowerHex(spanIDHex) || !isLowerHex(flagsHex) {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(traceIDHex)); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(spanIDHex)); err != nil {
+		return sc, false
+	}
+	if !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(flagsHex)); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&traceFlagSampled != 0
+	return sc, true
+}
+
+// TraceParent formats the span context as a W3C traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	var b strings.Builder
+	b.Grow(traceParentLen)
+	b.WriteString(traceParentVersion)
+	b.WriteByte('-')
+	b.WriteString(hex.EncodeToString(sc.TraceID[:]))
+	b.WriteByte('-')
+	b.WriteString(hex.EncodeToString(sc.SpanID[:]))
+	if sc.Sampled {
+		b.WriteString("-01")
+	} else {
+		b.WriteString("-00")
+	}
+	return b.String()
+}
+
+// Extract reads the remote span context from the request headers.
+func Extract(h http.Header) (SpanContext, bool) {
+	sc, ok := ParseTraceParent(h.Get(HeaderTraceParent))
+	if !ok {
+		return SpanContext{}, false
+	}
+	if ts := h.Get(HeaderTraceState); len(ts) <= maxTraceStateLength {
+		sc.TraceState = ts
+	}
+	return sc, true
+}
+
+// Inject writes the span context of span into the headers, replacing any existing trace context.
+//
+// It is a no-op for a nil span, leaving incoming trace headers untouched.
+func Inject(span *Span, h http.Header) {
+	if span == nil {
+		return
+	}
+	h.Set(HeaderTraceParent, span.TraceParent())
+	if span.TraceState != "" {
+		h.Set(HeaderTraceState, span.TraceState)
+	} else {
+		h.Del(HeaderTraceState)
+	}
+}
+
+func isLowerHex(s string) bool {
+	for i := range len(s) {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
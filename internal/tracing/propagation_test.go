@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceParent(t *testing.T) {
+	sc, ok := ParseTraceParent(testTraceParent)
+	require.True(t, ok)
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, testTraceParent, sc.TraceParent())
+
+	sc, ok = ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	require.True(t, ok)
+	assert.False(t, sc.Sampled)
+
+	// future versions may append fields
+	_, ok = ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.True(t, ok)
+}
+
+func TestParseTraceParentInvalid(t *testing.T) {
+	tests := map[string]string{
+		"empty":            "",
+		"too short":        "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"invalid version":  "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"trailing data":    testTraceParent + "-extra",
+		"upper case hex":   "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"zero trace id":    "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"zero span id":     "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"bad separator":    "00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"non hex trace id": "00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, ok := ParseTraceParent(value)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestExtractInject(t *testing.T) {
+	h := http.Header{}
+	h.Set(HeaderTraceParent, testTraceParent)
+	h.Set(HeaderTraceState, "vendor=value")
+
+	sc, ok := Extract(h)
+	require.True(t, ok)
+	assert.Equal(t, "vendor=value", sc.TraceState)
+
+	span := newSpan("test", SpanKindClient, sc.TraceID, sc.SpanID, sc.TraceState, nil)
+	out := http.Header{}
+	Inject(span, out)
+
+	injected, ok := Extract(out)
+	require.True(t, ok)
+	assert.Equal(t, sc.TraceID, injected.TraceID, "trace id should be propagated")
+	assert.Equal(t, span.SpanID, injected.SpanID, "parent id should be the client span")
+	assert.Equal(t, "vendor=value", injected.TraceState)
+}
+
+func TestInjectNilSpan(t *testing.T) {
+	h := http.Header{}
+	h.Set(HeaderTraceParent, testTraceParent)
+	Inject(nil, h)
+	assert.Equal(t, testTraceParent, h.Get(HeaderTraceParent))
+}
+
+func TestStartSpanWithoutParent(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx, span := StartSpan(req.Context(), "test", SpanKindInternal)
+	assert.Nil(t, span)
+	assert.Equal(t, req.Context(), ctx)
+
+	// all methods are safe on nil span
+	span.SetAttributes(String("k", "v"))
+	span.RecordError(assert.AnError)
+	span.SetHTTPStatus(http.StatusOK)
+	span.End()
+}
+
+func TestSetStatusNeverDowngradesError(t *testing.T) {
+	span := newSpan("test", SpanKindInternal, newTraceID(), SpanID{}, "", nil)
+	span.RecordError(assert.AnError)
+	span.SetStatus(StatusOK, "")
+	assert.Equal(t, StatusError, span.statusCode)
+}
@@ -0,0 +1,205 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+
+	SpanKind   uint8
+	StatusCode uint8
+
+	// SpanContext identifies a span and is what gets propagated across process boundaries.
+	SpanContext struct {
+		TraceID    TraceID
+		SpanID     SpanID
+		Sampled    bool
+		TraceState string
+	}
+
+	// Span is a single timed operation of a trace.
+	//
+	// All methods are safe to call on a nil *Span, which is returned when tracing is
+	// disabled or the trace is not sampled.
+	Span struct {
+		SpanContext
+
+		parent SpanID
+		name   string
+		kind   SpanKind
+		start  time.Time
+		end    time.Time
+
+		mu         sync.Mutex
+		attrs      []Attribute
+		statusCode StatusCode
+		statusMsg  string
+		ended      bool
+	}
+
+	spanContextKey struct{}
+)
+
+// Values are the same as the OTLP protocol.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Values are the same as the OTLP protocol.
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanFromContext returns the span stored in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan returns a copy of ctx that carries span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// StartSpan starts a child span of the span in ctx.
+//
+// It returns ctx unchanged and a nil span when there is no recording parent span,
+// so instrumentation points cost nothing for untraced requests.
+func StartSpan(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := newSpan(name, kind, parent.TraceID, parent.SpanID, parent.TraceState, attrs)
+	return ContextWithSpan(ctx, span), span
+}
+
+// startRootSpan starts a span which is either the root of a new trace, or a continuation of
+// a remote parent. It returns nil if tracing is disabled or the sampler drops the trace.
+func startRootSpan(ctx context.Context, name string, kind SpanKind, remote SpanContext, attrs []Attribute) (context.Context, *Span) {
+	t := activeTracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	var span *Span
+	if remote.TraceID.IsValid() {
+		// parent based sampling: respect the decision of the caller
+		if !remote.Sampled {
+			return ctx, nil
+		}
+		span = newSpan(name, kind, remote.TraceID, remote.SpanID, remote.TraceState, attrs)
+	} else {
+		traceID := newTraceID()
+		if !t.shouldSample(traceID) {
+			return ctx, nil
+		}
+		span = newSpan(name, kind, traceID, SpanID{}, "", attrs)
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+func newSpan(name string, kind SpanKind, traceID TraceID, parent SpanID, traceState string, attrs []Attribute) *Span {
+	return &Span{
+		SpanContext: SpanContext{
+			TraceID:    traceID,
+			SpanID:     newSpanID(),
+			Sampled:    true,
+			TraceState: traceState,
+		},
+		parent: parent,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+		attrs:  attrs,
+	}
+}
+
+// SetName overrides the span name.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttributes adds or overrides attributes of the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range attrs {
+		replaced := false
+		for i := range s.attrs {
+			if s.attrs[i].Key == attr.Key {
+				s.attrs[i] = attr
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.attrs = append(s.attrs, attr)
+		}
+	}
+}
+
+// SetStatus sets the status of the span. An error status is never downgraded.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.statusCode == StatusError && code != StatusError {
+		return
+	}
+	s.statusCode = code
+	s.statusMsg = msg
+}
+
+// RecordError marks the span as failed with err. It is a no-op if err is nil.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End finishes the span and queues it for export. Only the first call has effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if t := activeTracer.Load(); t != nil {
+		t.enqueue(s)
+	}
+}
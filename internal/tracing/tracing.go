@@ -0,0 +1,175 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/goutils/task"
+	"github.com/yusing/goutils/version"
+)
+
+type tracer struct {
+	exporter exporter
+	resource []Attribute
+
+	sampleThreshold uint64 // new traces with the lower 8 bytes of the trace id below it are sampled
+
+	queue chan *Span
+}
+
+const (
+	maxQueueSize       = 2048
+	maxExportBatchSize = 512
+	batchTimeout       = 5 * time.Second
+)
+
+var activeTracer atomic.Pointer[tracer]
+
+// Enabled reports whether tracing is configured and started.
+func Enabled() bool {
+	return activeTracer.Load() != nil
+}
+
+// Init starts the OTLP trace exporter if an endpoint is configured.
+//
+// Spans are batched and exported in the background, and flushed on shutdown.
+func Init() error {
+	if common.TracingOTLPEndpoint == "" {
+		return nil
+	}
+
+	headers := make(map[string]string, len(common.TracingOTLPHeaders))
+	for _, kv := range common.TracingOTLPHeaders {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			log.Warn().Str("header", kv).Msg("ignoring invalid OTLP header, expect key=value")
+			continue
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	sampleRatio, err := strconv.ParseFloat(common.TracingSampleRatio, 64)
+	if err != nil {
+		return fmt.Errorf("invalid tracing sample ratio %q: %w", common.TracingSampleRatio, err)
+	}
+
+	exp, err := newExporter(common.TracingOTLPProtocol, common.TracingOTLPEndpoint, headers)
+	if err != nil {
+		return err
+	}
+
+	t := &tracer{
+		exporter:        exp,
+		resource:        resourceAttributes(),
+		sampleThreshold: sampleThreshold(sampleRatio),
+		queue:           make(chan *Span, maxQueueSize),
+	}
+
+	tracingTask := task.RootTask("tracing", true)
+	go t.run(tracingTask)
+	activeTracer.Store(t)
+
+	log.Info().
+		Str("endpoint", common.TracingOTLPEndpoint).
+		Str("protocol", common.TracingOTLPProtocol).
+		Float64("sample_ratio", sampleRatio).
+		Msg("tracing enabled")
+	return nil
+}
+
+func resourceAttributes() []Attribute {
+	attrs := []Attribute{
+		String("service.name", common.TracingServiceName),
+		String("service.version", version.Get().String()),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		attrs = append(attrs, String("host.name", hostname))
+	}
+	return attrs
+}
+
+// sampleThreshold converts a ratio in [0, 1] to a threshold for the trace id based sampler.
+func sampleThreshold(ratio float64) uint64 {
+	switch {
+	case ratio >= 1:
+		return math.MaxUint64
+	case ratio <= 0:
+		return 0
+	}
+	return uint64(ratio * math.MaxUint64)
+}
+
+func (t *tracer) shouldSample(traceID TraceID) bool {
+	if t.sampleThreshold == math.MaxUint64 {
+		return true
+	}
+	return binary.BigEndian.Uint64(traceID[8:]) < t.sampleThreshold
+}
+
+func (t *tracer) enqueue(span *Span) {
+	select {
+	case t.queue <- span:
+	default: // queue full, drop the span rather than blocking requests
+	}
+}
+
+func (t *tracer) run(tracingTask *task.Task) {
+	ticker := time.NewTicker(batchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, maxExportBatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+		defer cancel()
+		if err := t.exporter.export(ctx, marshalExportRequest(t.resource, version.Get().String(), batch)); err != nil {
+			log.Warn().Err(err).Int("spans", len(batch)).Msg("failed to export spans")
+		}
+		clear(batch)
+		batch = batch[:0]
+	}
+
+	defer func() {
+		activeTracer.CompareAndSwap(t, nil)
+		// drain and export what is left before exiting
+		for drained := false; !drained; {
+			select {
+			case span := <-t.queue:
+				batch = append(batch, span)
+				if len(batch) == maxExportBatchSize {
+					flush(context.Background())
+				}
+			default:
+				drained = true
+			}
+		}
+		flush(context.Background())
+		_ = t.exporter.close()
+		tracingTask.Finish(nil)
+	}()
+
+	for {
+		select {
+		case <-tracingTask.Context().Done():
+			return
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) == maxExportBatchSize {
+				flush(tracingTask.Context())
+			}
+		case <-ticker.C:
+			flush(tracingTask.Context())
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package types
+
+import "time"
+
+type (
+	CircuitBreakerState string // @name CircuitBreakerState
+
+	CircuitBreakerInfo struct {
+		Upstream string              `json:"upstream,omitempty"`
+		State    CircuitBreakerState `json:"state" enums:"closed,open,half_open"`
+		Since    time.Time           `json:"since"`
+		// number of requests in the sliding window
+		Requests int `json:"requests"`
+		// ratio of failed requests in the sliding window
+		ErrorRatio float64 `json:"error_ratio"`
+		// latency percentile in the sliding window, in milliseconds
+		Latency int64 `json:"latency"`
+		// reason of the last trip
+		Reason string `json:"reason,omitempty"`
+	} // @name CircuitBreakerInfo
+)
+
+const (
+	CircuitBreakerClosed   CircuitBreakerState = "closed"
+	CircuitBreakerOpen     CircuitBreakerState = "open"
+	CircuitBreakerHalfOpen CircuitBreakerState = "half_open"
+)
@@ -80,6 +80,8 @@ type (
 		Status  HealthStatus  `json:"status" swaggertype:"string" enums:"healthy,unhealthy,napping,starting,error,unknown"`
 		Uptime  time.Duration `json:"uptime" swaggertype:"number"`
 		Latency time.Duration `json:"latency" swaggertype:"number"`
+		// CircuitBreakers are the circuit breakers of the route, if any.
+		CircuitBreakers []CircuitBreakerInfo `json:"circuit_breakers,omitempty" extensions:"x-nullable"`
 	} // @name HealthInfoWithoutDetail
 
 	HealthInfo struct {
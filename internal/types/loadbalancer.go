@@ -16,7 +16,21 @@ type (
 		Sticky       bool             `json:"sticky"`
 		StickyMaxAge time.Duration    `json:"sticky_max_age"`
 		Options      map[string]any   `json:"options,omitempty"`
+		// PassiveHealth ejects servers that keep failing requests between health checks.
+		PassiveHealth *PassiveHealthConfig `json:"passive_health,omitempty" extensions:"x-nullable"`
 	} // @name LoadBalancerConfig
+	PassiveHealthConfig struct {
+		// number of consecutive 5xx responses or connection errors to eject a server
+		ConsecutiveFailures int `json:"consecutive_failures" validate:"omitempty,gt=0"`
+		// ejection time of the first ejection, doubled on every consecutive ejection
+		EjectionTime time.Duration `json:"ejection_time"`
+		// maximum ejection time
+		MaxEjectionTime time.Duration `json:"max_ejection_time"`
+		// maximum percentage of servers that can be ejected at the same time
+		MaxEjectionPercent int `json:"max_ejection_percent" validate:"omitempty,gt=0,lte=100"`
+		// time to ramp up traffic of a reinstated server, negative to disable
+		SlowStart time.Duration `json:"slow_start"`
+	} // @name PassiveHealthConfig
 	LoadBalancerMode   string // @name LoadBalancerMode
 	LoadBalancerServer interface {
 		http.Handler
@@ -36,10 +50,47 @@ const (
 	LoadbalanceModeRoundRobin LoadBalancerMode = "roundrobin"
 	LoadbalanceModeLeastConn  LoadBalancerMode = "leastconn"
 	LoadbalanceModeIPHash     LoadBalancerMode = "iphash"
+
+	LoadbalanceModeWeightedRoundRobin LoadBalancerMode = "weightedroundrobin"
+	LoadbalanceModeRandom             LoadBalancerMode = "random"
+	LoadbalanceModeP2C                LoadBalancerMode = "p2c"
+	LoadbalanceModeEWMALatency        LoadBalancerMode = "ewmalatency"
+	LoadbalanceModeConsistentHash     LoadBalancerMode = "consistenthash"
 )
 
 const StickyMaxAgeDefault = 1 * time.Hour
 
+const (
+	PassiveHealthConsecutiveFailuresDefault = 5
+	PassiveHealthEjectionTimeDefault        = 30 * time.Second
+	PassiveHealthMaxEjectionTimeDefault     = 5 * time.Minute
+	PassiveHealthMaxEjectionPercentDefault  = 50
+	PassiveHealthSlowStartDefault           = 30 * time.Second
+)
+
+// Validate implements serialization.CustomValidator.
+func (cfg *PassiveHealthConfig) Validate() error {
+	if cfg.ConsecutiveFailures == 0 {
+		cfg.ConsecutiveFailures = PassiveHealthConsecutiveFailuresDefault
+	}
+	if cfg.EjectionTime <= 0 {
+		cfg.EjectionTime = PassiveHealthEjectionTimeDefault
+	}
+	if cfg.MaxEjectionTime <= 0 {
+		cfg.MaxEjectionTime = PassiveHealthMaxEjectionTimeDefault
+	}
+	if cfg.MaxEjectionTime < cfg.EjectionTime {
+		cfg.MaxEjectionTime = cfg.EjectionTime
+	}
+	if cfg.MaxEjectionPercent == 0 {
+		cfg.MaxEjectionPercent = PassiveHealthMaxEjectionPercentDefault
+	}
+	if cfg.SlowStart == 0 {
+		cfg.SlowStart = PassiveHealthSlowStartDefault
+	}
+	return nil
+}
+
 func (mode *LoadBalancerMode) ValidateUpdate() bool {
 	switch strutils.ToLowerNoSnake(string(*mode)) {
 	case "":
@@ -53,6 +104,21 @@ func (mode *LoadBalancerMode) ValidateUpdate() bool {
 	case string(LoadbalanceModeIPHash):
 		*mode = LoadbalanceModeIPHash
 		return true
+	case string(LoadbalanceModeWeightedRoundRobin):
+		*mode = LoadbalanceModeWeightedRoundRobin
+		return true
+	case string(LoadbalanceModeRandom):
+		*mode = LoadbalanceModeRandom
+		return true
+	case string(LoadbalanceModeP2C):
+		*mode = LoadbalanceModeP2C
+		return true
+	case string(LoadbalanceModeEWMALatency):
+		*mode = LoadbalanceModeEWMALatency
+		return true
+	case string(LoadbalanceModeConsistentHash):
+		*mode = LoadbalanceModeConsistentHash
+		return true
 	}
 	*mode = LoadbalanceModeRoundRobin
 	return false
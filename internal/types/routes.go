@@ -6,6 +6,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/yusing/godoxy/internal/agentpool"
 	"github.com/yusing/godoxy/internal/homepage"
+	"github.com/yusing/godoxy/internal/mtls"
 	nettypes "github.com/yusing/godoxy/internal/net/types"
 	provider "github.com/yusing/godoxy/internal/route/provider/types"
 	"github.com/yusing/goutils/http/reverseproxy"
@@ -34,6 +35,7 @@ type (
 		IdlewatcherConfig() *IdlewatcherConfig
 		HealthCheckConfig() HealthCheckConfig
 		LoadBalanceConfig() *LoadBalancerConfig
+		MTLSConfig() *mtls.Config
 		HomepageItem() homepage.Item
 		DisplayName() string
 		ContainerInfo() *Container
@@ -115,9 +115,8 @@ func (h *DirWatcher) start() {
 			relPath := strings.TrimPrefix(fsEvent.Name, h.dir)
 			relPath = strings.TrimPrefix(relPath, "/")
 
-			if len(relPath) > 0 && relPath[0] == '.' { // hidden file
-				continue
-			}
+			// hidden files are only sent to their file watchers
+			isHidden := len(relPath) > 0 && relPath[0] == '.'
 
 			msg := Event{
 				Type:      watcherEvents.EventTypeFile,
@@ -137,11 +136,13 @@ func (h *DirWatcher) start() {
 			}
 
 			// send event to directory watcher
-			select {
-			case h.eventCh <- msg:
-				h.Debug().Msg("sent event to directory watcher")
-			default:
-				h.Debug().Msg("failed to send event to directory watcher")
+			if !isHidden {
+				select {
+				case h.eventCh <- msg:
+					h.Debug().Msg("sent event to directory watcher")
+				default:
+					h.Debug().Msg("failed to send event to directory watcher")
+				}
 			}
 
 			// send event to file watcher too